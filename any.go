@@ -0,0 +1,91 @@
+package go_xml
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	attributesType = reflect.TypeOf([]Attribute(nil))
+	elementsType   = reflect.TypeOf([]*ElementNode(nil))
+)
+
+func checkAnyField(meta *fieldMeta) error {
+	expected := elementsType
+	if meta.Attr {
+		expected = attributesType
+	}
+	if meta.FieldType.Type != expected {
+		return fmt.Errorf("field %s with the any option must be %s, got %s", meta.FieldType.Name, expected, meta.FieldType.Type)
+	}
+	return nil
+}
+
+func (m *marshaler) marshalAny(meta *fieldMeta, fieldValue reflect.Value) error {
+	if err := checkAnyField(meta); err != nil {
+		return err
+	}
+	for i, node := range fieldValue.Interface().([]*ElementNode) {
+		if node == nil {
+			continue
+		}
+		if err := writeNode(m.out, node); err != nil {
+			return fmt.Errorf("error encoding %s: %w", m.fieldPath(indexSegment(i)), err)
+		}
+	}
+	return nil
+}
+
+func (u *unmarshaler) decodeAny(node *ElementNode, fieldValue reflect.Value, meta *fieldMeta, known *knownNames) error {
+	if err := checkAnyField(meta); err != nil {
+		return err
+	}
+
+	if meta.Attr {
+		var attrs []Attribute
+		for _, attr := range node.Attributes {
+			if !known.attrs[attr.Name] {
+				attrs = append(attrs, attr)
+			}
+		}
+		if len(attrs) > 0 {
+			fieldValue.Set(reflect.ValueOf(attrs))
+		}
+		return nil
+	}
+
+	var elements []*ElementNode
+	for _, child := range node.ChildElements() {
+		if _, ok := known.elements[child.Name]; !ok {
+			elements = append(elements, cloneElement(child))
+		}
+	}
+	if len(elements) > 0 {
+		fieldValue.Set(reflect.ValueOf(elements))
+	}
+	return nil
+}
+
+func cloneElement(node *ElementNode) *ElementNode {
+	clone := &ElementNode{Name: node.Name, SelfClose: node.SelfClose}
+	if len(node.Attributes) > 0 {
+		clone.Attributes = append([]Attribute(nil), node.Attributes...)
+	}
+	for _, child := range node.Children {
+		switch c := child.(type) {
+		case *ElementNode:
+			clone.Children = append(clone.Children, cloneElement(c))
+		case *TextNode:
+			clone.Children = append(clone.Children, &TextNode{Text: c.Text, Unescaped: c.Unescaped})
+		case *CommentNode:
+			clone.Children = append(clone.Children, &CommentNode{Text: c.Text})
+		case *CDataNode:
+			clone.Children = append(clone.Children, &CDataNode{Text: c.Text})
+		case *ProcessingInstructionNode:
+			clone.Children = append(clone.Children, &ProcessingInstructionNode{Target: c.Target, Data: c.Data})
+		case *RawNode:
+			clone.Children = append(clone.Children, &RawNode{XML: c.XML})
+		}
+	}
+	return clone
+}
@@ -0,0 +1,275 @@
+package atom
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+	"github.com/lrnxzz/go-xml/v2/rss"
+)
+
+const (
+	Namespace      = "http://www.w3.org/2005/Atom"
+	XHTMLNamespace = "http://www.w3.org/1999/xhtml"
+)
+
+var ErrMissingField = errors.New("atom: missing required field")
+
+type Feed struct {
+	ID         string
+	Title      string
+	Subtitle   string
+	Updated    time.Time
+	Authors    []Person
+	Links      []Link
+	Categories []string
+	Rights     string
+	Entries    []Entry
+}
+
+type Entry struct {
+	ID         string
+	Title      string
+	Updated    time.Time
+	Published  time.Time
+	Authors    []Person
+	Links      []Link
+	Categories []string
+	Summary    string
+	Content    *Content
+}
+
+type Person struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+	URI   string `xml:"uri,omitempty"`
+}
+
+type Link struct {
+	Href     string `xml:"href,attr"`
+	Rel      string `xml:"rel,attr,omitempty"`
+	Type     string `xml:"type,attr,omitempty"`
+	HrefLang string `xml:"hreflang,attr,omitempty"`
+	Title    string `xml:"title,attr,omitempty"`
+	Length   int64  `xml:"length,attr,omitempty"`
+}
+
+type Content struct {
+	Type string
+	Body string
+}
+
+func Text(body string) *Content {
+	return &Content{Type: "text", Body: body}
+}
+
+func HTML(body string) *Content {
+	return &Content{Type: "html", Body: body}
+}
+
+func XHTML(body string) *Content {
+	return &Content{Type: "xhtml", Body: body}
+}
+
+type feedXML struct {
+	Namespace  string        `xml:"xmlns,attr"`
+	ID         string        `xml:"id"`
+	Title      string        `xml:"title"`
+	Subtitle   string        `xml:"subtitle,omitempty"`
+	Updated    string        `xml:"updated"`
+	Authors    []Person      `xml:"author,omitempty"`
+	Links      []Link        `xml:"link,omitempty"`
+	Categories []categoryXML `xml:"category,omitempty"`
+	Rights     string        `xml:"rights,omitempty"`
+	Entries    []entryXML    `xml:"entry,omitempty"`
+}
+
+type entryXML struct {
+	ID         string        `xml:"id"`
+	Title      string        `xml:"title"`
+	Updated    string        `xml:"updated"`
+	Published  string        `xml:"published,omitempty"`
+	Authors    []Person      `xml:"author,omitempty"`
+	Links      []Link        `xml:"link,omitempty"`
+	Categories []categoryXML `xml:"category,omitempty"`
+	Summary    string        `xml:"summary,omitempty"`
+	Content    *contentXML   `xml:"content,omitempty"`
+}
+
+type categoryXML struct {
+	Term string `xml:"term,attr"`
+}
+
+type contentXML struct {
+	Type  string        `xml:"type,attr"`
+	XHTML go_xml.RawXML `xml:"div,omitempty"`
+	Text  string        `xml:",chardata"`
+}
+
+func (f *Feed) Validate() error {
+	if err := required("feed", f.ID, f.Title, f.Updated); err != nil {
+		return err
+	}
+	for i, entry := range f.Entries {
+		if err := required(fmt.Sprintf("entry %d", i), entry.ID, entry.Title, entry.Updated); err != nil {
+			return err
+		}
+		if len(f.Authors) == 0 && len(entry.Authors) == 0 {
+			return fmt.Errorf("%w: author (entry %d has none and the feed has no default)", ErrMissingField, i)
+		}
+		if entry.Content != nil {
+			switch entry.Content.Type {
+			case "", "text", "html":
+			case "xhtml":
+				if _, err := xhtmlDiv(entry.Content.Body); err != nil {
+					return fmt.Errorf("atom: entry %d has malformed xhtml content: %w", i, err)
+				}
+			default:
+				return fmt.Errorf("atom: entry %d has unsupported content type %q", i, entry.Content.Type)
+			}
+		}
+	}
+	return nil
+}
+
+func required(owner, id, title string, updated time.Time) error {
+	switch {
+	case id == "":
+		return fmt.Errorf("%w: %s id", ErrMissingField, owner)
+	case title == "":
+		return fmt.Errorf("%w: %s title", ErrMissingField, owner)
+	case updated.IsZero():
+		return fmt.Errorf("%w: %s updated", ErrMissingField, owner)
+	}
+	return nil
+}
+
+func (f *Feed) Marshal(opts *go_xml.MarshalOptions) ([]byte, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	doc := feedXML{
+		Namespace:  Namespace,
+		ID:         f.ID,
+		Title:      f.Title,
+		Subtitle:   f.Subtitle,
+		Updated:    formatDate(f.Updated),
+		Authors:    f.Authors,
+		Links:      f.Links,
+		Categories: categories(f.Categories),
+		Rights:     f.Rights,
+	}
+	for i, entry := range f.Entries {
+		entryContent, err := content(entry.Content)
+		if err != nil {
+			return nil, fmt.Errorf("atom: entry %d: %w", i, err)
+		}
+		doc.Entries = append(doc.Entries, entryXML{
+			ID:         entry.ID,
+			Title:      entry.Title,
+			Updated:    formatDate(entry.Updated),
+			Published:  formatDate(entry.Published),
+			Authors:    entry.Authors,
+			Links:      entry.Links,
+			Categories: categories(entry.Categories),
+			Summary:    entry.Summary,
+			Content:    entryContent,
+		})
+	}
+
+	marshalOpts := go_xml.MarshalOptions{XMLHeader: true, Indent: "  "}
+	if opts != nil {
+		marshalOpts = *opts
+	}
+	marshalOpts.RootTag = "feed"
+	marshalOpts.Namespace = ""
+	return go_xml.Marshal(doc, &marshalOpts)
+}
+
+func content(c *Content) (*contentXML, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Type == "xhtml" {
+		div, err := xhtmlDiv(c.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &contentXML{Type: "xhtml", XHTML: div}, nil
+	}
+	contentType := c.Type
+	if contentType == "" {
+		contentType = "text"
+	}
+	return &contentXML{Type: contentType, Text: c.Body}, nil
+}
+
+func xhtmlDiv(body string) (go_xml.RawXML, error) {
+	div := `<div xmlns="` + XHTMLNamespace + `">` + body + `</div>`
+	if _, err := go_xml.Parse([]byte(div)); err != nil {
+		return "", err
+	}
+	return go_xml.RawXML(div), nil
+}
+
+func categories(terms []string) []categoryXML {
+	var out []categoryXML
+	for _, term := range terms {
+		out = append(out, categoryXML{Term: term})
+	}
+	return out
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func FromRSS(feed *rss.Feed, id string) *Feed {
+	out := &Feed{
+		ID:       id,
+		Title:    feed.Title,
+		Subtitle: feed.Description,
+		Updated:  feed.LastBuildDate,
+		Rights:   feed.Copyright,
+		Links:    []Link{{Href: feed.Link, Rel: "alternate"}},
+	}
+	if feed.SelfLink != "" {
+		out.Links = append(out.Links, Link{Href: feed.SelfLink, Rel: "self", Type: "application/atom+xml"})
+	}
+
+	for _, item := range feed.Items {
+		entry := Entry{
+			ID:         item.GUID,
+			Title:      item.Title,
+			Updated:    item.PubDate,
+			Published:  item.PubDate,
+			Categories: item.Categories,
+			Summary:    item.Description,
+		}
+		if entry.ID == "" {
+			entry.ID = item.Link
+		}
+		if item.Link != "" {
+			entry.Links = append(entry.Links, Link{Href: item.Link, Rel: "alternate"})
+		}
+		if item.Enclosure != nil {
+			entry.Links = append(entry.Links, Link{Href: item.Enclosure.URL, Rel: "enclosure", Type: item.Enclosure.Type, Length: item.Enclosure.Length})
+		}
+		if item.Author != "" {
+			entry.Authors = []Person{{Name: item.Author}}
+		}
+		if item.Content != "" {
+			entry.Content = HTML(item.Content)
+		}
+		if entry.Updated.After(out.Updated) {
+			out.Updated = entry.Updated
+		}
+		out.Entries = append(out.Entries, entry)
+	}
+	return out
+}
@@ -0,0 +1,112 @@
+package atom
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+	"github.com/lrnxzz/go-xml/v2/rss"
+)
+
+func TestFeedMarshal(t *testing.T) {
+	updated := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	feed := &Feed{
+		ID:      "urn:uuid:60a76c80",
+		Title:   "Go XML",
+		Updated: updated,
+		Authors: []Person{{Name: "Alice"}},
+		Links:   []Link{{Href: "https://example.com/feed", Rel: "self"}},
+		Entries: []Entry{
+			{
+				ID:      "urn:uuid:1225c695",
+				Title:   "v2.1",
+				Updated: updated,
+				Links:   []Link{{Href: "https://example.com/v2.1"}},
+				Content: XHTML("<p>Faster &amp; <b>smaller</b></p>"),
+			},
+			{
+				ID:      "urn:uuid:1225c696",
+				Title:   "v2.2",
+				Updated: updated,
+				Content: HTML("<p>a & b</p>"),
+			},
+		},
+	}
+
+	output, err := feed.Marshal(&go_xml.MarshalOptions{})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	expected := `<feed xmlns="http://www.w3.org/2005/Atom">
+<id>urn:uuid:60a76c80</id><title>Go XML</title><updated>2024-03-01T09:00:00Z</updated>
+<author><name>Alice</name></author>
+<link href="https://example.com/feed" rel="self"/>
+<entry>
+  <id>urn:uuid:1225c695</id><title>v2.1</title><updated>2024-03-01T09:00:00Z</updated>
+  <link href="https://example.com/v2.1"/>
+  <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Faster &amp; <b>smaller</b></p></div></content>
+</entry>
+<entry>
+  <id>urn:uuid:1225c696</id><title>v2.2</title><updated>2024-03-01T09:00:00Z</updated>
+  <content type="html">&lt;p&gt;a &amp; b&lt;/p&gt;</content>
+</entry>
+</feed>`
+	diffs, err := go_xml.Diff([]byte(expected), output, nil)
+	if err != nil {
+		t.Fatalf("Diff error: %v\n%s", err, output)
+	}
+	if len(diffs) > 0 {
+		t.Errorf("Feed mismatch %v\nGot: %s", diffs, output)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	updated := time.Now()
+	tests := []struct {
+		name string
+		feed Feed
+	}{
+		{name: "Missing feed id", feed: Feed{Title: "t", Updated: updated}},
+		{name: "Missing entry updated", feed: Feed{ID: "f", Title: "t", Updated: updated, Authors: []Person{{Name: "a"}}, Entries: []Entry{{ID: "e", Title: "t"}}}},
+		{name: "Missing author", feed: Feed{ID: "f", Title: "t", Updated: updated, Entries: []Entry{{ID: "e", Title: "t", Updated: updated}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.feed.Marshal(nil); !errors.Is(err, ErrMissingField) {
+				t.Errorf("Expected ErrMissingField, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMalformedXHTMLContent(t *testing.T) {
+	updated := time.Now()
+	for _, body := range []string{"<b>bold", "</div><evil/>", "a & b"} {
+		feed := Feed{ID: "f", Title: "t", Updated: updated, Authors: []Person{{Name: "a"}}, Entries: []Entry{
+			{ID: "e", Title: "t", Updated: updated, Content: &Content{Type: "xhtml", Body: body}},
+		}}
+		if err := feed.Validate(); err == nil {
+			t.Errorf("Expected Validate to reject %q", body)
+		}
+		if output, err := feed.Marshal(nil); err == nil {
+			t.Errorf("Expected Marshal to reject %q, got %s", body, output)
+		}
+	}
+}
+
+func TestFromRSS(t *testing.T) {
+	published := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	source := rss.NewFeed("Go XML", "https://example.com", "Release notes").
+		AddItem(rss.Item{Title: "v2.1", Link: "https://example.com/v2.1", Author: "Alice", PubDate: published})
+
+	feed := FromRSS(source, "urn:feed")
+	if _, err := feed.Marshal(nil); err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if feed.Updated != published || feed.Entries[0].ID != "https://example.com/v2.1" {
+		t.Errorf("Unexpected conversion: %+v", feed)
+	}
+}
@@ -0,0 +1,44 @@
+package go_xml
+
+import (
+	"slices"
+	"strings"
+)
+
+type AttributeOrder int
+
+const (
+	AttributeOrderStruct AttributeOrder = iota
+	AttributeOrderAlphabetical
+)
+
+func attributeComparator(opts *MarshalOptions) func(a, b Attribute) int {
+	if opts.CompareAttributes != nil {
+		return opts.CompareAttributes
+	}
+	if opts.AttributeOrder == AttributeOrderAlphabetical || opts.Deterministic {
+		return compareAttributesAlphabetically
+	}
+	return nil
+}
+
+func compareAttributesAlphabetically(a, b Attribute) int {
+	_, aIsNS := namespacePrefix(a.Name)
+	_, bIsNS := namespacePrefix(b.Name)
+	if aIsNS != bIsNS {
+		if aIsNS {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+func (e *Encoder) orderAttributes(attrs []Attribute) []Attribute {
+	if e.compareAttrs == nil || len(attrs) < 2 {
+		return attrs
+	}
+	e.sortedAttrs = append(e.sortedAttrs[:0], attrs...)
+	slices.SortStableFunc(e.sortedAttrs, e.compareAttrs)
+	return e.sortedAttrs
+}
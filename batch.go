@@ -0,0 +1,75 @@
+package go_xml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+func MarshalAll(values []interface{}, opts *MarshalOptions) ([][]byte, error) {
+	return MarshalAllContext(context.Background(), values, opts)
+}
+
+func MarshalAllContext(ctx context.Context, values []interface{}, opts *MarshalOptions) ([][]byte, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	documentOpts := &MarshalOptions{}
+	if opts != nil {
+		if opts.Parallelism > 0 {
+			workers = opts.Parallelism
+		}
+		copied := *opts
+		copied.Parallelism = 0
+		documentOpts = &copied
+	}
+	if workers > len(values) {
+		workers = len(values)
+	}
+
+	batchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([][]byte, len(values))
+	errs := make([]error, len(values))
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				if err := batchCtx.Err(); err != nil {
+					errs[index] = err
+					continue
+				}
+				data, _, err := marshalCompressed(batchCtx, values[index], documentOpts)
+				if err != nil {
+					errs[index] = err
+					cancel()
+					continue
+				}
+				results[index] = data
+			}
+		}()
+	}
+
+	for i := range values {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil || (ctx.Err() == nil && errors.Is(err, context.Canceled)) {
+			continue
+		}
+		return nil, fmt.Errorf("error encoding document %d: %w", i, err)
+	}
+	return results, nil
+}
@@ -1,22 +1,51 @@
 package go_xml
 
 import (
+	"bufio"
 	"bytes"
+	"io"
 	"sync"
 )
 
 var bufferPool = sync.Pool{
 	New: func() interface{} {
+		bufferCounters.new()
 		return new(bytes.Buffer)
 	},
 }
 
 func acquireBuffer() *bytes.Buffer {
+	bufferCounters.get()
 	buf := bufferPool.Get().(*bytes.Buffer)
 	buf.Reset()
 	return buf
 }
 
 func releaseBuffer(buf *bytes.Buffer) {
+	if exceedsLimit(buf.Cap(), currentPoolConfig().MaxBufferSize) {
+		bufferCounters.drop()
+		return
+	}
+	bufferCounters.put()
 	bufferPool.Put(buf)
 }
+
+var bufferedWriterPool = sync.Pool{
+	New: func() interface{} {
+		writerCounters.new()
+		return bufio.NewWriterSize(nil, 4096)
+	},
+}
+
+func acquireBufferedWriter(w io.Writer) *bufio.Writer {
+	writerCounters.get()
+	bw := bufferedWriterPool.Get().(*bufio.Writer)
+	bw.Reset(w)
+	return bw
+}
+
+func releaseBufferedWriter(bw *bufio.Writer) {
+	bw.Reset(nil)
+	writerCounters.put()
+	bufferedWriterPool.Put(bw)
+}
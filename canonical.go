@@ -0,0 +1,230 @@
+package go_xml
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const xmlNamespaceURI = "http://www.w3.org/XML/1998/namespace"
+
+type namespaceDecl struct {
+	prefix string
+	uri    string
+}
+
+type canonicalAttribute struct {
+	space string
+	local string
+	name  string
+	value string
+}
+
+func Canonicalize(data []byte) ([]byte, error) {
+	root, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseNode(root)
+
+	return CanonicalizeNode(root, nil)
+}
+
+func CanonicalizeNode(node *ElementNode, inherited map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := canonicalizeElement(&buf, node, inherited, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func NamespaceScope(node *ElementNode, inherited map[string]string) map[string]string {
+	scope := inherited
+	copied := false
+	for _, attr := range node.Attributes {
+		prefix, ok := namespacePrefix(attr.Name)
+		if !ok {
+			continue
+		}
+		if !copied {
+			scope = make(map[string]string, len(inherited)+1)
+			for p, uri := range inherited {
+				scope[p] = uri
+			}
+			copied = true
+		}
+		scope[prefix] = attr.Value
+	}
+	return scope
+}
+
+func namespacePrefix(attrName string) (string, bool) {
+	if attrName == "xmlns" {
+		return "", true
+	}
+	if strings.HasPrefix(attrName, "xmlns:") {
+		return attrName[len("xmlns:"):], true
+	}
+	return "", false
+}
+
+func canonicalizeElement(buf *bytes.Buffer, node *ElementNode, inScope, rendered map[string]string) error {
+	scope := NamespaceScope(node, inScope)
+
+	elementPrefix, _ := splitQualifiedName(node.Name)
+	utilized := []string{elementPrefix}
+
+	var attrs []canonicalAttribute
+	for _, attr := range node.Attributes {
+		if _, ok := namespacePrefix(attr.Name); ok {
+			continue
+		}
+		prefix, local := splitQualifiedName(attr.Name)
+		space := ""
+		switch prefix {
+		case "":
+		case "xml":
+			space = xmlNamespaceURI
+		default:
+			uri, ok := scope[prefix]
+			if !ok {
+				return fmt.Errorf("undeclared namespace prefix %q on attribute %s", prefix, attr.Name)
+			}
+			space = uri
+			utilized = append(utilized, prefix)
+		}
+		attrs = append(attrs, canonicalAttribute{space: space, local: local, name: attr.Name, value: attr.Value})
+	}
+
+	var decls []namespaceDecl
+	childRendered := rendered
+	for _, prefix := range utilized {
+		if prefix == "xml" || containsDecl(decls, prefix) {
+			continue
+		}
+		uri, ok := scope[prefix]
+		if !ok && prefix != "" {
+			return fmt.Errorf("undeclared namespace prefix %q on element %s", prefix, node.Name)
+		}
+		if renderedURI, seen := rendered[prefix]; seen && renderedURI == uri {
+			continue
+		} else if !seen && prefix == "" && uri == "" {
+			continue
+		}
+
+		decls = append(decls, namespaceDecl{prefix: prefix, uri: uri})
+		if len(decls) == 1 {
+			childRendered = make(map[string]string, len(rendered)+1)
+			for p, u := range rendered {
+				childRendered[p] = u
+			}
+		}
+		childRendered[prefix] = uri
+	}
+
+	sort.Slice(decls, func(i, j int) bool {
+		return decls[i].prefix < decls[j].prefix
+	})
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].local < attrs[j].local
+	})
+
+	buf.WriteByte('<')
+	buf.WriteString(node.Name)
+	for _, decl := range decls {
+		if decl.prefix == "" {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(" xmlns:")
+			buf.WriteString(decl.prefix)
+			buf.WriteString(`="`)
+		}
+		writeCanonicalAttrValue(buf, decl.uri)
+		buf.WriteByte('"')
+	}
+	for _, attr := range attrs {
+		buf.WriteByte(' ')
+		buf.WriteString(attr.name)
+		buf.WriteString(`="`)
+		writeCanonicalAttrValue(buf, attr.value)
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+
+	for _, child := range node.Children {
+		switch c := child.(type) {
+		case *ElementNode:
+			if err := canonicalizeElement(buf, c, scope, childRendered); err != nil {
+				return err
+			}
+		case *TextNode:
+			writeCanonicalText(buf, c.Text)
+		case *CDataNode:
+			writeCanonicalText(buf, c.Text)
+		case *ProcessingInstructionNode:
+			buf.WriteString("<?")
+			buf.WriteString(c.Target)
+			if c.Data != "" {
+				buf.WriteByte(' ')
+				buf.WriteString(c.Data)
+			}
+			buf.WriteString("?>")
+		}
+	}
+
+	buf.WriteString("</")
+	buf.WriteString(node.Name)
+	buf.WriteByte('>')
+	return nil
+}
+
+func containsDecl(decls []namespaceDecl, prefix string) bool {
+	for _, decl := range decls {
+		if decl.prefix == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+func writeCanonicalText(buf *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
+
+func writeCanonicalAttrValue(buf *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '"':
+			buf.WriteString("&quot;")
+		case '\t':
+			buf.WriteString("&#x9;")
+		case '\n':
+			buf.WriteString("&#xA;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
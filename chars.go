@@ -0,0 +1,93 @@
+package go_xml
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+type InvalidCharPolicy int
+
+const (
+	InvalidCharsKeep InvalidCharPolicy = iota
+	InvalidCharsStrip
+	InvalidCharsReplace
+	InvalidCharsReference
+	InvalidCharsError
+)
+
+func isLegalChar(r rune) bool {
+	switch {
+	case r == '\t' || r == '\n' || r == '\r':
+		return true
+	case r >= 0x20 && r <= 0xD7FF:
+		return true
+	case r >= 0xE000 && r <= 0xFFFD:
+		return true
+	case r >= 0x10000 && r <= 0x10FFFF:
+		return true
+	}
+	return false
+}
+
+func isDiscouragedChar(r rune) bool {
+	return r >= 0x7F && r <= 0x9F && r != 0x85
+}
+
+func invalidCharIndex(s string, policy InvalidCharPolicy) (int, rune, int) {
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			if b < 0x20 && b != '\t' && b != '\n' && b != '\r' {
+				return i, rune(b), 1
+			}
+			if b == 0x7F && policy == InvalidCharsReference {
+				return i, rune(b), 1
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i, r, size
+		}
+		if !isLegalChar(r) || (policy == InvalidCharsReference && isDiscouragedChar(r)) {
+			return i, r, size
+		}
+		i += size
+	}
+	return -1, 0, 0
+}
+
+func (e *Encoder) writeSanitized(s string) error {
+	for {
+		i, r, size := invalidCharIndex(s, e.invalidChars)
+		if i < 0 {
+			return e.writeEscapedValid(s)
+		}
+		if err := e.writeEscapedValid(s[:i]); err != nil {
+			return err
+		}
+
+		var err error
+		switch e.invalidChars {
+		case InvalidCharsStrip:
+		case InvalidCharsReplace:
+			err = e.writeString("\uFFFD")
+		case InvalidCharsReference:
+			if isDiscouragedChar(r) {
+				e.scratch = strconv.AppendInt(append(e.scratch[:0], "&#x"...), int64(r), 16)
+				e.scratch = append(e.scratch, ';')
+				_, err = e.w.Write(e.scratch)
+			} else {
+				err = e.writeString("\uFFFD")
+			}
+		default:
+			return &InvalidCharError{Char: r}
+		}
+		if err != nil {
+			return err
+		}
+		s = s[i+size:]
+	}
+}
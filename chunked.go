@@ -0,0 +1,186 @@
+package go_xml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+type ChunkOptions struct {
+	MaxBytes int
+	MaxItems int
+
+	Marshal *MarshalOptions
+}
+
+type ChunkedWriter struct {
+	root    string
+	create  func(part int) (io.WriteCloser, error)
+	opts    ChunkOptions
+	prolog  []byte
+	closing string
+
+	scratch   bytes.Buffer
+	encoder   *Encoder
+	transcode func([]byte) ([]byte, error)
+	items     int
+
+	file      io.WriteCloser
+	out       *bufio.Writer
+	part      int
+	partItems int
+	partBytes int
+	closed    bool
+}
+
+func NewChunkedWriter(root string, create func(part int) (io.WriteCloser, error), opts *ChunkOptions) *ChunkedWriter {
+	c := &ChunkedWriter{root: root, create: create}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.Marshal == nil {
+		c.opts.Marshal = &MarshalOptions{}
+	}
+	c.encoder = newDocumentEncoder(&c.scratch, c.opts.Marshal)
+	c.closing = c.encoder.newline + "</" + root + ">"
+	return c
+}
+
+func (c *ChunkedWriter) Parts() int {
+	return c.part
+}
+
+func (c *ChunkedWriter) buildProlog() error {
+	var buf bytes.Buffer
+	encoder := newDocumentEncoder(&buf, c.opts.Marshal)
+	if err := encoder.writeProlog(c.opts.Marshal); err != nil {
+		return err
+	}
+	m := newMarshaler(c.opts.Marshal, encoder)
+	if err := m.startElement(c.root, nil); err != nil {
+		return err
+	}
+	if err := encoder.closeStartTag(encoder.current()); err != nil {
+		return err
+	}
+	c.prolog = buf.Bytes()
+
+	encodeProlog, err := transcoder(c.opts.Marshal.Encoding, false)
+	if err != nil || encodeProlog == nil {
+		return err
+	}
+	if c.prolog, err = encodeProlog(c.prolog); err != nil {
+		return err
+	}
+	if c.transcode, err = transcoder(c.opts.Marshal.Encoding, true); err != nil {
+		return err
+	}
+	closing, err := c.transcode([]byte(c.closing))
+	c.closing = string(closing)
+	return err
+}
+
+func (c *ChunkedWriter) Write(v interface{}) error {
+	if c.closed {
+		return ErrWriterClosed
+	}
+	if c.prolog == nil {
+		if err := c.buildProlog(); err != nil {
+			return err
+		}
+	}
+
+	val := reflect.ValueOf(v)
+	if isNilValue(val) {
+		return nil
+	}
+
+	c.scratch.Reset()
+	c.encoder.stack = append(c.encoder.stack[:0], openElement{name: c.root})
+	c.encoder.depth = 1
+
+	m := newMarshaler(c.opts.Marshal, c.encoder)
+	m.started = true
+	m.depth = 1
+	m.path = append(m.path, c.root, indexSegment(c.items))
+	tag, err := streamItemTag(val, m.opts)
+	if err != nil {
+		return fmt.Errorf("error encoding item %d: %w", c.items, err)
+	}
+	if err := m.marshalValue(val, []string{tag}); err != nil {
+		return fmt.Errorf("error encoding structure: %w", err)
+	}
+
+	data := c.scratch.Bytes()
+	if c.transcode != nil {
+		var err error
+		if data, err = c.transcode(data); err != nil {
+			return err
+		}
+	}
+	size := len(data)
+	if c.opts.MaxBytes > 0 && len(c.prolog)+size+len(c.closing) > c.opts.MaxBytes {
+		return fmt.Errorf("item %d needs %d bytes, more than the %d byte part limit", c.items, len(c.prolog)+size+len(c.closing), c.opts.MaxBytes)
+	}
+
+	if c.out != nil && (c.opts.MaxItems > 0 && c.partItems >= c.opts.MaxItems ||
+		c.opts.MaxBytes > 0 && c.partBytes+size+len(c.closing) > c.opts.MaxBytes) {
+		if err := c.finishPart(); err != nil {
+			return err
+		}
+	}
+	if c.out == nil {
+		if err := c.startPart(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := c.out.Write(data); err != nil {
+		return err
+	}
+	c.items++
+	c.partItems++
+	c.partBytes += size
+	return nil
+}
+
+func (c *ChunkedWriter) startPart() error {
+	c.part++
+	file, err := c.create(c.part)
+	if err != nil {
+		return err
+	}
+	c.file = file
+	c.out = acquireBufferedWriter(file)
+	c.partItems = 0
+	c.partBytes = len(c.prolog)
+	_, err = c.out.Write(c.prolog)
+	return err
+}
+
+func (c *ChunkedWriter) finishPart() error {
+	_, err := c.out.WriteString(c.closing)
+	if err == nil {
+		err = c.out.Flush()
+	}
+	releaseBufferedWriter(c.out)
+	c.out = nil
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	c.file = nil
+	return err
+}
+
+func (c *ChunkedWriter) Close() error {
+	if c.closed {
+		return ErrWriterClosed
+	}
+	c.closed = true
+	if c.out == nil {
+		return nil
+	}
+	return c.finishPart()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lrnxzz/go-xml/v2/goxmlgen"
+)
+
+func main() {
+	input := flag.String("in", "", "Go file to read (defaults to stdin)")
+	output := flag.String("out", "", "Go file to write (defaults to stdout)")
+	types := flag.String("types", "", "comma-separated struct types to generate (defaults to types annotated with //goxml:generate)")
+	flag.Parse()
+
+	if err := run(*input, *output, *types); err != nil {
+		fmt.Fprintln(os.Stderr, "goxmlgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(input, output, types string) error {
+	var src []byte
+	var err error
+	if input == "" {
+		src, err = io.ReadAll(os.Stdin)
+	} else {
+		src, err = os.ReadFile(input)
+	}
+	if err != nil {
+		return err
+	}
+
+	opts := &goxmlgen.Options{}
+	if types != "" {
+		opts.Types = strings.Split(types, ",")
+	}
+	source, err := goxmlgen.Generate(src, opts)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(source)
+		return err
+	}
+	return os.WriteFile(output, source, 0o644)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lrnxzz/go-xml/v2/xsdgen"
+)
+
+func main() {
+	input := flag.String("in", "", "XSD file to read (defaults to stdin)")
+	output := flag.String("out", "", "Go file to write (defaults to stdout)")
+	pkg := flag.String("package", "schema", "package name of the generated file")
+	flag.Parse()
+
+	if err := run(*input, *output, *pkg); err != nil {
+		fmt.Fprintln(os.Stderr, "xsdgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(input, output, pkg string) error {
+	var xsd []byte
+	var err error
+	if input == "" {
+		xsd, err = io.ReadAll(os.Stdin)
+	} else {
+		xsd, err = os.ReadFile(input)
+	}
+	if err != nil {
+		return err
+	}
+
+	source, err := xsdgen.Generate(xsd, &xsdgen.Options{Package: pkg})
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(source)
+		return err
+	}
+	return os.WriteFile(output, source, 0o644)
+}
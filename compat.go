@@ -0,0 +1,125 @@
+package go_xml
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+func checkCompatOptions(opts *MarshalOptions) error {
+	var option string
+	switch {
+	case opts.ItemTag != "":
+		option = "ItemTag"
+	case len(opts.SelfClosingTags) > 0:
+		option = "SelfClosingTags"
+	case opts.SpacedSelfClose:
+		option = "SpacedSelfClose"
+	case opts.StrictNames:
+		option = "StrictNames"
+	case opts.InvalidChars != InvalidCharsKeep:
+		option = "InvalidChars"
+	case opts.FieldFilter != nil || len(opts.Include) > 0 || len(opts.Exclude) > 0:
+		option = "field filters"
+	case len(opts.Groups) > 0:
+		option = "Groups"
+	case opts.SchemaVersion != "":
+		option = "SchemaVersion"
+	case len(opts.Transformers) > 0:
+		option = "Transformers"
+	case opts.Mode != ModeXML:
+		option = "Mode"
+	case opts.Newline != "" && opts.Newline != "\n":
+		option = "Newline"
+	case opts.AttributeOrder != AttributeOrderStruct || opts.CompareAttributes != nil:
+		option = "AttributeOrder"
+	case opts.WrapAttributes > 0:
+		option = "WrapAttributes"
+	case opts.EmptyElements != EmptyElementsExpanded:
+		option = "EmptyElements"
+	case len(opts.RootAttributes) > 0:
+		option = "RootAttributes"
+	case opts.NameStrategy != nil:
+		option = "NameStrategy"
+	case opts.Deterministic:
+		option = "Deterministic"
+	case opts.Redactor != nil:
+		option = "Redactor"
+	case opts.MaxDepth > 0:
+		option = "MaxDepth"
+	case opts.SkipUnsupported:
+		option = "SkipUnsupported"
+	case opts.DuplicateAttributes != DuplicateAttributesError:
+		option = "DuplicateAttributes"
+	case opts.Validate:
+		option = "Validate"
+	case opts.NilValues != NilOmit:
+		option = "NilValues"
+	case opts.OmitNilSlices:
+		option = "OmitNilSlices"
+	case opts.OmitEmptyStructs:
+		option = "OmitEmptyStructs"
+	case opts.Escaper != nil:
+		option = "Escaper"
+	case len(opts.Entities) > 0:
+		option = "Entities"
+	case opts.NormalizeUnicode:
+		option = "NormalizeUnicode"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s cannot be combined with CompatStdlib", option)
+}
+
+func encodeStdlib(ctx context.Context, w io.Writer, v interface{}, opts *MarshalOptions) error {
+	if err := checkCompatOptions(opts); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if opts.Declaration != nil || !isUTF8(opts.Encoding) {
+		header, err := declaration(opts)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, header+"\n"); err != nil {
+			return err
+		}
+	} else if opts.XMLHeader {
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", opts.Indent)
+	for _, comment := range opts.HeaderComments {
+		if err := encoder.EncodeToken(xml.Comment(comment)); err != nil {
+			return err
+		}
+	}
+	for _, pi := range opts.ProcessingInstructions {
+		if err := encoder.EncodeToken(xml.ProcInst{Target: pi.Target, Inst: []byte(pi.Data)}); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if opts.RootTag != "" || opts.Namespace != "" {
+		start := xml.StartElement{Name: xml.Name{Space: opts.Namespace, Local: opts.RootTag}}
+		if start.Name.Local == "" {
+			start.Name.Local = reflect.Indirect(reflect.ValueOf(v)).Type().Name()
+		}
+		err = encoder.EncodeElement(v, start)
+	} else {
+		err = encoder.Encode(v)
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding structure: %w", err)
+	}
+	return encoder.Close()
+}
@@ -2,19 +2,176 @@ package go_xml
 
 import (
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
 	"sync"
 )
 
+const (
+	CompressionGzip  = "gzip"
+	CompressionZlib  = "zlib"
+	CompressionFlate = "flate"
+)
+
 type Compressor interface {
 	Compress(data *bytes.Buffer) (*bytes.Buffer, error)
 }
 
-type GzipCompressor struct{}
+type StreamCompressor interface {
+	Compressor
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+type CompressorFactory func(level int) Compressor
+
+type GzipCompressor struct {
+	Level int
+}
+
+type ZlibCompressor struct {
+	Level int
+}
+
+type FlateCompressor struct {
+	Level int
+}
+
+func newGzipWriter(w io.Writer, level int) (pooledWriter, error) {
+	return gzip.NewWriterLevel(w, level)
+}
+
+func newZlibWriter(w io.Writer, level int) (pooledWriter, error) {
+	return zlib.NewWriterLevel(w, level)
+}
+
+func newFlateWriter(w io.Writer, level int) (pooledWriter, error) {
+	return flate.NewWriter(w, level)
+}
 
 func (gc *GzipCompressor) Compress(data *bytes.Buffer) (*bytes.Buffer, error) {
+	return compressPooled(data, CompressionGzip, gc.Level, newGzipWriter)
+}
+
+func (gc *GzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return acquireStreamWriter(w, CompressionGzip, gc.Level, newGzipWriter)
+}
+
+func (zc *ZlibCompressor) Compress(data *bytes.Buffer) (*bytes.Buffer, error) {
+	return compressPooled(data, CompressionZlib, zc.Level, newZlibWriter)
+}
+
+func (zc *ZlibCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return acquireStreamWriter(w, CompressionZlib, zc.Level, newZlibWriter)
+}
+
+func (fc *FlateCompressor) Compress(data *bytes.Buffer) (*bytes.Buffer, error) {
+	return compressPooled(data, CompressionFlate, fc.Level, newFlateWriter)
+}
+
+func (fc *FlateCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return acquireStreamWriter(w, CompressionFlate, fc.Level, newFlateWriter)
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]CompressorFactory{
+		CompressionGzip:  func(level int) Compressor { return &GzipCompressor{Level: level} },
+		CompressionZlib:  func(level int) Compressor { return &ZlibCompressor{Level: level} },
+		CompressionFlate: func(level int) Compressor { return &FlateCompressor{Level: level} },
+	}
+)
+
+func RegisterCompressor(name string, factory CompressorFactory) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[name] = factory
+}
+
+func lookupCompressor(name string, level int) (Compressor, error) {
+	if name == "" {
+		name = CompressionGzip
+	}
+
+	compressorsMu.RLock()
+	factory, ok := compressors[name]
+	compressorsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown compression algorithm %q", name)
+	}
+	return factory(level), nil
+}
+
+type pooledWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+type writerPoolKey struct {
+	algorithm string
+	level     int
+}
+
+var writerPools sync.Map
+
+type streamWriter struct {
+	pooledWriter
+	pool *sync.Pool
+}
+
+func (sw *streamWriter) Close() error {
+	if sw.pooledWriter == nil {
+		return nil
+	}
+	err := sw.pooledWriter.Close()
+	releaseWriter(sw.pool, sw.pooledWriter)
+	sw.pooledWriter = nil
+	return err
+}
+
+func acquireWriter(w io.Writer, algorithm string, level int, newWriter func(w io.Writer, level int) (pooledWriter, error)) (pooledWriter, *sync.Pool, error) {
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	key := writerPoolKey{algorithm: algorithm, level: level}
+	pool, _ := writerPools.LoadOrStore(key, &sync.Pool{})
+	if pooled, ok := pool.(*sync.Pool).Get().(pooledWriter); ok {
+		pooled.Reset(w)
+		return pooled, pool.(*sync.Pool), nil
+	}
+
+	created, err := newWriter(w, level)
+	if err != nil {
+		return nil, nil, err
+	}
+	return created, pool.(*sync.Pool), nil
+}
+
+func releaseWriter(pool *sync.Pool, writer pooledWriter) {
+	writer.Reset(io.Discard)
+	pool.Put(writer)
+}
+
+func acquireStreamWriter(w io.Writer, algorithm string, level int, newWriter func(w io.Writer, level int) (pooledWriter, error)) (io.WriteCloser, error) {
+	writer, pool, err := acquireWriter(w, algorithm, level, newWriter)
+	if err != nil {
+		return nil, err
+	}
+	return &streamWriter{pooledWriter: writer, pool: pool}, nil
+}
+
+func compressPooled(data *bytes.Buffer, algorithm string, level int, newWriter func(w io.Writer, level int) (pooledWriter, error)) (*bytes.Buffer, error) {
 	compressedBuffer := acquireBuffer()
-	writer := gzip.NewWriter(compressedBuffer)
+
+	writer, pool, err := acquireWriter(compressedBuffer, algorithm, level, newWriter)
+	if err != nil {
+		releaseBuffer(compressedBuffer)
+		return nil, err
+	}
 
 	if _, err := writer.Write(data.Bytes()); err != nil {
 		releaseBuffer(compressedBuffer)
@@ -25,19 +182,70 @@ func (gc *GzipCompressor) Compress(data *bytes.Buffer) (*bytes.Buffer, error) {
 		return nil, err
 	}
 
+	releaseWriter(pool, writer)
 	return compressedBuffer, nil
 }
 
-var compressorPool = sync.Pool{
-	New: func() interface{} {
-		return &GzipCompressor{}
-	},
+func shouldCompress(opts *MarshalOptions, size int) bool {
+	return opts != nil && opts.Compress && size >= opts.CompressMinSize
+}
+
+type thresholdWriter struct {
+	dst        io.Writer
+	stream     StreamCompressor
+	minSize    int
+	pending    *bytes.Buffer
+	compressed io.WriteCloser
+}
+
+func newThresholdWriter(dst io.Writer, stream StreamCompressor, minSize int) *thresholdWriter {
+	return &thresholdWriter{
+		dst:     dst,
+		stream:  stream,
+		minSize: minSize,
+		pending: acquireBuffer(),
+	}
+}
+
+func (tw *thresholdWriter) Write(p []byte) (int, error) {
+	if tw.compressed != nil {
+		return tw.compressed.Write(p)
+	}
+
+	tw.pending.Write(p)
+	if tw.pending.Len() < tw.minSize {
+		return len(p), nil
+	}
+
+	compressed, err := tw.stream.NewWriter(tw.dst)
+	if err != nil {
+		return 0, err
+	}
+	tw.compressed = compressed
+	if _, err := compressed.Write(tw.pending.Bytes()); err != nil {
+		return 0, err
+	}
+	releaseBuffer(tw.pending)
+	tw.pending = nil
+	return len(p), nil
 }
 
-func acquireCompressor() Compressor {
-	return compressorPool.Get().(Compressor)
+func (tw *thresholdWriter) Close() error {
+	if tw.compressed != nil {
+		return tw.compressed.Close()
+	}
+	if tw.pending == nil {
+		return nil
+	}
+	_, err := tw.dst.Write(tw.pending.Bytes())
+	releaseBuffer(tw.pending)
+	tw.pending = nil
+	return err
 }
 
-func releaseCompressor(compressor Compressor) {
-	compressorPool.Put(compressor)
+func (tw *thresholdWriter) abort() {
+	if tw.pending != nil {
+		releaseBuffer(tw.pending)
+		tw.pending = nil
+	}
 }
@@ -0,0 +1,167 @@
+package go_xml
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultCSVRootTag = "rows"
+	defaultCSVRowTag  = "row"
+)
+
+type CSVOptions struct {
+	RootTag    string
+	RowTag     string
+	Headers    []string
+	Attributes bool
+	Comma      rune
+
+	Marshal *MarshalOptions
+}
+
+func ConvertCSV(w io.Writer, r io.Reader, opts *CSVOptions) error {
+	var o CSVOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.RootTag == "" {
+		o.RootTag = defaultCSVRootTag
+	}
+	if o.RowTag == "" {
+		o.RowTag = defaultCSVRowTag
+	}
+	if o.Marshal == nil {
+		o.Marshal = &MarshalOptions{}
+	}
+
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	if o.Comma != 0 {
+		reader.Comma = o.Comma
+	}
+
+	headers := o.Headers
+	if headers == nil {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return fmt.Errorf("csv input has no header row")
+		}
+		if err != nil {
+			return fmt.Errorf("error reading csv: %w", err)
+		}
+		headers = append([]string(nil), record...)
+	} else {
+		reader.FieldsPerRecord = len(headers)
+	}
+
+	names, err := csvColumnNames(headers, o.Attributes)
+	if err != nil {
+		return err
+	}
+
+	bw := acquireBufferedWriter(w)
+	defer releaseBufferedWriter(bw)
+
+	ew, closer, err := encodingWriter(bw, o.Marshal)
+	if err != nil {
+		return err
+	}
+	encoder := newDocumentEncoder(ew, o.Marshal)
+	if err := encoder.writeProlog(o.Marshal); err != nil {
+		return err
+	}
+	if err := encoder.startElement(o.RootTag, nil); err != nil {
+		return err
+	}
+
+	attrs := make([]Attribute, len(names))
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading csv: %w", err)
+		}
+
+		if o.Attributes {
+			for i, name := range names {
+				attrs[i] = Attribute{Name: name, Value: record[i]}
+			}
+			if err := encoder.startElement(o.RowTag, attrs); err != nil {
+				return err
+			}
+		} else {
+			if err := encoder.startElement(o.RowTag, nil); err != nil {
+				return err
+			}
+			for i, name := range names {
+				if err := writeCSVField(encoder, name, record[i]); err != nil {
+					return err
+				}
+			}
+		}
+		if err := encoder.endElement(); err != nil {
+			return err
+		}
+	}
+
+	if err := encoder.endElement(); err != nil {
+		return err
+	}
+	if err := closer.Close(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeCSVField(encoder *Encoder, name, value string) error {
+	if err := encoder.startElement(name, nil); err != nil {
+		return err
+	}
+	if err := encoder.writeText(value); err != nil {
+		return err
+	}
+	return encoder.endElement()
+}
+
+func csvColumnNames(headers []string, attributes bool) ([]string, error) {
+	names := make([]string, len(headers))
+	seen := make(map[string]bool, len(headers))
+	for i, header := range headers {
+		name := sanitizeName(header)
+		if name == "" {
+			name = "column" + strconv.Itoa(i+1)
+		}
+		if attributes && seen[name] {
+			return nil, fmt.Errorf("duplicate csv column %q", name)
+		}
+		seen[name] = true
+		names[i] = name
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("csv input has no columns")
+	}
+	return names, nil
+}
+
+func sanitizeName(s string) string {
+	s = strings.TrimSpace(s)
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case sb.Len() == 0 && !isNameStartChar(r) && isNameChar(r):
+			sb.WriteByte('_')
+			sb.WriteRune(r)
+		case r == ':' || !isNameChar(r):
+			sb.WriteByte('_')
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,48 @@
+package go_xml
+
+import (
+	"math/big"
+	"reflect"
+	"sync"
+)
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+type DecimalFormatter func(v interface{}) string
+
+var (
+	decimalsMu sync.RWMutex
+	decimals   = map[reflect.Type]DecimalFormatter{
+		bigIntType: func(v interface{}) string {
+			n := v.(big.Int)
+			return n.String()
+		},
+		reflect.TypeOf(big.Float{}): func(v interface{}) string {
+			f := v.(big.Float)
+			return f.Text('f', -1)
+		},
+		reflect.TypeOf(big.Rat{}): func(v interface{}) string {
+			r := v.(big.Rat)
+			if digits, exact := r.FloatPrec(); exact {
+				return r.FloatString(digits)
+			}
+			return r.RatString()
+		},
+	}
+)
+
+func RegisterDecimal(typ reflect.Type, format DecimalFormatter) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	decimalsMu.Lock()
+	defer decimalsMu.Unlock()
+	decimals[typ] = format
+}
+
+func lookupDecimal(typ reflect.Type) (DecimalFormatter, bool) {
+	decimalsMu.RLock()
+	format, ok := decimals[typ]
+	decimalsMu.RUnlock()
+	return format, ok
+}
@@ -0,0 +1,46 @@
+package go_xml
+
+const (
+	defaultMaxDecodeDepth      = 1000
+	defaultMaxAttributes       = 256
+	defaultMaxAttributeLength  = 64 << 10
+	defaultMaxCharacters       = 64 << 20
+	defaultMaxEntityExpansions = 10000
+)
+
+type UnmarshalOptions struct {
+	MaxDepth            int
+	MaxAttributes       int
+	MaxAttributeLength  int
+	MaxCharacters       int
+	MaxEntityExpansions int
+
+	EntityResolver EntityResolver
+
+	DisallowUnknownElements   bool
+	DisallowUnknownAttributes bool
+	Lenient                   bool
+}
+
+func resolveUnmarshalOptions(opts *UnmarshalOptions) UnmarshalOptions {
+	var resolved UnmarshalOptions
+	if opts != nil {
+		resolved = *opts
+	}
+	resolved.MaxDepth = decodeLimit(resolved.MaxDepth, defaultMaxDecodeDepth)
+	resolved.MaxAttributes = decodeLimit(resolved.MaxAttributes, defaultMaxAttributes)
+	resolved.MaxAttributeLength = decodeLimit(resolved.MaxAttributeLength, defaultMaxAttributeLength)
+	resolved.MaxCharacters = decodeLimit(resolved.MaxCharacters, defaultMaxCharacters)
+	resolved.MaxEntityExpansions = decodeLimit(resolved.MaxEntityExpansions, defaultMaxEntityExpansions)
+	return resolved
+}
+
+func decodeLimit(value, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	if value < 0 {
+		return 0
+	}
+	return value
+}
@@ -0,0 +1,178 @@
+package go_xml
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type DiffKind int
+
+const (
+	DiffAdded DiffKind = iota
+	DiffRemoved
+	DiffChanged
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	default:
+		return "changed"
+	}
+}
+
+type Difference struct {
+	Kind     DiffKind
+	Path     string
+	Expected string
+	Actual   string
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("added %s: %q", d.Path, d.Actual)
+	case DiffRemoved:
+		return fmt.Sprintf("removed %s: %q", d.Path, d.Expected)
+	default:
+		return fmt.Sprintf("changed %s: %q != %q", d.Path, d.Expected, d.Actual)
+	}
+}
+
+type DiffOptions struct {
+	IgnoreAttributes []string
+	IgnoreElements   []string
+}
+
+func Diff(a, b []byte, opts *DiffOptions) ([]Difference, error) {
+	if opts == nil {
+		opts = &DiffOptions{}
+	}
+
+	expected, err := Parse(a)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing expected document: %w", err)
+	}
+	defer releaseNode(expected)
+
+	actual, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing actual document: %w", err)
+	}
+	defer releaseNode(actual)
+
+	d := &differ{opts: opts}
+	path := "/" + expected.Name
+	if expected.Name != actual.Name {
+		d.add(DiffChanged, "/", expected.Name, actual.Name)
+		return d.diffs, nil
+	}
+	d.compare(path, expected, actual)
+	return d.diffs, nil
+}
+
+type differ struct {
+	opts  *DiffOptions
+	diffs []Difference
+}
+
+func (d *differ) add(kind DiffKind, path, expected, actual string) {
+	d.diffs = append(d.diffs, Difference{Kind: kind, Path: path, Expected: expected, Actual: actual})
+}
+
+func (d *differ) compare(path string, expected, actual *ElementNode) {
+	d.compareAttributes(path, expected, actual)
+
+	if expectedText, actualText := directText(expected), directText(actual); expectedText != actualText {
+		d.add(DiffChanged, path+"/text()", expectedText, actualText)
+	}
+
+	expectedChildren := d.groupChildren(expected)
+	actualChildren := d.groupChildren(actual)
+
+	for _, name := range mergedKeys(expectedChildren, actualChildren) {
+		left, right := expectedChildren[name], actualChildren[name]
+		for i := 0; i < len(left) || i < len(right); i++ {
+			childPath := path + "/" + name + "[" + strconv.Itoa(i+1) + "]"
+			switch {
+			case i >= len(right):
+				d.add(DiffRemoved, childPath, left[i].Text(), "")
+			case i >= len(left):
+				d.add(DiffAdded, childPath, "", right[i].Text())
+			default:
+				d.compare(childPath, left[i], right[i])
+			}
+		}
+	}
+}
+
+func (d *differ) compareAttributes(path string, expected, actual *ElementNode) {
+	left := d.attributeMap(expected)
+	right := d.attributeMap(actual)
+
+	for _, name := range mergedKeys(left, right) {
+		expectedValue, inExpected := left[name]
+		actualValue, inActual := right[name]
+		attrPath := path + "/@" + name
+		switch {
+		case !inActual:
+			d.add(DiffRemoved, attrPath, expectedValue, "")
+		case !inExpected:
+			d.add(DiffAdded, attrPath, "", actualValue)
+		case expectedValue != actualValue:
+			d.add(DiffChanged, attrPath, expectedValue, actualValue)
+		}
+	}
+}
+
+func (d *differ) attributeMap(node *ElementNode) map[string]string {
+	attrs := make(map[string]string, len(node.Attributes))
+	for _, attr := range node.Attributes {
+		if !contains(d.opts.IgnoreAttributes, attr.Name) {
+			attrs[attr.Name] = attr.Value
+		}
+	}
+	return attrs
+}
+
+func (d *differ) groupChildren(node *ElementNode) map[string][]*ElementNode {
+	groups := map[string][]*ElementNode{}
+	for _, child := range node.ChildElements() {
+		if !contains(d.opts.IgnoreElements, child.Name) {
+			groups[child.Name] = append(groups[child.Name], child)
+		}
+	}
+	return groups
+}
+
+func directText(node *ElementNode) string {
+	var sb strings.Builder
+	for _, child := range node.Children {
+		switch c := child.(type) {
+		case *TextNode:
+			sb.WriteString(c.Text)
+		case *CDataNode:
+			sb.WriteString(c.Text)
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func mergedKeys[V any](a, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,25 @@
+package go_xml
+
+import (
+	"crypto"
+	"fmt"
+)
+
+func Digest(v interface{}, opts *MarshalOptions, hash crypto.Hash) ([]byte, error) {
+	if !hash.Available() {
+		return nil, fmt.Errorf("hash function %v is not available", hash)
+	}
+
+	var digestOpts MarshalOptions
+	if opts != nil {
+		digestOpts = *opts
+	}
+	digestOpts.Deterministic = true
+	digestOpts.Compress = false
+
+	h := hash.New()
+	if err := encodeBuffered(h, v, &digestOpts); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,73 @@
+package go_xml
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+type DocumentOptions struct {
+	Delimiter string
+
+	Marshal *MarshalOptions
+}
+
+type DocumentWriter struct {
+	w       io.Writer
+	opts    DocumentOptions
+	scratch bytes.Buffer
+	count   int
+	closed  bool
+	err     error
+}
+
+func NewDocumentWriter(w io.Writer, opts *DocumentOptions) *DocumentWriter {
+	d := &DocumentWriter{w: w}
+	if opts != nil {
+		d.opts = *opts
+	}
+	if d.opts.Marshal == nil {
+		d.opts.Marshal = &MarshalOptions{}
+	}
+	return d
+}
+
+func (d *DocumentWriter) Count() int {
+	return d.count
+}
+
+func (d *DocumentWriter) Encode(v interface{}) error {
+	return d.EncodeContext(context.Background(), v)
+}
+
+func (d *DocumentWriter) EncodeContext(ctx context.Context, v interface{}) error {
+	if d.closed {
+		return ErrWriterClosed
+	}
+	if d.err != nil {
+		return d.err
+	}
+
+	d.scratch.Reset()
+	if d.count > 0 {
+		d.scratch.WriteString(d.opts.Delimiter)
+	}
+	if err := encodeDocument(ctx, &d.scratch, v, d.opts.Marshal); err != nil {
+		return err
+	}
+	if _, err := d.w.Write(d.scratch.Bytes()); err != nil {
+		d.err = err
+		return err
+	}
+	d.count++
+	return nil
+}
+
+func (d *DocumentWriter) Close() error {
+	if d.closed {
+		return ErrWriterClosed
+	}
+	d.closed = true
+	d.scratch = bytes.Buffer{}
+	return d.err
+}
@@ -0,0 +1,424 @@
+package go_xml
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var predefinedEntities = map[string]string{
+	"lt":   "<",
+	"gt":   ">",
+	"amp":  "&",
+	"apos": "'",
+	"quot": "\"",
+}
+
+type EntityResolver interface {
+	ResolveEntity(name, publicID, systemID string) (string, error)
+}
+
+type EntityResolverFunc func(name, publicID, systemID string) (string, error)
+
+func (f EntityResolverFunc) ResolveEntity(name, publicID, systemID string) (string, error) {
+	return f(name, publicID, systemID)
+}
+
+type externalID struct {
+	publicID string
+	systemID string
+}
+
+type entityDecl struct {
+	name     string
+	value    string
+	external *externalID
+}
+
+func parseDocType(directive []byte) ([]entityDecl, *externalID, error) {
+	if !bytes.HasPrefix(directive, []byte("DOCTYPE")) {
+		return nil, nil, nil
+	}
+	header := directive[len("DOCTYPE"):]
+	start := skipQuoted(header, 0, '[')
+	if start < 0 {
+		start = len(header)
+	}
+
+	var dtd *externalID
+	if fields := strings.Fields(string(header[:start])); len(fields) > 1 {
+		id, _, ok := parseExternalID(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(header[:start])), fields[0])))
+		if !ok {
+			return nil, nil, fmt.Errorf("malformed external identifier in DOCTYPE")
+		}
+		dtd = id
+	}
+	if start == len(header) {
+		return nil, dtd, nil
+	}
+	decls, err := parseEntityDecls(string(header[start+1:]))
+	return decls, dtd, err
+}
+
+func parseEntityDecls(subset string) ([]entityDecl, error) {
+	var decls []entityDecl
+	for i := 0; i < len(subset); {
+		rest := subset[i:]
+		switch {
+		case rest[0] == ']':
+			return decls, nil
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest, "-->")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment in DOCTYPE")
+			}
+			i += end + 3
+		case strings.HasPrefix(rest, "<?"):
+			end := strings.Index(rest, "?>")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated processing instruction in DOCTYPE")
+			}
+			i += end + 2
+		case strings.HasPrefix(rest, "<!"):
+			end := skipQuoted([]byte(rest), 0, '>')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated declaration in DOCTYPE")
+			}
+			if strings.HasPrefix(rest, "<!ENTITY") {
+				decl, ok, err := parseEntityDecl(rest[len("<!ENTITY"):end])
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					decls = append(decls, decl)
+				}
+			}
+			i += end + 1
+		default:
+			i++
+		}
+	}
+	return decls, nil
+}
+
+func parseEntityDecl(decl string) (entityDecl, bool, error) {
+	fields := strings.Fields(decl)
+	if len(fields) < 2 || fields[0] == "%" {
+		return entityDecl{}, false, nil
+	}
+	name := fields[0]
+	if !isValidName(name) {
+		return entityDecl{}, false, &InvalidNameError{Name: name}
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(decl), name))
+	if id, _, ok := parseExternalID(rest); ok {
+		return entityDecl{name: name, external: id}, true, nil
+	}
+	value, _, ok := quotedLiteral(rest)
+	if !ok {
+		return entityDecl{}, false, fmt.Errorf("malformed value for entity %q", name)
+	}
+	return entityDecl{name: name, value: value}, true, nil
+}
+
+func parseExternalID(s string) (*externalID, string, bool) {
+	switch {
+	case strings.HasPrefix(s, "SYSTEM"):
+		systemID, rest, ok := quotedLiteral(strings.TrimSpace(s[len("SYSTEM"):]))
+		if !ok {
+			return nil, "", false
+		}
+		return &externalID{systemID: systemID}, rest, true
+	case strings.HasPrefix(s, "PUBLIC"):
+		publicID, rest, ok := quotedLiteral(strings.TrimSpace(s[len("PUBLIC"):]))
+		if !ok {
+			return nil, "", false
+		}
+		systemID, rest, ok := quotedLiteral(strings.TrimSpace(rest))
+		if !ok {
+			return nil, "", false
+		}
+		return &externalID{publicID: publicID, systemID: systemID}, rest, true
+	}
+	return nil, "", false
+}
+
+func quotedLiteral(s string) (string, string, bool) {
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		return "", "", false
+	}
+	end := strings.IndexByte(s[1:], s[0])
+	if end < 0 {
+		return "", "", false
+	}
+	return s[1 : end+1], s[end+2:], true
+}
+
+func skipQuoted(data []byte, from int, target byte) int {
+	var quote byte
+	for i := from; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == target:
+			return i
+		}
+	}
+	return -1
+}
+
+type entityExpander struct {
+	decls         map[string]entityDecl
+	resolved      map[string]string
+	resolver      EntityResolver
+	active        map[string]bool
+	expansions    int
+	maxExpansions int
+	counted       int
+	maxChars      int
+}
+
+func (p *parser) declareEntities(directive []byte) error {
+	decls, dtd, err := parseDocType(directive)
+	if err != nil {
+		return err
+	}
+	if dtd != nil && p.opts.EntityResolver != nil {
+		text, err := p.opts.EntityResolver.ResolveEntity("", dtd.publicID, dtd.systemID)
+		if err != nil {
+			return fmt.Errorf("error resolving DTD %q: %w", dtd.systemID, err)
+		}
+		external, err := parseEntityDecls(text)
+		if err != nil {
+			return err
+		}
+		decls = append(decls, external...)
+	}
+	if len(decls) == 0 {
+		return nil
+	}
+	if p.entities != nil {
+		return fmt.Errorf("multiple DOCTYPE declarations")
+	}
+
+	x := &entityExpander{
+		decls:         make(map[string]entityDecl, len(decls)),
+		resolved:      make(map[string]string),
+		resolver:      p.opts.EntityResolver,
+		active:        make(map[string]bool),
+		maxExpansions: p.opts.MaxEntityExpansions,
+		maxChars:      p.opts.MaxCharacters,
+	}
+	for _, decl := range decls {
+		if _, ok := x.decls[decl.name]; !ok {
+			x.decls[decl.name] = decl
+		}
+	}
+	for name, decl := range x.decls {
+		if _, err := x.replacementText(decl); err != nil {
+			return fmt.Errorf("entity %q: %w", name, err)
+		}
+	}
+
+	if p.decoder.Entity == nil {
+		p.decoder.Entity = make(map[string]string, len(x.decls))
+	}
+	for name := range x.decls {
+		p.decoder.Entity[name] = ""
+	}
+	p.entities = x
+	return nil
+}
+
+func (p *parser) expandEntities(decoded string, raw string) (string, error) {
+	x := p.entities
+	if x == nil || !strings.Contains(raw, "&") {
+		return decoded, p.countChars(len(decoded))
+	}
+
+	x.counted = p.chars
+	var b strings.Builder
+	for i := 0; i < len(raw); {
+		switch c := raw[i]; c {
+		case '&':
+			end := strings.IndexByte(raw[i:], ';')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated entity reference")
+			}
+			ref := raw[i+1 : i+end]
+			i += end + 1
+			if value, ok := predefinedEntities[ref]; ok {
+				b.WriteString(value)
+				break
+			}
+			if strings.HasPrefix(ref, "#") {
+				r, err := charReference(ref)
+				if err != nil {
+					return "", err
+				}
+				b.WriteRune(r)
+				break
+			}
+			if _, ok := x.decls[ref]; !ok {
+				return "", fmt.Errorf("undefined entity %q", ref)
+			}
+			if err := x.reference(ref, &b); err != nil {
+				return "", err
+			}
+		case '\r':
+			b.WriteByte('\n')
+			i++
+			if i < len(raw) && raw[i] == '\n' {
+				i++
+			}
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), p.countChars(b.Len())
+}
+
+func rawAttributeValues(tag string) []string {
+	var values []string
+	for i := 0; i < len(tag); {
+		eq := strings.IndexByte(tag[i:], '=')
+		if eq < 0 {
+			break
+		}
+		i += eq + 1
+		for i < len(tag) && strings.IndexByte(" \t\r\n", tag[i]) >= 0 {
+			i++
+		}
+		if i == len(tag) {
+			break
+		}
+		end := strings.IndexByte(tag[i+1:], tag[i])
+		if end < 0 {
+			break
+		}
+		values = append(values, tag[i+1:i+1+end])
+		i += end + 2
+	}
+	return values
+}
+
+func (x *entityExpander) reference(name string, b *strings.Builder) error {
+	x.expansions++
+	if exceedsLimit(x.expansions, x.maxExpansions) {
+		return &LimitError{Limit: "MaxEntityExpansions", Max: x.maxExpansions}
+	}
+	return x.expand(name, b)
+}
+
+func (x *entityExpander) replacementText(decl entityDecl) (string, error) {
+	if decl.external == nil {
+		return resolveCharRefs(decl.value)
+	}
+	if x.resolver == nil {
+		return "", nil
+	}
+	if text, ok := x.resolved[decl.name]; ok {
+		return text, nil
+	}
+	text, err := x.resolver.ResolveEntity(decl.name, decl.external.publicID, decl.external.systemID)
+	if err != nil {
+		return "", fmt.Errorf("error resolving %q: %w", decl.external.systemID, err)
+	}
+	x.resolved[decl.name] = text
+	return text, nil
+}
+
+func (x *entityExpander) expand(name string, b *strings.Builder) error {
+	if x.active[name] {
+		return fmt.Errorf("entity %q references itself", name)
+	}
+	x.active[name] = true
+	defer delete(x.active, name)
+
+	text, err := x.replacementText(x.decls[name])
+	if err != nil {
+		return fmt.Errorf("entity %q: %w", name, err)
+	}
+	for i := 0; i < len(text); {
+		switch c := text[i]; c {
+		case '<':
+			return fmt.Errorf("entity %q must not contain markup", name)
+		case '&':
+			end := strings.IndexByte(text[i:], ';')
+			if end < 0 {
+				return fmt.Errorf("entity %q has an unterminated reference", name)
+			}
+			ref := text[i+1 : i+end]
+			i += end + 1
+			if value, ok := predefinedEntities[ref]; ok {
+				b.WriteString(value)
+				break
+			}
+			if strings.HasPrefix(ref, "#") {
+				r, err := charReference(ref)
+				if err != nil {
+					return fmt.Errorf("entity %q: %w", name, err)
+				}
+				b.WriteRune(r)
+				break
+			}
+			if _, ok := x.decls[ref]; !ok {
+				return fmt.Errorf("entity %q references undefined entity %q", name, ref)
+			}
+			if err := x.reference(ref, b); err != nil {
+				return err
+			}
+		default:
+			b.WriteByte(c)
+			i++
+		}
+		if exceedsLimit(x.counted+b.Len(), x.maxChars) {
+			return &LimitError{Limit: "MaxCharacters", Max: x.maxChars}
+		}
+	}
+	return nil
+}
+
+func resolveCharRefs(literal string) (string, error) {
+	if !strings.Contains(literal, "&#") {
+		return literal, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(literal, "&#")
+		if i < 0 {
+			b.WriteString(literal)
+			return b.String(), nil
+		}
+		end := strings.IndexByte(literal[i:], ';')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated character reference")
+		}
+		r, err := charReference(literal[i+1 : i+end])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(literal[:i])
+		b.WriteRune(r)
+		literal = literal[i+end+1:]
+	}
+}
+
+func charReference(ref string) (rune, error) {
+	digits, base := ref[1:], 10
+	if strings.HasPrefix(digits, "x") {
+		digits, base = digits[1:], 16
+	}
+	n, err := strconv.ParseUint(digits, base, 32)
+	if err != nil || !isLegalChar(rune(n)) {
+		return 0, fmt.Errorf("invalid character reference &%s;", ref)
+	}
+	return rune(n), nil
+}
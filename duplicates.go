@@ -0,0 +1,67 @@
+package go_xml
+
+type DuplicateAttributePolicy int
+
+const (
+	DuplicateAttributesError DuplicateAttributePolicy = iota
+	DuplicateAttributesLastWins
+)
+
+func (m *marshaler) namespaceAttributes(attrs []Attribute) ([]Attribute, error) {
+	for _, attr := range attrs {
+		if attr.Name != "xmlns" {
+			continue
+		}
+		if attr.Value != m.opts.Namespace && m.opts.DuplicateAttributes == DuplicateAttributesError {
+			return attrs, &DuplicateAttributeError{Name: attr.Name, Path: m.fieldPath("")}
+		}
+		return attrs, nil
+	}
+	return insertAttributeAtBeginning(attrs, Attribute{
+		Name:  "xmlns",
+		Value: m.opts.Namespace,
+	}), nil
+}
+
+func (m *marshaler) uniqueAttributes(attrs []Attribute) ([]Attribute, error) {
+	attrs, duplicate := dedupeAttributes(attrs, m.opts.DuplicateAttributes)
+	if duplicate != "" {
+		return attrs, &DuplicateAttributeError{Name: duplicate, Path: m.fieldPath("")}
+	}
+	return attrs, nil
+}
+
+func dedupeAttributes(attrs []Attribute, policy DuplicateAttributePolicy) ([]Attribute, string) {
+	for i := 1; i < len(attrs); i++ {
+		for j := 0; j < i; j++ {
+			if attrs[j].Name != attrs[i].Name {
+				continue
+			}
+			if policy == DuplicateAttributesError {
+				return attrs, attrs[i].Name
+			}
+			attrs[j].Value = attrs[i].Value
+			attrs = append(attrs[:i], attrs[i+1:]...)
+			i--
+			break
+		}
+	}
+	return attrs, ""
+}
+
+func uniqueNodeAttributes(node *ElementNode, policy DuplicateAttributePolicy, path string) error {
+	path += "/" + node.Name
+	attrs, duplicate := dedupeAttributes(node.Attributes, policy)
+	node.Attributes = attrs
+	if duplicate != "" {
+		return &DuplicateAttributeError{Name: duplicate, Path: path}
+	}
+	for _, child := range node.Children {
+		if element, ok := child.(*ElementNode); ok {
+			if err := uniqueNodeAttributes(element, policy, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,109 +1,534 @@
 package go_xml
 
 import (
+	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 )
 
+const sharedIndentLevels = 32
+
+var indentCaches sync.Map
+
 type Encoder struct {
-	w               io.Writer
-	selfClosing     map[string]bool
-	indent          string
-	depth           int
-	spacedSelfClose bool
+	w                io.Writer
+	sw               io.StringWriter
+	selfClosing      map[string]bool
+	selfClosingPaths [][]string
+	indent           string
+	indentCache      string
+	depth            int
+	spacedSelfClose  bool
+	stack            []openElement
+	scratch          []byte
+	invalidChars     InvalidCharPolicy
+	mode             OutputMode
+	encodedToken     bool
+	newline          string
+	compareAttrs     func(a, b Attribute) int
+	sortedAttrs      []Attribute
+	wrapAttrs        int
+	collapseEmpty    bool
+	escaper          Escaper
+	normalize        bool
+	docType          []Entity
+	encodable        func(rune) bool
+}
+
+type EmptyElementStyle int
+
+const (
+	EmptyElementsExpanded EmptyElementStyle = iota
+	EmptyElementsCollapsed
+	EmptyElementsSpaced
+)
+
+type openElement struct {
+	name        string
+	pending     bool
+	selfClose   bool
+	lastElement bool
+	void        bool
+	rawText     bool
+	preserve    bool
 }
 
 func NewEncoder(w io.Writer, selfClosingTags []string, indent string, spacedSelfClose bool) *Encoder {
 	selfClosing := make(map[string]bool)
+	var selfClosingPaths [][]string
 	for _, tag := range selfClosingTags {
+		if strings.Contains(tag, ">") {
+			selfClosingPaths = append(selfClosingPaths, strings.Split(tag, ">"))
+			continue
+		}
 		selfClosing[tag] = true
 	}
+	sw, _ := w.(io.StringWriter)
 	return &Encoder{
-		w:               w,
-		selfClosing:     selfClosing,
-		indent:          indent,
-		depth:           0,
-		spacedSelfClose: spacedSelfClose,
+		w:                w,
+		sw:               sw,
+		selfClosing:      selfClosing,
+		selfClosingPaths: selfClosingPaths,
+		indent:           indent,
+		indentCache:      sharedIndentation(indent),
+		depth:            0,
+		spacedSelfClose:  spacedSelfClose,
+		newline:          "\n",
+	}
+}
+
+func (e *Encoder) Reset(w io.Writer) {
+	e.w = w
+	e.sw, _ = w.(io.StringWriter)
+	e.depth = 0
+	clear(e.stack)
+	e.stack = e.stack[:0]
+	e.encodedToken = false
+	e.docType = nil
+}
+
+func (e *Encoder) writeString(s string) error {
+	if e.sw != nil {
+		_, err := e.sw.WriteString(s)
+		return err
+	}
+	e.scratch = append(e.scratch[:0], s...)
+	_, err := e.w.Write(e.scratch)
+	return err
+}
+
+func (e *Encoder) writeEscaped(s string) error {
+	if e.invalidChars != InvalidCharsKeep {
+		return e.writeSanitized(s)
+	}
+	return e.writeEscapedValid(s)
+}
+
+func (e *Encoder) writeEscapedValid(s string) error {
+	if e.escaper != nil {
+		e.scratch = e.escaper.AppendEscaped(e.scratch[:0], s)
+		_, err := e.w.Write(e.scratch)
+		return err
+	}
+	for {
+		i := strings.IndexAny(s, escapedChars)
+		if i < 0 {
+			return e.writeString(s)
+		}
+		if err := e.writeString(s[:i]); err != nil {
+			return err
+		}
+		if err := e.writeString(escapeEntity(s[i])); err != nil {
+			return err
+		}
+		s = s[i+1:]
+	}
+}
+
+func sharedIndentation(indent string) string {
+	if indent == "" {
+		return ""
+	}
+	if cached, ok := indentCaches.Load(indent); ok {
+		return cached.(string)
+	}
+	cached, _ := indentCaches.LoadOrStore(indent, strings.Repeat(indent, sharedIndentLevels))
+	return cached.(string)
+}
+
+func (e *Encoder) indentation(depth int) string {
+	size := depth * len(e.indent)
+	if size > len(e.indentCache) {
+		levels := 2 * depth
+		if levels < 8 {
+			levels = 8
+		}
+		e.indentCache = strings.Repeat(e.indent, levels)
 	}
+	return e.indentCache[:size]
 }
 
 func (e *Encoder) writeIndent() error {
 	if e.indent != "" {
-		_, err := e.w.Write([]byte(strings.Repeat(e.indent, e.depth)))
-		return err
+		return e.writeString(e.indentation(e.depth))
 	}
 	return nil
 }
 
-func (e *Encoder) VisitElement(node *ElementNode) error {
+func (e *Encoder) current() *openElement {
+	if len(e.stack) == 0 {
+		return nil
+	}
+	return &e.stack[len(e.stack)-1]
+}
+
+func (e *Encoder) closeStartTag(open *openElement) error {
+	if !open.pending {
+		return nil
+	}
+	open.pending = false
+	return e.writeString(">")
+}
+
+func (e *Encoder) startMarkup() error {
+	if parent := e.current(); parent != nil {
+		if err := e.checkVoidContent(parent); err != nil {
+			return err
+		}
+		if err := e.closeStartTag(parent); err != nil {
+			return err
+		}
+		parent.lastElement = true
+		if parent.preserve {
+			return nil
+		}
+	}
+
 	if e.depth > 0 {
-		if _, err := e.w.Write([]byte("\n")); err != nil {
+		if err := e.writeString(e.newline); err != nil {
+			return err
+		}
+	}
+	return e.writeIndent()
+}
+
+func (e *Encoder) startElement(name string, attrs []Attribute) error {
+	if e.mode == ModeXHTML {
+		name = strings.ToLower(name)
+		attrs = xhtmlAttributes(attrs, len(e.stack) == 0)
+	}
+	if e.docType != nil && len(e.stack) == 0 {
+		entities := e.docType
+		e.docType = nil
+		if err := e.writeDocType(name, entities); err != nil {
 			return err
 		}
 	}
-	if err := e.writeIndent(); err != nil {
+	if err := e.startMarkup(); err != nil {
 		return err
 	}
+	attrs = e.orderAttributes(attrs)
 
-	if _, err := e.w.Write([]byte("<" + node.Name)); err != nil {
+	if err := e.writeString("<"); err != nil {
+		return err
+	}
+	if err := e.writeString(name); err != nil {
 		return err
 	}
 
-	for _, attr := range node.Attributes {
-		if _, err := e.w.Write([]byte(" " + attr.Name + "=\"" + escapeString(attr.Value) + "\"")); err != nil {
+	wrap := e.wrapAttrs > 0 && e.indent != "" && len(attrs) > e.wrapAttrs
+	for _, attr := range attrs {
+		if wrap {
+			if err := e.writeString(e.newline); err != nil {
+				return err
+			}
+			if err := e.writeString(e.indentation(e.depth + 1)); err != nil {
+				return err
+			}
+		} else if err := e.writeString(" "); err != nil {
+			return err
+		}
+		if err := e.writeAttribute(attr); err != nil {
 			return err
 		}
 	}
 
-	shouldSelfClose := node.SelfClose || (e.selfClosing[node.Name] && !hasNonEmptyChildren(node))
+	if e.mode == ModeHTML {
+		e.stack = append(e.stack, e.htmlElement(name))
+	} else {
+		e.stack = append(e.stack, openElement{
+			name:      name,
+			pending:   true,
+			selfClose: e.collapseEmpty || e.selfClosing[name] || e.matchesSelfClosingPath(name),
+		})
+	}
+	e.current().preserve = preservesSpace(attrs, len(e.stack) > 1 && e.stack[len(e.stack)-2].preserve)
+	e.depth++
+	return nil
+}
 
-	closing := "/>"
-	if e.spacedSelfClose {
-		closing = " />"
+func (e *Encoder) writeAttribute(attr Attribute) error {
+	if err := e.writeString(attr.Name); err != nil {
+		return err
 	}
+	if err := e.writeString("=\""); err != nil {
+		return err
+	}
+	attr.Value = e.normalized(attr.Value)
+	var err error
+	if attr.Unescaped {
+		err = e.writeString(attr.Value)
+	} else {
+		err = e.writeEscaped(attr.Value)
+	}
+	if err != nil {
+		return err
+	}
+	return e.writeString("\"")
+}
 
-	if shouldSelfClose {
-		if _, err := e.w.Write([]byte(closing)); err != nil {
-			return err
-		}
-		releaseElementNode(node)
+func (e *Encoder) writeText(text string) error {
+	return e.writeContent(text, true)
+}
+
+func (e *Encoder) writeUnescaped(text string) error {
+	return e.writeContent(text, false)
+}
+
+func (e *Encoder) normalized(text string) string {
+	if !e.normalize {
+		return text
+	}
+	return norm.NFC.String(text)
+}
+
+func (e *Encoder) writeContent(text string, escape bool) error {
+	text = e.normalized(text)
+	open := e.current()
+	if open == nil && !escape {
+		return e.writeString(text)
+	}
+	if open == nil {
+		return e.writeEscaped(text)
+	}
+
+	open.lastElement = false
+	if text == "" {
 		return nil
 	}
+	if err := e.checkVoidContent(open); err != nil {
+		return err
+	}
+	if err := e.closeStartTag(open); err != nil {
+		return err
+	}
+	if open.rawText {
+		return e.writeRawText(open, text)
+	}
+	if !escape {
+		return e.writeString(text)
+	}
+	return e.writeEscaped(text)
+}
 
-	if _, err := e.w.Write([]byte(">")); err != nil {
+func (e *Encoder) writeComment(text string) error {
+	if strings.Contains(text, "--") || strings.HasSuffix(text, "-") {
+		return fmt.Errorf("comment %q must not contain \"--\" or end with \"-\"", text)
+	}
+	if err := e.startMarkup(); err != nil {
+		return err
+	}
+	if err := e.writeString("<!--"); err != nil {
+		return err
+	}
+	if err := e.writeString(text); err != nil {
 		return err
 	}
+	return e.writeString("-->")
+}
 
-	e.depth++
-	for _, child := range node.Children {
-		if err := child.Accept(e); err != nil {
+func (e *Encoder) writeCData(text string) error {
+	if e.mode == ModeHTML {
+		return e.writeText(text)
+	}
+	if open := e.current(); open != nil {
+		open.lastElement = false
+		if err := e.closeStartTag(open); err != nil {
+			return err
+		}
+	}
+	if err := e.writeString("<![CDATA["); err != nil {
+		return err
+	}
+	text = e.normalized(text)
+	for {
+		i := strings.Index(text, "]]>")
+		if i < 0 {
+			break
+		}
+		if err := e.writeCDataText(text[:i+2]); err != nil {
+			return err
+		}
+		if err := e.writeString("]]><![CDATA["); err != nil {
 			return err
 		}
+		text = text[i+2:]
+	}
+	if err := e.writeCDataText(text); err != nil {
+		return err
+	}
+	return e.writeString("]]>")
+}
+
+func (e *Encoder) writeCDataText(text string) error {
+	if e.encodable == nil {
+		return e.writeString(text)
+	}
+	start := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if e.encodable(r) {
+			i += size
+			continue
+		}
+		if err := e.writeString(text[start:i]); err != nil {
+			return err
+		}
+		if err := e.writeString("]]>&#" + strconv.Itoa(int(r)) + ";<![CDATA["); err != nil {
+			return err
+		}
+		i += size
+		start = i
+	}
+	return e.writeString(text[start:])
+}
+
+func (e *Encoder) writeProcInst(target, data string) error {
+	if !isValidName(target) || strings.EqualFold(target, "xml") {
+		return &InvalidNameError{Name: target}
+	}
+	if strings.Contains(data, "?>") {
+		return fmt.Errorf("processing instruction %q must not contain \"?>\"", target)
+	}
+	if err := e.startMarkup(); err != nil {
+		return err
+	}
+	if err := e.writeString("<?"); err != nil {
+		return err
+	}
+	if err := e.writeString(target); err != nil {
+		return err
+	}
+	if data != "" {
+		if err := e.writeString(" "); err != nil {
+			return err
+		}
+		if err := e.writeString(data); err != nil {
+			return err
+		}
+	}
+	return e.writeString("?>")
+}
+
+func (e *Encoder) writeRaw(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if err := e.startMarkup(); err != nil {
+		return err
+	}
+	return e.writeString(raw)
+}
+
+func (e *Encoder) matchesSelfClosingPath(name string) bool {
+	for _, path := range e.selfClosingPaths {
+		last := len(path) - 1
+		if path[last] != name || last > len(e.stack) {
+			continue
+		}
+		matched := true
+		for i := 0; i < last; i++ {
+			if e.stack[len(e.stack)-last+i].name != path[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Encoder) selfClose() {
+	if e.mode != ModeHTML {
+		e.current().selfClose = true
 	}
+}
+
+func (e *Encoder) endElement() error {
+	open := e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
 	e.depth--
 
-	if len(node.Children) > 0 {
-		if _, isElement := node.Children[len(node.Children)-1].(*ElementNode); isElement {
-			if _, err := e.w.Write([]byte("\n")); err != nil {
+	if open.pending {
+		if open.void {
+			return e.writeString(">")
+		}
+		if open.selfClose {
+			if e.spacedSelfClose {
+				return e.writeString(" />")
+			}
+			return e.writeString("/>")
+		}
+		if err := e.writeString("></"); err != nil {
+			return err
+		}
+	} else {
+		if open.lastElement && !open.preserve {
+			if err := e.writeString(e.newline); err != nil {
 				return err
 			}
 			if err := e.writeIndent(); err != nil {
 				return err
 			}
 		}
+		if err := e.writeString("</"); err != nil {
+			return err
+		}
 	}
 
-	if _, err := e.w.Write([]byte("</" + node.Name + ">")); err != nil {
+	if err := e.writeString(open.name); err != nil {
 		return err
 	}
-	releaseElementNode(node)
-	return nil
+	return e.writeString(">")
 }
 
-func (e *Encoder) VisitText(node *TextNode) error {
-	if _, err := e.w.Write([]byte(escapeString(node.Text))); err != nil {
+func (e *Encoder) VisitElement(node *ElementNode) error {
+	if err := e.startElement(node.Name, node.Attributes); err != nil {
+		releaseNode(node)
 		return err
 	}
+
+	if node.SelfClose {
+		e.selfClose()
+	}
+	for i, child := range node.Children {
+		if err := child.Accept(e); err != nil {
+			releaseNodes(node.Children[i+1:])
+			releaseElementNode(node)
+			return err
+		}
+	}
+
+	err := e.endElement()
+	releaseElementNode(node)
+	return err
+}
+
+func (e *Encoder) VisitText(node *TextNode) error {
+	err := e.writeContent(node.Text, !node.Unescaped)
 	releaseTextNode(node)
-	return nil
+	return err
+}
+
+func (e *Encoder) VisitComment(node *CommentNode) error {
+	return e.writeComment(node.Text)
+}
+
+func (e *Encoder) VisitCData(node *CDataNode) error {
+	return e.writeCData(node.Text)
+}
+
+func (e *Encoder) VisitProcessingInstruction(node *ProcessingInstructionNode) error {
+	return e.writeProcInst(node.Target, node.Data)
+}
+
+func (e *Encoder) VisitRaw(node *RawNode) error {
+	return e.writeRaw(node.XML)
 }
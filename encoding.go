@@ -0,0 +1,81 @@
+package go_xml
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+var outputEncodings = map[string]encoding.Encoding{
+	"ISO-8859-1":   charmap.ISO8859_1,
+	"ISO-8859-15":  charmap.ISO8859_15,
+	"WINDOWS-1252": charmap.Windows1252,
+	"UTF-16":       unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	"UTF-16BE":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"UTF-16LE":     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+}
+
+func isUTF8(name string) bool {
+	return name == "" || strings.EqualFold(name, "UTF-8")
+}
+
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	enc, ok := outputEncodings[strings.ToUpper(name)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported output encoding %q", name)
+	}
+	return enc, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func encodingWriter(w io.Writer, opts *MarshalOptions) (io.Writer, io.Closer, error) {
+	if isUTF8(opts.Encoding) {
+		return w, nopCloser{}, nil
+	}
+	enc, err := lookupEncoding(opts.Encoding)
+	if err != nil {
+		return nil, nil, err
+	}
+	tw := transform.NewWriter(w, encoding.HTMLEscapeUnsupported(enc.NewEncoder()))
+	return tw, tw, nil
+}
+
+func transcoder(name string, continuation bool) (func([]byte) ([]byte, error), error) {
+	if isUTF8(name) {
+		return nil, nil
+	}
+	enc, err := lookupEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+	if continuation && strings.EqualFold(name, "UTF-16") {
+		enc = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	}
+	return encoding.HTMLEscapeUnsupported(enc.NewEncoder()).Bytes, nil
+}
+
+func encodableRune(name string) func(rune) bool {
+	if isUTF8(name) {
+		return nil
+	}
+	enc, err := lookupEncoding(name)
+	if err != nil {
+		return nil
+	}
+	cm, ok := enc.(*charmap.Charmap)
+	if !ok {
+		return nil
+	}
+	return func(r rune) bool {
+		_, ok := cm.EncodeRune(r)
+		return ok
+	}
+}
@@ -0,0 +1,114 @@
+package go_xml
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Entity struct {
+	Name  string
+	Value string
+}
+
+type entityEscaper struct {
+	entities []Entity
+	base     Escaper
+}
+
+func checkEntities(entities []Entity) error {
+	seen := make(map[string]bool, len(entities))
+	for _, entity := range entities {
+		if !isValidName(entity.Name) || strings.Contains(entity.Name, ":") {
+			return &InvalidNameError{Name: entity.Name}
+		}
+		if entity.Value == "" {
+			return fmt.Errorf("entity %q must have a value", entity.Name)
+		}
+		if seen[entity.Name] {
+			return fmt.Errorf("entity %q is declared twice", entity.Name)
+		}
+		seen[entity.Name] = true
+	}
+	return nil
+}
+
+func newEntityEscaper(entities []Entity, base Escaper) Escaper {
+	if base == nil {
+		base = EntityEscaper
+	}
+	sorted := append([]Entity(nil), entities...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Value) > len(sorted[j].Value)
+	})
+	return &entityEscaper{entities: sorted, base: base}
+}
+
+func (e *entityEscaper) AppendEscaped(dst []byte, s string) []byte {
+	for {
+		index, match := -1, Entity{}
+		for _, entity := range e.entities {
+			if i := strings.Index(s, entity.Value); i >= 0 && (index < 0 || i < index) {
+				index, match = i, entity
+			}
+		}
+		if index < 0 {
+			return e.base.AppendEscaped(dst, s)
+		}
+		dst = e.base.AppendEscaped(dst, s[:index])
+		dst = append(dst, '&')
+		dst = append(dst, match.Name...)
+		dst = append(dst, ';')
+		s = s[index+len(match.Value):]
+	}
+}
+
+func entityValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '&':
+			b.WriteString("&#38;#38;")
+		case '<':
+			b.WriteString("&#38;#60;")
+		case '"':
+			b.WriteString("&#34;")
+		case '%':
+			b.WriteString("&#37;")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func (e *Encoder) deferDocType(entities []Entity) {
+	e.docType = entities
+}
+
+func (e *Encoder) writeDocType(root string, entities []Entity) error {
+	if len(entities) == 0 || e.mode == ModeHTML {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE ")
+	b.WriteString(root)
+	b.WriteString(" [")
+	for _, entity := range entities {
+		if e.indent != "" {
+			b.WriteString(e.newline)
+			b.WriteString(e.indent)
+		}
+		b.WriteString("<!ENTITY ")
+		b.WriteString(entity.Name)
+		b.WriteString(` "`)
+		b.WriteString(entityValue(entity.Value))
+		b.WriteString(`">`)
+	}
+	if e.indent != "" {
+		b.WriteString(e.newline)
+	}
+	b.WriteString("]>")
+	return e.writePrologLine(b.String())
+}
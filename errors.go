@@ -0,0 +1,184 @@
+package go_xml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	ErrNilNode            = errors.New("returned node is null")
+	ErrInvalidName        = errors.New("invalid XML name")
+	ErrReservedName       = errors.New("reserved XML name")
+	ErrInvalidChar        = errors.New("invalid XML character")
+	ErrUnsupportedKind    = errors.New("unsupported kind")
+	ErrWriterClosed       = errors.New("writer is closed")
+	ErrLimitExceeded      = errors.New("limit exceeded")
+	ErrDuplicateAttribute = errors.New("duplicate attribute")
+	ErrValidation         = errors.New("validation failed")
+	ErrResultReleased     = errors.New("result has been released")
+	ErrDecode             = errors.New("decode error")
+	ErrUnknownElement     = errors.New("unknown element")
+	ErrUnknownAttribute   = errors.New("unknown attribute")
+)
+
+type InvalidNameError struct {
+	Name string
+	Path string
+}
+
+func (e *InvalidNameError) Error() string {
+	return withPath(fmt.Sprintf("%v %q", ErrInvalidName, e.Name), e.Path)
+}
+
+func (e *InvalidNameError) Is(target error) bool {
+	return target == ErrInvalidName
+}
+
+type DuplicateAttributeError struct {
+	Name string
+	Path string
+}
+
+func (e *DuplicateAttributeError) Error() string {
+	return withPath(fmt.Sprintf("%v %q", ErrDuplicateAttribute, e.Name), e.Path)
+}
+
+func (e *DuplicateAttributeError) Is(target error) bool {
+	return target == ErrDuplicateAttribute
+}
+
+type ValidationError struct {
+	Constraint string
+	Detail     string
+	Path       string
+}
+
+func (e *ValidationError) Error() string {
+	return withPath(fmt.Sprintf("%v: %s: %s", ErrValidation, e.Constraint, e.Detail), e.Path)
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+type LimitError struct {
+	Limit string
+	Max   int
+	Path  string
+}
+
+func (e *LimitError) Error() string {
+	return withPath(fmt.Sprintf("%v: %s of %d", ErrLimitExceeded, e.Limit, e.Max), e.Path)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+type ReservedNameError struct {
+	Name string
+	Path string
+}
+
+func (e *ReservedNameError) Error() string {
+	return withPath(fmt.Sprintf("%v %q", ErrReservedName, e.Name), e.Path)
+}
+
+func (e *ReservedNameError) Is(target error) bool {
+	return target == ErrReservedName || target == ErrInvalidName
+}
+
+type InvalidCharError struct {
+	Char rune
+	Path string
+}
+
+func (e *InvalidCharError) Error() string {
+	return withPath(fmt.Sprintf("%v %U", ErrInvalidChar, e.Char), e.Path)
+}
+
+func (e *InvalidCharError) Is(target error) bool {
+	return target == ErrInvalidChar
+}
+
+type UnsupportedKindError struct {
+	Kind reflect.Kind
+	Path string
+}
+
+func (e *UnsupportedKindError) Error() string {
+	return withPath(fmt.Sprintf("%v %s", ErrUnsupportedKind, e.Kind), e.Path)
+}
+
+func (e *UnsupportedKindError) Is(target error) bool {
+	return target == ErrUnsupportedKind
+}
+
+type UnknownElementError struct {
+	Name string
+	Path string
+}
+
+func (e *UnknownElementError) Error() string {
+	return withPath(fmt.Sprintf("%v %q", ErrUnknownElement, e.Name), e.Path)
+}
+
+func (e *UnknownElementError) Is(target error) bool {
+	return target == ErrUnknownElement
+}
+
+type UnknownAttributeError struct {
+	Name string
+	Path string
+}
+
+func (e *UnknownAttributeError) Error() string {
+	return withPath(fmt.Sprintf("%v %q", ErrUnknownAttribute, e.Name), e.Path)
+}
+
+func (e *UnknownAttributeError) Is(target error) bool {
+	return target == ErrUnknownAttribute
+}
+
+type DecodeError struct {
+	Line   int
+	Column int
+	Offset int64
+	Path   string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	msg := ErrDecode.Error()
+	if e.Path != "" {
+		msg += " in " + e.Path
+	}
+	if e.Line > 0 {
+		msg += fmt.Sprintf(" at line %d, column %d (offset %d)", e.Line, e.Column, e.Offset)
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrDecode
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func withPath(msg, path string) string {
+	if path == "" {
+		return msg
+	}
+	return msg + " at " + path
+}
+
+func (m *marshaler) annotate(err error, field string) error {
+	var charErr *InvalidCharError
+	if errors.As(err, &charErr) && charErr.Path == "" {
+		charErr.Path = m.fieldPath(field)
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package go_xml
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Escaper interface {
+	AppendEscaped(dst []byte, s string) []byte
+}
+
+type EscaperFunc func(dst []byte, s string) []byte
+
+func (f EscaperFunc) AppendEscaped(dst []byte, s string) []byte {
+	return f(dst, s)
+}
+
+var (
+	EntityEscaper  Escaper = EscaperFunc(AppendEscaped)
+	NumericEscaper Escaper = EscaperFunc(AppendNumericEscaped)
+)
+
+func AppendEscaped(dst []byte, s string) []byte {
+	for {
+		i := strings.IndexAny(s, escapedChars)
+		if i < 0 {
+			return append(dst, s...)
+		}
+		dst = append(dst, s[:i]...)
+		dst = append(dst, escapeEntity(s[i])...)
+		s = s[i+1:]
+	}
+}
+
+func AppendNumericEscaped(dst []byte, s string) []byte {
+	for {
+		i := strings.IndexAny(s, escapedChars)
+		if i < 0 {
+			return append(dst, s...)
+		}
+		dst = append(dst, s[:i]...)
+		dst = appendCharReference(dst, rune(s[i]))
+		s = s[i+1:]
+	}
+}
+
+func appendCharReference(dst []byte, r rune) []byte {
+	dst = strconv.AppendInt(append(dst, "&#x"...), int64(r), 16)
+	return append(dst, ';')
+}
+
+type EscapeOptions struct {
+	NumericChars string
+	ASCIIOnly    bool
+}
+
+const (
+	escapeNone byte = iota
+	escapeNamed
+	escapeNumeric
+)
+
+type configuredEscaper struct {
+	ascii     [utf8.RuneSelf]byte
+	numeric   map[rune]bool
+	asciiOnly bool
+}
+
+func NewEscaper(opts EscapeOptions) Escaper {
+	e := &configuredEscaper{asciiOnly: opts.ASCIIOnly}
+	for i := 0; i < len(escapedChars); i++ {
+		e.ascii[escapedChars[i]] = escapeNamed
+	}
+	for _, r := range opts.NumericChars {
+		if r < utf8.RuneSelf {
+			e.ascii[r] = escapeNumeric
+			continue
+		}
+		if e.numeric == nil {
+			e.numeric = make(map[rune]bool)
+		}
+		e.numeric[r] = true
+	}
+	return e
+}
+
+func (e *configuredEscaper) AppendEscaped(dst []byte, s string) []byte {
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			mode := e.ascii[b]
+			if mode == escapeNone {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			if mode == escapeNumeric {
+				dst = appendCharReference(dst, rune(b))
+			} else {
+				dst = append(dst, escapeEntity(b)...)
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !e.asciiOnly && !e.numeric[r] {
+			i += size
+			continue
+		}
+		dst = append(dst, s[start:i]...)
+		dst = appendCharReference(dst, r)
+		i += size
+		start = i
+	}
+	return append(dst, s[start:]...)
+}
+
+func (m *marshaler) writeValueText(currentTag, text string) error {
+	text = m.redact(currentTag, text)
+	if m.leaf.noescape && m.leaf.tag == currentTag {
+		return m.out.writeUnescaped(text)
+	}
+	return m.out.writeText(text)
+}
@@ -0,0 +1,130 @@
+package go_xml
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+func (m *marshaler) includeField(field reflect.StructField) bool {
+	opts := m.opts
+	if len(opts.Groups) > 0 && !inGroups(field, opts.Groups) {
+		return false
+	}
+	if opts.SchemaVersion != "" && !inVersion(field, opts.SchemaVersion) {
+		return false
+	}
+	if opts.FieldFilter == nil && len(opts.Include) == 0 && len(opts.Exclude) == 0 {
+		return true
+	}
+
+	path := m.filterPath(field.Name)
+	for _, excluded := range opts.Exclude {
+		if path == excluded {
+			return false
+		}
+	}
+	if len(opts.Include) > 0 && !matchesInclude(path, opts.Include) {
+		return false
+	}
+	if opts.FieldFilter != nil {
+		return opts.FieldFilter(path, field)
+	}
+	return true
+}
+
+func matchesInclude(path string, include []string) bool {
+	for _, included := range include {
+		switch {
+		case path == included:
+			return true
+		case strings.HasPrefix(included, path+"."):
+			return true
+		case strings.HasPrefix(path, included+"."):
+			return true
+		}
+	}
+	return false
+}
+
+func (m *marshaler) filterPath(field string) string {
+	var sb strings.Builder
+	if len(m.path) > 1 {
+		for _, segment := range m.path[1:] {
+			if strings.HasPrefix(segment, "[") {
+				continue
+			}
+			if sb.Len() > 0 {
+				sb.WriteByte('.')
+			}
+			sb.WriteString(segment)
+		}
+	}
+	if field != "" {
+		if sb.Len() > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(field)
+	}
+	return sb.String()
+}
+
+func inGroups(field reflect.StructField, groups []string) bool {
+	tag, ok := field.Tag.Lookup("groups")
+	if !ok {
+		return true
+	}
+	for tag != "" {
+		var group string
+		group, tag, _ = strings.Cut(tag, ",")
+		for _, requested := range groups {
+			if strings.TrimSpace(group) == requested {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *marshaler) redact(currentTag, value string) string {
+	if m.leaf.redactPath == "" || m.leaf.tag != currentTag {
+		return value
+	}
+	return m.opts.Redactor(m.leaf.redactPath, value)
+}
+
+func inVersion(field reflect.StructField, version string) bool {
+	if since, ok := field.Tag.Lookup("since"); ok && compareVersions(version, since) < 0 {
+		return false
+	}
+	if until, ok := field.Tag.Lookup("until"); ok && compareVersions(version, until) >= 0 {
+		return false
+	}
+	return true
+}
+
+func compareVersions(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aPart, bPart := "0", "0"
+		if i < len(aParts) {
+			aPart = aParts[i]
+		}
+		if i < len(bParts) {
+			bPart = bParts[i]
+		}
+		aNum, aErr := strconv.Atoi(aPart)
+		bNum, bErr := strconv.Atoi(bPart)
+		switch {
+		case aErr == nil && bErr == nil && aNum != bNum:
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		case (aErr != nil || bErr != nil) && aPart != bPart:
+			return strings.Compare(aPart, bPart)
+		}
+	}
+	return 0
+}
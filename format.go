@@ -0,0 +1,73 @@
+package go_xml
+
+import "strings"
+
+func Format(src []byte, opts *MarshalOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &MarshalOptions{}
+	}
+
+	root, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	trimWhitespace(root, false)
+	return encodeNodeDocument(root, opts)
+}
+
+func encodeNodeDocument(root *ElementNode, opts *MarshalOptions) ([]byte, error) {
+	if err := uniqueNodeAttributes(root, opts.DuplicateAttributes, ""); err != nil {
+		releaseNode(root)
+		return nil, err
+	}
+	buf := acquireBuffer()
+	defer releaseBuffer(buf)
+
+	w, closer, err := encodingWriter(limitOutput(buf, opts), opts)
+	if err != nil {
+		releaseNode(root)
+		return nil, err
+	}
+	encoder := newDocumentEncoder(w, opts)
+	if err := encoder.writeProlog(opts); err != nil {
+		releaseNode(root)
+		return nil, err
+	}
+	encoder.deferDocType(opts.Entities)
+	if err := root.Accept(encoder); err != nil {
+		return nil, err
+	}
+	if err := closer.Close(); err != nil {
+		return nil, err
+	}
+
+	if shouldCompress(opts, buf.Len()) {
+		return compressBuffer(nil, buf, opts)
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+func trimWhitespace(node *ElementNode, inherited bool) {
+	preserve := preservesSpace(node.Attributes, inherited)
+	hasElements := false
+	for _, child := range node.Children {
+		if element, ok := child.(*ElementNode); ok {
+			hasElements = true
+			trimWhitespace(element, preserve)
+		}
+	}
+	if !hasElements || preserve {
+		return
+	}
+
+	children := node.Children[:0]
+	for _, child := range node.Children {
+		if text, ok := child.(*TextNode); ok && strings.TrimSpace(text.Text) == "" {
+			releaseTextNode(text)
+			continue
+		}
+		children = append(children, child)
+	}
+	clear(node.Children[len(children):])
+	node.Children = children
+}
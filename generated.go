@@ -0,0 +1,43 @@
+package go_xml
+
+import (
+	"io"
+	"reflect"
+)
+
+type GoXMLMarshaler interface {
+	MarshalGoXML(w io.Writer, opts *MarshalOptions) error
+}
+
+var goXMLMarshalerType = reflect.TypeOf((*GoXMLMarshaler)(nil)).Elem()
+
+func generatedMarshaler(val reflect.Value, plan *typePlan, opts *MarshalOptions) (GoXMLMarshaler, bool) {
+	if !plan.generated || !generatedEligible(opts) {
+		return nil, false
+	}
+	return val.Interface().(GoXMLMarshaler), true
+}
+
+func encodeGenerated(w io.Writer, generated GoXMLMarshaler, opts *MarshalOptions) error {
+	if err := newDocumentEncoder(w, opts).writeProlog(opts); err != nil {
+		return err
+	}
+	return generated.MarshalGoXML(w, opts)
+}
+
+func generatedEligible(opts *MarshalOptions) bool {
+	plain := *opts
+	plain.XMLHeader = false
+	plain.Declaration = nil
+	plain.ProcessingInstructions = nil
+	plain.HeaderComments = nil
+	plain.Encoding = ""
+	plain.Compress = false
+	plain.CompressionAlgorithm = ""
+	plain.CompressionLevel = 0
+	plain.CompressMinSize = 0
+	plain.MaxBytes = 0
+	plain.Parallelism = 0
+	plain.ParallelThreshold = 0
+	return reflect.DeepEqual(plain, MarshalOptions{})
+}
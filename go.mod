@@ -1,3 +1,5 @@
 module github.com/lrnxzz/go-xml/v2
 
 go 1.23.1
+
+require golang.org/x/text v0.21.0
@@ -0,0 +1,453 @@
+package goxmlgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const annotation = "goxml:generate"
+
+type Options struct {
+	Types []string
+}
+
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindStruct
+)
+
+var builtinKinds = map[string]valueKind{
+	"string":  kindString,
+	"bool":    kindBool,
+	"byte":    kindUint,
+	"rune":    kindInt,
+	"int":     kindInt,
+	"int8":    kindInt,
+	"int16":   kindInt,
+	"int32":   kindInt,
+	"int64":   kindInt,
+	"uint":    kindUint,
+	"uint8":   kindUint,
+	"uint16":  kindUint,
+	"uint32":  kindUint,
+	"uint64":  kindUint,
+	"uintptr": kindUint,
+	"float32": kindFloat,
+	"float64": kindFloat,
+}
+
+var supportedOptions = map[string]bool{
+	"attr":      true,
+	"omitempty": true,
+	"omitnil":   true,
+	"noescape":  true,
+	"required":  true,
+	"redact":    true,
+}
+
+var unsupportedTags = []string{"enum", "min", "max", "pattern"}
+
+type field struct {
+	name      string
+	tags      []string
+	kind      valueKind
+	slice     bool
+	attr      bool
+	omitEmpty bool
+	omitNil   bool
+	noescape  bool
+}
+
+func (f field) conditional() bool {
+	return (f.slice && f.omitNil) || (f.omitEmpty && f.kind != kindStruct)
+}
+
+type structType struct {
+	name   string
+	fields []field
+}
+
+type generator struct {
+	targets       map[string]bool
+	structs       []*structType
+	buf           bytes.Buffer
+	trackChildren bool
+}
+
+func Generate(src []byte, opts *Options) ([]byte, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("goxmlgen: %w", err)
+	}
+
+	specs := make(map[string]*ast.StructType)
+	var order []string
+	g := &generator{targets: make(map[string]bool)}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			st, ok := typeSpec.Type.(*ast.StructType)
+			if !ok || typeSpec.TypeParams != nil {
+				continue
+			}
+			name := typeSpec.Name.Name
+			specs[name] = st
+			order = append(order, name)
+			if len(opts.Types) == 0 && (annotated(gen.Doc) || annotated(typeSpec.Doc)) {
+				g.targets[name] = true
+			}
+		}
+	}
+	for _, name := range opts.Types {
+		if specs[name] == nil {
+			return nil, fmt.Errorf("goxmlgen: struct type %s not found", name)
+		}
+		g.targets[name] = true
+	}
+	if len(g.targets) == 0 {
+		return nil, fmt.Errorf("goxmlgen: no struct types to generate")
+	}
+
+	for _, name := range order {
+		if !g.targets[name] {
+			continue
+		}
+		st, err := g.structFor(name, specs[name])
+		if err != nil {
+			return nil, err
+		}
+		g.structs = append(g.structs, st)
+	}
+	return g.render(file.Name.Name)
+}
+
+func annotated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, comment := range doc.List {
+		if strings.TrimSpace(strings.TrimPrefix(comment.Text, "//")) == annotation {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) structFor(name string, st *ast.StructType) (*structType, error) {
+	result := &structType{name: name}
+	for _, astField := range st.Fields.List {
+		if len(astField.Names) == 0 {
+			return nil, fmt.Errorf("goxmlgen: %s: embedded fields are not supported", name)
+		}
+
+		var tag reflect.StructTag
+		if astField.Tag != nil {
+			unquoted, err := strconv.Unquote(astField.Tag.Value)
+			if err != nil {
+				return nil, fmt.Errorf("goxmlgen: %s: %w", name, err)
+			}
+			tag = reflect.StructTag(unquoted)
+		}
+
+		for _, ident := range astField.Names {
+			f, skip, err := g.fieldFor(ident.Name, astField.Type, tag)
+			if err != nil {
+				return nil, fmt.Errorf("goxmlgen: %s.%s: %w", name, ident.Name, err)
+			}
+			if !skip {
+				result.fields = append(result.fields, f)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (g *generator) fieldFor(name string, expr ast.Expr, tag reflect.StructTag) (field, bool, error) {
+	xmlTag := tag.Get("xml")
+	if xmlTag == "-" {
+		return field{}, true, nil
+	}
+	for _, key := range unsupportedTags {
+		if _, ok := tag.Lookup(key); ok {
+			return field{}, false, fmt.Errorf("%s constraints are not supported", key)
+		}
+	}
+
+	parts := strings.Split(xmlTag, ",")
+	tagName := parts[0]
+	if tagName == "" {
+		tagName = name
+	}
+	if uri, _, ok := strings.Cut(tagName, " "); ok && strings.Contains(uri, ":") {
+		return field{}, false, fmt.Errorf("namespaced tag %q is not supported", tagName)
+	}
+
+	f := field{name: name, tags: strings.Split(tagName, ">")}
+	for _, option := range parts[1:] {
+		if !supportedOptions[option] {
+			return field{}, false, fmt.Errorf("tag option %q is not supported", option)
+		}
+		switch option {
+		case "attr":
+			f.attr = true
+		case "omitempty":
+			f.omitEmpty = true
+		case "omitnil":
+			f.omitNil = true
+		case "noescape":
+			f.noescape = true
+		}
+	}
+
+	if array, ok := expr.(*ast.ArrayType); ok {
+		if array.Len != nil {
+			return field{}, false, fmt.Errorf("arrays are not supported")
+		}
+		f.slice = true
+		expr = array.Elt
+	}
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return field{}, false, fmt.Errorf("type %s is not supported", exprString(expr))
+	}
+	switch kind, builtin := builtinKinds[ident.Name]; {
+	case builtin:
+		if f.slice && (ident.Name == "byte" || ident.Name == "uint8") {
+			return field{}, false, fmt.Errorf("byte slices are not supported")
+		}
+		f.kind = kind
+	case g.targets[ident.Name]:
+		f.kind = kindStruct
+	default:
+		return field{}, false, fmt.Errorf("type %s is not supported", ident.Name)
+	}
+
+	if f.attr && (f.slice || f.kind == kindStruct || len(f.tags) > 1) {
+		return field{}, false, fmt.Errorf("attribute must be a simple value")
+	}
+	return f, false, nil
+}
+
+func exprString(expr ast.Expr) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), expr); err != nil {
+		return fmt.Sprintf("%T", expr)
+	}
+	return buf.String()
+}
+
+func (g *generator) render(pkg string) ([]byte, error) {
+	g.buf.WriteString("// Code generated by goxmlgen. DO NOT EDIT.\n\n")
+	g.buf.WriteString("package " + pkg + "\n\n")
+	g.buf.WriteString("import (\n\t\"io\"\n")
+	if g.needsStrconv() {
+		g.buf.WriteString("\t\"strconv\"\n")
+	}
+	g.buf.WriteString("\n\tgo_xml \"github.com/lrnxzz/go-xml/v2\"\n)\n")
+
+	for _, st := range g.structs {
+		g.renderStruct(st)
+	}
+
+	formatted, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("goxmlgen: formatting generated code: %w", err)
+	}
+	return formatted, nil
+}
+
+func (g *generator) needsStrconv() bool {
+	for _, st := range g.structs {
+		for _, f := range st.fields {
+			if f.kind != kindString && f.kind != kindStruct {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (g *generator) line(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+	g.buf.WriteByte('\n')
+}
+
+func (g *generator) literal(s string) {
+	if len(s) == 1 {
+		g.line("dst = append(dst, %s)", strconv.QuoteRune(rune(s[0])))
+		return
+	}
+	g.line("dst = append(dst, %s...)", strconv.Quote(s))
+}
+
+func (g *generator) renderStruct(st *structType) {
+	hasElements, alwaysChildren := false, false
+	for _, f := range st.fields {
+		if f.attr {
+			continue
+		}
+		hasElements = true
+		if !f.conditional() && (!f.slice || len(f.tags) > 1) {
+			alwaysChildren = true
+		}
+	}
+	g.trackChildren = hasElements && !alwaysChildren
+
+	g.line("\nfunc (v %s) MarshalGoXML(w io.Writer, opts *go_xml.MarshalOptions) error {", st.name)
+	g.line("_, err := w.Write(v.AppendGoXML(nil, %q))", st.name)
+	g.line("return err")
+	g.line("}")
+
+	g.line("\nfunc (v %s) AppendGoXML(dst []byte, name string) []byte {", st.name)
+	g.literal("<")
+	g.line("dst = append(dst, name...)")
+	for _, f := range st.fields {
+		if f.attr {
+			g.renderAttribute(f)
+		}
+	}
+	g.literal(">")
+	if g.trackChildren {
+		g.line("children := false")
+	}
+	for _, f := range st.fields {
+		if !f.attr {
+			g.renderElement(f)
+		}
+	}
+	switch {
+	case g.trackChildren:
+		g.line("if children {")
+		g.literal("\n")
+		g.line("}")
+		g.literal("</")
+	case alwaysChildren:
+		g.literal("\n</")
+	default:
+		g.literal("</")
+	}
+	g.line("dst = append(dst, name...)")
+	g.line("return append(dst, '>')")
+	g.line("}")
+}
+
+func (g *generator) renderAttribute(f field) {
+	if f.omitEmpty {
+		g.line("if %s {", nonEmpty("v."+f.name, f))
+	}
+	g.literal(" " + f.tags[0] + "=\"")
+	g.appendValue("v."+f.name, f)
+	g.literal("\"")
+	if f.omitEmpty {
+		g.line("}")
+	}
+}
+
+func (g *generator) renderElement(f field) {
+	value := "v." + f.name
+	switch {
+	case f.slice && f.omitNil:
+		g.line("if %s != nil {", value)
+	case f.conditional():
+		g.line("if %s {", nonEmpty(value, f))
+	}
+
+	wrappers, leaf := f.tags[:len(f.tags)-1], f.tags[len(f.tags)-1]
+	if g.trackChildren && (len(wrappers) > 0 || !f.slice) {
+		g.line("children = true")
+	}
+	for _, wrapper := range wrappers {
+		g.literal("\n<" + wrapper + ">")
+	}
+
+	if f.slice {
+		g.line("for _, item := range %s {", value)
+		if g.trackChildren && len(wrappers) == 0 {
+			g.line("children = true")
+		}
+		g.renderLeaf("item", leaf, f)
+		g.line("}")
+	} else {
+		g.renderLeaf(value, leaf, f)
+	}
+
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		if i == len(wrappers)-1 && f.slice && !(f.omitEmpty && !f.omitNil) {
+			g.line("if len(%s) != 0 {", value)
+			g.literal("\n")
+			g.line("}")
+			g.literal("</" + wrappers[i] + ">")
+			continue
+		}
+		g.literal("\n</" + wrappers[i] + ">")
+	}
+
+	if f.conditional() {
+		g.line("}")
+	}
+}
+
+func (g *generator) renderLeaf(value, tag string, f field) {
+	if f.kind == kindStruct {
+		g.literal("\n")
+		g.line("dst = %s.AppendGoXML(dst, %q)", value, tag)
+		return
+	}
+	g.literal("\n<" + tag + ">")
+	g.appendValue(value, f)
+	g.literal("</" + tag + ">")
+}
+
+func (g *generator) appendValue(value string, f field) {
+	switch f.kind {
+	case kindString:
+		if f.noescape {
+			g.line("dst = append(dst, %s...)", value)
+			return
+		}
+		g.line("dst = go_xml.AppendEscaped(dst, %s)", value)
+	case kindBool:
+		g.line("dst = strconv.AppendBool(dst, %s)", value)
+	case kindInt:
+		g.line("dst = strconv.AppendInt(dst, int64(%s), 10)", value)
+	case kindUint:
+		g.line("dst = strconv.AppendUint(dst, uint64(%s), 10)", value)
+	case kindFloat:
+		g.line("dst = strconv.AppendFloat(dst, float64(%s), 'f', 2, 64)", value)
+	}
+}
+
+func nonEmpty(value string, f field) string {
+	if f.slice {
+		return "len(" + value + ") != 0"
+	}
+	switch f.kind {
+	case kindString:
+		return value + ` != ""`
+	case kindBool:
+		return value
+	default:
+		return value + " != 0"
+	}
+}
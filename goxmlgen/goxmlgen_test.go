@@ -0,0 +1,165 @@
+package goxmlgen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	src := `package shop
+
+//goxml:generate
+type Item struct {
+	SKU   string   ` + "`" + `xml:"sku,attr"` + "`" + `
+	Price float64  ` + "`" + `xml:"price"` + "`" + `
+	Tags  []string ` + "`" + `xml:"tags>tag,omitempty"` + "`" + `
+	Blurb string   ` + "`" + `xml:"blurb,noescape"` + "`" + `
+}
+
+type Ignored struct {
+	Value int
+}
+`
+
+	expected := `// Code generated by goxmlgen. DO NOT EDIT.
+
+package shop
+
+import (
+	"io"
+	"strconv"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+func (v Item) MarshalGoXML(w io.Writer, opts *go_xml.MarshalOptions) error {
+	_, err := w.Write(v.AppendGoXML(nil, "Item"))
+	return err
+}
+
+func (v Item) AppendGoXML(dst []byte, name string) []byte {
+	dst = append(dst, '<')
+	dst = append(dst, name...)
+	dst = append(dst, " sku=\""...)
+	dst = go_xml.AppendEscaped(dst, v.SKU)
+	dst = append(dst, '"')
+	dst = append(dst, '>')
+	dst = append(dst, "\n<price>"...)
+	dst = strconv.AppendFloat(dst, float64(v.Price), 'f', 2, 64)
+	dst = append(dst, "</price>"...)
+	if len(v.Tags) != 0 {
+		dst = append(dst, "\n<tags>"...)
+		for _, item := range v.Tags {
+			dst = append(dst, "\n<tag>"...)
+			dst = go_xml.AppendEscaped(dst, item)
+			dst = append(dst, "</tag>"...)
+		}
+		dst = append(dst, "\n</tags>"...)
+	}
+	dst = append(dst, "\n<blurb>"...)
+	dst = append(dst, v.Blurb...)
+	dst = append(dst, "</blurb>"...)
+	dst = append(dst, "\n</"...)
+	dst = append(dst, name...)
+	return append(dst, '>')
+}
+`
+
+	tests := []struct {
+		name string
+		opts *Options
+	}{
+		{name: "Annotated types", opts: nil},
+		{name: "Explicit types", opts: &Options{Types: []string{"Item"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generated, err := Generate([]byte(src), tt.opts)
+			if err != nil {
+				t.Fatalf("Generate error: %v", err)
+			}
+			if string(generated) != expected {
+				t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", expected, generated)
+			}
+		})
+	}
+}
+
+func TestGenerateConditionalChildren(t *testing.T) {
+	src := `package shop
+
+//goxml:generate
+type Note struct {
+	Text  string   ` + "`" + `xml:"text,omitempty"` + "`" + `
+	Lines []string ` + "`" + `xml:"line"` + "`" + `
+}
+`
+	generated, err := Generate([]byte(src), nil)
+	if err != nil {
+		t.Fatalf("Generate error: %v", err)
+	}
+	for _, want := range []string{"children := false", "children = true", "if children {"} {
+		if !strings.Contains(string(generated), want) {
+			t.Errorf("Expected generated code to contain %q, got:\n%s", want, generated)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		opts    *Options
+		message string
+	}{
+		{
+			name:    "No annotated types",
+			src:     "package p\n\ntype T struct{ A int }\n",
+			message: "no struct types",
+		},
+		{
+			name:    "Missing explicit type",
+			src:     "package p\n\ntype T struct{ A int }\n",
+			opts:    &Options{Types: []string{"U"}},
+			message: "struct type U not found",
+		},
+		{
+			name:    "Pointer field",
+			src:     "package p\n\n//goxml:generate\ntype T struct{ A *int }\n",
+			message: "type *int is not supported",
+		},
+		{
+			name:    "Unknown named type",
+			src:     "package p\n\n//goxml:generate\ntype T struct{ A Other }\n\ntype Other struct{}\n",
+			message: "type Other is not supported",
+		},
+		{
+			name:    "Embedded field",
+			src:     "package p\n\ntype Base struct{}\n\n//goxml:generate\ntype T struct{ Base }\n",
+			message: "embedded fields",
+		},
+		{
+			name:    "Unsupported option",
+			src:     "package p\n\n//goxml:generate\ntype T struct{ A string `xml:\"a,selfclose\"` }\n",
+			message: `tag option "selfclose"`,
+		},
+		{
+			name:    "Constraint tag",
+			src:     "package p\n\n//goxml:generate\ntype T struct{ A string `xml:\"a\" enum:\"x|y\"` }\n",
+			message: "enum constraints",
+		},
+		{
+			name:    "Byte slice",
+			src:     "package p\n\n//goxml:generate\ntype T struct{ A []byte }\n",
+			message: "byte slices",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Generate([]byte(tt.src), tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("Expected error containing %q, got %v", tt.message, err)
+			}
+		})
+	}
+}
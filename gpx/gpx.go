@@ -0,0 +1,206 @@
+package gpx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+const (
+	Namespace      = "http://www.topografix.com/GPX/1/1"
+	SchemaLocation = "http://www.topografix.com/GPX/1/1 http://www.topografix.com/GPX/1/1/gpx.xsd"
+	xsiNamespace   = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+var ErrInvalidCoordinate = errors.New("gpx: coordinate out of range")
+
+type Document struct {
+	Creator     string
+	Name        string
+	Description string
+	Author      string
+	Time        time.Time
+	Waypoints   []Point
+	Tracks      []Track
+}
+
+type Track struct {
+	Name        string
+	Description string
+	Type        string
+	Segments    []Segment
+}
+
+type Segment struct {
+	Points []Point
+}
+
+type Point struct {
+	Lat         float64
+	Lon         float64
+	Elevation   *float64
+	Time        time.Time
+	Name        string
+	Description string
+	Symbol      string
+}
+
+func New(creator string) *Document {
+	return &Document{Creator: creator}
+}
+
+func Elevation(meters float64) *float64 {
+	return &meters
+}
+
+func (d *Document) AddWaypoint(p Point) *Document {
+	d.Waypoints = append(d.Waypoints, p)
+	return d
+}
+
+func (d *Document) AddTrack(t Track) *Document {
+	d.Tracks = append(d.Tracks, t)
+	return d
+}
+
+type gpxXML struct {
+	Version        string       `xml:"version,attr"`
+	Creator        string       `xml:"creator,attr"`
+	Namespace      string       `xml:"xmlns,attr"`
+	XSINamespace   string       `xml:"xmlns:xsi,attr"`
+	SchemaLocation string       `xml:"xsi:schemaLocation,attr"`
+	Metadata       *metadataXML `xml:"metadata,omitempty"`
+	Waypoints      []pointXML   `xml:"wpt,omitempty"`
+	Tracks         []trackXML   `xml:"trk,omitempty"`
+}
+
+type metadataXML struct {
+	Name        string     `xml:"name,omitempty"`
+	Description string     `xml:"desc,omitempty"`
+	Author      *authorXML `xml:"author,omitempty"`
+	Time        string     `xml:"time,omitempty"`
+}
+
+type authorXML struct {
+	Name string `xml:"name"`
+}
+
+type trackXML struct {
+	Name        string       `xml:"name,omitempty"`
+	Description string       `xml:"desc,omitempty"`
+	Type        string       `xml:"type,omitempty"`
+	Segments    []segmentXML `xml:"trkseg"`
+}
+
+type segmentXML struct {
+	Points []pointXML `xml:"trkpt"`
+}
+
+type pointXML struct {
+	Lat         string `xml:"lat,attr"`
+	Lon         string `xml:"lon,attr"`
+	Elevation   string `xml:"ele,omitempty"`
+	Time        string `xml:"time,omitempty"`
+	Name        string `xml:"name,omitempty"`
+	Description string `xml:"desc,omitempty"`
+	Symbol      string `xml:"sym,omitempty"`
+}
+
+func (d *Document) Marshal(opts *go_xml.MarshalOptions) ([]byte, error) {
+	doc, err := d.toXML()
+	if err != nil {
+		return nil, err
+	}
+
+	marshalOpts := go_xml.MarshalOptions{XMLHeader: true, Indent: "  "}
+	if opts != nil {
+		marshalOpts = *opts
+	}
+	marshalOpts.RootTag = "gpx"
+	marshalOpts.Namespace = ""
+	return go_xml.Marshal(doc, &marshalOpts)
+}
+
+func (d *Document) toXML() (*gpxXML, error) {
+	doc := &gpxXML{
+		Version:        "1.1",
+		Creator:        d.Creator,
+		Namespace:      Namespace,
+		XSINamespace:   xsiNamespace,
+		SchemaLocation: SchemaLocation,
+	}
+	if doc.Creator == "" {
+		doc.Creator = "go-xml"
+	}
+	if d.Name != "" || d.Description != "" || d.Author != "" || !d.Time.IsZero() {
+		doc.Metadata = &metadataXML{Name: d.Name, Description: d.Description, Time: formatTime(d.Time)}
+		if d.Author != "" {
+			doc.Metadata.Author = &authorXML{Name: d.Author}
+		}
+	}
+
+	for i, wpt := range d.Waypoints {
+		point, err := pointToXML(wpt)
+		if err != nil {
+			return nil, fmt.Errorf("%w (waypoint %d)", err, i)
+		}
+		doc.Waypoints = append(doc.Waypoints, point)
+	}
+
+	for i, trk := range d.Tracks {
+		track := trackXML{Name: trk.Name, Description: trk.Description, Type: trk.Type}
+		for j, seg := range trk.Segments {
+			segment := segmentXML{}
+			for k, pt := range seg.Points {
+				point, err := pointToXML(pt)
+				if err != nil {
+					return nil, fmt.Errorf("%w (track %d, segment %d, point %d)", err, i, j, k)
+				}
+				segment.Points = append(segment.Points, point)
+			}
+			track.Segments = append(track.Segments, segment)
+		}
+		doc.Tracks = append(doc.Tracks, track)
+	}
+	return doc, nil
+}
+
+func pointToXML(p Point) (pointXML, error) {
+	if math.IsNaN(p.Lat) || p.Lat < -90 || p.Lat > 90 {
+		return pointXML{}, fmt.Errorf("%w: latitude %v", ErrInvalidCoordinate, p.Lat)
+	}
+	if math.IsNaN(p.Lon) || p.Lon < -180 || p.Lon >= 180 {
+		return pointXML{}, fmt.Errorf("%w: longitude %v", ErrInvalidCoordinate, p.Lon)
+	}
+
+	point := pointXML{
+		Lat:         formatDecimal(p.Lat),
+		Lon:         formatDecimal(p.Lon),
+		Time:        formatTime(p.Time),
+		Name:        p.Name,
+		Description: p.Description,
+		Symbol:      p.Symbol,
+	}
+	if p.Elevation != nil {
+		if math.IsNaN(*p.Elevation) || math.IsInf(*p.Elevation, 0) {
+			return pointXML{}, fmt.Errorf("%w: elevation %v", ErrInvalidCoordinate, *p.Elevation)
+		}
+		point.Elevation = formatDecimal(*p.Elevation)
+	}
+	return point, nil
+}
+
+func formatDecimal(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
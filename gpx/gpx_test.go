@@ -0,0 +1,71 @@
+package gpx
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMarshal(t *testing.T) {
+	start := time.Date(2024, 5, 4, 8, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	doc := New("tracker").
+		AddWaypoint(Point{Lat: 46.5, Lon: 7.25, Name: "Summit", Symbol: "Flag"}).
+		AddTrack(Track{
+			Name: "Morning hike",
+			Segments: []Segment{{Points: []Point{
+				{Lat: 46.123456789, Lon: 0.0000001, Elevation: Elevation(1520.5), Time: start},
+				{Lat: -12, Lon: -179.5},
+			}}},
+		})
+	doc.Name = "Alps"
+
+	output, err := doc.Marshal(nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="tracker" xmlns="http://www.topografix.com/GPX/1/1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.topografix.com/GPX/1/1 http://www.topografix.com/GPX/1/1/gpx.xsd">
+  <metadata>
+    <name>Alps</name>
+  </metadata>
+  <wpt lat="46.5" lon="7.25">
+    <name>Summit</name>
+    <sym>Flag</sym>
+  </wpt>
+  <trk>
+    <name>Morning hike</name>
+    <trkseg>
+      <trkpt lat="46.123456789" lon="0.0000001">
+        <ele>1520.5</ele>
+        <time>2024-05-04T06:30:00Z</time>
+      </trkpt>
+      <trkpt lat="-12" lon="-179.5"></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+	if string(output) != expected {
+		t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", expected, output)
+	}
+}
+
+func TestInvalidCoordinates(t *testing.T) {
+	tests := []struct {
+		name  string
+		point Point
+	}{
+		{"Latitude too large", Point{Lat: 91}},
+		{"Longitude too small", Point{Lon: -181}},
+		{"Infinite elevation", Point{Elevation: Elevation(math.Inf(1))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := New("").AddTrack(Track{Segments: []Segment{{Points: []Point{tt.point}}}})
+			if _, err := doc.Marshal(nil); !errors.Is(err, ErrInvalidCoordinate) {
+				t.Errorf("Expected ErrInvalidCoordinate, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package go_xml
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type BeforeMarshaler interface {
+	BeforeMarshalXML() error
+}
+
+type AfterMarshaler interface {
+	AfterMarshalXML()
+}
+
+type hookSet uint8
+
+const (
+	hookBefore hookSet = 1 << iota
+	hookBeforePtr
+	hookAfter
+	hookAfterPtr
+)
+
+var (
+	hookCache sync.Map
+
+	beforeMarshalerType = reflect.TypeOf((*BeforeMarshaler)(nil)).Elem()
+	afterMarshalerType  = reflect.TypeOf((*AfterMarshaler)(nil)).Elem()
+)
+
+func lookupHooks(t reflect.Type) hookSet {
+	if cached, ok := hookCache.Load(t); ok {
+		return cached.(hookSet)
+	}
+
+	var hooks hookSet
+	ptr := reflect.PtrTo(t)
+	if t.Implements(beforeMarshalerType) {
+		hooks |= hookBefore
+	} else if ptr.Implements(beforeMarshalerType) {
+		hooks |= hookBeforePtr
+	}
+	if t.Implements(afterMarshalerType) {
+		hooks |= hookAfter
+	} else if ptr.Implements(afterMarshalerType) {
+		hooks |= hookAfterPtr
+	}
+
+	hookCache.Store(t, hooks)
+	return hooks
+}
+
+func hookReceiver(val reflect.Value, hooks hookSet, valueHook, ptrHook hookSet) (interface{}, bool) {
+	switch {
+	case hooks&valueHook != 0 && val.CanInterface():
+		return val.Interface(), true
+	case hooks&ptrHook != 0 && val.CanAddr() && val.CanInterface():
+		return val.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+func (m *marshaler) beforeMarshal(val reflect.Value, hooks hookSet) error {
+	receiver, ok := hookReceiver(val, hooks, hookBefore, hookBeforePtr)
+	if !ok {
+		return nil
+	}
+	if err := receiver.(BeforeMarshaler).BeforeMarshalXML(); err != nil {
+		return fmt.Errorf("BeforeMarshalXML failed at %s: %w", m.fieldPath(""), err)
+	}
+	return nil
+}
+
+func afterMarshal(val reflect.Value, hooks hookSet) {
+	if receiver, ok := hookReceiver(val, hooks, hookAfter, hookAfterPtr); ok {
+		receiver.(AfterMarshaler).AfterMarshalXML()
+	}
+}
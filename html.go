@@ -0,0 +1,114 @@
+package go_xml
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type OutputMode int
+
+const (
+	ModeXML OutputMode = iota
+	ModeHTML
+	ModeXHTML
+)
+
+const xhtmlNamespace = "http://www.w3.org/1999/xhtml"
+
+var htmlVoidElements = map[string]bool{
+	"area":   true,
+	"base":   true,
+	"br":     true,
+	"col":    true,
+	"embed":  true,
+	"hr":     true,
+	"img":    true,
+	"input":  true,
+	"link":   true,
+	"meta":   true,
+	"param":  true,
+	"source": true,
+	"track":  true,
+	"wbr":    true,
+}
+
+var htmlRawTextElements = map[string]bool{
+	"script": true,
+	"style":  true,
+}
+
+func newDocumentEncoder(w io.Writer, opts *MarshalOptions) *Encoder {
+	encoder := NewEncoder(w, opts.SelfClosingTags, opts.Indent, opts.SpacedSelfClose)
+	encoder.invalidChars = opts.InvalidChars
+	encoder.mode = opts.Mode
+	if opts.Mode == ModeXML && opts.EmptyElements != EmptyElementsExpanded {
+		encoder.collapseEmpty = true
+		encoder.spacedSelfClose = opts.EmptyElements == EmptyElementsSpaced
+	}
+	if opts.Newline != "" {
+		encoder.newline = opts.Newline
+	}
+	encoder.compareAttrs = attributeComparator(opts)
+	encoder.wrapAttrs = opts.WrapAttributes
+	encoder.escaper = opts.Escaper
+	encoder.normalize = opts.NormalizeUnicode
+	encoder.encodable = encodableRune(opts.Encoding)
+	if len(opts.Entities) > 0 {
+		encoder.escaper = newEntityEscaper(opts.Entities, opts.Escaper)
+	}
+	if opts.Mode == ModeXHTML {
+		encoder.selfClosing = make(map[string]bool, len(htmlVoidElements)+len(opts.SelfClosingTags))
+		for name := range htmlVoidElements {
+			encoder.selfClosing[name] = true
+		}
+		for _, name := range opts.SelfClosingTags {
+			if !strings.Contains(name, ">") {
+				encoder.selfClosing[strings.ToLower(name)] = true
+			}
+		}
+		for _, path := range encoder.selfClosingPaths {
+			for i := range path {
+				path[i] = strings.ToLower(path[i])
+			}
+		}
+		encoder.spacedSelfClose = true
+	}
+	return encoder
+}
+
+func xhtmlAttributes(attrs []Attribute, root bool) []Attribute {
+	lowered := make([]Attribute, 0, len(attrs)+1)
+	if root && !hasAttribute(attrs, "xmlns") {
+		lowered = append(lowered, Attribute{Name: "xmlns", Value: xhtmlNamespace})
+	}
+	for _, attr := range attrs {
+		attr.Name = strings.ToLower(attr.Name)
+		lowered = append(lowered, attr)
+	}
+	return lowered
+}
+
+func (e *Encoder) htmlElement(name string) openElement {
+	lower := strings.ToLower(name)
+	return openElement{
+		name:    name,
+		pending: true,
+		void:    htmlVoidElements[lower],
+		rawText: htmlRawTextElements[lower],
+	}
+}
+
+func (e *Encoder) checkVoidContent(open *openElement) error {
+	if open != nil && open.void {
+		return fmt.Errorf("void element <%s> cannot have content", open.name)
+	}
+	return nil
+}
+
+func (e *Encoder) writeRawText(open *openElement, text string) error {
+	if strings.Contains(strings.ToLower(text), "</"+strings.ToLower(open.name)) {
+		return fmt.Errorf("content of <%s> must not contain its end tag", open.name)
+	}
+	return e.writeString(text)
+}
@@ -0,0 +1,384 @@
+package go_xml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultAttributePrefix = "@"
+	defaultTextKey         = "#text"
+	defaultJSONRootTag     = "root"
+	defaultJSONItemTag     = "item"
+)
+
+type JSONOptions struct {
+	AttributePrefix string
+	TextKey         string
+	RootTag         string
+	ItemTag         string
+
+	Marshal *MarshalOptions
+
+	InferTypes  bool
+	ForceArrays []string
+	Indent      string
+}
+
+func (o *JSONOptions) withDefaults() JSONOptions {
+	var opts JSONOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.AttributePrefix == "" {
+		opts.AttributePrefix = defaultAttributePrefix
+	}
+	if opts.TextKey == "" {
+		opts.TextKey = defaultTextKey
+	}
+	if opts.ItemTag == "" {
+		opts.ItemTag = defaultJSONItemTag
+	}
+	if opts.Marshal == nil {
+		opts.Marshal = &MarshalOptions{}
+	}
+	return opts
+}
+
+type jsonConverter struct {
+	opts   JSONOptions
+	dec    *json.Decoder
+	root   *ElementNode
+	unwrap bool
+}
+
+func FromJSON(data []byte, opts *JSONOptions) ([]byte, error) {
+	c := &jsonConverter{opts: opts.withDefaults()}
+	c.dec = json.NewDecoder(bytes.NewReader(data))
+	c.dec.UseNumber()
+
+	rootTag := c.opts.RootTag
+	if rootTag == "" {
+		rootTag = defaultJSONRootTag
+	}
+
+	root := acquireElementNode()
+	root.Name = rootTag
+	c.root = root
+	token, err := c.token()
+	if err == nil {
+		c.unwrap = token == json.Delim('{') && c.opts.RootTag == ""
+		err = c.fillElement(root, token, rootTag)
+	}
+	if err != nil {
+		releaseNode(root)
+		return nil, err
+	}
+	if _, err := c.dec.Token(); err != io.EOF {
+		releaseNode(root)
+		return nil, fmt.Errorf("invalid JSON: unexpected data after the top-level value")
+	}
+
+	if c.unwrap && len(root.Attributes) == 0 && len(root.Children) == 1 {
+		if child, ok := root.Children[0].(*ElementNode); ok {
+			root.Children = root.Children[:0]
+			releaseNode(root)
+			root = child
+		}
+	}
+	return encodeNodeDocument(root, c.opts.Marshal)
+}
+
+func (c *jsonConverter) token() (json.Token, error) {
+	token, err := c.dec.Token()
+	if err == io.EOF {
+		return nil, fmt.Errorf("invalid JSON: %w", io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return token, nil
+}
+
+func (c *jsonConverter) readValue(node *ElementNode, path string) error {
+	token, err := c.token()
+	if err != nil {
+		return err
+	}
+	return c.fillElement(node, token, path)
+}
+
+func (c *jsonConverter) fillElement(node *ElementNode, token json.Token, path string) error {
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '[' {
+			return c.readArray(node, c.opts.ItemTag, path)
+		}
+		return c.readObject(node, path)
+	case nil:
+		return nil
+	default:
+		appendText(node, jsonScalar(t))
+		return nil
+	}
+}
+
+func (c *jsonConverter) readObject(node *ElementNode, path string) error {
+	for c.dec.More() {
+		token, err := c.token()
+		if err != nil {
+			return err
+		}
+		key := token.(string)
+		keyPath := path + "." + key
+
+		switch {
+		case key == c.opts.TextKey:
+			text, err := c.readScalar(keyPath)
+			if err != nil {
+				return err
+			}
+			appendText(node, text)
+		case len(key) > len(c.opts.AttributePrefix) && key[:len(c.opts.AttributePrefix)] == c.opts.AttributePrefix:
+			name := key[len(c.opts.AttributePrefix):]
+			if !isValidName(name) {
+				return &InvalidNameError{Name: name, Path: keyPath}
+			}
+			value, err := c.readScalar(keyPath)
+			if err != nil {
+				return err
+			}
+			node.Attributes = append(node.Attributes, Attribute{Name: name, Value: value})
+		default:
+			if !isValidName(key) {
+				return &InvalidNameError{Name: key, Path: keyPath}
+			}
+			token, err := c.token()
+			if err != nil {
+				return err
+			}
+			if delim, ok := token.(json.Delim); ok && delim == '[' {
+				if node == c.root {
+					c.unwrap = false
+				}
+				if err := c.readArray(node, key, keyPath); err != nil {
+					return err
+				}
+				continue
+			}
+			child := acquireElementNode()
+			child.Name = key
+			node.Children = append(node.Children, child)
+			if err := c.fillElement(child, token, keyPath); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := c.token()
+	return err
+}
+
+func (c *jsonConverter) readArray(parent *ElementNode, name, path string) error {
+	for i := 0; c.dec.More(); i++ {
+		child := acquireElementNode()
+		child.Name = name
+		parent.Children = append(parent.Children, child)
+		if err := c.readValue(child, path+indexSegment(i)); err != nil {
+			return err
+		}
+	}
+	_, err := c.token()
+	return err
+}
+
+func (c *jsonConverter) readScalar(path string) (string, error) {
+	token, err := c.token()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := token.(json.Delim); ok {
+		return "", fmt.Errorf("invalid JSON: %s must be a string, number, boolean or null", path)
+	}
+	return jsonScalar(token), nil
+}
+
+func jsonScalar(token json.Token) string {
+	switch t := token.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		if t {
+			return "true"
+		}
+		return "false"
+	}
+	return ""
+}
+
+func ToJSON(data []byte, opts *JSONOptions) ([]byte, error) {
+	root, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseNode(root)
+
+	o := opts.withDefaults()
+	forced := make(map[string]bool, len(o.ForceArrays))
+	for _, name := range o.ForceArrays {
+		forced[name] = true
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeJSONString(&buf, root.Name)
+	buf.WriteByte(':')
+	if forced[root.Name] {
+		buf.WriteByte('[')
+		writeJSONElement(&buf, root, &o, forced)
+		buf.WriteByte(']')
+	} else {
+		writeJSONElement(&buf, root, &o, forced)
+	}
+	buf.WriteByte('}')
+
+	if o.Indent == "" {
+		return buf.Bytes(), nil
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, buf.Bytes(), "", o.Indent); err != nil {
+		return nil, err
+	}
+	return indented.Bytes(), nil
+}
+
+func writeJSONElement(buf *bytes.Buffer, node *ElementNode, opts *JSONOptions, forced map[string]bool) {
+	var text strings.Builder
+	var names []string
+	groups := make(map[string][]*ElementNode)
+	for _, child := range node.Children {
+		switch c := child.(type) {
+		case *ElementNode:
+			if _, seen := groups[c.Name]; !seen {
+				names = append(names, c.Name)
+			}
+			groups[c.Name] = append(groups[c.Name], c)
+		case *TextNode:
+			text.WriteString(c.Text)
+		case *CDataNode:
+			text.WriteString(c.Text)
+		}
+	}
+
+	content := text.String()
+	if len(names) > 0 || len(node.Attributes) > 0 {
+		content = strings.TrimSpace(content)
+	}
+	if len(names) == 0 && len(node.Attributes) == 0 {
+		writeJSONScalar(buf, content, opts.InferTypes)
+		return
+	}
+
+	buf.WriteByte('{')
+	first := true
+	member := func(key string) {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		writeJSONString(buf, key)
+		buf.WriteByte(':')
+	}
+
+	for _, attr := range node.Attributes {
+		member(opts.AttributePrefix + attr.Name)
+		writeJSONScalar(buf, attr.Value, opts.InferTypes)
+	}
+	if content != "" {
+		member(opts.TextKey)
+		writeJSONScalar(buf, content, opts.InferTypes)
+	}
+	for _, name := range names {
+		member(name)
+		elements := groups[name]
+		if len(elements) == 1 && !forced[name] {
+			writeJSONElement(buf, elements[0], opts, forced)
+			continue
+		}
+		buf.WriteByte('[')
+		for i, element := range elements {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONElement(buf, element, opts, forced)
+		}
+		buf.WriteByte(']')
+	}
+	buf.WriteByte('}')
+}
+
+func writeJSONScalar(buf *bytes.Buffer, s string, infer bool) {
+	if infer {
+		switch {
+		case s == "true" || s == "false":
+			buf.WriteString(s)
+			return
+		case isJSONNumber(s):
+			buf.WriteString(s)
+			return
+		}
+	}
+	writeJSONString(buf, s)
+}
+
+func isJSONNumber(s string) bool {
+	if s == "" || (s[0] != '-' && (s[0] < '0' || s[0] > '9')) {
+		return false
+	}
+	return json.Valid([]byte(s))
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				buf.WriteString(`\ufffd`)
+			} else {
+				buf.WriteString(s[i : i+size])
+			}
+			i += size
+			continue
+		}
+		switch c {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[c>>4])
+				buf.WriteByte(hex[c&0xF])
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+		i++
+	}
+	buf.WriteByte('"')
+}
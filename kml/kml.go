@@ -0,0 +1,320 @@
+package kml
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+const Namespace = "http://www.opengis.net/kml/2.2"
+
+var (
+	ErrInvalidCoordinate = errors.New("kml: coordinate out of range")
+	ErrUnknownStyle      = errors.New("kml: placemark references an undefined style")
+	ErrInvalidGeometry   = errors.New("kml: placemark geometry is invalid")
+)
+
+type Coordinate struct {
+	Lon float64
+	Lat float64
+	Alt float64
+}
+
+type Document struct {
+	Name        string
+	Description string
+	Styles      []Style
+	Folders     []Folder
+	Placemarks  []Placemark
+}
+
+type Folder struct {
+	Name        string
+	Description string
+	Folders     []Folder
+	Placemarks  []Placemark
+}
+
+type Style struct {
+	ID        string
+	IconHref  string
+	IconScale float64
+	LineColor string
+	LineWidth float64
+	PolyColor string
+}
+
+type Placemark struct {
+	Name        string
+	Description string
+	StyleID     string
+	Point       *Coordinate
+	LineString  []Coordinate
+	Polygon     []Coordinate
+}
+
+func New(name string) *Document {
+	return &Document{Name: name}
+}
+
+func (d *Document) AddStyle(s Style) *Document {
+	d.Styles = append(d.Styles, s)
+	return d
+}
+
+func (d *Document) AddFolder(f Folder) *Document {
+	d.Folders = append(d.Folders, f)
+	return d
+}
+
+func (d *Document) AddPlacemark(p Placemark) *Document {
+	d.Placemarks = append(d.Placemarks, p)
+	return d
+}
+
+type kmlXML struct {
+	Namespace string      `xml:"xmlns,attr"`
+	Document  documentXML `xml:"Document"`
+}
+
+type documentXML struct {
+	Name        string         `xml:"name,omitempty"`
+	Description string         `xml:"description,omitempty"`
+	Styles      []styleXML     `xml:"Style,omitempty"`
+	Folders     []folderXML    `xml:"Folder,omitempty"`
+	Placemarks  []placemarkXML `xml:"Placemark,omitempty"`
+}
+
+type folderXML struct {
+	Name        string         `xml:"name,omitempty"`
+	Description string         `xml:"description,omitempty"`
+	Folders     []folderXML    `xml:"Folder,omitempty"`
+	Placemarks  []placemarkXML `xml:"Placemark,omitempty"`
+}
+
+type styleXML struct {
+	ID        string        `xml:"id,attr"`
+	IconStyle *iconStyleXML `xml:"IconStyle,omitempty"`
+	LineStyle *lineStyleXML `xml:"LineStyle,omitempty"`
+	PolyStyle *polyStyleXML `xml:"PolyStyle,omitempty"`
+}
+
+type iconStyleXML struct {
+	Scale string `xml:"scale,omitempty"`
+	Href  string `xml:"Icon>href"`
+}
+
+type lineStyleXML struct {
+	Color string `xml:"color,omitempty"`
+	Width string `xml:"width,omitempty"`
+}
+
+type polyStyleXML struct {
+	Color string `xml:"color"`
+}
+
+type placemarkXML struct {
+	Name        string         `xml:"name,omitempty"`
+	Description string         `xml:"description,omitempty"`
+	StyleURL    string         `xml:"styleUrl,omitempty"`
+	Point       *coordsXML     `xml:"Point,omitempty"`
+	LineString  *lineStringXML `xml:"LineString,omitempty"`
+	Polygon     *polygonXML    `xml:"Polygon,omitempty"`
+}
+
+type coordsXML struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type lineStringXML struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+type polygonXML struct {
+	Outer coordsXML `xml:"outerBoundaryIs>LinearRing"`
+}
+
+func (d *Document) Marshal(opts *go_xml.MarshalOptions) ([]byte, error) {
+	doc, err := d.toXML()
+	if err != nil {
+		return nil, err
+	}
+
+	marshalOpts := go_xml.MarshalOptions{XMLHeader: true, Indent: "  "}
+	if opts != nil {
+		marshalOpts = *opts
+	}
+	marshalOpts.RootTag = "kml"
+	marshalOpts.Namespace = ""
+	return go_xml.Marshal(doc, &marshalOpts)
+}
+
+func (d *Document) toXML() (*kmlXML, error) {
+	styles := make(map[string]bool, len(d.Styles))
+	doc := &kmlXML{
+		Namespace: Namespace,
+		Document:  documentXML{Name: d.Name, Description: d.Description},
+	}
+
+	for _, s := range d.Styles {
+		styles[s.ID] = true
+		doc.Document.Styles = append(doc.Document.Styles, styleToXML(s))
+	}
+
+	folders, err := foldersToXML(d.Folders, styles, "")
+	if err != nil {
+		return nil, err
+	}
+	doc.Document.Folders = folders
+
+	placemarks, err := placemarksToXML(d.Placemarks, styles, "")
+	if err != nil {
+		return nil, err
+	}
+	doc.Document.Placemarks = placemarks
+	return doc, nil
+}
+
+func styleToXML(s Style) styleXML {
+	out := styleXML{ID: s.ID}
+	if s.IconHref != "" {
+		out.IconStyle = &iconStyleXML{Href: s.IconHref, Scale: formatOptional(s.IconScale)}
+	}
+	if s.LineColor != "" || s.LineWidth != 0 {
+		out.LineStyle = &lineStyleXML{Color: s.LineColor, Width: formatOptional(s.LineWidth)}
+	}
+	if s.PolyColor != "" {
+		out.PolyStyle = &polyStyleXML{Color: s.PolyColor}
+	}
+	return out
+}
+
+func foldersToXML(folders []Folder, styles map[string]bool, path string) ([]folderXML, error) {
+	var out []folderXML
+	for i, f := range folders {
+		folderPath := fmt.Sprintf("%sfolder %d/", path, i)
+		children, err := foldersToXML(f.Folders, styles, folderPath)
+		if err != nil {
+			return nil, err
+		}
+		placemarks, err := placemarksToXML(f.Placemarks, styles, folderPath)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, folderXML{
+			Name:        f.Name,
+			Description: f.Description,
+			Folders:     children,
+			Placemarks:  placemarks,
+		})
+	}
+	return out, nil
+}
+
+func placemarksToXML(placemarks []Placemark, styles map[string]bool, path string) ([]placemarkXML, error) {
+	var out []placemarkXML
+	for i, p := range placemarks {
+		placemark, err := placemarkToXML(p, styles)
+		if err != nil {
+			return nil, fmt.Errorf("%w (%splacemark %d)", err, path, i)
+		}
+		out = append(out, placemark)
+	}
+	return out, nil
+}
+
+func placemarkToXML(p Placemark, styles map[string]bool) (placemarkXML, error) {
+	out := placemarkXML{Name: p.Name, Description: p.Description}
+	if p.StyleID != "" {
+		if !styles[p.StyleID] {
+			return out, fmt.Errorf("%w: %q", ErrUnknownStyle, p.StyleID)
+		}
+		out.StyleURL = "#" + p.StyleID
+	}
+
+	geometries := 0
+	for _, set := range []bool{p.Point != nil, p.LineString != nil, p.Polygon != nil} {
+		if set {
+			geometries++
+		}
+	}
+	if geometries > 1 {
+		return out, fmt.Errorf("%w: placemark has %d geometries, at most one is allowed", ErrInvalidGeometry, geometries)
+	}
+
+	if p.Point != nil {
+		coords, err := FormatCoordinates([]Coordinate{*p.Point})
+		if err != nil {
+			return out, err
+		}
+		out.Point = &coordsXML{Coordinates: coords}
+	}
+	if p.LineString != nil {
+		if len(p.LineString) < 2 {
+			return out, fmt.Errorf("%w: line string needs at least 2 coordinates", ErrInvalidGeometry)
+		}
+		coords, err := FormatCoordinates(p.LineString)
+		if err != nil {
+			return out, err
+		}
+		out.LineString = &lineStringXML{Tessellate: 1, Coordinates: coords}
+	}
+	if p.Polygon != nil {
+		ring := p.Polygon
+		if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+			ring = append(ring[:len(ring):len(ring)], ring[0])
+		}
+		if len(ring) < 4 {
+			return out, fmt.Errorf("%w: polygon needs at least 3 distinct coordinates", ErrInvalidGeometry)
+		}
+		coords, err := FormatCoordinates(ring)
+		if err != nil {
+			return out, err
+		}
+		out.Polygon = &polygonXML{Outer: coordsXML{Coordinates: coords}}
+	}
+	return out, nil
+}
+
+func FormatCoordinates(coords []Coordinate) (string, error) {
+	var sb strings.Builder
+	for i, c := range coords {
+		if math.IsNaN(c.Lat) || c.Lat < -90 || c.Lat > 90 {
+			return "", fmt.Errorf("%w: latitude %v", ErrInvalidCoordinate, c.Lat)
+		}
+		if math.IsNaN(c.Lon) || c.Lon < -180 || c.Lon > 180 {
+			return "", fmt.Errorf("%w: longitude %v", ErrInvalidCoordinate, c.Lon)
+		}
+		if math.IsNaN(c.Alt) || math.IsInf(c.Alt, 0) {
+			return "", fmt.Errorf("%w: altitude %v", ErrInvalidCoordinate, c.Alt)
+		}
+
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(formatDecimal(c.Lon))
+		sb.WriteByte(',')
+		sb.WriteString(formatDecimal(c.Lat))
+		if c.Alt != 0 {
+			sb.WriteByte(',')
+			sb.WriteString(formatDecimal(c.Alt))
+		}
+	}
+	return sb.String(), nil
+}
+
+func formatDecimal(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func formatOptional(f float64) string {
+	if f == 0 {
+		return ""
+	}
+	return formatDecimal(f)
+}
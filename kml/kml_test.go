@@ -0,0 +1,106 @@
+package kml
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	doc := New("Trip").
+		AddStyle(Style{ID: "route", LineColor: "ff0000ff", LineWidth: 2.5}).
+		AddStyle(Style{ID: "pin", IconHref: "https://maps.example.com/pin.png"}).
+		AddFolder(Folder{
+			Name: "Stops",
+			Placemarks: []Placemark{
+				{Name: "Start", StyleID: "pin", Point: &Coordinate{Lon: 8.5417, Lat: 47.3769, Alt: 408}},
+			},
+		}).
+		AddPlacemark(Placemark{
+			Name:       "Route",
+			StyleID:    "route",
+			LineString: []Coordinate{{Lon: 8.5417, Lat: 47.3769}, {Lon: 7.4474, Lat: 46.948}},
+		}).
+		AddPlacemark(Placemark{
+			Name:    "Area",
+			Polygon: []Coordinate{{Lon: 0, Lat: 0}, {Lon: 1, Lat: 0}, {Lon: 1, Lat: 1}},
+		})
+
+	output, err := doc.Marshal(nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+  <Document>
+    <name>Trip</name>
+    <Style id="route">
+      <LineStyle>
+        <color>ff0000ff</color>
+        <width>2.5</width>
+      </LineStyle>
+    </Style>
+    <Style id="pin">
+      <IconStyle>
+        <Icon>
+          <href>https://maps.example.com/pin.png</href>
+        </Icon>
+      </IconStyle>
+    </Style>
+    <Folder>
+      <name>Stops</name>
+      <Placemark>
+        <name>Start</name>
+        <styleUrl>#pin</styleUrl>
+        <Point>
+          <coordinates>8.5417,47.3769,408</coordinates>
+        </Point>
+      </Placemark>
+    </Folder>
+    <Placemark>
+      <name>Route</name>
+      <styleUrl>#route</styleUrl>
+      <LineString>
+        <tessellate>1</tessellate>
+        <coordinates>8.5417,47.3769 7.4474,46.948</coordinates>
+      </LineString>
+    </Placemark>
+    <Placemark>
+      <name>Area</name>
+      <Polygon>
+        <outerBoundaryIs>
+          <LinearRing>
+            <coordinates>0,0 1,0 1,1 0,0</coordinates>
+          </LinearRing>
+        </outerBoundaryIs>
+      </Polygon>
+    </Placemark>
+  </Document>
+</kml>`
+	if string(output) != expected {
+		t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", expected, output)
+	}
+}
+
+func TestInvalidPlacemarks(t *testing.T) {
+	tests := []struct {
+		name      string
+		placemark Placemark
+		expected  error
+	}{
+		{"Unknown style", Placemark{StyleID: "missing"}, ErrUnknownStyle},
+		{"Latitude out of range", Placemark{Point: &Coordinate{Lat: 95}}, ErrInvalidCoordinate},
+		{"Short line", Placemark{LineString: []Coordinate{{}}}, ErrInvalidGeometry},
+		{"Degenerate polygon", Placemark{Polygon: []Coordinate{{Lon: 1}, {Lon: 2}}}, ErrInvalidGeometry},
+		{"Several geometries", Placemark{Point: &Coordinate{}, LineString: []Coordinate{{}, {Lon: 1}}}, ErrInvalidGeometry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := New("").AddFolder(Folder{Folders: []Folder{{Placemarks: []Placemark{tt.placemark}}}})
+			if _, err := doc.Marshal(nil); !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package go_xml
+
+import (
+	"io"
+)
+
+type limitWriter struct {
+	w         io.Writer
+	max       int
+	remaining int
+}
+
+func limitOutput(w io.Writer, opts *MarshalOptions) io.Writer {
+	if opts == nil || opts.MaxBytes <= 0 {
+		return w
+	}
+	return &limitWriter{w: w, max: opts.MaxBytes, remaining: opts.MaxBytes}
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if len(p) > l.remaining {
+		return 0, &LimitError{Limit: "MaxBytes", Max: l.max}
+	}
+	l.remaining -= len(p)
+	return l.w.Write(p)
+}
+
+func (l *limitWriter) WriteString(s string) (int, error) {
+	if len(s) > l.remaining {
+		return 0, &LimitError{Limit: "MaxBytes", Max: l.max}
+	}
+	l.remaining -= len(s)
+	return io.WriteString(l.w, s)
+}
+
+func (m *marshaler) enterElement() error {
+	m.depth++
+	if max := m.opts.MaxDepth; max > 0 && m.depth > max {
+		return &LimitError{Limit: "MaxDepth", Max: max, Path: m.fieldPath("")}
+	}
+	return nil
+}
+
+func (m *marshaler) endElement() error {
+	m.depth--
+	m.popBindings()
+	return m.out.endElement()
+}
@@ -2,15 +2,23 @@ package go_xml
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"reflect"
-	"strings"
 	"sync"
 )
 
+var (
+	rawXMLType = reflect.TypeOf(RawXML(""))
+	cdataType  = reflect.TypeOf(CDATA(""))
+)
+
 const (
 	xmlHeader = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>"
+
+	defaultParallelThreshold = 64
 )
 
 type MarshalOptions struct {
@@ -18,86 +26,409 @@ type MarshalOptions struct {
 	XMLHeader       bool
 	Namespace       string
 	RootTag         string
+	ItemTag         string
 	Compress        bool
 	SelfClosingTags []string
 	SpacedSelfClose bool
+
+	Parallelism       int
+	ParallelThreshold int
+
+	CompressionAlgorithm string
+	CompressionLevel     int
+	CompressMinSize      int
+
+	StrictNames  bool
+	InvalidChars InvalidCharPolicy
+
+	FieldFilter func(path string, field reflect.StructField) bool
+	Include     []string
+	Exclude     []string
+	Groups      []string
+
+	SchemaVersion string
+
+	Transformers []NodeTransformer
+
+	Mode OutputMode
+
+	CompatStdlib bool
+
+	Declaration            *Declaration
+	ProcessingInstructions []ProcessingInstructionNode
+	HeaderComments         []string
+
+	Encoding string
+	Newline  string
+
+	AttributeOrder    AttributeOrder
+	CompareAttributes func(a, b Attribute) int
+	WrapAttributes    int
+
+	EmptyElements  EmptyElementStyle
+	RootAttributes []Attribute
+
+	NameStrategy func(fieldName string) string
+
+	Deterministic bool
+
+	Redactor func(path, value string) string
+
+	MaxDepth int
+	MaxBytes int
+
+	SkipUnsupported bool
+
+	DuplicateAttributes DuplicateAttributePolicy
+
+	Validate bool
+
+	NilValues        NilPolicy
+	OmitNilSlices    bool
+	OmitEmptyStructs bool
+
+	Escaper  Escaper
+	Entities []Entity
+
+	NormalizeUnicode bool
 }
 
 func Marshal(v interface{}, opts *MarshalOptions) ([]byte, error) {
-	if opts == nil {
-		opts = &MarshalOptions{}
-	}
+	data, _, err := MarshalCompressed(v, opts)
+	return data, err
+}
 
-	rootTag := opts.RootTag
-	if rootTag == "" {
-		rootTag = reflect.TypeOf(v).Name()
+func MarshalContext(ctx context.Context, v interface{}, opts *MarshalOptions) ([]byte, error) {
+	data, _, err := marshalCompressed(ctx, v, opts)
+	return data, err
+}
+
+func MarshalCompressed(v interface{}, opts *MarshalOptions) ([]byte, bool, error) {
+	return marshalCompressed(context.Background(), v, opts)
+}
+
+func marshalCompressed(ctx context.Context, v interface{}, opts *MarshalOptions) ([]byte, bool, error) {
+	return marshalPlanned(ctx, v, nil, opts)
+}
+
+func marshalPlanned(ctx context.Context, v interface{}, plan *typePlan, opts *MarshalOptions) ([]byte, bool, error) {
+	buf := acquireBuffer()
+	defer releaseBuffer(buf)
+
+	if err := encodePlanned(ctx, buf, v, plan, opts); err != nil {
+		return nil, false, err
 	}
 
-	node, err := structToNode(reflect.ValueOf(v), opts, []string{rootTag})
-	if err != nil {
-		return nil, fmt.Errorf("error converting structure to node: %w", err)
+	if shouldCompress(opts, buf.Len()) {
+		data, err := compressBuffer(nil, buf, opts)
+		return data, err == nil, err
 	}
 
-	if node == nil {
-		return nil, fmt.Errorf("returned node is null")
+	return append([]byte(nil), buf.Bytes()...), false, nil
+}
+
+func AppendMarshal(dst []byte, v interface{}, opts *MarshalOptions) ([]byte, error) {
+	if opts == nil || !opts.Compress {
+		buf := bytes.NewBuffer(dst)
+		if err := encodeDocument(context.Background(), buf, v, opts); err != nil {
+			return dst, err
+		}
+		return buf.Bytes(), nil
 	}
 
 	buf := acquireBuffer()
 	defer releaseBuffer(buf)
 
-	encoder := NewEncoder(buf, opts.SelfClosingTags, opts.Indent, opts.SpacedSelfClose)
+	if err := encodeDocument(context.Background(), buf, v, opts); err != nil {
+		return dst, err
+	}
+	if !shouldCompress(opts, buf.Len()) {
+		return append(dst, buf.Bytes()...), nil
+	}
+	return compressBuffer(dst, buf, opts)
+}
+
+func MarshalTo(w io.Writer, v interface{}, opts *MarshalOptions) error {
+	if opts == nil || !opts.Compress {
+		return encodeBuffered(w, v, opts)
+	}
+
+	compressor, err := lookupCompressor(opts.CompressionAlgorithm, opts.CompressionLevel)
+	if err != nil {
+		return err
+	}
 
-	if opts.XMLHeader {
-		if _, err := buf.WriteString(xmlHeader); err != nil {
-			return nil, err
+	if stream, ok := compressor.(StreamCompressor); ok {
+		var compressedWriter io.WriteCloser
+		if opts.CompressMinSize > 0 {
+			compressedWriter = newThresholdWriter(w, stream, opts.CompressMinSize)
+		} else {
+			compressedWriter, err = stream.NewWriter(w)
+			if err != nil {
+				return fmt.Errorf("error compressing data: %w", err)
+			}
+		}
+		if err := encodeBuffered(compressedWriter, v, opts); err != nil {
+			if tw, ok := compressedWriter.(*thresholdWriter); ok {
+				tw.abort()
+			}
+			return err
 		}
-		if opts.Indent != "" {
-			buf.WriteString("\n")
+		if err := compressedWriter.Close(); err != nil {
+			return fmt.Errorf("error compressing data: %w", err)
 		}
+		return nil
 	}
 
-	if opts.Namespace != "" {
-		if elementNode, ok := node.(*ElementNode); ok {
-			if !elementNode.HasAttribute("xmlns") {
-				elementNode.Attributes = insertAttributeAtBeginning(elementNode.Attributes, Attribute{
-					Name:  "xmlns",
-					Value: opts.Namespace,
-				})
-			}
+	buf := acquireBuffer()
+	defer releaseBuffer(buf)
+
+	if err := encodeDocument(context.Background(), buf, v, opts); err != nil {
+		return err
+	}
+	if !shouldCompress(opts, buf.Len()) {
+		_, err = w.Write(buf.Bytes())
+		return err
+	}
+
+	compressedBuf, err := compressor.Compress(buf)
+	if err != nil {
+		return fmt.Errorf("error compressing data: %w", err)
+	}
+	defer releaseBuffer(compressedBuf)
+
+	_, err = w.Write(compressedBuf.Bytes())
+	return err
+}
+
+func encodeBuffered(w io.Writer, v interface{}, opts *MarshalOptions) error {
+	bw := acquireBufferedWriter(w)
+	defer releaseBufferedWriter(bw)
+
+	if err := encodeDocument(context.Background(), bw, v, opts); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func encodeDocument(ctx context.Context, w io.Writer, v interface{}, opts *MarshalOptions) error {
+	return encodePlanned(ctx, w, v, nil, opts)
+}
+
+func encodePlanned(ctx context.Context, w io.Writer, v interface{}, plan *typePlan, opts *MarshalOptions) error {
+	w = limitOutput(w, opts)
+	if opts == nil || isUTF8(opts.Encoding) {
+		return encodeUTF8Document(ctx, w, v, plan, opts)
+	}
+	ew, closer, err := encodingWriter(w, opts)
+	if err != nil {
+		return err
+	}
+	if err := encodeUTF8Document(ctx, ew, v, plan, opts); err != nil {
+		return err
+	}
+	return closer.Close()
+}
+
+func encodeUTF8Document(ctx context.Context, w io.Writer, v interface{}, plan *typePlan, opts *MarshalOptions) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while encoding structure: %v", r)
 		}
+	}()
+
+	val := reflect.ValueOf(v)
+	if isNilValue(val) {
+		return ErrNilNode
+	}
+	if plan == nil {
+		plan = planFor(val.Type())
+	}
+
+	m := newMarshaler(opts, nil)
+	opts = m.opts
+	if opts.CompatStdlib {
+		return encodeStdlib(ctx, w, v, opts)
+	}
+	if ctx.Done() != nil {
+		m.ctx = ctx
+	}
+
+	if generated, ok := generatedMarshaler(val, plan, opts); ok {
+		return encodeGenerated(w, generated, opts)
+	}
+
+	tags, err := rootTags(plan.root, opts)
+	if err != nil {
+		return err
 	}
 
-	if err := node.Accept(encoder); err != nil {
-		return nil, fmt.Errorf("error encoding node: %w", err)
+	encoder := newDocumentEncoder(w, opts)
+	if err := encoder.writeProlog(opts); err != nil {
+		return err
+	}
+	encoder.deferDocType(opts.Entities)
+	m.out = encoder
+	m.path = append(m.path, tags[0])
+	// Namespace declarations are hoisted to the lowest element that covers
+	// every use, which needs the whole tree, so namespaced types are built in
+	// memory before encoding. MaxBytes still aborts early against a lower
+	// bound of the output size. See BenchmarkNamespacedMarshal for the cost.
+	m.deferNamespaces = plan.namespaces
+	if len(opts.Transformers) > 0 || m.deferNamespaces {
+		return m.encodeTransformed(val, tags, encoder)
+	}
+	if err := m.marshalValue(val, tags); err != nil {
+		return fmt.Errorf("error encoding structure: %w", err)
 	}
 
-	if opts.Compress {
-		return compressBuffer(buf)
+	return nil
+}
+
+func rootTags(typ reflect.Type, opts *MarshalOptions) ([]string, error) {
+	rootTag := opts.RootTag
+	if rootTag == "" {
+		rootTag = typ.Name()
+	}
+	if (typ.Kind() != reflect.Slice && typ.Kind() != reflect.Array) || typ.Elem().Kind() == reflect.Uint8 {
+		return []string{rootTag}, nil
 	}
 
-	return buf.Bytes(), nil
+	if opts.RootTag == "" {
+		return nil, fmt.Errorf("marshaling a top-level %s requires RootTag", typ.Kind())
+	}
+	itemTag := opts.ItemTag
+	if itemTag == "" {
+		elem := typ.Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		itemTag = elem.Name()
+	}
+	if itemTag == "" {
+		return nil, fmt.Errorf("marshaling a top-level %s of %s requires ItemTag", typ.Kind(), typ.Elem())
+	}
+	return []string{rootTag, itemTag}, nil
 }
 
-func compressBuffer(buf *bytes.Buffer) ([]byte, error) {
-	compressor := acquireCompressor()
-	defer releaseCompressor(compressor)
+func compressBuffer(dst []byte, buf *bytes.Buffer, opts *MarshalOptions) ([]byte, error) {
+	compressor, err := lookupCompressor(opts.CompressionAlgorithm, opts.CompressionLevel)
+	if err != nil {
+		return dst, err
+	}
 
 	compressedBuf, err := compressor.Compress(buf)
 	if err != nil {
-		return nil, fmt.Errorf("error compressing data: %w", err)
+		return dst, fmt.Errorf("error compressing data: %w", err)
 	}
 	defer releaseBuffer(compressedBuf)
-	return compressedBuf.Bytes(), nil
+	return append(dst, compressedBuf.Bytes()...), nil
 }
 
-func structToNode(val reflect.Value, opts *MarshalOptions, tagHierarchy []string) (Node, error) {
-	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
-		if val.IsNil() {
-			return nil, nil
+type marshaler struct {
+	opts    *MarshalOptions
+	out     elementWriter
+	attrs   []Attribute
+	path    []string
+	started bool
+	depth   int
+	ctx     context.Context
+
+	deferNamespaces bool
+	bindings        []namespaceBinding
+	bindingMarks    []int
+
+	leaf fieldLeaf
+}
+
+type fieldLeaf struct {
+	tag        string
+	selfClose  bool
+	preserve   bool
+	redactPath string
+	noescape   bool
+}
+
+func newMarshaler(opts *MarshalOptions, out elementWriter) *marshaler {
+	if opts == nil {
+		opts = &MarshalOptions{}
+	}
+	return &marshaler{opts: opts, out: out}
+}
+
+func structToNode(val reflect.Value, opts *MarshalOptions, tagHierarchy []string) (node Node, err error) {
+	builder := &treeBuilder{}
+	defer func() {
+		if r := recover(); r != nil {
+			builder.release()
+			node, err = nil, fmt.Errorf("panic while encoding structure: %v", r)
 		}
-		val = val.Elem()
+	}()
+
+	m := newMarshaler(opts, builder)
+	if len(tagHierarchy) > 0 {
+		m.path = append(m.path, tagHierarchy[0])
+	}
+	if err := m.marshalValue(val, tagHierarchy); err != nil {
+		builder.release()
+		return nil, err
+	}
+	return builder.root, nil
+}
+
+func (m *marshaler) startElement(name string, attrs []Attribute) error {
+	if !m.started {
+		m.started = true
+		if m.opts.Namespace != "" {
+			var err error
+			if attrs, err = m.namespaceAttributes(attrs); err != nil {
+				return err
+			}
+		}
+		for _, attr := range m.opts.RootAttributes {
+			if !isValidName(attr.Name) {
+				return &InvalidNameError{Name: attr.Name, Path: "RootAttributes"}
+			}
+			attrs = setAttribute(attrs, attr)
+		}
+	}
+	if m.ctx != nil {
+		if err := m.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if err := m.enterElement(); err != nil {
+		return err
+	}
+	if err := m.checkName(name, ""); err != nil {
+		return err
+	}
+	if !m.deferNamespaces {
+		name, attrs = qualifyAttributes(name, attrs)
+	}
+	attrs, err := m.uniqueAttributes(attrs)
+	if err != nil {
+		return err
+	}
+	m.pushBindings(attrs)
+	return m.annotate(m.out.startElement(name, attrs), "")
+}
+
+func (m *marshaler) startValueElement(name string, attrs []Attribute) error {
+	leaf := m.leaf.tag != "" && m.leaf.tag == name
+	if leaf && m.leaf.preserve && !hasAttribute(attrs, xmlSpaceAttr) {
+		attrs = append(attrs, Attribute{Name: xmlSpaceAttr, Value: "preserve"})
 	}
+	if err := m.startElement(name, attrs); err != nil {
+		return err
+	}
+	if leaf && m.leaf.selfClose {
+		m.out.selfClose()
+	}
+	return nil
+}
 
+func (m *marshaler) marshalValue(val reflect.Value, tagHierarchy []string) error {
 	currentTag := ""
 	remainingTags := tagHierarchy
 	if len(tagHierarchy) > 0 {
@@ -105,188 +436,425 @@ func structToNode(val reflect.Value, opts *MarshalOptions, tagHierarchy []string
 		remainingTags = tagHierarchy[1:]
 	}
 
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return m.marshalNil(currentTag)
+		}
+		val = val.Elem()
+	}
+	if val.Kind() == reflect.Map && val.IsNil() {
+		return m.marshalNil(currentTag)
+	}
+
+	hooks := lookupHooks(val.Type())
+	if hooks == 0 {
+		return m.marshalKind(val, currentTag, remainingTags)
+	}
+
+	if err := m.beforeMarshal(val, hooks); err != nil {
+		return err
+	}
+	if err := m.marshalKind(val, currentTag, remainingTags); err != nil {
+		return err
+	}
+	afterMarshal(val, hooks)
+	return nil
+}
+
+func (m *marshaler) marshalKind(val reflect.Value, currentTag string, remainingTags []string) error {
+	switch val.Type() {
+	case rawXMLType:
+		return m.out.writeRaw(val.String())
+	case cdataType:
+		return m.marshalCData(val, currentTag)
+	case qnameType:
+		return m.marshalQName(val, currentTag)
+	}
+	if _, ok := lookupDecimal(val.Type()); ok {
+		return m.marshalSimple(val, currentTag)
+	}
+
 	switch val.Kind() {
 	case reflect.Struct:
-		return handleStructNode(val, currentTag, opts)
+		return m.marshalStruct(val, currentTag)
 	case reflect.Slice, reflect.Array:
-		return handleSliceNode(val, currentTag, remainingTags, opts)
+		return m.marshalSlice(val, currentTag, remainingTags)
 	default:
-		return handleSimpleNode(val, currentTag)
+		if skip, err := m.checkKind(val, ""); skip || err != nil {
+			return err
+		}
+		return m.marshalSimple(val, currentTag)
 	}
 }
 
-func handleStructNode(val reflect.Value, currentTag string, opts *MarshalOptions) (Node, error) {
-	element := acquireElementNode()
-	element.Name = currentTag
+func (m *marshaler) marshalStruct(val reflect.Value, currentTag string) error {
+	name, attrs, err := m.structAttributes(val, currentTag, m.attrs[:0], true)
+	if err == nil {
+		err = m.startValueElement(name, attrs)
+	}
+	m.attrs = attrs[:0]
+	if err != nil {
+		return err
+	}
+
+	if err := m.structContent(val); err != nil {
+		return err
+	}
 
-	typ := val.Type()
-	fields := GetFieldMetadata(typ)
+	return m.endElement()
+}
 
-	for _, fieldMeta := range fields {
-		field := fieldMeta.FieldType
+func (m *marshaler) structAttributes(val reflect.Value, name string, attrs []Attribute, useXMLName bool) (string, []Attribute, error) {
+	fields := GetFieldMetadata(val.Type())
+
+	for i := range fields {
+		meta := &fields[i]
+		field := meta.FieldType
 		fieldValue := val.FieldByIndex(field.Index)
 
 		if field.Anonymous {
-			if err := processAnonymousField(element, fieldValue, opts); err != nil {
-				return nil, err
+			if embedded, ok := embeddedStruct(fieldValue); ok {
+				var err error
+				if _, attrs, err = m.structAttributes(embedded, name, attrs, false); err != nil {
+					return name, attrs, err
+				}
 			}
 			continue
 		}
 
-		xmlTag := field.Tag.Get("xml")
-		if xmlTag == "-" {
+		if meta.XMLName {
+			if xmlName, ok := fieldValue.Interface().(xml.Name); ok && useXMLName && xmlName.Local != "" {
+				name = expandedName(xmlName.Space, xmlName.Local)
+			}
 			continue
 		}
 
-		tagParts := strings.Split(xmlTag, ",")
-		tagName := tagParts[0]
-		if tagName == "" {
-			tagName = field.Name
+		if meta.Any {
+			if meta.Attr && m.includeField(field) {
+				if err := checkAnyField(meta); err != nil {
+					return name, attrs, err
+				}
+				attrs = append(attrs, fieldValue.Interface().([]Attribute)...)
+			}
+			continue
 		}
 
-		var tagOptions []string
-		if len(tagParts) > 1 {
-			tagOptions = tagParts[1:]
+		if meta.Attr && m.includeField(field) {
+			tags := m.fieldTags(meta)
+			tagName := tags[len(tags)-1]
+			if err := m.checkRequired(fieldValue, meta.Options, field.Name); err != nil {
+				return name, attrs, err
+			}
+			if meta.OmitEmpty && isEmptyValue(fieldValue) {
+				continue
+			}
+			if meta.OmitZero && isZeroValue(fieldValue) {
+				continue
+			}
+			if err := m.checkName(tagName, field.Name); err != nil {
+				return name, attrs, err
+			}
+			if skip, err := m.checkKind(fieldValue, field.Name); err != nil {
+				return name, attrs, err
+			} else if skip {
+				continue
+			}
+			var value string
+			if qname := reflect.Indirect(fieldValue); qname.IsValid() && qname.Type() == qnameType {
+				value, attrs = m.qualifyQName(qname.Interface().(QName), attrs)
+			} else {
+				value = m.valueString(fieldValue)
+			}
+			if err := fieldViolation(field, value); err != nil {
+				err.Path = m.fieldPath(field.Name)
+				return name, attrs, err
+			}
+			if meta.Redact && m.opts.Redactor != nil {
+				value = m.opts.Redactor(m.filterPath(field.Name), value)
+			}
+			attrs = append(attrs, Attribute{
+				Name:      tagName,
+				Value:     value,
+				Unescaped: meta.NoEscape,
+			})
 		}
+	}
+
+	return name, attrs, nil
+}
 
-		if field.Type == reflect.TypeOf(xml.Name{}) {
-			if xmlName, ok := fieldValue.Interface().(xml.Name); ok && xmlName.Local != "" {
-				element.Name = xmlName.Local
+func (m *marshaler) structContent(val reflect.Value) error {
+	fields := GetFieldMetadata(val.Type())
+
+	for i := range fields {
+		meta := &fields[i]
+		field := meta.FieldType
+		fieldValue := val.FieldByIndex(field.Index)
+
+		if field.Anonymous {
+			if err := m.anonymousContent(fieldValue); err != nil {
+				return err
 			}
 			continue
 		}
 
-		if err := processField(element, fieldValue, tagName, tagOptions, opts); err != nil {
-			return nil, err
+		if meta.XMLName || meta.Attr || !m.includeField(field) {
+			continue
+		}
+
+		m.path = append(m.path, field.Name)
+		var err error
+		switch {
+		case meta.Any:
+			err = m.marshalAny(meta, fieldValue)
+		case meta.CharData:
+			err = m.charData(fieldValue)
+		default:
+			err = m.marshalField(meta, fieldValue)
+		}
+		m.path = m.path[:len(m.path)-1]
+		if err != nil {
+			return err
 		}
 	}
 
-	return element, nil
+	return nil
 }
 
-func processAnonymousField(element *ElementNode, fieldValue reflect.Value, opts *MarshalOptions) error {
-	embeddedNode, err := structToNode(fieldValue, opts, []string{})
-	if err != nil {
-		return err
-	}
-	if embeddedElement, ok := embeddedNode.(*ElementNode); ok {
-		element.Attributes = append(element.Attributes, embeddedElement.Attributes...)
-		element.Children = append(element.Children, embeddedElement.Children...)
+func (m *marshaler) anonymousContent(fieldValue reflect.Value) error {
+	if embedded, ok := embeddedStruct(fieldValue); ok {
+		return m.structContent(embedded)
 	}
-	return nil
+	return m.charData(fieldValue)
 }
 
-func handleSliceNode(val reflect.Value, currentTag string, remainingTags []string, opts *MarshalOptions) (Node, error) {
-	element := acquireElementNode()
-	element.Name = currentTag
-
-	childNodes := make([]Node, val.Len())
-	wg := sync.WaitGroup{}
-	errChan := make(chan error, 1)
-	var mutex sync.Mutex
-
-	for i := 0; i < val.Len(); i++ {
-		wg.Add(1)
-		go func(index int) {
-			defer wg.Done()
-			childValue := val.Index(index)
-			childNode, err := structToNode(childValue, opts, remainingTags)
-			if err != nil {
-				select {
-				case errChan <- err:
-				default:
-				}
-				return
-			}
-			mutex.Lock()
-			childNodes[index] = childNode
-			mutex.Unlock()
-		}(i)
+func (m *marshaler) charData(fieldValue reflect.Value) error {
+	if isNilValue(fieldValue) {
+		return nil
 	}
+	if skip, err := m.checkKind(fieldValue, ""); skip || err != nil {
+		return err
+	}
+	return m.annotate(m.out.writeText(m.valueString(fieldValue)), "")
+}
 
-	wg.Wait()
-	close(errChan)
-
-	if err := <-errChan; err != nil {
-		return nil, err
+func (m *marshaler) marshalSlice(val reflect.Value, currentTag string, remainingTags []string) error {
+	if err := m.startValueElement(currentTag, nil); err != nil {
+		return err
 	}
 
-	for _, node := range childNodes {
-		if node != nil {
-			element.Children = append(element.Children, node)
-		}
+	if err := m.marshalItems(val, remainingTags); err != nil {
+		return err
 	}
 
-	return element, nil
+	return m.endElement()
 }
 
-func handleSimpleNode(val reflect.Value, currentTag string) (Node, error) {
-	element := acquireElementNode()
-	element.Name = currentTag
-
-	textNode := acquireTextNode()
-	textNode.Text = valueToString(val)
-	element.Children = append(element.Children, textNode)
+func (m *marshaler) marshalSimple(val reflect.Value, currentTag string) error {
+	if err := m.startValueElement(currentTag, nil); err != nil {
+		return err
+	}
+	if err := m.writeValueText(currentTag, m.valueString(val)); err != nil {
+		return m.annotate(err, "")
+	}
+	return m.endElement()
+}
 
-	return element, nil
+func (m *marshaler) marshalCData(val reflect.Value, currentTag string) error {
+	if err := m.startValueElement(currentTag, nil); err != nil {
+		return err
+	}
+	if err := m.out.writeCData(m.redact(currentTag, val.String())); err != nil {
+		return err
+	}
+	return m.endElement()
 }
 
-func processField(element *ElementNode, fieldValue reflect.Value, tagName string, tagOptions []string, opts *MarshalOptions) error {
-	if contains(tagOptions, "attr") {
-		attrValue := valueToString(fieldValue)
-		element.Attributes = append(element.Attributes, Attribute{
-			Name:  tagName,
-			Value: attrValue,
-		})
+func (m *marshaler) marshalField(meta *fieldMeta, fieldValue reflect.Value) error {
+	if err := m.checkRequired(fieldValue, meta.Options, ""); err != nil {
+		return err
+	}
+	if fieldValue.Kind() == reflect.Slice && fieldValue.IsNil() && (m.opts.OmitNilSlices || meta.OmitNil) {
 		return nil
 	}
-
-	if contains(tagOptions, "omitempty") && isEmptyValue(fieldValue) {
+	if meta.OmitEmpty && m.isEmpty(fieldValue) {
 		return nil
 	}
-
-	var childTags []string
-	if strings.Contains(tagName, ">") {
-		childTags = strings.Split(tagName, ">")
-	} else {
-		childTags = []string{tagName}
+	if meta.OmitZero && isZeroValue(fieldValue) {
+		return nil
+	}
+	if err := m.validateField(meta.FieldType, fieldValue); err != nil {
+		return err
 	}
 
-	return processChildTags(element, fieldValue, childTags, opts)
-}
+	childTags := m.fieldTags(meta)
 
-func processChildTags(element *ElementNode, fieldValue reflect.Value, childTags []string, opts *MarshalOptions) error {
-	currentElement := element
+	parentLeaf := m.leaf
+	m.leaf = fieldLeaf{
+		tag:       childTags[len(childTags)-1],
+		selfClose: meta.SelfClose,
+		preserve:  meta.Preserve,
+		noescape:  meta.NoEscape,
+	}
+	if meta.Redact && m.opts.Redactor != nil {
+		m.leaf.redactPath = m.filterPath("")
+	}
+	err := m.marshalChildTags(fieldValue, childTags)
+	m.leaf = parentLeaf
+	return err
+}
 
+func (m *marshaler) marshalChildTags(fieldValue reflect.Value, childTags []string) error {
 	for i := 0; i < len(childTags)-1; i++ {
-		newElement := acquireElementNode()
-		newElement.Name = childTags[i]
-		currentElement.Children = append(currentElement.Children, newElement)
-		currentElement = newElement
+		if err := m.startElement(childTags[i], nil); err != nil {
+			return err
+		}
 	}
 
 	lastTag := childTags[len(childTags)-1]
 
-	if fieldValue.Kind() == reflect.Slice || fieldValue.Kind() == reflect.Array {
-		for i := 0; i < fieldValue.Len(); i++ {
-			childValue := fieldValue.Index(i)
-			childNode, err := structToNode(childValue, opts, []string{lastTag})
+	if fieldValue.Kind() == reflect.Slice && fieldValue.IsNil() {
+		if err := m.marshalNil(lastTag); err != nil {
+			return err
+		}
+	} else if fieldValue.Kind() == reflect.Slice || fieldValue.Kind() == reflect.Array {
+		if err := m.marshalItems(fieldValue, []string{lastTag}); err != nil {
+			return err
+		}
+	} else {
+		if err := m.marshalValue(fieldValue, []string{lastTag}); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < len(childTags)-1; i++ {
+		if err := m.endElement(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *marshaler) marshalItems(val reflect.Value, tagHierarchy []string) error {
+	if !m.shouldParallelize(val.Len()) {
+		for i := 0; i < val.Len(); i++ {
+			m.path = append(m.path, indexSegment(i))
+			err := m.marshalValue(val.Index(i), tagHierarchy)
+			m.path = m.path[:len(m.path)-1]
 			if err != nil {
 				return err
 			}
-			if childNode != nil {
-				currentElement.Children = append(currentElement.Children, childNode)
-			}
 		}
-	} else {
-		childNode, err := structToNode(fieldValue, opts, []string{lastTag})
+		return nil
+	}
+
+	nodes, err := m.buildItemsConcurrently(val, tagHierarchy)
+	if err != nil {
+		return err
+	}
+
+	for i, node := range nodes {
+		if node == nil {
+			continue
+		}
+		err := writeNode(m.out, node)
+		releaseNode(node)
 		if err != nil {
-			return err
+			releaseNodes(nodes[i+1:])
+			return m.annotate(err, indexSegment(i))
 		}
-		if childNode != nil {
-			currentElement.Children = append(currentElement.Children, childNode)
+	}
+	return nil
+}
+
+func (m *marshaler) shouldParallelize(length int) bool {
+	threshold := m.opts.ParallelThreshold
+	if threshold <= 0 {
+		threshold = defaultParallelThreshold
+	}
+	return m.opts.Parallelism > 1 && length >= threshold
+}
+
+func (m *marshaler) buildItemsConcurrently(val reflect.Value, tagHierarchy []string) ([]Node, error) {
+	length := val.Len()
+	workers := m.opts.Parallelism
+	if workers > length {
+		workers = length
+	}
+
+	nodes := make([]Node, length)
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	var errOnce sync.Once
+	var firstErr error
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				if m.ctx != nil {
+					if err := m.ctx.Err(); err != nil {
+						errOnce.Do(func() { firstErr = err })
+						continue
+					}
+				}
+				node, err := m.buildItem(val.Index(index), index, tagHierarchy)
+				if err != nil {
+					errOnce.Do(func() { firstErr = err })
+					continue
+				}
+				nodes[index] = node
+			}
+		}()
+	}
+
+	for i := 0; i < length; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		releaseNodes(nodes)
+		return nil, firstErr
+	}
+	return nodes, nil
+}
+
+func (m *marshaler) buildItem(val reflect.Value, index int, tagHierarchy []string) (node Node, err error) {
+	builder := &treeBuilder{}
+	defer func() {
+		if r := recover(); r != nil {
+			builder.release()
+			node, err = nil, fmt.Errorf("panic while encoding slice element: %v", r)
 		}
+	}()
+
+	worker := newMarshaler(m.opts, builder)
+	worker.started = true
+	worker.ctx = m.ctx
+	worker.depth = m.depth
+	worker.deferNamespaces = m.deferNamespaces
+	worker.bindings = append(worker.bindings, m.bindings...)
+	worker.leaf = m.leaf
+	worker.path = append(append(make([]string, 0, len(m.path)+1), m.path...), indexSegment(index))
+	if err := worker.marshalValue(val, tagHierarchy); err != nil {
+		builder.release()
+		return nil, err
 	}
+	return builder.root, nil
+}
 
-	return nil
+func (m *marshaler) checkKind(val reflect.Value, field string) (bool, error) {
+	kind := reflect.Indirect(val).Kind()
+	switch kind {
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		if m.opts.SkipUnsupported {
+			return true, nil
+		}
+		return false, &UnsupportedKindError{Kind: kind, Path: m.fieldPath(field)}
+	}
+	return false, nil
 }
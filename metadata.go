@@ -1,6 +1,7 @@
 package go_xml
 
 import (
+	"encoding/xml"
 	"reflect"
 	"strings"
 	"sync"
@@ -9,10 +10,26 @@ import (
 type fieldMeta struct {
 	Name      string
 	FieldType reflect.StructField
+	Options   []string
+	Tags      []string
+	Explicit  bool
+	Attr      bool
+	OmitEmpty bool
+	XMLName   bool
+	Any       bool
+	CharData  bool
+	OmitZero  bool
+	OmitNil   bool
+	Redact    bool
+	NoEscape  bool
+	SelfClose bool
+	Preserve  bool
 }
 
 var fieldCache sync.Map
 
+var xmlNameType = reflect.TypeOf(xml.Name{})
+
 func GetFieldMetadata(t reflect.Type) []fieldMeta {
 	if cached, ok := fieldCache.Load(t); ok {
 		return cached.([]fieldMeta)
@@ -25,14 +42,24 @@ func GetFieldMetadata(t reflect.Type) []fieldMeta {
 		if xmlTag == "-" {
 			continue
 		}
-		tagParts := strings.Split(xmlTag, ",")
-		tagName := tagParts[0]
-		if tagName == "" {
-			tagName = field.Name
-		}
+		tagName, tagOptions := parseTag(field)
 		fields = append(fields, fieldMeta{
 			Name:      tagName,
 			FieldType: field,
+			Options:   tagOptions,
+			Tags:      strings.Split(namespacedTag(tagName), ">"),
+			Explicit:  hasExplicitName(field),
+			Attr:      contains(tagOptions, "attr"),
+			OmitEmpty: contains(tagOptions, "omitempty"),
+			XMLName:   field.Type == xmlNameType,
+			Any:       contains(tagOptions, "any"),
+			CharData:  contains(tagOptions, "chardata"),
+			OmitZero:  contains(tagOptions, "omitzero"),
+			OmitNil:   contains(tagOptions, "omitnil"),
+			Redact:    contains(tagOptions, "redact"),
+			NoEscape:  contains(tagOptions, "noescape"),
+			SelfClose: contains(tagOptions, "selfclose"),
+			Preserve:  contains(tagOptions, "preserve"),
 		})
 	}
 
@@ -0,0 +1,121 @@
+package go_xml
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+func isValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r == utf8.RuneError {
+			return false
+		}
+		if i == 0 {
+			if !isNameStartChar(r) {
+				return false
+			}
+			continue
+		}
+		if !isNameChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNameStartChar(r rune) bool {
+	switch {
+	case r == ':' || r == '_':
+		return true
+	case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		return true
+	case r >= 0xC0 && r <= 0xD6, r >= 0xD8 && r <= 0xF6, r >= 0xF8 && r <= 0x2FF:
+		return true
+	case r >= 0x370 && r <= 0x37D, r >= 0x37F && r <= 0x1FFF:
+		return true
+	case r >= 0x200C && r <= 0x200D, r >= 0x2070 && r <= 0x218F:
+		return true
+	case r >= 0x2C00 && r <= 0x2FEF, r >= 0x3001 && r <= 0xD7FF:
+		return true
+	case r >= 0xF900 && r <= 0xFDCF, r >= 0xFDF0 && r <= 0xFFFD:
+		return true
+	case r >= 0x10000 && r <= 0xEFFFF:
+		return true
+	}
+	return false
+}
+
+func isNameChar(r rune) bool {
+	switch {
+	case isNameStartChar(r):
+		return true
+	case r == '-' || r == '.' || r == 0xB7:
+		return true
+	case r >= '0' && r <= '9':
+		return true
+	case r >= 0x300 && r <= 0x36F, r >= 0x203F && r <= 0x2040:
+		return true
+	}
+	return false
+}
+
+func (m *marshaler) checkName(name string, field string) error {
+	if !m.opts.StrictNames {
+		return nil
+	}
+	_, name = splitExpandedName(name)
+	if !isValidName(name) {
+		return &InvalidNameError{Name: name, Path: m.fieldPath(field)}
+	}
+	if isReservedName(name) {
+		return &ReservedNameError{Name: name, Path: m.fieldPath(field)}
+	}
+	return nil
+}
+
+func isReservedName(name string) bool {
+	if len(name) < 3 || !strings.EqualFold(name[:3], "xml") {
+		return false
+	}
+	return name != "xmlns" && !strings.HasPrefix(name, "xmlns:") && !strings.HasPrefix(name, "xml:")
+}
+
+func (m *marshaler) fieldPath(field string) string {
+	return joinPath(m.path, field)
+}
+
+func joinPath(path []string, field string) string {
+	var sb strings.Builder
+	for _, segment := range path {
+		if sb.Len() > 0 && !strings.HasPrefix(segment, "[") {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(segment)
+	}
+	if field != "" {
+		if sb.Len() > 0 && !strings.HasPrefix(field, "[") {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(field)
+	}
+	return sb.String()
+}
+
+func indexSegment(i int) string {
+	return "[" + strconv.Itoa(i) + "]"
+}
+
+const xmlSpaceAttr = "xml:space"
+
+func preservesSpace(attrs []Attribute, inherited bool) bool {
+	for _, attr := range attrs {
+		if attr.Name == xmlSpaceAttr {
+			return attr.Value == "preserve"
+		}
+	}
+	return inherited
+}
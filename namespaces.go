@@ -0,0 +1,248 @@
+package go_xml
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var namespaceCache sync.Map
+
+func splitNamespaceTag(tagName string) (string, string, bool) {
+	uri, local, ok := strings.Cut(tagName, " ")
+	if !ok || !strings.Contains(uri, ":") {
+		return "", tagName, false
+	}
+	return uri, strings.TrimSpace(local), true
+}
+
+func expandedName(uri, local string) string {
+	if uri == "" {
+		return local
+	}
+	return "{" + uri + "}" + local
+}
+
+func splitExpandedName(name string) (string, string) {
+	if !strings.HasPrefix(name, "{") {
+		return "", name
+	}
+	end := strings.IndexByte(name, '}')
+	if end < 0 {
+		return "", name
+	}
+	return name[1:end], name[end+1:]
+}
+
+func namespacedTag(tagName string) string {
+	uri, local, ok := splitNamespaceTag(tagName)
+	if !ok {
+		return tagName
+	}
+	if i := strings.LastIndexByte(local, '>'); i >= 0 {
+		return local[:i+1] + expandedName(uri, local[i+1:])
+	}
+	return expandedName(uri, local)
+}
+
+func usesNamespaces(t reflect.Type) bool {
+	if cached, ok := namespaceCache.Load(t); ok {
+		return cached.(bool)
+	}
+	result := scanNamespaces(t, make(map[reflect.Type]bool))
+	namespaceCache.Store(t, result)
+	return result
+}
+
+func scanNamespaces(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	for _, meta := range GetFieldMetadata(t) {
+		if _, _, ok := splitNamespaceTag(meta.Name); ok {
+			return true
+		}
+		if scanNamespaces(meta.FieldType.Type, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+func qualifyAttributes(name string, attrs []Attribute) (string, []Attribute) {
+	uri, local := splitExpandedName(name)
+	if uri != "" {
+		name = local
+		attrs = setAttribute(attrs, Attribute{Name: "xmlns", Value: uri})
+	}
+
+	declared := 0
+	for i := range attrs {
+		uri, local := splitExpandedName(attrs[i].Name)
+		if uri == "" {
+			continue
+		}
+		prefix, ok := declaredPrefix(attrs, uri)
+		if !ok {
+			for prefix == "" || hasAttribute(attrs, "xmlns:"+prefix) {
+				declared++
+				prefix = "ns" + strconv.Itoa(declared)
+			}
+			attrs = append(attrs, Attribute{Name: "xmlns:" + prefix, Value: uri})
+		}
+		attrs[i].Name = prefix + ":" + local
+	}
+	return name, attrs
+}
+
+func declaredPrefix(attrs []Attribute, uri string) (string, bool) {
+	for _, attr := range attrs {
+		if prefix, ok := namespacePrefix(attr.Name); ok && prefix != "" && attr.Value == uri {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+type namespaceUse struct {
+	uri      string
+	ancestor []*ElementNode
+}
+
+type pendingName struct {
+	node  *ElementNode
+	attr  int
+	uri   string
+	local string
+}
+
+type namespaceResolver struct {
+	uses    []*namespaceUse
+	byURI   map[string]*namespaceUse
+	pending []pendingName
+	taken   map[string]bool
+	stack   []*ElementNode
+}
+
+func resolveNamespaces(root *ElementNode) {
+	r := &namespaceResolver{
+		byURI: make(map[string]*namespaceUse),
+		taken: make(map[string]bool),
+	}
+	r.walk(root, "", nil)
+	if len(r.uses) == 0 {
+		return
+	}
+
+	prefixes := make(map[string]string, len(r.uses))
+	next := 0
+	for _, use := range r.uses {
+		prefix := ""
+		for prefix == "" || r.taken[prefix] {
+			next++
+			prefix = "ns" + strconv.Itoa(next)
+		}
+		prefixes[use.uri] = prefix
+	}
+
+	for _, p := range r.pending {
+		name := prefixes[p.uri] + ":" + p.local
+		if p.attr < 0 {
+			p.node.Name = name
+		} else {
+			p.node.Attributes[p.attr].Name = name
+		}
+	}
+
+	for _, use := range r.uses {
+		owner := use.ancestor[len(use.ancestor)-1]
+		owner.Attributes = insertDeclaration(owner.Attributes, Attribute{Name: "xmlns:" + prefixes[use.uri], Value: use.uri})
+	}
+}
+
+func (r *namespaceResolver) walk(node *ElementNode, defaultURI string, scope map[string]string) {
+	for _, attr := range node.Attributes {
+		prefix, ok := namespacePrefix(attr.Name)
+		if !ok {
+			continue
+		}
+		if prefix == "" {
+			defaultURI = attr.Value
+			continue
+		}
+		r.taken[prefix] = true
+		copied := make(map[string]string, len(scope)+1)
+		for uri, p := range scope {
+			copied[uri] = p
+		}
+		copied[attr.Value] = prefix
+		scope = copied
+	}
+
+	r.stack = append(r.stack, node)
+	if uri, local := splitExpandedName(node.Name); uri != "" {
+		switch {
+		case uri == defaultURI:
+			node.Name = local
+		case scope[uri] != "":
+			node.Name = scope[uri] + ":" + local
+		default:
+			r.use(uri)
+			r.pending = append(r.pending, pendingName{node: node, attr: -1, uri: uri, local: local})
+		}
+	}
+	for i, attr := range node.Attributes {
+		uri, local := splitExpandedName(attr.Name)
+		if uri == "" {
+			continue
+		}
+		if prefix := scope[uri]; prefix != "" {
+			node.Attributes[i].Name = prefix + ":" + local
+			continue
+		}
+		r.use(uri)
+		r.pending = append(r.pending, pendingName{node: node, attr: i, uri: uri, local: local})
+	}
+
+	for _, child := range node.Children {
+		if element, ok := child.(*ElementNode); ok {
+			r.walk(element, defaultURI, scope)
+		}
+	}
+	r.stack = r.stack[:len(r.stack)-1]
+}
+
+func (r *namespaceResolver) use(uri string) {
+	use, ok := r.byURI[uri]
+	if !ok {
+		use = &namespaceUse{uri: uri, ancestor: append([]*ElementNode(nil), r.stack...)}
+		r.byURI[uri] = use
+		r.uses = append(r.uses, use)
+		return
+	}
+	common := 0
+	for common < len(use.ancestor) && common < len(r.stack) && use.ancestor[common] == r.stack[common] {
+		common++
+	}
+	use.ancestor = use.ancestor[:common]
+}
+
+func insertDeclaration(attrs []Attribute, decl Attribute) []Attribute {
+	i := 0
+	for i < len(attrs) {
+		if _, ok := namespacePrefix(attrs[i].Name); !ok {
+			break
+		}
+		i++
+	}
+	attrs = append(attrs, Attribute{})
+	copy(attrs[i+1:], attrs[i:])
+	attrs[i] = decl
+	return attrs
+}
@@ -0,0 +1,83 @@
+package go_xml
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func (m *marshaler) fieldTags(meta *fieldMeta) []string {
+	if m.opts.NameStrategy == nil || meta.Explicit {
+		return meta.Tags
+	}
+	return strings.Split(namespacedTag(m.opts.NameStrategy(meta.FieldType.Name)), ">")
+}
+
+func hasExplicitName(field reflect.StructField) bool {
+	name, _, _ := strings.Cut(field.Tag.Get("xml"), ",")
+	return name != ""
+}
+
+func splitWords(s string) []string {
+	var words []string
+	runes := []rune(s)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '_' || r == '-' || r == ' ' || r == '.' {
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+			continue
+		}
+		if i == start || !unicode.IsUpper(r) {
+			continue
+		}
+		prev := runes[i-1]
+		nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+func joinWords(s, sep string, transform func(i int, word string) string) string {
+	words := splitWords(s)
+	for i, word := range words {
+		words[i] = transform(i, word)
+	}
+	return strings.Join(words, sep)
+}
+
+func upperFirst(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + word[size:]
+}
+
+func SnakeCase(s string) string {
+	return joinWords(s, "_", func(_ int, word string) string { return strings.ToLower(word) })
+}
+
+func KebabCase(s string) string {
+	return joinWords(s, "-", func(_ int, word string) string { return strings.ToLower(word) })
+}
+
+func CamelCase(s string) string {
+	return joinWords(s, "", func(i int, word string) string {
+		if i == 0 {
+			return strings.ToLower(word)
+		}
+		return upperFirst(word)
+	})
+}
+
+func PascalCase(s string) string {
+	return joinWords(s, "", func(_ int, word string) string { return upperFirst(word) })
+}
@@ -0,0 +1,36 @@
+package go_xml
+
+type NilPolicy int
+
+const (
+	NilOmit NilPolicy = iota
+	NilEmpty
+	NilSelfClose
+	NilXSI
+)
+
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+func (m *marshaler) marshalNil(currentTag string) error {
+	if m.opts.NilValues == NilOmit || currentTag == "" {
+		return nil
+	}
+
+	var attrs []Attribute
+	if m.opts.NilValues == NilXSI {
+		prefix, ok := m.lookupPrefix(xsiNamespace, nil)
+		if !ok || prefix == "" {
+			prefix = "xsi"
+			attrs = append(attrs, Attribute{Name: "xmlns:xsi", Value: xsiNamespace})
+		}
+		attrs = append(attrs, Attribute{Name: prefix + ":nil", Value: "true"})
+	}
+
+	if err := m.startValueElement(currentTag, attrs); err != nil {
+		return err
+	}
+	if m.opts.NilValues != NilEmpty {
+		m.out.selfClose()
+	}
+	return m.endElement()
+}
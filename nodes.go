@@ -12,11 +12,28 @@ type Node interface {
 type Visitor interface {
 	VisitElement(node *ElementNode) error
 	VisitText(node *TextNode) error
+	VisitComment(node *CommentNode) error
+	VisitCData(node *CDataNode) error
+	VisitProcessingInstruction(node *ProcessingInstructionNode) error
+	VisitRaw(node *RawNode) error
+}
+
+type elementWriter interface {
+	startElement(name string, attrs []Attribute) error
+	writeText(text string) error
+	writeUnescaped(text string) error
+	writeComment(text string) error
+	writeCData(text string) error
+	writeProcInst(target, data string) error
+	writeRaw(raw string) error
+	selfClose()
+	endElement() error
 }
 
 type Attribute struct {
-	Name  string
-	Value string
+	Name      string
+	Value     string
+	Unescaped bool
 }
 
 type ElementNode struct {
@@ -27,46 +44,101 @@ type ElementNode struct {
 }
 
 type TextNode struct {
+	Text      string
+	Unescaped bool
+}
+
+type CommentNode struct {
 	Text string
 }
 
+type CDataNode struct {
+	Text string
+}
+
+type ProcessingInstructionNode struct {
+	Target string
+	Data   string
+}
+
+type RawXML string
+
+type CDATA string
+
+type RawNode struct {
+	XML string
+}
+
 var (
 	elementNodePool = sync.Pool{
 		New: func() interface{} {
+			elementCounters.new()
+			cfg := currentPoolConfig()
 			return &ElementNode{
-				Attributes: make([]Attribute, 0, 10),
-				Children:   make([]Node, 0, 10),
+				Attributes: make([]Attribute, 0, cfg.AttributeCapacity),
+				Children:   make([]Node, 0, cfg.ChildrenCapacity),
 			}
 		},
 	}
 
 	textNodePool = sync.Pool{
 		New: func() interface{} {
+			textNodeCounters.new()
 			return &TextNode{}
 		},
 	}
 )
 
 func acquireElementNode() *ElementNode {
+	elementCounters.get()
 	node := elementNodePool.Get().(*ElementNode)
 	node.Reset()
 	return node
 }
 
 func releaseElementNode(node *ElementNode) {
+	clear(node.Attributes)
+	clear(node.Children)
+	node.Reset()
+	if limit := currentPoolConfig().MaxNodeCapacity; exceedsLimit(cap(node.Attributes), limit) || exceedsLimit(cap(node.Children), limit) {
+		elementCounters.drop()
+		return
+	}
+	elementCounters.put()
 	elementNodePool.Put(node)
 }
 
 func acquireTextNode() *TextNode {
+	textNodeCounters.get()
 	node := textNodePool.Get().(*TextNode)
 	node.Reset()
 	return node
 }
 
 func releaseTextNode(node *TextNode) {
+	node.Reset()
+	textNodeCounters.put()
 	textNodePool.Put(node)
 }
 
+func releaseNode(node Node) {
+	switch n := node.(type) {
+	case *ElementNode:
+		releaseNodes(n.Children)
+		releaseElementNode(n)
+	case *TextNode:
+		releaseTextNode(n)
+	}
+}
+
+func releaseNodes(nodes []Node) {
+	for _, node := range nodes {
+		if node != nil {
+			releaseNode(node)
+		}
+	}
+}
+
 func (n *ElementNode) Accept(visitor Visitor) error {
 	return visitor.VisitElement(n)
 }
@@ -84,13 +156,184 @@ func (n *TextNode) Accept(visitor Visitor) error {
 
 func (n *TextNode) Reset() {
 	n.Text = ""
+	n.Unescaped = false
+}
+
+func (n *CommentNode) Accept(visitor Visitor) error {
+	return visitor.VisitComment(n)
+}
+
+func (n *CommentNode) Reset() {
+	n.Text = ""
+}
+
+func (n *CDataNode) Accept(visitor Visitor) error {
+	return visitor.VisitCData(n)
+}
+
+func (n *CDataNode) Reset() {
+	n.Text = ""
+}
+
+func (n *ProcessingInstructionNode) Accept(visitor Visitor) error {
+	return visitor.VisitProcessingInstruction(n)
+}
+
+func (n *ProcessingInstructionNode) Reset() {
+	n.Target = ""
+	n.Data = ""
+}
+
+func (n *RawNode) Accept(visitor Visitor) error {
+	return visitor.VisitRaw(n)
+}
+
+func (n *RawNode) Reset() {
+	n.XML = ""
 }
 
 func (n *ElementNode) HasAttribute(name string) bool {
-	for _, attr := range n.Attributes {
-		if attr.Name == name {
-			return true
+	return hasAttribute(n.Attributes, name)
+}
+
+type treeBuilder struct {
+	root     Node
+	stack    []*ElementNode
+	maxBytes int
+	size     int
+}
+
+func (b *treeBuilder) count(n int) error {
+	b.size += n
+	if b.maxBytes > 0 && b.size > b.maxBytes {
+		return &LimitError{Limit: "MaxBytes", Max: b.maxBytes}
+	}
+	return nil
+}
+
+func (b *treeBuilder) appendChild(node Node) {
+	if len(b.stack) == 0 {
+		if b.root == nil {
+			b.root = node
+		}
+		return
+	}
+	parent := b.stack[len(b.stack)-1]
+	parent.Children = append(parent.Children, node)
+}
+
+func (b *treeBuilder) startElement(name string, attrs []Attribute) error {
+	if b.maxBytes > 0 {
+		_, local := splitExpandedName(name)
+		n := len(local) + len("</>")
+		for _, attr := range attrs {
+			_, local := splitExpandedName(attr.Name)
+			n += len(local) + len(attr.Value) + len(` =""`)
+		}
+		if err := b.count(n); err != nil {
+			return err
+		}
+	}
+	node := acquireElementNode()
+	node.Name = name
+	node.Attributes = append(node.Attributes, attrs...)
+	b.appendChild(node)
+	b.stack = append(b.stack, node)
+	return nil
+}
+
+func (b *treeBuilder) writeText(text string) error {
+	if err := b.count(len(text)); err != nil {
+		return err
+	}
+	node := acquireTextNode()
+	node.Text = text
+	b.appendChild(node)
+	return nil
+}
+
+func (b *treeBuilder) writeUnescaped(text string) error {
+	if err := b.count(len(text)); err != nil {
+		return err
+	}
+	node := acquireTextNode()
+	node.Text = text
+	node.Unescaped = true
+	b.appendChild(node)
+	return nil
+}
+
+func (b *treeBuilder) writeComment(text string) error {
+	if err := b.count(len(text)); err != nil {
+		return err
+	}
+	b.appendChild(&CommentNode{Text: text})
+	return nil
+}
+
+func (b *treeBuilder) writeCData(text string) error {
+	if err := b.count(len(text)); err != nil {
+		return err
+	}
+	b.appendChild(&CDataNode{Text: text})
+	return nil
+}
+
+func (b *treeBuilder) writeProcInst(target, data string) error {
+	b.appendChild(&ProcessingInstructionNode{Target: target, Data: data})
+	return nil
+}
+
+func (b *treeBuilder) writeRaw(raw string) error {
+	if err := b.count(len(raw)); err != nil {
+		return err
+	}
+	b.appendChild(&RawNode{XML: raw})
+	return nil
+}
+
+func (b *treeBuilder) selfClose() {
+	b.stack[len(b.stack)-1].SelfClose = true
+}
+
+func (b *treeBuilder) endElement() error {
+	b.stack = b.stack[:len(b.stack)-1]
+	return nil
+}
+
+func (b *treeBuilder) release() {
+	if b.root != nil {
+		releaseNode(b.root)
+		b.root = nil
+	}
+	b.stack = b.stack[:0]
+}
+
+func writeNode(out elementWriter, node Node) error {
+	switch n := node.(type) {
+	case *ElementNode:
+		if err := out.startElement(n.Name, n.Attributes); err != nil {
+			return err
+		}
+		if n.SelfClose {
+			out.selfClose()
+		}
+		for _, child := range n.Children {
+			if err := writeNode(out, child); err != nil {
+				return err
+			}
 		}
+		return out.endElement()
+	case *TextNode:
+		return out.writeText(n.Text)
+	case *CommentNode:
+		return out.writeComment(n.Text)
+	case *CDataNode:
+		return out.writeCData(n.Text)
+	case *ProcessingInstructionNode:
+		return out.writeProcInst(n.Target, n.Data)
+	case *RawNode:
+		return out.writeRaw(n.XML)
 	}
-	return false
+	return nil
 }
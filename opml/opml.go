@@ -0,0 +1,121 @@
+package opml
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+var ErrNotOPML = errors.New("opml: document is not OPML")
+
+type Document struct {
+	Version  string    `xml:"version,attr"`
+	Head     Head      `xml:"head"`
+	Outlines []Outline `xml:"body>outline"`
+}
+
+type Head struct {
+	Title           string `xml:"title,omitempty"`
+	DateCreated     string `xml:"dateCreated,omitempty"`
+	DateModified    string `xml:"dateModified,omitempty"`
+	OwnerName       string `xml:"ownerName,omitempty"`
+	OwnerEmail      string `xml:"ownerEmail,omitempty"`
+	OwnerID         string `xml:"ownerId,omitempty"`
+	Docs            string `xml:"docs,omitempty"`
+	ExpansionState  string `xml:"expansionState,omitempty"`
+	VertScrollState int    `xml:"vertScrollState,omitempty"`
+	WindowTop       int    `xml:"windowTop,omitempty"`
+	WindowLeft      int    `xml:"windowLeft,omitempty"`
+	WindowBottom    int    `xml:"windowBottom,omitempty"`
+	WindowRight     int    `xml:"windowRight,omitempty"`
+}
+
+type Outline struct {
+	Text         string    `xml:"text,attr"`
+	Title        string    `xml:"title,attr,omitempty"`
+	Type         string    `xml:"type,attr,omitempty"`
+	XMLURL       string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL      string    `xml:"htmlUrl,attr,omitempty"`
+	Description  string    `xml:"description,attr,omitempty"`
+	Language     string    `xml:"language,attr,omitempty"`
+	Version      string    `xml:"version,attr,omitempty"`
+	Category     string    `xml:"category,attr,omitempty"`
+	Created      string    `xml:"created,attr,omitempty"`
+	IsComment    bool      `xml:"isComment,attr,omitempty"`
+	IsBreakpoint bool      `xml:"isBreakpoint,attr,omitempty"`
+	Outlines     []Outline `xml:"outline,omitempty"`
+}
+
+func New(title string) *Document {
+	return &Document{
+		Version: "2.0",
+		Head:    Head{Title: title, DateCreated: FormatDate(time.Now())},
+	}
+}
+
+func Feed(title, xmlURL, htmlURL string) Outline {
+	return Outline{Text: title, Title: title, Type: "rss", XMLURL: xmlURL, HTMLURL: htmlURL}
+}
+
+func FormatDate(t time.Time) string {
+	return t.Format(time.RFC1123Z)
+}
+
+func (d *Document) Marshal(opts *go_xml.MarshalOptions) ([]byte, error) {
+	marshalOpts := go_xml.MarshalOptions{XMLHeader: true, Indent: "  "}
+	if opts != nil {
+		marshalOpts = *opts
+	}
+	marshalOpts.RootTag = "opml"
+	marshalOpts.Namespace = ""
+
+	doc := *d
+	if doc.Version == "" {
+		doc.Version = "2.0"
+	}
+	return go_xml.Marshal(doc, &marshalOpts)
+}
+
+func Parse(data []byte) (*Document, error) {
+	root, err := go_xml.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if root.Name != "opml" {
+		return nil, fmt.Errorf("%w: root element is <%s>", ErrNotOPML, root.Name)
+	}
+
+	doc := &Document{}
+	if err := go_xml.UnmarshalNode(root, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (d *Document) Walk(fn func(outline *Outline, depth int) bool) {
+	walk(d.Outlines, 0, fn)
+}
+
+func walk(outlines []Outline, depth int, fn func(outline *Outline, depth int) bool) bool {
+	for i := range outlines {
+		if !fn(&outlines[i], depth) || !walk(outlines[i].Outlines, depth+1, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Document) Feeds() []Outline {
+	var feeds []Outline
+	d.Walk(func(outline *Outline, depth int) bool {
+		if outline.XMLURL != "" {
+			feed := *outline
+			feed.Outlines = nil
+			feeds = append(feeds, feed)
+		}
+		return true
+	})
+	return feeds
+}
@@ -0,0 +1,77 @@
+package opml
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+func TestMarshal(t *testing.T) {
+	doc := &Document{
+		Head: Head{Title: "Subscriptions", OwnerName: "Alice", DateCreated: "Fri, 01 Mar 2024 09:00:00 +0000"},
+		Outlines: []Outline{
+			{Text: "Go", Outlines: []Outline{
+				Feed("Go Blog", "https://go.dev/blog/feed.atom", "https://go.dev/blog"),
+			}},
+			Feed("XML & Friends", "https://example.com/feed", ""),
+		},
+	}
+
+	output, err := doc.Marshal(nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head>
+    <title>Subscriptions</title>
+    <dateCreated>Fri, 01 Mar 2024 09:00:00 +0000</dateCreated>
+    <ownerName>Alice</ownerName>
+  </head>
+  <body>
+    <outline text="Go">
+      <outline text="Go Blog" title="Go Blog" type="rss" xmlUrl="https://go.dev/blog/feed.atom" htmlUrl="https://go.dev/blog"></outline>
+    </outline>
+    <outline text="XML &amp; Friends" title="XML &amp; Friends" type="rss" xmlUrl="https://example.com/feed"></outline>
+  </body>
+</opml>`
+	if string(output) != expected {
+		t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", expected, output)
+	}
+
+	parsed, err := Parse(output)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	doc.Version = "2.0"
+	if !reflect.DeepEqual(parsed, doc) {
+		t.Errorf("Round trip mismatch.\nExpected: %+v\nGot: %+v", doc, parsed)
+	}
+
+	var depths []int
+	parsed.Walk(func(outline *Outline, depth int) bool {
+		depths = append(depths, depth)
+		return true
+	})
+	if !reflect.DeepEqual(depths, []int{0, 1, 0}) {
+		t.Errorf("Unexpected walk depths %v", depths)
+	}
+	if feeds := parsed.Feeds(); len(feeds) != 2 || feeds[0].Text != "Go Blog" {
+		t.Errorf("Unexpected feeds %+v", feeds)
+	}
+}
+
+func TestParseRejectsOtherDocuments(t *testing.T) {
+	if _, err := Parse([]byte(`<rss/>`)); !errors.Is(err, ErrNotOPML) {
+		t.Errorf("Expected ErrNotOPML, got %v", err)
+	}
+	if _, err := Parse([]byte(`<opml>`)); err == nil {
+		t.Errorf("Expected a parse error")
+	}
+	if _, err := New("x").Marshal(&go_xml.MarshalOptions{}); err != nil {
+		t.Errorf("Marshal error: %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+package go_xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func Parse(data []byte) (*ElementNode, error) {
+	return ParseWithOptions(data, nil)
+}
+
+func ParseWithOptions(data []byte, opts *UnmarshalOptions) (*ElementNode, error) {
+	root, _, err := parseDocument(data, opts, false)
+	return root, err
+}
+
+func parseDocument(data []byte, opts *UnmarshalOptions, track bool) (*ElementNode, []nodePosition, error) {
+	p := &parser{
+		opts:    resolveUnmarshalOptions(opts),
+		decoder: xml.NewDecoder(bytes.NewReader(data)),
+		input:   data,
+		track:   track,
+	}
+	root, err := p.parse()
+	if err != nil {
+		err = p.decodeError(err, p.elementPath(""))
+		if p.root != nil {
+			releaseNode(p.root)
+		}
+		return nil, nil, err
+	}
+	return root, p.positions, nil
+}
+
+type parser struct {
+	opts      UnmarshalOptions
+	decoder   *xml.Decoder
+	root      *ElementNode
+	stack     []*ElementNode
+	input     []byte
+	chars     int
+	entities  *entityExpander
+	track     bool
+	positions []nodePosition
+	position  nodePosition
+}
+
+func (p *parser) parse() (*ElementNode, error) {
+	for {
+		p.mark()
+		token, err := p.decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			p.mark()
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if err := p.startElement(t); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			name := qualifiedName(t.Name)
+			if len(p.stack) == 0 || p.stack[len(p.stack)-1].Name != name {
+				return nil, fmt.Errorf("unexpected end element </%s>", name)
+			}
+			p.stack = p.stack[:len(p.stack)-1]
+			if len(p.stack) == 0 && p.opts.Lenient {
+				return p.root, nil
+			}
+		case xml.CharData:
+			raw := p.raw()
+			if strings.HasPrefix(raw, "<![CDATA[") {
+				raw = ""
+			}
+			text, err := p.expandEntities(string(t), raw)
+			if err != nil {
+				return nil, err
+			}
+			if len(p.stack) == 0 {
+				if strings.TrimSpace(text) != "" {
+					return nil, fmt.Errorf("character data outside the root element")
+				}
+				continue
+			}
+			appendText(p.stack[len(p.stack)-1], text)
+		case xml.Comment:
+			if err := p.countChars(len(t)); err != nil {
+				return nil, err
+			}
+			if len(p.stack) > 0 {
+				parent := p.stack[len(p.stack)-1]
+				parent.Children = append(parent.Children, &CommentNode{Text: string(t)})
+			}
+		case xml.ProcInst:
+			if err := p.countChars(len(t.Inst)); err != nil {
+				return nil, err
+			}
+			if len(p.stack) > 0 {
+				parent := p.stack[len(p.stack)-1]
+				parent.Children = append(parent.Children, &ProcessingInstructionNode{Target: t.Target, Data: string(t.Inst)})
+			}
+		case xml.Directive:
+			if p.root == nil {
+				if err := p.declareEntities(t); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if p.root == nil {
+		return nil, fmt.Errorf("document has no root element")
+	}
+	if len(p.stack) > 0 {
+		return nil, fmt.Errorf("unclosed element <%s>", p.stack[len(p.stack)-1].Name)
+	}
+	return p.root, nil
+}
+
+func (p *parser) startElement(t xml.StartElement) error {
+	name := qualifiedName(t.Name)
+	if len(p.stack) == 0 && p.root != nil {
+		return fmt.Errorf("multiple root elements: <%s> after <%s>", name, p.root.Name)
+	}
+	if exceedsLimit(len(p.stack)+1, p.opts.MaxDepth) {
+		path := p.elementPath(name)
+		return p.decodeError(&LimitError{Limit: "MaxDepth", Max: p.opts.MaxDepth, Path: path}, path)
+	}
+	if exceedsLimit(len(t.Attr), p.opts.MaxAttributes) {
+		path := p.elementPath(name)
+		return p.decodeError(&LimitError{Limit: "MaxAttributes", Max: p.opts.MaxAttributes, Path: path}, path)
+	}
+
+	node := acquireElementNode()
+	node.Name = name
+	if len(p.stack) == 0 {
+		p.root = node
+	} else {
+		parent := p.stack[len(p.stack)-1]
+		parent.Children = append(parent.Children, node)
+	}
+	p.stack = append(p.stack, node)
+	if p.track {
+		p.positions = append(p.positions, p.position)
+	}
+
+	var raw []string
+	if p.entities != nil {
+		if raw = rawAttributeValues(p.raw()); len(raw) != len(t.Attr) {
+			return fmt.Errorf("malformed attributes in <%s>", name)
+		}
+	}
+	for i, attr := range t.Attr {
+		var rawValue string
+		if raw != nil {
+			rawValue = raw[i]
+		}
+		value, err := p.expandEntities(attr.Value, rawValue)
+		if err != nil {
+			return err
+		}
+		if exceedsLimit(len(value), p.opts.MaxAttributeLength) {
+			path := p.elementPath("@" + qualifiedName(attr.Name))
+			return p.decodeError(&LimitError{Limit: "MaxAttributeLength", Max: p.opts.MaxAttributeLength, Path: path}, path)
+		}
+		node.Attributes = append(node.Attributes, Attribute{
+			Name:  qualifiedName(attr.Name),
+			Value: value,
+		})
+	}
+	return nil
+}
+
+func (p *parser) countChars(n int) error {
+	p.chars += n
+	if exceedsLimit(p.chars, p.opts.MaxCharacters) {
+		return &LimitError{Limit: "MaxCharacters", Max: p.opts.MaxCharacters, Path: p.elementPath("")}
+	}
+	return nil
+}
+
+func (p *parser) raw() string {
+	if p.entities == nil {
+		return ""
+	}
+	return string(p.input[p.position.offset:p.decoder.InputOffset()])
+}
+
+func (p *parser) mark() {
+	p.position.line, p.position.column = p.decoder.InputPos()
+	p.position.offset = p.decoder.InputOffset()
+}
+
+func (p *parser) decodeError(err error, path string) error {
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	return &DecodeError{
+		Line:   p.position.line,
+		Column: p.position.column,
+		Offset: p.position.offset,
+		Path:   path,
+		Err:    err,
+	}
+}
+
+func (p *parser) elementPath(name string) string {
+	var sb strings.Builder
+	var parent *ElementNode
+	for _, node := range p.stack {
+		sb.WriteByte('/')
+		sb.WriteString(elementSegment(parent, node, node.Name))
+		parent = node
+	}
+	if strings.HasPrefix(name, "@") {
+		sb.WriteByte('/')
+		sb.WriteString(name)
+	} else if name != "" {
+		sb.WriteByte('/')
+		sb.WriteString(elementSegment(parent, nil, name))
+	}
+	return sb.String()
+}
+
+func appendText(parent *ElementNode, text string) {
+	if len(parent.Children) > 0 {
+		if last, ok := parent.Children[len(parent.Children)-1].(*TextNode); ok {
+			last.Text += text
+			return
+		}
+	}
+	node := acquireTextNode()
+	node.Text = text
+	parent.Children = append(parent.Children, node)
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+func splitQualifiedName(name string) (string, string) {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
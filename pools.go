@@ -0,0 +1,138 @@
+package go_xml
+
+import (
+	"sync/atomic"
+)
+
+const (
+	defaultAttributeCapacity = 10
+	defaultChildrenCapacity  = 10
+	defaultMaxBufferSize     = 64 << 10
+	defaultMaxNodeCapacity   = 256
+)
+
+type PoolConfig struct {
+	AttributeCapacity int
+	ChildrenCapacity  int
+	MaxBufferSize     int
+	MaxNodeCapacity   int
+	Instrument        bool
+}
+
+type PoolCounters struct {
+	Gets  uint64
+	Puts  uint64
+	News  uint64
+	Drops uint64
+}
+
+type PoolStats struct {
+	Buffers  PoolCounters
+	Writers  PoolCounters
+	Elements PoolCounters
+	Texts    PoolCounters
+}
+
+type poolCounters struct {
+	gets  atomic.Uint64
+	puts  atomic.Uint64
+	news  atomic.Uint64
+	drops atomic.Uint64
+}
+
+var (
+	poolConfig atomic.Pointer[PoolConfig]
+
+	bufferCounters   poolCounters
+	writerCounters   poolCounters
+	elementCounters  poolCounters
+	textNodeCounters poolCounters
+)
+
+func ConfigurePools(cfg PoolConfig) {
+	if cfg.AttributeCapacity <= 0 {
+		cfg.AttributeCapacity = defaultAttributeCapacity
+	}
+	if cfg.ChildrenCapacity <= 0 {
+		cfg.ChildrenCapacity = defaultChildrenCapacity
+	}
+	if cfg.MaxBufferSize == 0 {
+		cfg.MaxBufferSize = defaultMaxBufferSize
+	}
+	if cfg.MaxNodeCapacity == 0 {
+		cfg.MaxNodeCapacity = defaultMaxNodeCapacity
+	}
+	poolConfig.Store(&cfg)
+}
+
+func currentPoolConfig() PoolConfig {
+	if cfg := poolConfig.Load(); cfg != nil {
+		return *cfg
+	}
+	return PoolConfig{
+		AttributeCapacity: defaultAttributeCapacity,
+		ChildrenCapacity:  defaultChildrenCapacity,
+		MaxBufferSize:     defaultMaxBufferSize,
+		MaxNodeCapacity:   defaultMaxNodeCapacity,
+	}
+}
+
+func instrumented() bool {
+	cfg := poolConfig.Load()
+	return cfg != nil && cfg.Instrument
+}
+
+func (c *poolCounters) get() {
+	if instrumented() {
+		c.gets.Add(1)
+	}
+}
+
+func (c *poolCounters) put() {
+	if instrumented() {
+		c.puts.Add(1)
+	}
+}
+
+func (c *poolCounters) new() {
+	if instrumented() {
+		c.news.Add(1)
+	}
+}
+
+func (c *poolCounters) drop() {
+	if instrumented() {
+		c.drops.Add(1)
+	}
+}
+
+func (c *poolCounters) snapshot() PoolCounters {
+	return PoolCounters{Gets: c.gets.Load(), Puts: c.puts.Load(), News: c.news.Load(), Drops: c.drops.Load()}
+}
+
+func (c *poolCounters) reset() {
+	c.gets.Store(0)
+	c.puts.Store(0)
+	c.news.Store(0)
+	c.drops.Store(0)
+}
+
+func exceedsLimit(size, limit int) bool {
+	return limit > 0 && size > limit
+}
+
+func PoolStatistics() PoolStats {
+	return PoolStats{
+		Buffers:  bufferCounters.snapshot(),
+		Writers:  writerCounters.snapshot(),
+		Elements: elementCounters.snapshot(),
+		Texts:    textNodeCounters.snapshot(),
+	}
+}
+
+func ResetPoolStatistics() {
+	bufferCounters.reset()
+	writerCounters.reset()
+	elementCounters.reset()
+	textNodeCounters.reset()
+}
@@ -0,0 +1,83 @@
+package go_xml
+
+import (
+	"strconv"
+	"strings"
+)
+
+type nodePosition struct {
+	line   int
+	column int
+	offset int64
+}
+
+func elementSegment(parent, node *ElementNode, name string) string {
+	if parent == nil {
+		return name
+	}
+	index, total := 0, 0
+	for _, child := range parent.Children {
+		element, ok := child.(*ElementNode)
+		if !ok || element.Name != name {
+			continue
+		}
+		total++
+		if element == node {
+			index = total
+		}
+	}
+	if node == nil {
+		total++
+		index = total
+	}
+	if total < 2 {
+		return name
+	}
+	return name + "[" + strconv.Itoa(index) + "]"
+}
+
+func locateNode(root, target *ElementNode) (string, int, bool) {
+	var segments []string
+	order := 0
+	var walk func(parent, node *ElementNode) bool
+	walk = func(parent, node *ElementNode) bool {
+		segments = append(segments, elementSegment(parent, node, node.Name))
+		if node == target {
+			return true
+		}
+		order++
+		for _, child := range node.Children {
+			if element, ok := child.(*ElementNode); ok && walk(node, element) {
+				return true
+			}
+		}
+		segments = segments[:len(segments)-1]
+		return false
+	}
+	if root == nil || target == nil || !walk(nil, root) {
+		return "", 0, false
+	}
+	return "/" + strings.Join(segments, "/"), order, true
+}
+
+func (u *unmarshaler) locate(err error, node *ElementNode, attr string) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	path, order, ok := locateNode(u.root, node)
+	if !ok {
+		return err
+	}
+	if attr != "" {
+		path += "/@" + attr
+	}
+	decodeErr := &DecodeError{Path: path, Err: err}
+	if order < len(u.positions) {
+		pos := u.positions[order]
+		decodeErr.Line, decodeErr.Column, decodeErr.Offset = pos.line, pos.column, pos.offset
+	}
+	return decodeErr
+}
@@ -0,0 +1,131 @@
+package go_xml
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Declaration struct {
+	Version    string
+	Encoding   string
+	Standalone string
+}
+
+func (d *Declaration) String() (string, error) {
+	version := d.Version
+	if version == "" {
+		version = "1.0"
+	}
+	if version != "1.0" && version != "1.1" {
+		return "", fmt.Errorf("unsupported XML version %q", version)
+	}
+	if d.Encoding != "" && !isEncodingName(d.Encoding) {
+		return "", fmt.Errorf("invalid encoding name %q", d.Encoding)
+	}
+	if d.Standalone != "" && d.Standalone != "yes" && d.Standalone != "no" {
+		return "", fmt.Errorf("standalone must be \"yes\" or \"no\", got %q", d.Standalone)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="`)
+	sb.WriteString(version)
+	sb.WriteByte('"')
+	if d.Encoding != "" {
+		sb.WriteString(` encoding="`)
+		sb.WriteString(d.Encoding)
+		sb.WriteByte('"')
+	}
+	if d.Standalone != "" {
+		sb.WriteString(` standalone="`)
+		sb.WriteString(d.Standalone)
+		sb.WriteByte('"')
+	}
+	sb.WriteString("?>")
+	return sb.String(), nil
+}
+
+func isEncodingName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-'):
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+func declaration(opts *MarshalOptions) (string, error) {
+	if opts.Declaration != nil {
+		decl := *opts.Declaration
+		if !isUTF8(opts.Encoding) {
+			if decl.Encoding == "" {
+				decl.Encoding = opts.Encoding
+			} else if !strings.EqualFold(decl.Encoding, opts.Encoding) {
+				return "", fmt.Errorf("declaration encoding %q conflicts with output encoding %q", decl.Encoding, opts.Encoding)
+			}
+		}
+		return decl.String()
+	}
+	if !isUTF8(opts.Encoding) {
+		return (&Declaration{Encoding: opts.Encoding}).String()
+	}
+	if opts.XMLHeader {
+		return xmlHeader, nil
+	}
+	return "", nil
+}
+
+func (e *Encoder) writeProlog(opts *MarshalOptions) error {
+	if opts.Newline != "" && opts.Newline != "\n" && opts.Newline != "\r\n" {
+		return fmt.Errorf("unsupported newline %q", opts.Newline)
+	}
+	if err := checkEntities(opts.Entities); err != nil {
+		return err
+	}
+	if opts.Mode == ModeHTML {
+		return nil
+	}
+	header, err := declaration(opts)
+	if err != nil {
+		return err
+	}
+	if header != "" {
+		if err := e.writePrologLine(header); err != nil {
+			return err
+		}
+	}
+	for _, comment := range opts.HeaderComments {
+		if err := e.writeComment(comment); err != nil {
+			return err
+		}
+		if err := e.endPrologLine(); err != nil {
+			return err
+		}
+	}
+	for _, pi := range opts.ProcessingInstructions {
+		if err := e.writeProcInst(pi.Target, pi.Data); err != nil {
+			return err
+		}
+		if err := e.endPrologLine(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) writePrologLine(s string) error {
+	if err := e.writeString(s); err != nil {
+		return err
+	}
+	return e.endPrologLine()
+}
+
+func (e *Encoder) endPrologLine() error {
+	if e.indent != "" {
+		return e.writeString(e.newline)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package go_xml
+
+import (
+	"reflect"
+	"strconv"
+)
+
+type QName struct {
+	Space string
+	Local string
+}
+
+var qnameType = reflect.TypeOf(QName{})
+
+type namespaceBinding struct {
+	prefix string
+	uri    string
+}
+
+func (m *marshaler) pushBindings(attrs []Attribute) {
+	m.bindingMarks = append(m.bindingMarks, len(m.bindings))
+	for _, attr := range attrs {
+		if prefix, ok := namespacePrefix(attr.Name); ok {
+			m.bindings = append(m.bindings, namespaceBinding{prefix: prefix, uri: attr.Value})
+		}
+	}
+}
+
+func (m *marshaler) popBindings() {
+	if len(m.bindingMarks) == 0 {
+		return
+	}
+	mark := m.bindingMarks[len(m.bindingMarks)-1]
+	m.bindingMarks = m.bindingMarks[:len(m.bindingMarks)-1]
+	m.bindings = m.bindings[:mark]
+}
+
+func (m *marshaler) lookupPrefix(uri string, attrs []Attribute) (string, bool) {
+	shadowed := make(map[string]bool)
+	for _, attr := range attrs {
+		if prefix, ok := namespacePrefix(attr.Name); ok {
+			if attr.Value == uri {
+				return prefix, true
+			}
+			shadowed[prefix] = true
+		}
+	}
+	for i := len(m.bindings) - 1; i >= 0; i-- {
+		binding := m.bindings[i]
+		if shadowed[binding.prefix] {
+			continue
+		}
+		if binding.uri == uri {
+			return binding.prefix, true
+		}
+		shadowed[binding.prefix] = true
+	}
+	return "", false
+}
+
+func (m *marshaler) prefixInUse(prefix string, attrs []Attribute) bool {
+	for _, attr := range attrs {
+		if declared, ok := namespacePrefix(attr.Name); ok && declared == prefix {
+			return true
+		}
+	}
+	for _, binding := range m.bindings {
+		if binding.prefix == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *marshaler) qualifyQName(q QName, attrs []Attribute) (string, []Attribute) {
+	if q.Space == "" {
+		return q.Local, attrs
+	}
+	if prefix, ok := m.lookupPrefix(q.Space, attrs); ok {
+		if prefix == "" {
+			return q.Local, attrs
+		}
+		return prefix + ":" + q.Local, attrs
+	}
+
+	prefix := ""
+	for n := 1; prefix == "" || m.prefixInUse(prefix, attrs); n++ {
+		prefix = "ns" + strconv.Itoa(n)
+	}
+	attrs = append(attrs, Attribute{Name: "xmlns:" + prefix, Value: q.Space})
+	return prefix + ":" + q.Local, attrs
+}
+
+func (m *marshaler) marshalQName(val reflect.Value, currentTag string) error {
+	text, attrs := m.qualifyQName(val.Interface().(QName), nil)
+	if err := m.startValueElement(currentTag, attrs); err != nil {
+		return err
+	}
+	if err := m.out.writeText(m.redact(currentTag, text)); err != nil {
+		return m.annotate(err, "")
+	}
+	return m.endElement()
+}
@@ -0,0 +1,107 @@
+package go_xml
+
+import "strings"
+
+func (n *ElementNode) Walk(fn func(*ElementNode) bool) bool {
+	for _, child := range n.Children {
+		element, ok := child.(*ElementNode)
+		if !ok {
+			continue
+		}
+		if !fn(element) || !element.Walk(fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *ElementNode) Find(name string) *ElementNode {
+	var found *ElementNode
+	n.Walk(func(element *ElementNode) bool {
+		if element.Name == name {
+			found = element
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func (n *ElementNode) FindAll(name string) []*ElementNode {
+	var found []*ElementNode
+	n.Walk(func(element *ElementNode) bool {
+		if element.Name == name {
+			found = append(found, element)
+		}
+		return true
+	})
+	return found
+}
+
+func (n *ElementNode) FindByAttr(name, key, value string) *ElementNode {
+	var found *ElementNode
+	n.Walk(func(element *ElementNode) bool {
+		if name != "" && element.Name != name {
+			return true
+		}
+		if attr, ok := element.Attribute(key); ok && attr == value {
+			found = element
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func (n *ElementNode) ChildElements() []*ElementNode {
+	var elements []*ElementNode
+	for _, child := range n.Children {
+		if element, ok := child.(*ElementNode); ok {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+func (n *ElementNode) Attribute(name string) (string, bool) {
+	for _, attr := range n.Attributes {
+		if attr.Name == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+func (n *ElementNode) SetAttribute(name, value string) {
+	for i := range n.Attributes {
+		if n.Attributes[i].Name == name {
+			n.Attributes[i].Value = value
+			return
+		}
+	}
+	n.Attributes = append(n.Attributes, Attribute{Name: name, Value: value})
+}
+
+func (n *ElementNode) RemoveAttribute(name string) {
+	for i := range n.Attributes {
+		if n.Attributes[i].Name == name {
+			n.Attributes = append(n.Attributes[:i], n.Attributes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (n *ElementNode) Text() string {
+	var sb strings.Builder
+	for _, child := range n.Children {
+		switch c := child.(type) {
+		case *TextNode:
+			sb.WriteString(c.Text)
+		case *CDataNode:
+			sb.WriteString(c.Text)
+		case *ElementNode:
+			sb.WriteString(c.Text())
+		}
+	}
+	return sb.String()
+}
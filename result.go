@@ -0,0 +1,68 @@
+package go_xml
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+type Result struct {
+	buf        *bytes.Buffer
+	data       []byte
+	compressed bool
+	released   bool
+}
+
+func MarshalResult(v interface{}, opts *MarshalOptions) (*Result, error) {
+	return MarshalResultContext(context.Background(), v, opts)
+}
+
+func MarshalResultContext(ctx context.Context, v interface{}, opts *MarshalOptions) (*Result, error) {
+	buf := acquireBuffer()
+	if err := encodeDocument(ctx, buf, v, opts); err != nil {
+		releaseBuffer(buf)
+		return nil, err
+	}
+
+	if shouldCompress(opts, buf.Len()) {
+		data, err := compressBuffer(nil, buf, opts)
+		releaseBuffer(buf)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{data: data, compressed: true}, nil
+	}
+	return &Result{buf: buf, data: buf.Bytes()}, nil
+}
+
+func (r *Result) Len() int {
+	return len(r.data)
+}
+
+func (r *Result) Bytes() []byte {
+	return r.data
+}
+
+func (r *Result) Compressed() bool {
+	return r.compressed
+}
+
+func (r *Result) WriteTo(w io.Writer) (int64, error) {
+	if r.released {
+		return 0, ErrResultReleased
+	}
+	n, err := w.Write(r.data)
+	return int64(n), err
+}
+
+func (r *Result) Release() {
+	if r.released {
+		return
+	}
+	r.released = true
+	r.data = nil
+	if r.buf != nil {
+		releaseBuffer(r.buf)
+		r.buf = nil
+	}
+}
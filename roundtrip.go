@@ -0,0 +1,114 @@
+package go_xml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+)
+
+type RoundTripError struct {
+	Path     string
+	Expected string
+	Actual   string
+	Output   []byte
+}
+
+func (e *RoundTripError) Error() string {
+	return fmt.Sprintf("round trip diverged at %s: expected %s, got %s", e.Path, e.Expected, e.Actual)
+}
+
+func RoundTrip(v interface{}, opts *MarshalOptions) error {
+	val := reflect.ValueOf(v)
+	if isNilValue(val) {
+		return ErrNilNode
+	}
+	for val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+
+	plain := MarshalOptions{}
+	if opts != nil {
+		plain = *opts
+	}
+	plain.Compress = false
+
+	output, err := Marshal(val.Interface(), &plain)
+	if err != nil {
+		return err
+	}
+
+	decoded := reflect.New(val.Type())
+	if err := Unmarshal(output, decoded.Interface()); err != nil {
+		return fmt.Errorf("error decoding marshaled output: %w", err)
+	}
+
+	c := &marshaler{path: []string{val.Type().Name()}}
+	if err := c.compareValues(val, decoded.Elem()); err != nil {
+		err.Output = output
+		return err
+	}
+	return nil
+}
+
+func (m *marshaler) compareValues(expected, actual reflect.Value) *RoundTripError {
+	if expected.Kind() == reflect.Ptr || expected.Kind() == reflect.Interface {
+		if expected.IsNil() || actual.IsNil() {
+			if expected.IsNil() != actual.IsNil() {
+				return m.divergence(expected, actual)
+			}
+			return nil
+		}
+		return m.compareValues(expected.Elem(), actual.Elem())
+	}
+
+	switch expected.Kind() {
+	case reflect.Struct:
+		for _, fieldMeta := range GetFieldMetadata(expected.Type()) {
+			field := fieldMeta.FieldType
+			if !field.IsExported() || field.Type == rawXMLType || field.Type == reflect.TypeOf(xml.Name{}) {
+				continue
+			}
+			if !field.Anonymous {
+				m.path = append(m.path, field.Name)
+			}
+			err := m.compareValues(expected.FieldByIndex(field.Index), actual.FieldByIndex(field.Index))
+			if !field.Anonymous {
+				m.path = m.path[:len(m.path)-1]
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if expected.Len() != actual.Len() {
+			return &RoundTripError{
+				Path:     m.fieldPath(""),
+				Expected: fmt.Sprintf("%d items", expected.Len()),
+				Actual:   fmt.Sprintf("%d items", actual.Len()),
+			}
+		}
+		for i := 0; i < expected.Len(); i++ {
+			m.path = append(m.path, indexSegment(i))
+			err := m.compareValues(expected.Index(i), actual.Index(i))
+			m.path = m.path[:len(m.path)-1]
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !reflect.DeepEqual(expected.Interface(), actual.Interface()) {
+		return m.divergence(expected, actual)
+	}
+	return nil
+}
+
+func (m *marshaler) divergence(expected, actual reflect.Value) *RoundTripError {
+	return &RoundTripError{
+		Path:     m.fieldPath(""),
+		Expected: fmt.Sprintf("%#v", expected.Interface()),
+		Actual:   fmt.Sprintf("%#v", actual.Interface()),
+	}
+}
@@ -0,0 +1,166 @@
+package rss
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+const (
+	ContentNamespace = "http://purl.org/rss/1.0/modules/content/"
+	AtomNamespace    = "http://www.w3.org/2005/Atom"
+)
+
+var ErrInvalidItem = errors.New("rss: item needs a title or a description")
+
+type Feed struct {
+	Title         string
+	Link          string
+	Description   string
+	Language      string
+	Copyright     string
+	SelfLink      string
+	LastBuildDate time.Time
+	Items         []Item
+}
+
+type Item struct {
+	Title           string
+	Link            string
+	Description     string
+	Content         string
+	Author          string
+	Categories      []string
+	GUID            string
+	GUIDIsPermaLink bool
+	PubDate         time.Time
+	Enclosure       *Enclosure
+}
+
+type Enclosure struct {
+	URL    string
+	Length int64
+	Type   string
+}
+
+func NewFeed(title, link, description string) *Feed {
+	return &Feed{Title: title, Link: link, Description: description}
+}
+
+func (f *Feed) AddItem(item Item) *Feed {
+	f.Items = append(f.Items, item)
+	return f
+}
+
+type rssXML struct {
+	Version   string     `xml:"version,attr"`
+	ContentNS string     `xml:"xmlns:content,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	Channel   channelXML `xml:"channel"`
+}
+
+type channelXML struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	AtomLink      *atomLink `xml:"atom:link,omitempty"`
+	Language      string    `xml:"language,omitempty"`
+	Copyright     string    `xml:"copyright,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []itemXML `xml:"item"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type itemXML struct {
+	Title       string        `xml:"title,omitempty"`
+	Link        string        `xml:"link,omitempty"`
+	Description go_xml.CDATA  `xml:"description,omitempty"`
+	Content     go_xml.CDATA  `xml:"content:encoded,omitempty"`
+	Author      string        `xml:"author,omitempty"`
+	Categories  []string      `xml:"category,omitempty"`
+	GUID        *guidXML      `xml:"guid,omitempty"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Enclosure   *enclosureXML `xml:"enclosure,omitempty"`
+}
+
+type guidXML struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type enclosureXML struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+func (f *Feed) Marshal(opts *go_xml.MarshalOptions) ([]byte, error) {
+	doc, err := f.toXML()
+	if err != nil {
+		return nil, err
+	}
+
+	marshalOpts := go_xml.MarshalOptions{XMLHeader: true, Indent: "  "}
+	if opts != nil {
+		marshalOpts = *opts
+	}
+	marshalOpts.RootTag = "rss"
+	marshalOpts.Namespace = ""
+	return go_xml.Marshal(doc, &marshalOpts)
+}
+
+func (f *Feed) toXML() (*rssXML, error) {
+	doc := &rssXML{
+		Version:   "2.0",
+		ContentNS: ContentNamespace,
+		AtomNS:    AtomNamespace,
+		Channel: channelXML{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Description,
+			Language:      f.Language,
+			Copyright:     f.Copyright,
+			LastBuildDate: formatDate(f.LastBuildDate),
+		},
+	}
+	if f.SelfLink != "" {
+		doc.Channel.AtomLink = &atomLink{Href: f.SelfLink, Rel: "self", Type: "application/rss+xml"}
+	}
+
+	for i, item := range f.Items {
+		if item.Title == "" && item.Description == "" {
+			return nil, fmt.Errorf("%w (item %d)", ErrInvalidItem, i)
+		}
+		out := itemXML{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: go_xml.CDATA(item.Description),
+			Content:     go_xml.CDATA(item.Content),
+			Author:      item.Author,
+			Categories:  item.Categories,
+			PubDate:     formatDate(item.PubDate),
+		}
+		if item.GUID != "" {
+			out.GUID = &guidXML{IsPermaLink: item.GUIDIsPermaLink, Value: item.GUID}
+		}
+		if item.Enclosure != nil {
+			out.Enclosure = &enclosureXML{URL: item.Enclosure.URL, Length: item.Enclosure.Length, Type: item.Enclosure.Type}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, out)
+	}
+	return doc, nil
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC1123Z)
+}
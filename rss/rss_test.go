@@ -0,0 +1,59 @@
+package rss
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+func TestFeedMarshal(t *testing.T) {
+	published := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	feed := NewFeed("Go XML", "https://example.com", "Release notes").
+		AddItem(Item{
+			Title:           "v2.1",
+			Link:            "https://example.com/v2.1",
+			Description:     "<p>Faster & smaller</p>",
+			Content:         "<h1>Details</h1>",
+			Categories:      []string{"release", "go"},
+			GUID:            "https://example.com/v2.1",
+			GUIDIsPermaLink: true,
+			PubDate:         published,
+			Enclosure:       &Enclosure{URL: "https://example.com/v2.1.mp3", Length: 1024, Type: "audio/mpeg"},
+		})
+	feed.SelfLink = "https://example.com/feed.xml"
+
+	output, err := feed.Marshal(nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:atom="http://www.w3.org/2005/Atom">
+  <channel>
+    <title>Go XML</title>
+    <link>https://example.com</link>
+    <description>Release notes</description>
+    <atom:link href="https://example.com/feed.xml" rel="self" type="application/rss+xml"></atom:link>
+    <item>
+      <title>v2.1</title>
+      <link>https://example.com/v2.1</link>
+      <description><![CDATA[<p>Faster & smaller</p>]]></description>
+      <content:encoded><![CDATA[<h1>Details</h1>]]></content:encoded>
+      <category>release</category>
+      <category>go</category>
+      <guid isPermaLink="true">https://example.com/v2.1</guid>
+      <pubDate>Fri, 01 Mar 2024 09:00:00 +0000</pubDate>
+      <enclosure url="https://example.com/v2.1.mp3" length="1024" type="audio/mpeg"></enclosure>
+    </item>
+  </channel>
+</rss>`
+	if string(output) != expected {
+		t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", expected, output)
+	}
+
+	if _, err := NewFeed("t", "l", "d").AddItem(Item{Link: "x"}).Marshal(&go_xml.MarshalOptions{}); !errors.Is(err, ErrInvalidItem) {
+		t.Errorf("Expected ErrInvalidItem, got %v", err)
+	}
+}
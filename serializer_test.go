@@ -1,14 +1,30 @@
 package go_xml
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 	"unicode"
+	"unicode/utf8"
+	"unsafe"
 )
 
 func normalizeXML(s string) string {
@@ -321,6 +337,259 @@ func TestCompressionOptionWithLargerData(t *testing.T) {
 	}
 }
 
+type reversingCompressor struct{}
+
+func (rc *reversingCompressor) Compress(data *bytes.Buffer) (*bytes.Buffer, error) {
+	src := data.Bytes()
+	out := new(bytes.Buffer)
+	for i := len(src) - 1; i >= 0; i-- {
+		out.WriteByte(src[i])
+	}
+	return out, nil
+}
+
+func TestCompressionAlgorithms(t *testing.T) {
+	type Data struct {
+		Text string `xml:"text"`
+	}
+
+	example := Data{Text: strings.Repeat("compress me please ", 200)}
+	uncompressedData, err := Marshal(example, nil)
+	if err != nil {
+		t.Fatalf("Serialization error: %v", err)
+	}
+
+	RegisterCompressor("reverse", func(level int) Compressor {
+		return &reversingCompressor{}
+	})
+
+	tests := []struct {
+		name       string
+		opts       *MarshalOptions
+		decompress func(data []byte) ([]byte, error)
+	}{
+		{
+			name: "Gzip best speed",
+			opts: &MarshalOptions{Compress: true, CompressionLevel: gzip.BestSpeed},
+			decompress: func(data []byte) ([]byte, error) {
+				reader, err := gzip.NewReader(bytes.NewReader(data))
+				if err != nil {
+					return nil, err
+				}
+				return io.ReadAll(reader)
+			},
+		},
+		{
+			name: "Zlib best compression",
+			opts: &MarshalOptions{Compress: true, CompressionAlgorithm: CompressionZlib, CompressionLevel: zlib.BestCompression},
+			decompress: func(data []byte) ([]byte, error) {
+				reader, err := zlib.NewReader(bytes.NewReader(data))
+				if err != nil {
+					return nil, err
+				}
+				return io.ReadAll(reader)
+			},
+		},
+		{
+			name: "Flate default level",
+			opts: &MarshalOptions{Compress: true, CompressionAlgorithm: CompressionFlate},
+			decompress: func(data []byte) ([]byte, error) {
+				return io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+			},
+		},
+		{
+			name: "Registered compressor",
+			opts: &MarshalOptions{Compress: true, CompressionAlgorithm: "reverse"},
+			decompress: func(data []byte) ([]byte, error) {
+				out := make([]byte, 0, len(data))
+				for i := len(data) - 1; i >= 0; i-- {
+					out = append(out, data[i])
+				}
+				return out, nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				compressedData, err := Marshal(example, tt.opts)
+				if err != nil {
+					t.Fatalf("Compression error: %v", err)
+				}
+				decompressedData, err := tt.decompress(compressedData)
+				if err != nil {
+					t.Fatalf("Decompression error: %v", err)
+				}
+				if !bytes.Equal(uncompressedData, decompressedData) {
+					t.Fatalf("Decompressed data does not match uncompressed data")
+				}
+			}
+		})
+	}
+
+	t.Run("Unknown algorithm", func(t *testing.T) {
+		if _, err := Marshal(example, &MarshalOptions{Compress: true, CompressionAlgorithm: "lzma"}); err == nil {
+			t.Fatalf("Expected error for unknown algorithm")
+		}
+	})
+
+	t.Run("Invalid level", func(t *testing.T) {
+		if _, err := Marshal(example, &MarshalOptions{Compress: true, CompressionLevel: 42}); err == nil {
+			t.Fatalf("Expected error for invalid compression level")
+		}
+	})
+}
+
+func TestMarshalTo(t *testing.T) {
+	type Item struct {
+		ID   int    `xml:"id,attr"`
+		Name string `xml:"name"`
+	}
+	type Export struct {
+		Items []Item `xml:"items>item"`
+	}
+
+	export := Export{}
+	for i := 0; i < 2000; i++ {
+		export.Items = append(export.Items, Item{ID: i, Name: fmt.Sprintf("Item %d", i)})
+	}
+
+	expected, err := Marshal(export, &MarshalOptions{Indent: "  ", XMLHeader: true})
+	if err != nil {
+		t.Fatalf("Serialization error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		opts       *MarshalOptions
+		decompress func(data []byte) ([]byte, error)
+	}{
+		{
+			name: "Uncompressed",
+			opts: &MarshalOptions{Indent: "  ", XMLHeader: true},
+			decompress: func(data []byte) ([]byte, error) {
+				return data, nil
+			},
+		},
+		{
+			name: "Streaming gzip",
+			opts: &MarshalOptions{Indent: "  ", XMLHeader: true, Compress: true},
+			decompress: func(data []byte) ([]byte, error) {
+				reader, err := gzip.NewReader(bytes.NewReader(data))
+				if err != nil {
+					return nil, err
+				}
+				return io.ReadAll(reader)
+			},
+		},
+		{
+			name: "Buffered fallback for non-streaming compressor",
+			opts: &MarshalOptions{Indent: "  ", XMLHeader: true, Compress: true, CompressionAlgorithm: "reverse-stream-test"},
+			decompress: func(data []byte) ([]byte, error) {
+				out := make([]byte, 0, len(data))
+				for i := len(data) - 1; i >= 0; i-- {
+					out = append(out, data[i])
+				}
+				return out, nil
+			},
+		},
+	}
+
+	RegisterCompressor("reverse-stream-test", func(level int) Compressor {
+		return &reversingCompressor{}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			if err := MarshalTo(&output, export, tt.opts); err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			decompressed, err := tt.decompress(output.Bytes())
+			if err != nil {
+				t.Fatalf("Decompression error: %v", err)
+			}
+			if !bytes.Equal(decompressed, expected) {
+				t.Fatalf("Output does not match Marshal")
+			}
+		})
+	}
+
+	t.Run("Writer error", func(t *testing.T) {
+		if err := MarshalTo(&failingWriter{remaining: 100}, export, &MarshalOptions{Compress: true}); err == nil {
+			t.Fatalf("Expected write error")
+		}
+	})
+}
+
+func TestCompressMinSize(t *testing.T) {
+	type Data struct {
+		Text string `xml:"text"`
+	}
+
+	small := Data{Text: "tiny"}
+	large := Data{Text: strings.Repeat("large payload ", 200)}
+
+	tests := []struct {
+		name       string
+		input      Data
+		minSize    int
+		compressed bool
+	}{
+		{name: "Below threshold", input: small, minSize: 512, compressed: false},
+		{name: "Above threshold", input: large, minSize: 512, compressed: true},
+		{name: "No threshold", input: small, minSize: 0, compressed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain, err := Marshal(tt.input, nil)
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			opts := &MarshalOptions{Compress: true, CompressMinSize: tt.minSize}
+
+			data, compressed, err := MarshalCompressed(tt.input, opts)
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			if compressed != tt.compressed {
+				t.Fatalf("Expected compressed=%t, got %t", tt.compressed, compressed)
+			}
+
+			var streamed bytes.Buffer
+			if err := MarshalTo(&streamed, tt.input, opts); err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			appended, err := AppendMarshal(nil, tt.input, opts)
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+
+			for _, output := range [][]byte{data, streamed.Bytes(), appended} {
+				if !tt.compressed {
+					if !bytes.Equal(output, plain) {
+						t.Fatalf("Expected uncompressed output %s, got %q", plain, output)
+					}
+					continue
+				}
+				reader, err := gzip.NewReader(bytes.NewReader(output))
+				if err != nil {
+					t.Fatalf("Gzip reader error: %v", err)
+				}
+				decompressed, err := io.ReadAll(reader)
+				if err != nil {
+					t.Fatalf("Decompression error: %v", err)
+				}
+				if !bytes.Equal(decompressed, plain) {
+					t.Fatalf("Decompressed data does not match uncompressed data")
+				}
+			}
+		})
+	}
+}
+
 func TestSpecialCharacters(t *testing.T) {
 	type SpecialCharStruct struct {
 		Text string `xml:"text"`
@@ -511,6 +780,18 @@ func TestPointerFieldsSerialization(t *testing.T) {
 			expected: `<?xml version="1.0" encoding="UTF-8"?>
 <PointerStruct id="10"></PointerStruct>`,
 		},
+		{
+			name:  "Nil attribute omitted",
+			input: PointerStruct{Active: &active},
+			opts: &MarshalOptions{
+				Indent:    "  ",
+				XMLHeader: true,
+			},
+			expected: `<?xml version="1.0" encoding="UTF-8"?>
+<PointerStruct>
+  <active>true</active>
+</PointerStruct>`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -605,90 +886,5425 @@ func TestMixedContentSerialization(t *testing.T) {
 	}
 }
 
-func BenchmarkPerformance(b *testing.B) {
-	type SimpleStruct struct {
-		ID   int    `xml:"id,attr"`
-		Name string `xml:"name"`
+func TestStreamingMatchesNodeTree(t *testing.T) {
+	type Base struct {
+		Kind    string `xml:"kind,attr"`
+		Comment string `xml:"comment"`
+	}
+	type Item struct {
+		SKU   string  `xml:"sku,attr"`
+		Price float64 `xml:"price"`
+	}
+	type Order struct {
+		XMLName xml.Name `xml:"order"`
+		Base
+		ID    int      `xml:"id,attr"`
+		Items []Item   `xml:"items>item"`
+		Tags  []string `xml:"tag"`
+		Note  string   `xml:"note"`
+		Extra *Item    `xml:"extra,omitempty"`
 	}
 
-	type NestedStruct struct {
-		ID       int      `xml:"id,attr"`
-		Title    string   `xml:"title"`
-		Children []string `xml:"children>child"`
+	input := Order{
+		XMLName: xml.Name{Local: "purchase"},
+		Base:    Base{Kind: "online", Comment: "a & b"},
+		ID:      42,
+		Items:   []Item{{SKU: "A1", Price: 9.5}, {SKU: "B2", Price: 3}},
+		Tags:    []string{"x", "y"},
 	}
 
 	tests := []struct {
-		scenario   string
-		data       interface{}
-		opts       *MarshalOptions
-		iterations int
+		name string
+		opts *MarshalOptions
 	}{
 		{
-			scenario: "Simple struct - 1M serializations",
-			data: SimpleStruct{
-				ID:   1,
-				Name: "TestName",
-			},
-			opts: &MarshalOptions{
-				Indent:    "  ",
-				XMLHeader: true,
-			},
-			iterations: 1_000_000,
+			name: "Nil options",
 		},
 		{
-			scenario: "Nested struct - 1M serializations",
-			data: NestedStruct{
-				ID:    2,
-				Title: "Parent",
-				Children: []string{
-					"Child1",
-					"Child2",
-					"Child3",
-				},
-			},
-			opts: &MarshalOptions{
-				Indent:    "  ",
-				XMLHeader: true,
-			},
-			iterations: 1_000_000,
+			name: "Indented",
+			opts: &MarshalOptions{Indent: "  "},
 		},
 		{
-			scenario: "Large data - 500k serializations",
-			data: NestedStruct{
-				ID:    3,
-				Title: "Large Parent",
-				Children: func() []string {
-					largeList := make([]string, 1000)
-					for i := range largeList {
-						largeList[i] = fmt.Sprintf("Child%d", i+1)
-					}
-					return largeList
-				}(),
-			},
-			opts: &MarshalOptions{
-				Indent:    "  ",
-				XMLHeader: true,
-			},
-			iterations: 500_000,
+			name: "Compact with namespace",
+			opts: &MarshalOptions{Namespace: "http://example.com/orders"},
+		},
+		{
+			name: "Self-closing tags",
+			opts: &MarshalOptions{Indent: "\t", SelfClosingTags: []string{"note"}, SpacedSelfClose: true},
 		},
 	}
 
-	fmt.Println("Scenario,Iterations,TotalTime(s),AvgTimePerIteration(ms)")
-
 	for _, tt := range tests {
-		b.Run(tt.scenario, func(b *testing.B) {
-			start := time.Now()
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(input, tt.opts)
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
 
-			for i := 0; i < tt.iterations; i++ {
-				_, err := Marshal(tt.data, tt.opts)
-				if err != nil {
-					b.Fatalf("Serialization error: %v", err)
-				}
+			node, err := structToNode(reflect.ValueOf(input), tt.opts, []string{"Order"})
+			if err != nil {
+				t.Fatalf("Node conversion error: %v", err)
+			}
+			opts := tt.opts
+			if opts == nil {
+				opts = &MarshalOptions{}
+			}
+			var treeOutput bytes.Buffer
+			encoder := NewEncoder(&treeOutput, opts.SelfClosingTags, opts.Indent, opts.SpacedSelfClose)
+			if err := node.Accept(encoder); err != nil {
+				t.Fatalf("Encoding error: %v", err)
 			}
 
-			duration := time.Since(start).Seconds()
-			avgTimePerIteration := (duration / float64(tt.iterations)) * 1000 // in milliseconds
-			fmt.Printf("%s,%d,%.2f,%.4f\n", tt.scenario, tt.iterations, duration, avgTimePerIteration)
+			if treeOutput.String() != string(outputBytes) {
+				t.Fatalf("Expected: %s, Got: %s", treeOutput.String(), string(outputBytes))
+			}
+		})
+	}
+}
+
+func TestParallelSliceSerialization(t *testing.T) {
+	type Item struct {
+		ID    int    `xml:"id,attr"`
+		Label string `xml:"label"`
+	}
+	type Catalog struct {
+		Items []Item   `xml:"items>item"`
+		Codes []string `xml:"code"`
+	}
+
+	catalog := Catalog{}
+	for i := 0; i < 500; i++ {
+		catalog.Items = append(catalog.Items, Item{ID: i, Label: fmt.Sprintf("Item%d", i)})
+		catalog.Codes = append(catalog.Codes, fmt.Sprintf("C%d", i))
+	}
+
+	expected, err := Marshal(catalog, &MarshalOptions{Indent: "  "})
+	if err != nil {
+		t.Fatalf("Serialization error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts *MarshalOptions
+	}{
+		{
+			name: "Default threshold",
+			opts: &MarshalOptions{Indent: "  ", Parallelism: 4},
+		},
+		{
+			name: "Low threshold",
+			opts: &MarshalOptions{Indent: "  ", Parallelism: 8, ParallelThreshold: 2},
+		},
+		{
+			name: "More workers than items",
+			opts: &MarshalOptions{Indent: "  ", Parallelism: 1000, ParallelThreshold: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(catalog, tt.opts)
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			if !bytes.Equal(outputBytes, expected) {
+				t.Fatalf("Parallel output differs from sequential output")
+			}
+		})
+	}
+}
+
+type failingWriter struct {
+	remaining int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.remaining {
+		return 0, fmt.Errorf("write limit reached")
+	}
+	w.remaining -= len(p)
+	return len(p), nil
+}
+
+func collectNodes(node Node, nodes []Node) []Node {
+	nodes = append(nodes, node)
+	if element, ok := node.(*ElementNode); ok {
+		for _, child := range element.Children {
+			nodes = collectNodes(child, nodes)
+		}
+	}
+	return nodes
+}
+
+func TestNodeReleaseOnError(t *testing.T) {
+	type Item struct {
+		ID    int    `xml:"id,attr"`
+		Label string `xml:"label"`
+	}
+	type Catalog struct {
+		Title string `xml:"title"`
+		Items []Item `xml:"items>item"`
+	}
+
+	catalog := Catalog{
+		Title: "Catalog",
+		Items: []Item{{ID: 1, Label: "One"}, {ID: 2, Label: "Two"}, {ID: 3, Label: "Three"}},
+	}
+
+	for _, limit := range []int{0, 10, 40, 80} {
+		t.Run(fmt.Sprintf("Failure after %d bytes", limit), func(t *testing.T) {
+			node, err := structToNode(reflect.ValueOf(catalog), &MarshalOptions{}, []string{"catalog"})
+			if err != nil {
+				t.Fatalf("Node conversion error: %v", err)
+			}
+			nodes := collectNodes(node, nil)
+
+			encoder := NewEncoder(&failingWriter{remaining: limit}, nil, "  ", false)
+			if err := node.Accept(encoder); err == nil {
+				t.Fatalf("Expected write error")
+			}
+
+			for _, n := range nodes {
+				switch released := n.(type) {
+				case *ElementNode:
+					if released.Name != "" || len(released.Children) != 0 {
+						t.Fatalf("Element node %q was not released", released.Name)
+					}
+				case *TextNode:
+					if released.Text != "" {
+						t.Fatalf("Text node %q was not released", released.Text)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("Panics become errors on every path", func(t *testing.T) {
+		type Broken struct {
+			meta map[string]int
+		}
+		type Holder struct {
+			Values []Broken `xml:"value"`
+		}
+
+		identity := NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) { return root, nil })
+		panicking := NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) { panic("transformer failed") })
+		holder := Holder{Values: []Broken{{meta: map[string]int{"a": 1}}, {meta: map[string]int{"b": 2}}}}
+		tests := []struct {
+			name  string
+			value interface{}
+			opts  *MarshalOptions
+		}{
+			{name: "Streaming", value: holder, opts: &MarshalOptions{}},
+			{name: "Tree", value: holder, opts: &MarshalOptions{Transformers: []NodeTransformer{identity}}},
+			{name: "Parallel workers", value: holder, opts: &MarshalOptions{Parallelism: 2, ParallelThreshold: 1}},
+			{name: "Transformer", value: catalog, opts: &MarshalOptions{Transformers: []NodeTransformer{panicking}}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := Marshal(tt.value, tt.opts)
+				if err == nil || !strings.Contains(err.Error(), "panic while encoding") {
+					t.Fatalf("Expected a panic error, got %v", err)
+				}
+			})
+		}
+
+		if _, err := structToNode(reflect.ValueOf(holder), &MarshalOptions{}, []string{"holder"}); err == nil {
+			t.Errorf("Expected a panic error from structToNode")
+		}
+	})
+}
+
+func TestEncoderElementAllocations(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Grow(1 << 16)
+
+	attrs := []Attribute{{Name: "id", Value: "42"}, {Name: "note", Value: "fish & chips"}}
+	text := "clean text with <markup> inside"
+
+	tests := []struct {
+		name    string
+		encoder *Encoder
+	}{
+		{
+			name:    "Indented",
+			encoder: NewEncoder(&buf, []string{"leaf"}, "  ", false),
+		},
+		{
+			name:    "Plain writer",
+			encoder: NewEncoder(&failingWriter{remaining: 1 << 30}, []string{"leaf"}, "\t", true),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encode := func() {
+				buf.Reset()
+				for depth := 0; depth < 12; depth++ {
+					if err := tt.encoder.startElement("level", nil); err != nil {
+						t.Fatalf("Encoding error: %v", err)
+					}
+				}
+				for i := 0; i < 4; i++ {
+					if err := tt.encoder.startElement("leaf", attrs); err != nil {
+						t.Fatalf("Encoding error: %v", err)
+					}
+					if err := tt.encoder.writeText(text); err != nil {
+						t.Fatalf("Encoding error: %v", err)
+					}
+					if err := tt.encoder.endElement(); err != nil {
+						t.Fatalf("Encoding error: %v", err)
+					}
+				}
+				for depth := 0; depth < 12; depth++ {
+					if err := tt.encoder.endElement(); err != nil {
+						t.Fatalf("Encoding error: %v", err)
+					}
+				}
+			}
+
+			encode()
+			if allocs := testing.AllocsPerRun(100, encode); allocs != 0 {
+				t.Fatalf("Expected zero allocations per document, got %.1f", allocs)
+			}
+		})
+	}
+}
+
+func TestEscapeString(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Empty", input: "", expected: ""},
+		{name: "Clean", input: "plain text", expected: "plain text"},
+		{name: "Only special", input: "<&>", expected: "&lt;&amp;&gt;"},
+		{name: "Leading and trailing", input: "'quoted\"", expected: "&apos;quoted&quot;"},
+		{name: "Multibyte", input: "café & crème", expected: "café &amp; crème"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AppendEscaped(nil, tt.input); string(got) != tt.expected {
+				t.Fatalf("Expected: %s, Got: %s", tt.expected, got)
+			}
+
+			var buf bytes.Buffer
+			encoder := NewEncoder(&buf, nil, "", false)
+			if err := encoder.writeEscaped(tt.input); err != nil {
+				t.Fatalf("Encoding error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Fatalf("Expected: %s, Got: %s", tt.expected, buf.String())
+			}
+		})
+	}
+
+	dst := make([]byte, 0, 64)
+	if allocs := testing.AllocsPerRun(100, func() { AppendEscaped(dst, "nothing to escape here") }); allocs != 0 {
+		t.Fatalf("Expected no allocations for clean strings, got %.1f", allocs)
+	}
+}
+
+func TestMarkupNodes(t *testing.T) {
+	tests := []struct {
+		name          string
+		node          func() Node
+		expected      string
+		expectedError bool
+	}{
+		{
+			name: "Comment, CDATA and processing instruction",
+			node: func() Node {
+				return &ElementNode{Name: "doc", Children: []Node{
+					&ProcessingInstructionNode{Target: "render", Data: "mode=\"fast\""},
+					&CommentNode{Text: " generated "},
+					&ElementNode{Name: "script", Children: []Node{
+						&CDataNode{Text: "if (a < b && c]]>d) {}"},
+					}},
+				}}
+			},
+			expected: "<doc>\n  <?render mode=\"fast\"?>\n  <!-- generated -->\n  <script><![CDATA[if (a < b && c]]]]><![CDATA[>d) {}]]></script>\n</doc>",
+		},
+		{
+			name: "Comment with double hyphen",
+			node: func() Node {
+				return &ElementNode{Name: "doc", Children: []Node{&CommentNode{Text: "a--b"}}}
+			},
+			expectedError: true,
+		},
+		{
+			name: "Reserved processing instruction target",
+			node: func() Node {
+				return &ElementNode{Name: "doc", Children: []Node{&ProcessingInstructionNode{Target: "XML"}}}
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := tt.node().Accept(NewEncoder(&buf, nil, "  ", false))
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("Expected an error, got output %q", buf.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Encoding error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, buf.String())
+			}
+		})
+	}
+
+	canonical, err := Canonicalize([]byte(`<doc><!-- dropped --><?keep me?><![CDATA[a<b]]></doc>`))
+	if err != nil {
+		t.Fatalf("Canonicalization error: %v", err)
+	}
+	if expected := `<doc><?keep me?>a&lt;b</doc>`; string(canonical) != expected {
+		t.Errorf("Expected %s, got %s", expected, canonical)
+	}
+}
+
+func TestCDATAField(t *testing.T) {
+	type Item struct {
+		Title       string `xml:"title"`
+		Description CDATA  `xml:"description,omitempty"`
+	}
+
+	outputBytes, err := Marshal(Item{Title: "a & b", Description: "<p>x]]>y</p>"}, &MarshalOptions{Indent: "  "})
+	if err != nil {
+		t.Fatalf("Serialization error: %v", err)
+	}
+	expected := "<Item>\n  <title>a &amp; b</title>\n  <description><![CDATA[<p>x]]]]><![CDATA[>y</p>]]></description>\n</Item>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+}
+
+func TestRawXML(t *testing.T) {
+	type Envelope struct {
+		ID        string   `xml:"id,attr"`
+		Body      string   `xml:"body"`
+		Signature RawXML   `xml:"Signature,omitempty"`
+		Cached    []RawXML `xml:"cached"`
+	}
+
+	tests := []struct {
+		name     string
+		input    Envelope
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name: "Fragments are written verbatim",
+			input: Envelope{
+				ID:        "1",
+				Body:      "a & b",
+				Signature: `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">x&amp;y</ds:Signature>`,
+				Cached:    []RawXML{"<item>1</item>", "<item>2</item>"},
+			},
+			opts:     &MarshalOptions{Indent: "  "},
+			expected: "<Envelope id=\"1\">\n  <body>a &amp; b</body>\n  <ds:Signature xmlns:ds=\"http://www.w3.org/2000/09/xmldsig#\">x&amp;y</ds:Signature>\n  <item>1</item>\n  <item>2</item>\n</Envelope>",
+		},
+		{
+			name:     "Empty fragment is omitted",
+			input:    Envelope{ID: "2", Body: "b"},
+			opts:     &MarshalOptions{Indent: "  "},
+			expected: "<Envelope id=\"2\">\n  <body>b</body>\n</Envelope>",
+		},
+		{
+			name: "Fragments survive parallel encoding",
+			input: Envelope{
+				ID:     "3",
+				Body:   "c",
+				Cached: []RawXML{"<item>1</item>", "<item>2</item>"},
+			},
+			opts:     &MarshalOptions{Indent: "  ", Parallelism: 2, ParallelThreshold: 2},
+			expected: "<Envelope id=\"3\">\n  <body>c</body>\n  <item>1</item>\n  <item>2</item>\n</Envelope>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(tt.input, tt.opts)
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+}
+
+func TestNodeQueries(t *testing.T) {
+	root, err := Parse([]byte(`<orders>
+  <order id="1"><item sku="A"><price>10</price></item><item sku="B"><price>20</price></item></order>
+  <order id="2"><item sku="C"><price>30</price></item><note>rush <b>now</b></note></order>
+</orders>`))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	defer releaseNode(root)
+
+	if first := root.Find("price"); first == nil || first.Text() != "10" {
+		t.Errorf("Find returned %v", first)
+	}
+	if missing := root.Find("absent"); missing != nil {
+		t.Errorf("Expected nil for missing element, got %v", missing)
+	}
+
+	var prices []string
+	for _, price := range root.FindAll("price") {
+		prices = append(prices, price.Text())
+	}
+	if got := strings.Join(prices, ","); got != "10,20,30" {
+		t.Errorf("FindAll returned %s", got)
+	}
+
+	item := root.FindByAttr("item", "sku", "C")
+	if item == nil || item.Find("price").Text() != "30" {
+		t.Fatalf("FindByAttr returned %v", item)
+	}
+	if order := root.FindByAttr("", "id", "2"); order == nil || len(order.ChildElements()) != 2 {
+		t.Errorf("FindByAttr without name returned %v", order)
+	}
+	if note := root.Find("note"); note.Text() != "rush now" {
+		t.Errorf("Text returned %q", note.Text())
+	}
+
+	item.SetAttribute("sku", "D")
+	item.SetAttribute("qty", "2")
+	item.RemoveAttribute("missing")
+	if sku, _ := item.Attribute("sku"); sku != "D" || !item.HasAttribute("qty") {
+		t.Errorf("Attribute edits not applied: %v", item.Attributes)
+	}
+	item.RemoveAttribute("qty")
+	if _, ok := item.Attribute("qty"); ok {
+		t.Errorf("RemoveAttribute left qty: %v", item.Attributes)
+	}
+}
+
+func TestXPath(t *testing.T) {
+	root, err := Parse([]byte(`<orders>
+  <order id="1"><item sku="A"><price>10</price></item><item sku="X"><price>20</price></item></order>
+  <order id="2"><item sku="X"><price>30</price></item><item sku="B"><price>40</price></item></order>
+</orders>`))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	defer releaseNode(root)
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{expr: "//order/item[@sku='X']/price", expected: "20,30"},
+		{expr: "/orders/order[2]/item[1]/price", expected: "30"},
+		{expr: "order[@id=\"1\"]/item[last()]/price", expected: "20"},
+		{expr: "//item[1]/price", expected: "10,30"},
+		{expr: "//price", expected: "10,20,30,40"},
+		{expr: "/orders/*/item[@sku]/price", expected: "10,20,30,40"},
+		{expr: "//price/../../item[@sku='B']/price", expected: "40"},
+		{expr: "/order", expected: ""},
+		{expr: "//item[5]", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			matches, err := root.Query(tt.expr)
+			if err != nil {
+				t.Fatalf("Query error: %v", err)
+			}
+			var texts []string
+			for _, match := range matches {
+				texts = append(texts, match.Text())
+			}
+			if got := strings.Join(texts, ","); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	for _, expr := range []string{"", "//", "item[@sku=X]", "item[0]", "item[@sku='X'", "item[position()>1]"} {
+		if _, err := CompileXPath(expr); err == nil {
+			t.Errorf("Expected compile error for %q", expr)
+		}
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Prolog and empty elements",
+			input:    "<?xml version=\"1.0\"?>\n<root>\n  <empty/>\n</root>\n",
+			expected: "<root>\n  <empty></empty>\n</root>",
+		},
+		{
+			name:     "Attribute and namespace ordering",
+			input:    `<doc xmlns:b="http://b" xmlns:a="http://a"><a:e b:attr="1" z="2" a:y="3"/></doc>`,
+			expected: `<doc><a:e xmlns:a="http://a" xmlns:b="http://b" z="2" a:y="3" b:attr="1"></a:e></doc>`,
+		},
+		{
+			name:     "Default namespace rendered once",
+			input:    `<r xmlns="urn:x"><c xmlns="urn:x"/><d xmlns=""/></r>`,
+			expected: `<r xmlns="urn:x"><c></c><d xmlns=""></d></r>`,
+		},
+		{
+			name:     "Unused declarations dropped",
+			input:    `<r xmlns:unused="urn:u" xml:lang="en"><x/></r>`,
+			expected: `<r xml:lang="en"><x></x></r>`,
+		},
+		{
+			name:     "Escaping",
+			input:    `<r a="x&quot;&#9;y&lt;">a &amp; b &gt; c &apos;d&apos;</r>`,
+			expected: `<r a="x&quot;&#x9;y&lt;">a &amp; b &gt; c 'd'</r>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Canonicalize([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Canonicalization error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Fatalf("Expected: %s, Got: %s", tt.expected, string(outputBytes))
+			}
+		})
+	}
+
+	t.Run("Undeclared prefix", func(t *testing.T) {
+		if _, err := Canonicalize([]byte(`<p:root/>`)); err == nil {
+			t.Fatalf("Expected error for undeclared prefix")
+		}
+	})
+
+	t.Run("Mismatched end tag", func(t *testing.T) {
+		if _, err := Canonicalize([]byte(`<a><b></a></b>`)); err == nil {
+			t.Fatalf("Expected parse error")
+		}
+	})
+}
+
+func TestGenerateXSD(t *testing.T) {
+	type Address struct {
+		Street string `xml:"street"`
+		City   string `xml:"city"`
+	}
+	type Audit struct {
+		Version int32 `xml:"version,attr"`
+	}
+	type Employee struct {
+		Audit
+		ID      int      `xml:"id,attr"`
+		Name    string   `xml:"name"`
+		Salary  float64  `xml:"salary,omitempty"`
+		Active  bool     `xml:"active"`
+		Address *Address `xml:"address"`
+		Tags    []string `xml:"tags>tag"`
+		Skipped string   `xml:"-"`
+	}
+
+	outputBytes, err := GenerateXSD(Employee{}, &MarshalOptions{Namespace: "http://example.com/employees"})
+	if err != nil {
+		t.Fatalf("Generation error: %v", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" elementFormDefault="qualified" targetNamespace="http://example.com/employees" xmlns="http://example.com/employees">
+  <xs:element name="Employee" type="Employee"/>
+  <xs:complexType name="Employee">
+    <xs:sequence>
+      <xs:element name="name" type="xs:string"/>
+      <xs:element name="salary" type="xs:decimal" minOccurs="0"/>
+      <xs:element name="active" type="xs:boolean"/>
+      <xs:element name="address" type="Address" minOccurs="0"/>
+      <xs:element name="tags">
+        <xs:complexType>
+          <xs:sequence>
+            <xs:element name="tag" type="xs:string" minOccurs="0" maxOccurs="unbounded"/>
+          </xs:sequence>
+        </xs:complexType>
+      </xs:element>
+    </xs:sequence>
+    <xs:attribute name="version" type="xs:int" use="required"/>
+    <xs:attribute name="id" type="xs:long" use="required"/>
+  </xs:complexType>
+  <xs:complexType name="Address">
+    <xs:sequence>
+      <xs:element name="street" type="xs:string"/>
+      <xs:element name="city" type="xs:string"/>
+    </xs:sequence>
+  </xs:complexType>
+</xs:schema>`
+
+	if string(outputBytes) != expected {
+		t.Fatalf("Expected: %s, Got: %s", expected, string(outputBytes))
+	}
+
+	if _, err := GenerateXSD("not a struct", nil); err == nil {
+		t.Fatalf("Expected error for non-struct input")
+	}
+}
+
+func TestAppendMarshal(t *testing.T) {
+	type SimpleStruct struct {
+		ID   int    `xml:"id,attr"`
+		Name string `xml:"name"`
+	}
+
+	tests := []struct {
+		name   string
+		prefix []byte
+		input  SimpleStruct
+		opts   *MarshalOptions
+	}{
+		{
+			name:  "Nil destination",
+			input: SimpleStruct{ID: 1, Name: "First"},
+			opts: &MarshalOptions{
+				Indent:    "  ",
+				XMLHeader: true,
+			},
+		},
+		{
+			name:   "Existing content is preserved",
+			prefix: []byte("prefix:"),
+			input:  SimpleStruct{ID: 2, Name: "Second"},
+			opts: &MarshalOptions{
+				Indent: "  ",
+			},
+		},
+		{
+			name:   "Compressed output",
+			prefix: []byte("gz:"),
+			input:  SimpleStruct{ID: 3, Name: "Third"},
+			opts: &MarshalOptions{
+				Compress: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, err := Marshal(tt.input, tt.opts)
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+
+			dst := append(make([]byte, 0, 512), tt.prefix...)
+			outputBytes, err := AppendMarshal(dst, tt.input, tt.opts)
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			if !bytes.HasPrefix(outputBytes, tt.prefix) {
+				t.Fatalf("Prefix was not preserved: %q", outputBytes)
+			}
+			if tt.opts.Compress {
+				reader, err := gzip.NewReader(bytes.NewReader(outputBytes[len(tt.prefix):]))
+				if err != nil {
+					t.Fatalf("Gzip reader error: %v", err)
+				}
+				defer reader.Close()
+				if _, err := io.ReadAll(reader); err != nil {
+					t.Fatalf("Decompression error: %v", err)
+				}
+				return
+			}
+			if !bytes.Equal(outputBytes[len(tt.prefix):], expected) {
+				t.Fatalf("Expected: %s, Got: %s", expected, outputBytes[len(tt.prefix):])
+			}
+			if cap(dst) > 0 && &outputBytes[0] != &dst[:1][0] {
+				t.Fatalf("Destination buffer was not reused")
+			}
+		})
+	}
+}
+
+func TestStrictNames(t *testing.T) {
+	type Item struct {
+		Value string `xml:"bad value"`
+	}
+	type Document struct {
+		ID    int    `xml:"1d,attr"`
+		Name  string `xml:"name"`
+		Items []Item `xml:"items>item"`
+	}
+	type Valid struct {
+		Lang  string `xml:"xml:lang,attr"`
+		Title string `xml:"título"`
+		Note  string `xml:"_note-1.x"`
+	}
+
+	tests := []struct {
+		name         string
+		input        interface{}
+		opts         *MarshalOptions
+		expectedName string
+		expectedPath string
+	}{
+		{
+			name:         "Invalid attribute name",
+			input:        Document{ID: 1},
+			opts:         &MarshalOptions{StrictNames: true},
+			expectedName: "1d",
+			expectedPath: "Document.ID",
+		},
+		{
+			name: "Invalid element inside slice",
+			input: struct {
+				Items []Item `xml:"items>item"`
+			}{Items: []Item{{Value: "a"}, {Value: "b"}}},
+			opts:         &MarshalOptions{StrictNames: true, RootTag: "doc"},
+			expectedName: "bad value",
+			expectedPath: "doc.Items[0].Value",
+		},
+		{
+			name: "Invalid element built in parallel",
+			input: struct {
+				Items []Item `xml:"items>item"`
+			}{Items: []Item{{Value: "a"}}},
+			opts:         &MarshalOptions{StrictNames: true, RootTag: "doc", Parallelism: 2, ParallelThreshold: 1},
+			expectedName: "bad value",
+			expectedPath: "doc.Items[0].Value",
+		},
+		{
+			name:  "Valid names",
+			input: Valid{Lang: "pt", Title: "Olá", Note: "n"},
+			opts:  &MarshalOptions{StrictNames: true},
+		},
+		{
+			name:  "Validation disabled",
+			input: Document{ID: 1, Items: []Item{{Value: "a"}}},
+			opts:  &MarshalOptions{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Marshal(tt.input, tt.opts)
+			if tt.expectedName == "" {
+				if err != nil {
+					t.Fatalf("Serialization error: %v", err)
+				}
+				return
+			}
+
+			var nameErr *InvalidNameError
+			if !errors.As(err, &nameErr) {
+				t.Fatalf("Expected InvalidNameError, got %v", err)
+			}
+			if nameErr.Name != tt.expectedName || nameErr.Path != tt.expectedPath {
+				t.Errorf("Got name %q at %q, expected %q at %q", nameErr.Name, nameErr.Path, tt.expectedName, tt.expectedPath)
+			}
+		})
+	}
+}
+
+func TestInvalidCharPolicy(t *testing.T) {
+	type Message struct {
+		Kind string `xml:"kind,attr"`
+		Body string `xml:"body"`
+	}
+
+	input := Message{Kind: "a\x01b", Body: "x\x00y\u0080z\xffw"}
+
+	tests := []struct {
+		name          string
+		policy        InvalidCharPolicy
+		expected      string
+		expectedError bool
+	}{
+		{
+			name:     "Keep",
+			policy:   InvalidCharsKeep,
+			expected: "<Message kind=\"a\x01b\">\n<body>x\x00y\u0080z\xffw</body>\n</Message>",
+		},
+		{
+			name:     "Strip",
+			policy:   InvalidCharsStrip,
+			expected: "<Message kind=\"ab\">\n<body>xy\u0080zw</body>\n</Message>",
+		},
+		{
+			name:     "Replace",
+			policy:   InvalidCharsReplace,
+			expected: "<Message kind=\"a\uFFFDb\">\n<body>x\uFFFDy\u0080z\uFFFDw</body>\n</Message>",
+		},
+		{
+			name:     "Reference",
+			policy:   InvalidCharsReference,
+			expected: "<Message kind=\"a\uFFFDb\">\n<body>x\uFFFDy&#x80;z\uFFFDw</body>\n</Message>",
+		},
+		{
+			name:          "Error",
+			policy:        InvalidCharsError,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(input, &MarshalOptions{InvalidChars: tt.policy})
+			if tt.expectedError {
+				var charErr *InvalidCharError
+				if !errors.As(err, &charErr) || charErr.Char != 0x01 {
+					t.Fatalf("Expected InvalidCharError for U+0001, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	type Line struct {
+		Price string `xml:"price"`
+	}
+	type Order struct {
+		Items []Line `xml:"items>item"`
+	}
+
+	lines := make([]Line, 4)
+	lines[3].Price = "1\x00"
+
+	tests := []struct {
+		name         string
+		run          func() error
+		target       error
+		expectedPath string
+	}{
+		{
+			name:   "Nil node",
+			run:    func() error { _, err := Marshal((*Order)(nil), nil); return err },
+			target: ErrNilNode,
+		},
+		{
+			name: "Invalid name",
+			run: func() error {
+				_, err := Marshal(struct {
+					Value string `xml:"a b"`
+				}{}, &MarshalOptions{StrictNames: true, RootTag: "Order"})
+				return err
+			},
+			target:       ErrInvalidName,
+			expectedPath: "Order.Value",
+		},
+		{
+			name: "Invalid character",
+			run: func() error {
+				_, err := Marshal(Order{Items: lines}, &MarshalOptions{InvalidChars: InvalidCharsError})
+				return err
+			},
+			target:       ErrInvalidChar,
+			expectedPath: "Order.Items[3].Price",
+		},
+		{
+			name: "Invalid character in parallel slice",
+			run: func() error {
+				_, err := Marshal(Order{Items: lines}, &MarshalOptions{
+					InvalidChars:      InvalidCharsError,
+					Parallelism:       2,
+					ParallelThreshold: 2,
+				})
+				return err
+			},
+			target:       ErrInvalidChar,
+			expectedPath: "Order.Items[3]",
+		},
+		{
+			name:   "Unsupported kind",
+			run:    func() error { _, err := GenerateXSD(42, nil); return err },
+			target: ErrUnsupportedKind,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if !errors.Is(err, tt.target) {
+				t.Fatalf("Expected %v, got %v", tt.target, err)
+			}
+			if tt.expectedPath == "" {
+				return
+			}
+
+			var path string
+			var nameErr *InvalidNameError
+			var charErr *InvalidCharError
+			switch {
+			case errors.As(err, &nameErr):
+				path = nameErr.Path
+			case errors.As(err, &charErr):
+				path = charErr.Path
+			}
+			if path != tt.expectedPath {
+				t.Errorf("Expected path %q, got %q", tt.expectedPath, path)
+			}
+		})
+	}
+}
+
+func TestMarshalContext(t *testing.T) {
+	type Item struct {
+		Name string `xml:"name"`
+	}
+	type Catalog struct {
+		Items []Item `xml:"items>item"`
+	}
+
+	catalog := Catalog{Items: make([]Item, 200)}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		opts          *MarshalOptions
+		expectedError error
+	}{
+		{
+			name: "Active context",
+			ctx:  context.Background(),
+			opts: &MarshalOptions{Indent: "  "},
+		},
+		{
+			name:          "Cancelled context",
+			ctx:           cancelled,
+			opts:          &MarshalOptions{Indent: "  "},
+			expectedError: context.Canceled,
+		},
+		{
+			name:          "Cancelled context with parallel workers",
+			ctx:           cancelled,
+			opts:          &MarshalOptions{Indent: "  ", Parallelism: 4, ParallelThreshold: 8},
+			expectedError: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := MarshalContext(tt.ctx, catalog, tt.opts)
+			if tt.expectedError != nil {
+				if !errors.Is(err, tt.expectedError) {
+					t.Fatalf("Expected %v, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+
+			expected, err := Marshal(catalog, tt.opts)
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			if !bytes.Equal(outputBytes, expected) {
+				t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", expected, outputBytes)
+			}
+		})
+	}
+}
+
+type hookedLine struct {
+	Quantity int     `xml:"quantity"`
+	Price    float64 `xml:"price"`
+	Total    float64 `xml:"total"`
+}
+
+func (l *hookedLine) BeforeMarshalXML() error {
+	if l.Quantity < 0 {
+		return fmt.Errorf("negative quantity")
+	}
+	l.Total = float64(l.Quantity) * l.Price
+	return nil
+}
+
+type hookedInvoice struct {
+	Lines      []hookedLine `xml:"lines>line"`
+	marshalled int          `xml:"-"`
+}
+
+func (i *hookedInvoice) AfterMarshalXML() {
+	i.marshalled++
+}
+
+func TestMarshalHooks(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            *hookedInvoice
+		opts             *MarshalOptions
+		expected         string
+		expectedError    bool
+		expectedAfterRun int
+	}{
+		{
+			name:             "Before derives fields and After runs once",
+			input:            &hookedInvoice{Lines: []hookedLine{{Quantity: 2, Price: 1.5}, {Quantity: 3, Price: 2}}},
+			opts:             &MarshalOptions{RootTag: "invoice", Indent: "  "},
+			expected:         `<invoice><lines><line><quantity>2</quantity><price>1.50</price><total>3.00</total></line><line><quantity>3</quantity><price>2.00</price><total>6.00</total></line></lines></invoice>`,
+			expectedAfterRun: 1,
+		},
+		{
+			name:             "Hooks run inside parallel workers",
+			input:            &hookedInvoice{Lines: []hookedLine{{Quantity: 2, Price: 1.5}, {Quantity: 3, Price: 2}}},
+			opts:             &MarshalOptions{RootTag: "invoice", Indent: "  ", Parallelism: 2, ParallelThreshold: 2},
+			expected:         `<invoice><lines><line><quantity>2</quantity><price>1.50</price><total>3.00</total></line><line><quantity>3</quantity><price>2.00</price><total>6.00</total></line></lines></invoice>`,
+			expectedAfterRun: 1,
+		},
+		{
+			name:          "Before error aborts serialization",
+			input:         &hookedInvoice{Lines: []hookedLine{{Quantity: -1}}},
+			opts:          &MarshalOptions{RootTag: "invoice"},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(tt.input, tt.opts)
+			if tt.expectedError {
+				if err == nil || !strings.Contains(err.Error(), "invoice.Lines[0]") {
+					t.Fatalf("Expected hook error with field path, got %v", err)
+				}
+				if tt.input.marshalled != 0 {
+					t.Errorf("AfterMarshalXML ran after a failed serialization")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			if normalizeXML(string(outputBytes)) != normalizeXML(tt.expected) {
+				t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", tt.expected, outputBytes)
+			}
+			if tt.input.marshalled != tt.expectedAfterRun {
+				t.Errorf("AfterMarshalXML ran %d times, expected %d", tt.input.marshalled, tt.expectedAfterRun)
+			}
+		})
+	}
+}
+
+func TestFieldFilters(t *testing.T) {
+	type Address struct {
+		Street string `xml:"street"`
+		City   string `xml:"city"`
+	}
+	type Employee struct {
+		ID      int      `xml:"id,attr"`
+		Name    string   `xml:"name"`
+		Salary  int      `xml:"salary"`
+		Address *Address `xml:"address"`
+	}
+	type Team struct {
+		Members []Employee `xml:"members>member"`
+	}
+
+	input := Team{Members: []Employee{{
+		ID:      7,
+		Name:    "Alice",
+		Salary:  100,
+		Address: &Address{Street: "Elm", City: "Techville"},
+	}}}
+
+	tests := []struct {
+		name     string
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name:     "Exclude",
+			opts:     &MarshalOptions{Exclude: []string{"Members.Salary", "Members.Address.Street"}},
+			expected: `<Team><members><member id="7"><name>Alice</name><address><city>Techville</city></address></member></members></Team>`,
+		},
+		{
+			name:     "Include",
+			opts:     &MarshalOptions{Include: []string{"Members.Name", "Members.Address.City"}},
+			expected: `<Team><members><member><name>Alice</name><address><city>Techville</city></address></member></members></Team>`,
+		},
+		{
+			name: "FieldFilter",
+			opts: &MarshalOptions{
+				FieldFilter: func(path string, field reflect.StructField) bool {
+					return field.Name != "Salary" && path != "Members.Address"
+				},
+			},
+			expected: `<Team><members><member id="7"><name>Alice</name></member></members></Team>`,
+		},
+		{
+			name: "Filters apply in parallel workers",
+			opts: &MarshalOptions{
+				Exclude:           []string{"Members.Salary", "Members.Address"},
+				Parallelism:       2,
+				ParallelThreshold: 1,
+			},
+			expected: `<Team><members><member id="7"><name>Alice</name></member></members></Team>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(input, tt.opts)
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			if normalizeXML(string(outputBytes)) != normalizeXML(tt.expected) {
+				t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", tt.expected, outputBytes)
+			}
+		})
+	}
+}
+
+func TestSerializationGroups(t *testing.T) {
+	type Account struct {
+		ID       int    `xml:"id,attr"`
+		Name     string `xml:"name" groups:"public,internal"`
+		Email    string `xml:"email" groups:"internal"`
+		Password string `xml:"password" groups:"admin"`
+	}
+
+	input := Account{ID: 1, Name: "Alice", Email: "alice@example.com", Password: "secret"}
+
+	tests := []struct {
+		name     string
+		groups   []string
+		expected string
+	}{
+		{
+			name:     "No groups emits every field",
+			expected: `<Account id="1"><name>Alice</name><email>alice@example.com</email><password>secret</password></Account>`,
+		},
+		{
+			name:     "Public view",
+			groups:   []string{"public"},
+			expected: `<Account id="1"><name>Alice</name></Account>`,
+		},
+		{
+			name:     "Internal and admin view",
+			groups:   []string{"internal", "admin"},
+			expected: `<Account id="1"><name>Alice</name><email>alice@example.com</email><password>secret</password></Account>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(input, &MarshalOptions{Groups: tt.groups})
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			if normalizeXML(string(outputBytes)) != normalizeXML(tt.expected) {
+				t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", tt.expected, outputBytes)
+			}
+		})
+	}
+}
+
+func TestTransformers(t *testing.T) {
+	type Item struct {
+		SKU  string `xml:"sku,attr"`
+		Name string `xml:"name"`
+		Note string `xml:"note"`
+	}
+	type Order struct {
+		ID    int    `xml:"id,attr"`
+		Items []Item `xml:"items>item"`
+		Extra []Item `xml:"extra>item"`
+	}
+
+	input := Order{ID: 7, Items: []Item{{SKU: "A", Name: "Widget"}, {SKU: "B"}}}
+
+	tests := []struct {
+		name          string
+		transformers  []NodeTransformer
+		expected      string
+		expectedError bool
+	}{
+		{
+			name:         "Rename elements",
+			transformers: []NodeTransformer{RenameElements(map[string]string{"Order": "order", "item": "line"})},
+			expected:     `<order id="7"><items><line sku="A"><name>Widget</name><note></note></line><line sku="B"><name></name><note></note></line></items><extra></extra></order>`,
+		},
+		{
+			name:         "Strip empty elements and inject metadata",
+			transformers: []NodeTransformer{StripEmptyElements(), SetRootAttributes(Attribute{Name: "version", Value: "2"})},
+			expected:     `<Order id="7" version="2"><items><item sku="A"><name>Widget</name></item><item sku="B"></item></items></Order>`,
+		},
+		{
+			name: "Custom transformer error",
+			transformers: []NodeTransformer{NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) {
+				return nil, fmt.Errorf("rejected")
+			})},
+			expectedError: true,
+		},
+		{
+			name: "Nil root without error",
+			transformers: []NodeTransformer{NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) {
+				return nil, nil
+			})},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(input, &MarshalOptions{Indent: "  ", Transformers: tt.transformers})
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("Expected an error, got %s", outputBytes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			}
+			if normalizeXML(string(outputBytes)) != normalizeXML(tt.expected) {
+				t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", tt.expected, outputBytes)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name:     "Compact document is indented",
+			input:    `<?xml version="1.0"?><order id="1"><item sku="A">Widget &amp; co</item><empty></empty></order>`,
+			opts:     &MarshalOptions{Indent: "  ", XMLHeader: true, SelfClosingTags: []string{"empty"}},
+			expected: "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<order id=\"1\">\n  <item sku=\"A\">Widget &amp; co</item>\n  <empty/>\n</order>",
+		},
+		{
+			name:     "Existing indentation is replaced",
+			input:    "<a>\n\t\t<b>\n\t\t\t<c>text</c>\n\t\t</b>\n</a>",
+			opts:     &MarshalOptions{Indent: "    "},
+			expected: "<a>\n    <b>\n        <c>text</c>\n    </b>\n</a>",
+		},
+		{
+			name:     "Mixed content keeps meaningful text",
+			input:    "<p>Hello <b>world</b> again<!-- note --></p>",
+			opts:     &MarshalOptions{Indent: "  "},
+			expected: "<p>Hello \n  <b>world</b> again\n  <!-- note -->\n</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Format([]byte(tt.input), tt.opts)
+			if err != nil {
+				t.Fatalf("Format error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+
+	if _, err := Format([]byte("<a><b></a>"), nil); err == nil {
+		t.Errorf("Expected an error for malformed input")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		opts     *DiffOptions
+		expected []string
+	}{
+		{
+			name:     "Equivalent documents",
+			a:        `<order id="1" status="new"><item sku="A">Widget</item><note/></order>`,
+			b:        "<order status=\"new\" id=\"1\">\n  <item sku=\"A\"> Widget </item>\n  <note></note>\n</order>",
+			expected: nil,
+		},
+		{
+			name: "Added, removed and changed",
+			a:    `<order id="1"><item sku="A">Widget</item><item sku="B">Gadget</item><total>10</total></order>`,
+			b:    `<order id="2" currency="EUR"><item sku="A">Widget</item><total>12</total></order>`,
+			expected: []string{
+				`added /order/@currency: "EUR"`,
+				`changed /order/@id: "1" != "2"`,
+				`removed /order/item[2]: "Gadget"`,
+				`changed /order/total[1]/text(): "10" != "12"`,
+			},
+		},
+		{
+			name:     "Ignored attributes and elements",
+			a:        `<order generated="1"><stamp>a</stamp><id>1</id></order>`,
+			b:        `<order generated="2"><stamp>b</stamp><id>1</id></order>`,
+			opts:     &DiffOptions{IgnoreAttributes: []string{"generated"}, IgnoreElements: []string{"stamp"}},
+			expected: nil,
+		},
+		{
+			name:     "Different roots",
+			a:        `<order/>`,
+			b:        `<invoice/>`,
+			expected: []string{`changed /: "order" != "invoice"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, err := Diff([]byte(tt.a), []byte(tt.b), tt.opts)
+			if err != nil {
+				t.Fatalf("Diff error: %v", err)
+			}
+			var got []string
+			for _, diff := range diffs {
+				got = append(got, diff.String())
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	type Address struct {
+		City string `xml:"city"`
+	}
+	type Base struct {
+		Version int `xml:"version,attr"`
+	}
+	type Employee struct {
+		Base
+		XMLName xml.Name `xml:"employee"`
+		ID      int      `xml:"id,attr"`
+		Name    string   `xml:"name"`
+		Active  bool     `xml:"active"`
+		Rate    float64  `xml:"rate"`
+		Address *Address `xml:"address"`
+		Tags    []string `xml:"tags>tag"`
+		Missing string   `xml:"missing"`
+	}
+
+	var employee Employee
+	err := Unmarshal([]byte(`<employee version="2" id="7">
+  <name>Alice &amp; Bob</name>
+  <active>true</active>
+  <rate>1.25</rate>
+  <address><city>Techville</city></address>
+  <tags><tag>a</tag><tag>b</tag></tags>
+</employee>`), &employee)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+
+	expected := Employee{
+		Base:    Base{Version: 2},
+		XMLName: xml.Name{Local: "employee"},
+		ID:      7,
+		Name:    "Alice & Bob",
+		Active:  true,
+		Rate:    1.25,
+		Address: &Address{City: "Techville"},
+		Tags:    []string{"a", "b"},
+	}
+	if !reflect.DeepEqual(employee, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, employee)
+	}
+
+	err = Unmarshal([]byte(`<employee><tags><tag>x</tag></tags><rate>fast</rate></employee>`), &employee)
+	if err == nil || !strings.Contains(err.Error(), "Employee.Rate") {
+		t.Errorf("Expected decode error with field path, got %v", err)
+	}
+	if err := Unmarshal([]byte(`<employee/>`), employee); err == nil {
+		t.Errorf("Expected an error for a non-pointer destination")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	type Line struct {
+		SKU   string  `xml:"sku,attr"`
+		Price float64 `xml:"price"`
+	}
+	type Order struct {
+		ID    int    `xml:"id,attr"`
+		Lines []Line `xml:"lines>line"`
+		Note  string `xml:"note,omitempty"`
+	}
+
+	tests := []struct {
+		name         string
+		input        interface{}
+		opts         *MarshalOptions
+		expectedPath string
+	}{
+		{
+			name:  "Faithful round trip",
+			input: Order{ID: 1, Lines: []Line{{SKU: "A", Price: 1.5}, {SKU: "B", Price: 2}}, Note: "ok"},
+			opts:  &MarshalOptions{Indent: "  ", Compress: true},
+		},
+		{
+			name:         "Float precision is lost",
+			input:        &Order{ID: 2, Lines: []Line{{SKU: "A", Price: 1.5}, {SKU: "B", Price: 2.125}}},
+			expectedPath: "Order.Lines[1].Price",
+		},
+		{
+			name:         "Excluded fields diverge",
+			input:        Order{ID: 3, Note: "hidden"},
+			opts:         &MarshalOptions{Exclude: []string{"Note"}},
+			expectedPath: "Order.Note",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RoundTrip(tt.input, tt.opts)
+			if tt.expectedPath == "" {
+				if err != nil {
+					t.Fatalf("Round trip error: %v", err)
+				}
+				return
+			}
+
+			var roundTripErr *RoundTripError
+			if !errors.As(err, &roundTripErr) {
+				t.Fatalf("Expected RoundTripError, got %v", err)
+			}
+			if roundTripErr.Path != tt.expectedPath {
+				t.Errorf("Expected divergence at %s, got %v", tt.expectedPath, err)
+			}
+		})
+	}
+}
+
+func TestHTMLMode(t *testing.T) {
+	type Image struct {
+		Src string `xml:"src,attr"`
+		Alt string `xml:"alt,attr"`
+	}
+	type Page struct {
+		Heading string   `xml:"h1"`
+		Break   struct{} `xml:"br"`
+		Image   Image    `xml:"img"`
+		Empty   string   `xml:"span"`
+		Script  string   `xml:"script"`
+		Style   string   `xml:"style"`
+		Notes   CDATA    `xml:"p"`
+	}
+
+	page := Page{
+		Heading: "Fish & Chips",
+		Image:   Image{Src: "/a.png", Alt: "A <b>"},
+		Script:  "if (a < b && c > d) { run(); }",
+		Style:   "a > b { color: red; }",
+		Notes:   "1 < 2",
+	}
+
+	tests := []struct {
+		name     string
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name:     "Void elements and raw text",
+			opts:     &MarshalOptions{Mode: ModeHTML, RootTag: "div", XMLHeader: true, SelfClosingTags: []string{"span", "br"}},
+			expected: "<div>\n<h1>Fish &amp; Chips</h1>\n<br>\n<img src=\"/a.png\" alt=\"A &lt;b&gt;\">\n<span></span>\n<script>if (a < b && c > d) { run(); }</script>\n<style>a > b { color: red; }</style>\n<p>1 &lt; 2</p>\n</div>",
+		},
+		{
+			name:     "Indented fragment",
+			opts:     &MarshalOptions{Mode: ModeHTML, RootTag: "div", Indent: "  "},
+			expected: "<div>\n  <h1>Fish &amp; Chips</h1>\n  <br>\n  <img src=\"/a.png\" alt=\"A &lt;b&gt;\">\n  <span></span>\n  <script>if (a < b && c > d) { run(); }</script>\n  <style>a > b { color: red; }</style>\n  <p>1 &lt; 2</p>\n</div>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(page, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+
+	t.Run("Void element content is rejected", func(t *testing.T) {
+		type Bad struct {
+			Break string `xml:"br"`
+		}
+		if _, err := Marshal(Bad{Break: "text"}, &MarshalOptions{Mode: ModeHTML}); err == nil {
+			t.Errorf("Expected an error for content inside a void element")
+		}
+	})
+
+	t.Run("Script end tag is rejected", func(t *testing.T) {
+		type Bad struct {
+			Script string `xml:"script"`
+		}
+		if _, err := Marshal(Bad{Script: "x</SCRIPT><b>"}, &MarshalOptions{Mode: ModeHTML}); err == nil {
+			t.Errorf("Expected an error for an embedded end tag")
+		}
+	})
+}
+
+func TestXHTMLMode(t *testing.T) {
+	type Image struct {
+		Src string `xml:"SRC,attr"`
+	}
+	type Body struct {
+		Title string   `xml:"H1"`
+		Break struct{} `xml:"br"`
+		Image Image    `xml:"IMG"`
+		Para  string   `xml:"p"`
+		Rule  struct{} `xml:"Divider"`
+	}
+
+	tests := []struct {
+		name     string
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name:     "Lowercase names and spaced self-closing void elements",
+			opts:     &MarshalOptions{Mode: ModeXHTML, Indent: "  "},
+			expected: "<body xmlns=\"http://www.w3.org/1999/xhtml\">\n  <h1>Intro</h1>\n  <br />\n  <img src=\"a.png\" />\n  <p></p>\n  <divider></divider>\n</body>",
+		},
+		{
+			name:     "SelfClosingTags extend the void set",
+			opts:     &MarshalOptions{Mode: ModeXHTML, Indent: "  ", Namespace: "urn:custom", SelfClosingTags: []string{"Divider"}},
+			expected: "<body xmlns=\"urn:custom\">\n  <h1>Intro</h1>\n  <br />\n  <img src=\"a.png\" />\n  <p></p>\n  <divider />\n</body>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(Body{Title: "Intro", Image: Image{Src: "a.png"}}, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		opts     *JSONOptions
+		expected string
+	}{
+		{
+			name:     "Single key object becomes the root",
+			input:    `{"order": {"@id": "42", "customer": "Ana & Bo", "item": [{"@sku": "A", "#text": "Widget"}, {"@sku": "B", "qty": 2}], "paid": true, "note": null}}`,
+			opts:     &JSONOptions{Marshal: &MarshalOptions{Indent: "  "}},
+			expected: "<order id=\"42\">\n  <customer>Ana &amp; Bo</customer>\n  <item sku=\"A\">Widget</item>\n  <item sku=\"B\">\n    <qty>2</qty>\n  </item>\n  <paid>true</paid>\n  <note></note>\n</order>",
+		},
+		{
+			name:     "Top-level arrays use the root and item tags",
+			input:    `[1, [2.5, "x"]]`,
+			opts:     &JSONOptions{RootTag: "values", ItemTag: "v", Marshal: &MarshalOptions{Indent: "  "}},
+			expected: "<values>\n  <v>1</v>\n  <v>\n    <v>2.5</v>\n    <v>x</v>\n  </v>\n</values>",
+		},
+		{
+			name:     "Single item arrays keep the root",
+			input:    `[1]`,
+			expected: "<root>\n<item>1</item>\n</root>",
+		},
+		{
+			name:     "Single key arrays keep the root",
+			input:    `{"a": [1]}`,
+			expected: "<root>\n<a>1</a>\n</root>",
+		},
+		{
+			name:     "Custom conventions",
+			input:    `{"a": {"_b": "1", "$": "text"}, "c": "d"}`,
+			opts:     &JSONOptions{AttributePrefix: "_", TextKey: "$", Marshal: &MarshalOptions{XMLHeader: true}},
+			expected: "<?xml version=\"1.0\" encoding=\"UTF-8\"?><root>\n<a b=\"1\">text</a>\n<c>d</c>\n</root>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := FromJSON([]byte(tt.input), tt.opts)
+			if err != nil {
+				t.Fatalf("FromJSON error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		name  string
+		input string
+	}{
+		{"Invalid element name", `{"first name": "x"}`},
+		{"Object attribute", `{"a": {"@b": {}}}`},
+		{"Truncated document", `{"a": [1, 2`},
+		{"Trailing data", `{"a": 1} {"b": 2}`},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := FromJSON([]byte(tt.input), nil); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+
+	if _, err := FromJSON([]byte(`{"1a": true}`), nil); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Expected ErrInvalidName, got %v", err)
+	}
+
+	duplicate := []byte(`{"a": {"@id": 1, "@id": 2}}`)
+	var dupErr *DuplicateAttributeError
+	if _, err := FromJSON(duplicate, nil); !errors.As(err, &dupErr) || dupErr.Name != "id" || dupErr.Path != "/a" {
+		t.Errorf("Expected a duplicate attribute error at /a, got %v", err)
+	}
+	outputBytes, err := FromJSON(duplicate, &JSONOptions{Marshal: &MarshalOptions{DuplicateAttributes: DuplicateAttributesLastWins}})
+	if err != nil || string(outputBytes) != `<a id="2"></a>` {
+		t.Errorf("Expected the last attribute to win, got %q (%v)", outputBytes, err)
+	}
+	if _, err := Format([]byte(`<a id="1" id="2"/>`), nil); !errors.As(err, &dupErr) {
+		t.Errorf("Expected Format to reject duplicate attributes, got %v", err)
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	input := `<order id="42" paid="true"><customer>Ana "B"</customer><item sku="A">Widget</item><item sku="B"><qty>2</qty></item><zip>007</zip><note/><!-- skipped --></order>`
+
+	tests := []struct {
+		name     string
+		input    string
+		opts     *JSONOptions
+		expected string
+	}{
+		{
+			name:     "Repeated siblings fold into arrays",
+			input:    input,
+			expected: `{"order":{"@id":"42","@paid":"true","customer":"Ana \"B\"","item":[{"@sku":"A","#text":"Widget"},{"@sku":"B","qty":"2"}],"zip":"007","note":""}}`,
+		},
+		{
+			name:     "Type inference and custom prefixes",
+			input:    input,
+			opts:     &JSONOptions{InferTypes: true, AttributePrefix: "-", TextKey: "value"},
+			expected: `{"order":{"-id":42,"-paid":true,"customer":"Ana \"B\"","item":[{"-sku":"A","value":"Widget"},{"-sku":"B","qty":2}],"zip":"007","note":""}}`,
+		},
+		{
+			name:     "Forced arrays and indentation",
+			input:    "<list>\n  <entry>one</entry>\n</list>",
+			opts:     &JSONOptions{ForceArrays: []string{"entry"}, Indent: "  "},
+			expected: "{\n  \"list\": {\n    \"entry\": [\n      \"one\"\n    ]\n  }\n}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := ToJSON([]byte(tt.input), tt.opts)
+			if err != nil {
+				t.Fatalf("ToJSON error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", tt.expected, outputBytes)
+			}
+			if !json.Valid(outputBytes) {
+				t.Errorf("Output is not valid JSON")
+			}
+		})
+	}
+
+	t.Run("Round trip through FromJSON", func(t *testing.T) {
+		jsonBytes, err := ToJSON([]byte(`<a x="1"><b>2</b><b>3</b></a>`), nil)
+		if err != nil {
+			t.Fatalf("ToJSON error: %v", err)
+		}
+		xmlBytes, err := FromJSON(jsonBytes, nil)
+		if err != nil {
+			t.Fatalf("FromJSON error: %v", err)
+		}
+		if expected := "<a x=\"1\">\n<b>2</b>\n<b>3</b>\n</a>"; string(xmlBytes) != expected {
+			t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, xmlBytes)
+		}
+	})
+
+	if _, err := ToJSON([]byte("<a>"), nil); err == nil {
+		t.Errorf("Expected an error for malformed input")
+	}
+}
+
+func TestConvertCSV(t *testing.T) {
+	input := "id,First Name,1st choice,\n1,Ana & Bo,tea,x\n2,\"Quoted, comma\",coffee,\n"
+
+	tests := []struct {
+		name     string
+		input    string
+		opts     *CSVOptions
+		expected string
+	}{
+		{
+			name:     "Columns as elements",
+			input:    input,
+			opts:     &CSVOptions{Marshal: &MarshalOptions{Indent: "  ", XMLHeader: true}},
+			expected: "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<rows>\n  <row>\n    <id>1</id>\n    <First_Name>Ana &amp; Bo</First_Name>\n    <_1st_choice>tea</_1st_choice>\n    <column4>x</column4>\n  </row>\n  <row>\n    <id>2</id>\n    <First_Name>Quoted, comma</First_Name>\n    <_1st_choice>coffee</_1st_choice>\n    <column4></column4>\n  </row>\n</rows>",
+		},
+		{
+			name:     "Columns as attributes with explicit headers",
+			input:    "a;b\nc;d\n",
+			opts:     &CSVOptions{RootTag: "table", RowTag: "r", Headers: []string{"x", "y"}, Attributes: true, Comma: ';', Marshal: &MarshalOptions{Indent: "  ", SelfClosingTags: []string{"r"}}},
+			expected: "<table>\n  <r x=\"a\" y=\"b\"/>\n  <r x=\"c\" y=\"d\"/>\n</table>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := ConvertCSV(&buf, strings.NewReader(tt.input), tt.opts); err != nil {
+				t.Fatalf("ConvertCSV error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, buf.String())
+			}
+		})
+	}
+
+	errorTests := []struct {
+		name  string
+		input string
+		opts  *CSVOptions
+	}{
+		{"Empty input", "", nil},
+		{"Ragged row", "a,b\n1\n", nil},
+		{"Duplicate attribute columns", "a,a\n1,2\n", &CSVOptions{Attributes: true}},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ConvertCSV(io.Discard, strings.NewReader(tt.input), tt.opts); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
+
+func TestCompatStdlib(t *testing.T) {
+	type Line struct {
+		SKU   string  `xml:"sku,attr"`
+		Qty   int     `xml:"qty"`
+		Price float64 `xml:"price"`
+		Note  string  `xml:"note,omitempty"`
+	}
+	type Order struct {
+		XMLName xml.Name `xml:"order"`
+		ID      string   `xml:"id,attr"`
+		Buyer   string   `xml:"buyer>name"`
+		Lines   []Line   `xml:"line"`
+		Comment string   `xml:",comment"`
+		Empty   *Line    `xml:"empty"`
+	}
+
+	order := Order{
+		ID:      "7",
+		Buyer:   "Ana & Bo <co>",
+		Lines:   []Line{{SKU: "A", Qty: 2, Price: 9.5}, {SKU: "B\"", Qty: 1, Price: 0.125, Note: "fragile\n"}},
+		Comment: " generated ",
+	}
+
+	tests := []struct {
+		name   string
+		opts   *MarshalOptions
+		stdlib func() ([]byte, error)
+	}{
+		{
+			name:   "Compact",
+			opts:   &MarshalOptions{CompatStdlib: true},
+			stdlib: func() ([]byte, error) { return xml.Marshal(order) },
+		},
+		{
+			name: "Indented with header",
+			opts: &MarshalOptions{CompatStdlib: true, Indent: "  ", XMLHeader: true},
+			stdlib: func() ([]byte, error) {
+				data, err := xml.MarshalIndent(&order, "", "  ")
+				return append([]byte(xml.Header), data...), err
+			},
+		},
+		{
+			name: "Root tag override",
+			opts: &MarshalOptions{CompatStdlib: true, RootTag: "purchase"},
+			stdlib: func() ([]byte, error) {
+				var buf bytes.Buffer
+				err := xml.NewEncoder(&buf).EncodeElement(order, xml.StartElement{Name: xml.Name{Local: "purchase"}})
+				return buf.Bytes(), err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, err := tt.stdlib()
+			if err != nil {
+				t.Fatalf("encoding/xml error: %v", err)
+			}
+			outputBytes, err := Marshal(order, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if !bytes.Equal(outputBytes, expected) {
+				t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", expected, outputBytes)
+			}
+		})
+	}
+
+	if _, err := Marshal(order, &MarshalOptions{CompatStdlib: true, SelfClosingTags: []string{"empty"}}); err == nil {
+		t.Errorf("Expected an error for an incompatible option")
+	}
+}
+
+func TestEncodeToken(t *testing.T) {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	encoder := NewEncoder(bw, []string{"br"}, "  ", false)
+
+	tokens := []xml.Token{
+		xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0"`)},
+		xml.StartElement{Name: xml.Name{Space: "urn:feed", Local: "feed"}, Attr: []xml.Attr{{Name: xml.Name{Local: "id"}, Value: "a&b"}}},
+		xml.Comment(" entries "),
+		xml.StartElement{Name: xml.Name{Local: "entry"}},
+		xml.CharData("1 < 2"),
+		xml.EndElement{Name: xml.Name{Local: "entry"}},
+		xml.StartElement{Name: xml.Name{Local: "br"}},
+		xml.EndElement{Name: xml.Name{Local: "br"}},
+		xml.EndElement{Name: xml.Name{Space: "urn:feed", Local: "feed"}},
+	}
+	for _, token := range tokens {
+		if err := encoder.EncodeToken(token); err != nil {
+			t.Fatalf("EncodeToken(%#v) error: %v", token, err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected output to stay buffered until Flush")
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatalf("Flush error: %v", err)
+	}
+
+	expected := "<?xml version=\"1.0\"?>\n<feed xmlns=\"urn:feed\" id=\"a&amp;b\">\n  <!-- entries -->\n  <entry>1 &lt; 2</entry>\n  <br/>\n</feed>"
+	if buf.String() != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, buf.String())
+	}
+
+	errorTests := []struct {
+		name   string
+		tokens []xml.Token
+	}{
+		{"Mismatched end element", []xml.Token{xml.StartElement{Name: xml.Name{Local: "a"}}, xml.EndElement{Name: xml.Name{Local: "b"}}}},
+		{"Unopened end element", []xml.Token{xml.EndElement{Name: xml.Name{Local: "a"}}}},
+		{"Late declaration", []xml.Token{xml.StartElement{Name: xml.Name{Local: "a"}}, xml.ProcInst{Target: "xml"}}},
+		{"Invalid name", []xml.Token{xml.StartElement{Name: xml.Name{Local: "1a"}}}},
+		{"Unbalanced directive", []xml.Token{xml.Directive("DOCTYPE a [<!ENTITY x 'y>]")}},
+		{"Directive closing early", []xml.Token{xml.Directive("DOCTYPE a><injected/")}},
+		{"Unterminated comment in directive", []xml.Token{xml.Directive("DOCTYPE a <!-- x")}},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := NewEncoder(io.Discard, nil, "", false)
+			var err error
+			for _, token := range tt.tokens {
+				if err = encoder.EncodeToken(token); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+
+	t.Run("Namespaced attributes", func(t *testing.T) {
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf, nil, "", false)
+		tokens := []xml.Token{
+			xml.Directive(`DOCTYPE link [<!ENTITY gt ">"> <!-- a > b -->]`),
+			xml.StartElement{Name: xml.Name{Local: "link"}, Attr: []xml.Attr{
+				{Name: xml.Name{Space: "http://www.w3.org/1999/xlink", Local: "href"}, Value: "#a"},
+				{Name: xml.Name{Space: "http://www.w3.org/XML/1998/namespace", Local: "lang"}, Value: "en"},
+				{Name: xml.Name{Space: "xlink", Local: "type"}, Value: "simple"},
+			}},
+			xml.EndElement{Name: xml.Name{Local: "link"}},
+		}
+		for _, token := range tokens {
+			if err := encoder.EncodeToken(token); err != nil {
+				t.Fatalf("EncodeToken(%#v) error: %v", token, err)
+			}
+		}
+		expected := "<!DOCTYPE link [<!ENTITY gt \">\"> <!-- a > b -->]><link ns1:href=\"#a\" xml:lang=\"en\" xlink:type=\"simple\" xmlns:ns1=\"http://www.w3.org/1999/xlink\"></link>"
+		if buf.String() != expected {
+			t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, buf.String())
+		}
+	})
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, &MarshalOptions{Indent: "  ", XMLHeader: true, SelfClosingTags: []string{"flag"}})
+
+	steps := []func() error{
+		func() error { return w.StartElement("export", Attribute{Name: "table", Value: "users"}) },
+		func() error { return w.Comment(" cursor batch 1 ") },
+		func() error { return w.StartElement("user", Attribute{Name: "id", Value: "1"}) },
+		func() error { return w.StartElement("name") },
+		func() error { return w.Text("Ana & Bo") },
+		func() error { return w.EndElement() },
+		func() error { return w.StartElement("bio") },
+		func() error { return w.CData("<b>hi</b>") },
+		func() error { return w.EndElement() },
+		func() error { return w.StartElement("flag") },
+		func() error { return w.EndElement() },
+		func() error { return w.EndElement() },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("Step %d error: %v", i, err)
+		}
+	}
+	if w.Depth() != 1 {
+		t.Errorf("Expected depth 1, got %d", w.Depth())
+	}
+	if err := w.Close(); err == nil {
+		t.Errorf("Expected an error for an unclosed root")
+	}
+
+	buf.Reset()
+	w = NewWriter(&buf, &MarshalOptions{Indent: "  ", XMLHeader: true})
+	for _, step := range []func() error{
+		func() error { return w.StartElement("export") },
+		func() error { return w.StartElement("user") },
+		func() error { return w.Text("1") },
+		func() error { return w.EndElement() },
+		func() error { return w.Flush() },
+		func() error { return w.EndElement() },
+	} {
+		if err := step(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	expected := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<export>\n  <user>1</user>\n</export>"
+	if buf.String() != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, buf.String())
+	}
+	if err := w.StartElement("late"); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("Expected ErrWriterClosed, got %v", err)
+	}
+
+	errorTests := []struct {
+		name  string
+		steps func(w *Writer) error
+	}{
+		{"End without start", func(w *Writer) error { return w.EndElement() }},
+		{"Text outside root", func(w *Writer) error { return w.Text("x") }},
+		{"Invalid name", func(w *Writer) error { return w.StartElement("a b") }},
+		{"Second root", func(w *Writer) error {
+			w.StartElement("a")
+			w.EndElement()
+			return w.StartElement("b")
+		}},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWriter(io.Discard, nil)
+			defer w.Close()
+			if err := tt.steps(w); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
+
+func TestMarshalStream(t *testing.T) {
+	type Record struct {
+		ID   int    `xml:"id,attr"`
+		Name string `xml:"name"`
+	}
+
+	items := make(chan interface{})
+	go func() {
+		defer close(items)
+		items <- Record{ID: 1, Name: "Ana"}
+		items <- nil
+		items <- &Record{ID: 2, Name: "Bo & Co"}
+	}()
+
+	var buf bytes.Buffer
+	opts := &MarshalOptions{Indent: "  ", XMLHeader: true, Namespace: "urn:export"}
+	if err := MarshalStream(&buf, "export", items, opts); err != nil {
+		t.Fatalf("MarshalStream error: %v", err)
+	}
+
+	expected := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<export xmlns=\"urn:export\">\n  <Record id=\"1\">\n    <name>Ana</name>\n  </Record>\n  <Record id=\"2\">\n    <name>Bo &amp; Co</name>\n  </Record>\n</export>"
+	if buf.String() != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, buf.String())
+	}
+
+	t.Run("Errors report the item index and leave the producer to the caller", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		items := make(chan interface{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer close(items)
+			for _, record := range []Record{{ID: 1}, {ID: 2, Name: "bad\x00"}, {ID: 3}} {
+				select {
+				case items <- record:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		err := MarshalStreamContext(ctx, io.Discard, "export", items, &MarshalOptions{InvalidChars: InvalidCharsError})
+		cancel()
+		var charErr *InvalidCharError
+		if !errors.As(err, &charErr) || charErr.Path != "export[1].Name" {
+			t.Fatalf("Expected InvalidCharError at export[1].Name, got %v", err)
+		}
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("Producer was left blocked")
+		}
+	})
+
+	t.Run("Unnamed item types need ItemTag", func(t *testing.T) {
+		items := make(chan interface{}, 1)
+		items <- struct {
+			ID int `xml:"id,attr"`
+		}{ID: 7}
+		close(items)
+		if err := MarshalStream(io.Discard, "export", items, nil); err == nil || !strings.Contains(err.Error(), "ItemTag") {
+			t.Errorf("Expected an ItemTag error, got %v", err)
+		}
+
+		items = make(chan interface{}, 1)
+		items <- struct {
+			ID int `xml:"id,attr"`
+		}{ID: 7}
+		close(items)
+		var buf bytes.Buffer
+		if err := MarshalStream(&buf, "export", items, &MarshalOptions{ItemTag: "row"}); err != nil {
+			t.Fatalf("MarshalStream error: %v", err)
+		}
+		if expected := "<export>\n<row id=\"7\"></row>\n</export>"; buf.String() != expected {
+			t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, buf.String())
+		}
+	})
+
+	t.Run("Cancellation stops waiting for items", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := MarshalStreamContext(ctx, io.Discard, "export", make(chan interface{}), nil); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+type chunkFile struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (f *chunkFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestChunkedWriter(t *testing.T) {
+	type Row struct {
+		ID int `xml:"id,attr"`
+	}
+
+	var files []*chunkFile
+	create := func(part int) (io.WriteCloser, error) {
+		if part != len(files)+1 {
+			t.Errorf("Unexpected part number %d", part)
+		}
+		file := &chunkFile{}
+		files = append(files, file)
+		return file, nil
+	}
+
+	opts := &ChunkOptions{MaxItems: 2, Marshal: &MarshalOptions{Indent: "  ", XMLHeader: true, Namespace: "urn:rows", SelfClosingTags: []string{"Row"}}}
+	w := NewChunkedWriter("rows", create, opts)
+	for i := 1; i <= 5; i++ {
+		if err := w.Write(Row{ID: i}); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close error: %v", err)
+	}
+
+	if w.Parts() != 3 || len(files) != 3 {
+		t.Fatalf("Expected 3 parts, got %d", w.Parts())
+	}
+	expected := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<rows xmlns=\"urn:rows\">\n  <Row id=\"3\"/>\n  <Row id=\"4\"/>\n</rows>"
+	if files[1].String() != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, files[1].String())
+	}
+	for i, file := range files {
+		if !file.closed {
+			t.Errorf("Part %d was not closed", i+1)
+		}
+		if _, err := Parse(file.Bytes()); err != nil {
+			t.Errorf("Part %d is not well-formed: %v", i+1, err)
+		}
+	}
+
+	t.Run("Byte limit splits at element boundaries", func(t *testing.T) {
+		files = nil
+		w := NewChunkedWriter("rows", create, &ChunkOptions{MaxBytes: 60})
+		for i := 1; i <= 4; i++ {
+			if err := w.Write(Row{ID: i}); err != nil {
+				t.Fatalf("Write error: %v", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close error: %v", err)
+		}
+		for i, file := range files {
+			if file.Len() > 60 {
+				t.Errorf("Part %d has %d bytes", i+1, file.Len())
+			}
+		}
+		if len(files) != 2 || files[0].String() != "<rows>\n<Row id=\"1\"></Row>\n<Row id=\"2\"></Row>\n</rows>" {
+			t.Errorf("Unexpected parts: %d, first %q", len(files), files[0].String())
+		}
+	})
+
+	t.Run("Oversized items are rejected", func(t *testing.T) {
+		w := NewChunkedWriter("rows", create, &ChunkOptions{MaxBytes: 10})
+		if err := w.Write(Row{ID: 1}); err == nil {
+			t.Errorf("Expected an error for an item larger than the limit")
+		}
+		w.Close()
+		if err := w.Write(Row{ID: 2}); !errors.Is(err, ErrWriterClosed) {
+			t.Errorf("Expected ErrWriterClosed, got %v", err)
+		}
+	})
+
+	t.Run("Rejected items do not count", func(t *testing.T) {
+		type Entry struct {
+			ID   int    `xml:"id,attr"`
+			Name string `xml:"name,attr"`
+		}
+		long := strings.Repeat("x", 100)
+		files = nil
+		w := NewChunkedWriter("rows", create, &ChunkOptions{MaxItems: 2, MaxBytes: 100})
+		for _, entry := range []Entry{{ID: 1, Name: "a"}, {ID: 2, Name: long}, {ID: 3, Name: "c"}, {ID: 4, Name: long}, {ID: 5, Name: "e"}} {
+			err := w.Write(entry)
+			if entry.Name == long {
+				if err == nil {
+					t.Fatalf("Expected an error for item %d", entry.ID)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("Write error: %v", err)
+			}
+		}
+		if err := w.Write(Entry{ID: 6, Name: long}); err == nil || !strings.Contains(err.Error(), "item 3 ") {
+			t.Errorf("Expected the error to name item 3, got %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close error: %v", err)
+		}
+		if len(files) != 2 || files[0].String() != "<rows>\n<Entry id=\"1\" name=\"a\"></Entry>\n<Entry id=\"3\" name=\"c\"></Entry>\n</rows>" {
+			t.Errorf("Unexpected parts: %d, first %q", len(files), files[0].String())
+		}
+	})
+
+	t.Run("Unnamed item types need ItemTag", func(t *testing.T) {
+		item := struct {
+			ID int `xml:"id,attr"`
+		}{ID: 1}
+		w := NewChunkedWriter("rows", create, nil)
+		if err := w.Write(item); err == nil || !strings.Contains(err.Error(), "ItemTag") {
+			t.Errorf("Expected an ItemTag error, got %v", err)
+		}
+
+		files = nil
+		w = NewChunkedWriter("rows", create, &ChunkOptions{Marshal: &MarshalOptions{ItemTag: "row"}})
+		if err := w.Write(item); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close error: %v", err)
+		}
+		if len(files) != 1 || files[0].String() != "<rows>\n<row id=\"1\"></row>\n</rows>" {
+			t.Errorf("Unexpected parts: %d", len(files))
+		}
+	})
+}
+
+func TestDeclaration(t *testing.T) {
+	type Config struct {
+		Name string `xml:"name"`
+	}
+
+	tests := []struct {
+		name     string
+		decl     *Declaration
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "Defaults to version 1.0",
+			decl:     &Declaration{},
+			expected: "<?xml version=\"1.0\"?>\n<Config>\n  <name>a</name>\n</Config>",
+		},
+		{
+			name:     "Version, encoding and standalone",
+			decl:     &Declaration{Version: "1.1", Encoding: "UTF-8", Standalone: "yes"},
+			expected: "<?xml version=\"1.1\" encoding=\"UTF-8\" standalone=\"yes\"?>\n<Config>\n  <name>a</name>\n</Config>",
+		},
+		{name: "Unsupported version", decl: &Declaration{Version: "2.0"}, wantErr: true},
+		{name: "Invalid encoding label", decl: &Declaration{Encoding: "utf 8"}, wantErr: true},
+		{name: "Invalid standalone value", decl: &Declaration{Standalone: "true"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(Config{Name: "a"}, &MarshalOptions{Indent: "  ", Declaration: tt.decl})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+}
+
+func TestPrologProcessingInstructions(t *testing.T) {
+	type Report struct {
+		Title string `xml:"title"`
+	}
+	stylesheet := ProcessingInstructionNode{Target: "xml-stylesheet", Data: `type="text/xsl" href="t.xsl"`}
+
+	tests := []struct {
+		name     string
+		opts     *MarshalOptions
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "Indented prolog",
+			opts:     &MarshalOptions{Indent: "  ", XMLHeader: true, ProcessingInstructions: []ProcessingInstructionNode{stylesheet, {Target: "app", Data: ""}}},
+			expected: "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<?xml-stylesheet type=\"text/xsl\" href=\"t.xsl\"?>\n<?app?>\n<Report>\n  <title>Q1</title>\n</Report>",
+		},
+		{
+			name:     "Compact prolog",
+			opts:     &MarshalOptions{ProcessingInstructions: []ProcessingInstructionNode{stylesheet}},
+			expected: "<?xml-stylesheet type=\"text/xsl\" href=\"t.xsl\"?><Report>\n<title>Q1</title>\n</Report>",
+		},
+		{
+			name:    "Reserved target",
+			opts:    &MarshalOptions{ProcessingInstructions: []ProcessingInstructionNode{{Target: "XML", Data: "x"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Terminator in data",
+			opts:    &MarshalOptions{ProcessingInstructions: []ProcessingInstructionNode{{Target: "app", Data: "a?>b"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(Report{Title: "Q1"}, tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+}
+
+func TestHeaderComments(t *testing.T) {
+	type Settings struct {
+		Port int `xml:"port"`
+	}
+
+	opts := &MarshalOptions{
+		Indent:                 "  ",
+		XMLHeader:              true,
+		HeaderComments:         []string{" Licensed under MIT ", " Generated 2024-01-02 "},
+		ProcessingInstructions: []ProcessingInstructionNode{{Target: "app", Data: "v2"}},
+	}
+	outputBytes, err := Marshal(Settings{Port: 80}, opts)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<!-- Licensed under MIT -->\n<!-- Generated 2024-01-02 -->\n<?app v2?>\n<Settings>\n  <port>80</port>\n</Settings>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+
+	stdlibOpts := *opts
+	stdlibOpts.CompatStdlib = true
+	outputBytes, err = Marshal(Settings{Port: 80}, &stdlibOpts)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected = xml.Header + "<!-- Licensed under MIT --><!-- Generated 2024-01-02 --><?app v2?><Settings>\n  <port>80</port>\n</Settings>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+
+	if _, err := Marshal(Settings{}, &MarshalOptions{HeaderComments: []string{"a -- b"}}); err == nil {
+		t.Errorf("Expected an error for a comment containing \"--\"")
+	}
+}
+
+func TestOutputEncoding(t *testing.T) {
+	type Note struct {
+		Text string `xml:"text"`
+		Lang string `xml:"lang,attr"`
+	}
+	note := Note{Text: "Café 5€", Lang: "fr"}
+
+	tests := []struct {
+		name     string
+		opts     *MarshalOptions
+		expected []byte
+	}{
+		{
+			name:     "ISO-8859-1 references unsupported characters",
+			opts:     &MarshalOptions{Encoding: "ISO-8859-1"},
+			expected: []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><Note lang=\"fr\">\n<text>Caf\xe9 5&#8364;</text>\n</Note>"),
+		},
+		{
+			name:     "Windows-1252 with a custom declaration",
+			opts:     &MarshalOptions{Encoding: "windows-1252", Declaration: &Declaration{Standalone: "yes"}},
+			expected: []byte("<?xml version=\"1.0\" encoding=\"windows-1252\" standalone=\"yes\"?><Note lang=\"fr\">\n<text>Caf\xe9 5\x80</text>\n</Note>"),
+		},
+		{
+			name:     "UTF-8 is unchanged",
+			opts:     &MarshalOptions{Encoding: "utf-8"},
+			expected: []byte("<Note lang=\"fr\">\n<text>Café 5€</text>\n</Note>"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(note, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if !bytes.Equal(outputBytes, tt.expected) {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+
+	t.Run("Byte order marks", func(t *testing.T) {
+		prefixes := map[string][]byte{
+			"UTF-16":   {0xFE, 0xFF, 0, '<', 0, '?'},
+			"UTF-16BE": {0, '<', 0, '?', 0, 'x'},
+			"UTF-16LE": {'<', 0, '?', 0, 'x', 0},
+		}
+		for label, prefix := range prefixes {
+			outputBytes, err := Marshal(note, &MarshalOptions{Encoding: label})
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if !bytes.HasPrefix(outputBytes, prefix) {
+				t.Errorf("%s: unexpected prefix % x", label, outputBytes[:6])
+			}
+		}
+	})
+
+	t.Run("CDATA keeps character references outside the section", func(t *testing.T) {
+		type Memo struct {
+			Body CDATA `xml:"body"`
+		}
+		outputBytes, err := Marshal(Memo{Body: "5€ net"}, &MarshalOptions{Encoding: "ISO-8859-1"})
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		expected := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><Memo>\n<body><![CDATA[5]]>&#8364;<![CDATA[ net]]></body>\n</Memo>"
+		if string(outputBytes) != expected {
+			t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+		}
+	})
+
+	t.Run("Streaming entry points transcode", func(t *testing.T) {
+		opts := &MarshalOptions{Encoding: "ISO-8859-1"}
+		header := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>"
+		entries := []struct {
+			name     string
+			write    func(w io.Writer) error
+			expected string
+		}{
+			{
+				name: "MarshalStream",
+				write: func(w io.Writer) error {
+					items := make(chan interface{}, 1)
+					items <- note
+					close(items)
+					return MarshalStream(w, "notes", items, opts)
+				},
+				expected: header + "<notes>\n<Note lang=\"fr\">\n<text>Caf\xe9 5&#8364;</text>\n</Note>\n</notes>",
+			},
+			{
+				name: "NewChunkedWriter",
+				write: func(w io.Writer) error {
+					file := &chunkFile{}
+					chunks := NewChunkedWriter("notes", func(int) (io.WriteCloser, error) { return file, nil }, &ChunkOptions{Marshal: opts})
+					if err := chunks.Write(note); err != nil {
+						return err
+					}
+					if err := chunks.Close(); err != nil {
+						return err
+					}
+					_, err := w.Write(file.Bytes())
+					return err
+				},
+				expected: header + "<notes>\n<Note lang=\"fr\">\n<text>Caf\xe9 5&#8364;</text>\n</Note>\n</notes>",
+			},
+			{
+				name: "NewWriter",
+				write: func(w io.Writer) error {
+					xw := NewWriter(w, opts)
+					if err := xw.StartElement("text"); err != nil {
+						return err
+					}
+					if err := xw.Text("Café 5€"); err != nil {
+						return err
+					}
+					if err := xw.EndElement(); err != nil {
+						return err
+					}
+					return xw.Close()
+				},
+				expected: header + "<text>Caf\xe9 5&#8364;</text>",
+			},
+			{
+				name: "ConvertCSV",
+				write: func(w io.Writer) error {
+					return ConvertCSV(w, strings.NewReader("text\nCafé 5€\n"), &CSVOptions{Marshal: opts})
+				},
+				expected: header + "<rows>\n<row>\n<text>Caf\xe9 5&#8364;</text>\n</row>\n</rows>",
+			},
+		}
+		for _, entry := range entries {
+			var buf bytes.Buffer
+			if err := entry.write(&buf); err != nil {
+				t.Fatalf("%s error: %v", entry.name, err)
+			}
+			if buf.String() != entry.expected {
+				t.Errorf("%s output mismatch.\nExpected: %q\nGot: %q", entry.name, entry.expected, buf.String())
+			}
+		}
+	})
+
+	t.Run("Decoding the transcoded output", func(t *testing.T) {
+		outputBytes, err := Marshal(note, &MarshalOptions{Encoding: "ISO-8859-1"})
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		decoder := xml.NewDecoder(bytes.NewReader(outputBytes))
+		decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+			data, err := io.ReadAll(input)
+			runes := make([]rune, len(data))
+			for i, b := range data {
+				runes[i] = rune(b)
+			}
+			return strings.NewReader(string(runes)), err
+		}
+		var decoded struct {
+			Text string `xml:"text"`
+		}
+		if err := decoder.Decode(&decoded); err != nil {
+			t.Fatalf("Decode error: %v", err)
+		}
+		if decoded.Text != note.Text {
+			t.Errorf("Expected %q, got %q", note.Text, decoded.Text)
+		}
+	})
+
+	if _, err := Marshal(note, &MarshalOptions{Encoding: "EBCDIC"}); err == nil {
+		t.Errorf("Expected an error for an unsupported encoding")
+	}
+	if _, err := Marshal(note, &MarshalOptions{Encoding: "ISO-8859-1", Declaration: &Declaration{Encoding: "UTF-8"}}); err == nil {
+		t.Errorf("Expected an error for a conflicting declaration")
+	}
+}
+
+func TestNewline(t *testing.T) {
+	type Item struct {
+		Name string `xml:"name"`
+	}
+	type List struct {
+		Items []Item `xml:"item"`
+	}
+	list := List{Items: []Item{{Name: "a"}, {Name: "b"}}}
+
+	opts := &MarshalOptions{Indent: "  ", XMLHeader: true, Newline: "\r\n", HeaderComments: []string{" x "}}
+	outputBytes, err := Marshal(list, opts)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\r\n<!-- x -->\r\n<List>\r\n  <item>\r\n    <name>a</name>\r\n  </item>\r\n  <item>\r\n    <name>b</name>\r\n  </item>\r\n</List>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+	if strings.Count(string(outputBytes), "\n") != strings.Count(string(outputBytes), "\r\n") {
+		t.Errorf("Found bare line feeds in %q", outputBytes)
+	}
+
+	formatted, err := Format([]byte("<a><b>1</b></a>"), &MarshalOptions{Indent: "\t", Newline: "\r\n"})
+	if err != nil {
+		t.Fatalf("Format error: %v", err)
+	}
+	if expected := "<a>\r\n\t<b>1</b>\r\n</a>"; string(formatted) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, formatted)
+	}
+
+	if _, err := Marshal(list, &MarshalOptions{Newline: "\r"}); err == nil {
+		t.Errorf("Expected an error for an unsupported newline")
+	}
+}
+
+func TestAttributeOrder(t *testing.T) {
+	type Link struct {
+		Rel   string `xml:"rel,attr"`
+		Href  string `xml:"href,attr"`
+		ID    string `xml:"id,attr"`
+		XLink string `xml:"xmlns:xl,attr"`
+	}
+	link := Link{Rel: "self", Href: "/a", ID: "1", XLink: "urn:xl"}
+
+	tests := []struct {
+		name     string
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name:     "Struct order keeps xmlns first",
+			opts:     &MarshalOptions{Namespace: "urn:a"},
+			expected: `<Link xmlns="urn:a" rel="self" href="/a" id="1" xmlns:xl="urn:xl"></Link>`,
+		},
+		{
+			name:     "Alphabetical puts namespace declarations first",
+			opts:     &MarshalOptions{Namespace: "urn:a", AttributeOrder: AttributeOrderAlphabetical},
+			expected: `<Link xmlns="urn:a" xmlns:xl="urn:xl" href="/a" id="1" rel="self"></Link>`,
+		},
+		{
+			name: "Custom comparator",
+			opts: &MarshalOptions{CompareAttributes: func(a, b Attribute) int {
+				switch {
+				case a.Name == "id" && b.Name != "id":
+					return -1
+				case b.Name == "id" && a.Name != "id":
+					return 1
+				}
+				return 0
+			}},
+			expected: `<Link id="1" rel="self" href="/a" xmlns:xl="urn:xl"></Link>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(link, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", tt.expected, outputBytes)
+			}
+		})
+	}
+
+	formatted, err := Format([]byte(`<a z="1" b="2"><c y="3" x="4"/></a>`), &MarshalOptions{AttributeOrder: AttributeOrderAlphabetical})
+	if err != nil {
+		t.Fatalf("Format error: %v", err)
+	}
+	if expected := "<a b=\"2\" z=\"1\">\n<c x=\"4\" y=\"3\"></c>\n</a>"; string(formatted) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, formatted)
+	}
+}
+
+func TestWrapAttributes(t *testing.T) {
+	type Endpoint struct {
+		Name string `xml:"name,attr"`
+	}
+	type Backend struct {
+		Host   string `xml:"host,attr"`
+		Port   int    `xml:"port,attr"`
+		Weight int    `xml:"weight,attr"`
+	}
+	type Server struct {
+		Host     string   `xml:"host,attr"`
+		Port     int      `xml:"port,attr"`
+		TLS      bool     `xml:"tls,attr"`
+		Endpoint Endpoint `xml:"endpoint"`
+		Backup   Backend  `xml:"backup"`
+	}
+
+	server := Server{Host: "example.com", Port: 443, TLS: true, Endpoint: Endpoint{Name: "api"}, Backup: Backend{Host: "b", Port: 8443, Weight: 2}}
+	opts := &MarshalOptions{Indent: "  ", WrapAttributes: 2, SelfClosingTags: []string{"endpoint", "backup"}}
+	outputBytes, err := Marshal(server, opts)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := "<Server\n  host=\"example.com\"\n  port=\"443\"\n  tls=\"true\">\n  <endpoint name=\"api\"/>\n  <backup\n    host=\"b\"\n    port=\"8443\"\n    weight=\"2\"/>\n</Server>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+
+	opts.Indent = ""
+	outputBytes, err = Marshal(server, opts)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if strings.Contains(string(outputBytes), "\n  ") || !strings.HasPrefix(string(outputBytes), `<Server host="example.com" port="443" tls="true">`) {
+		t.Errorf("Expected no wrapping without indentation, got %q", outputBytes)
+	}
+}
+
+func TestScopedSelfClosing(t *testing.T) {
+	type Line struct {
+		SKU  string `xml:"sku,attr"`
+		Note string `xml:"note"`
+	}
+	type Order struct {
+		Note    string `xml:"note"`
+		Flag    string `xml:"flags>flag,selfclose"`
+		Lines   []Line `xml:"line,selfclose"`
+		Comment string `xml:"comment,selfclose"`
+	}
+	order := Order{Lines: []Line{{SKU: "A"}, {SKU: "B", Note: "gift"}}, Comment: "fine"}
+
+	tests := []struct {
+		name     string
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name:     "Tag option scopes self-closing to the field",
+			opts:     &MarshalOptions{Indent: "  ", RootTag: "order"},
+			expected: "<order>\n  <note></note>\n  <flags>\n    <flag/>\n  </flags>\n  <line sku=\"A\">\n    <note></note>\n  </line>\n  <line sku=\"B\">\n    <note>gift</note>\n  </line>\n  <comment>fine</comment>\n</order>",
+		},
+		{
+			name:     "Path-qualified entries match the parent element",
+			opts:     &MarshalOptions{Indent: "  ", RootTag: "order", SelfClosingTags: []string{"order>note"}},
+			expected: "<order>\n  <note/>\n  <flags>\n    <flag/>\n  </flags>\n  <line sku=\"A\">\n    <note></note>\n  </line>\n  <line sku=\"B\">\n    <note>gift</note>\n  </line>\n  <comment>fine</comment>\n</order>",
+		},
+		{
+			name:     "Tree path keeps content of self-closing fields",
+			opts:     &MarshalOptions{Indent: "  ", RootTag: "order", Transformers: []NodeTransformer{NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) { return root, nil })}},
+			expected: "<order>\n  <note></note>\n  <flags>\n    <flag/>\n  </flags>\n  <line sku=\"A\">\n    <note></note>\n  </line>\n  <line sku=\"B\">\n    <note>gift</note>\n  </line>\n  <comment>fine</comment>\n</order>",
+		},
+		{
+			name:     "Parallel items keep the tag option",
+			opts:     &MarshalOptions{Indent: "  ", RootTag: "order", Parallelism: 4, ParallelThreshold: 1, SelfClosingTags: []string{"line>note"}},
+			expected: "<order>\n  <note></note>\n  <flags>\n    <flag/>\n  </flags>\n  <line sku=\"A\">\n    <note/>\n  </line>\n  <line sku=\"B\">\n    <note>gift</note>\n  </line>\n  <comment>fine</comment>\n</order>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(order, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+
+	t.Run("Empty items self-close", func(t *testing.T) {
+		type Empty struct {
+			Items []struct{} `xml:"item,selfclose"`
+		}
+		outputBytes, err := Marshal(Empty{Items: make([]struct{}, 2)}, &MarshalOptions{Parallelism: 2, ParallelThreshold: 1})
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		if expected := "<Empty>\n<item/>\n<item/>\n</Empty>"; string(outputBytes) != expected {
+			t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+		}
+	})
+}
+
+func TestEmptyElementStyle(t *testing.T) {
+	type Meta struct {
+		Key string `xml:"key,attr"`
+	}
+	type Doc struct {
+		Title string `xml:"title"`
+		Body  string `xml:"body"`
+		Meta  Meta   `xml:"meta"`
+	}
+	doc := Doc{Body: "text", Meta: Meta{Key: "k"}}
+
+	tests := []struct {
+		name     string
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name:     "Expanded by default",
+			opts:     &MarshalOptions{Indent: "  "},
+			expected: "<Doc>\n  <title></title>\n  <body>text</body>\n  <meta key=\"k\"></meta>\n</Doc>",
+		},
+		{
+			name:     "Collapsed",
+			opts:     &MarshalOptions{Indent: "  ", EmptyElements: EmptyElementsCollapsed},
+			expected: "<Doc>\n  <title/>\n  <body>text</body>\n  <meta key=\"k\"/>\n</Doc>",
+		},
+		{
+			name:     "Spaced",
+			opts:     &MarshalOptions{Indent: "  ", EmptyElements: EmptyElementsSpaced},
+			expected: "<Doc>\n  <title />\n  <body>text</body>\n  <meta key=\"k\" />\n</Doc>",
+		},
+		{
+			name:     "HTML mode ignores the style",
+			opts:     &MarshalOptions{Mode: ModeHTML, EmptyElements: EmptyElementsCollapsed},
+			expected: "<Doc>\n<title></title>\n<body>text</body>\n<meta key=\"k\">\n</Doc>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(doc, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+}
+
+func TestRootAttributes(t *testing.T) {
+	type Catalog struct {
+		Version string   `xml:"version,attr"`
+		Items   []string `xml:"item"`
+	}
+	catalog := Catalog{Version: "1", Items: []string{"a"}}
+
+	opts := &MarshalOptions{
+		Namespace: "urn:catalog",
+		RootAttributes: []Attribute{
+			{Name: "xmlns:xsi", Value: "http://www.w3.org/2001/XMLSchema-instance"},
+			{Name: "xsi:schemaLocation", Value: "urn:catalog catalog.xsd"},
+			{Name: "version", Value: "2"},
+		},
+	}
+	outputBytes, err := Marshal(catalog, opts)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := `<Catalog xmlns="urn:catalog" version="2" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="urn:catalog catalog.xsd">` + "\n<item>a</item>\n</Catalog>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+
+	outputBytes, err = Marshal("x", &MarshalOptions{RootTag: "note", RootAttributes: []Attribute{{Name: "generator", Value: "go-xml"}}})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if expected := "<note generator=\"go-xml\">x</note>"; string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+
+	if _, err := Marshal(catalog, &MarshalOptions{RootAttributes: []Attribute{{Name: "bad name", Value: "x"}}}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Expected ErrInvalidName, got %v", err)
+	}
+}
+
+func TestNameStrategy(t *testing.T) {
+	words := []struct {
+		input                       string
+		snake, kebab, camel, pascal string
+	}{
+		{"UserID", "user_id", "user-id", "userID", "UserID"},
+		{"HTTPServerURL", "http_server_url", "http-server-url", "httpServerURL", "HTTPServerURL"},
+		{"createdAt", "created_at", "created-at", "createdAt", "CreatedAt"},
+		{"Field2Name", "field2_name", "field2-name", "field2Name", "Field2Name"},
+		{"already_snake", "already_snake", "already-snake", "alreadySnake", "AlreadySnake"},
+	}
+	for _, w := range words {
+		if got := SnakeCase(w.input); got != w.snake {
+			t.Errorf("SnakeCase(%q) = %q, want %q", w.input, got, w.snake)
+		}
+		if got := KebabCase(w.input); got != w.kebab {
+			t.Errorf("KebabCase(%q) = %q, want %q", w.input, got, w.kebab)
+		}
+		if got := CamelCase(w.input); got != w.camel {
+			t.Errorf("CamelCase(%q) = %q, want %q", w.input, got, w.camel)
+		}
+		if got := PascalCase(w.input); got != w.pascal {
+			t.Errorf("PascalCase(%q) = %q, want %q", w.input, got, w.pascal)
+		}
+	}
+
+	type Account struct {
+		AccountID   string `xml:",attr"`
+		DisplayName string
+		EmailAddr   string `xml:"email"`
+		IsActive    bool   `xml:",omitempty"`
+	}
+	outputBytes, err := Marshal(Account{AccountID: "7", DisplayName: "Ana", EmailAddr: "a@b.c"}, &MarshalOptions{NameStrategy: KebabCase, RootTag: "account"})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := "<account account-id=\"7\">\n<display-name>Ana</display-name>\n<email>a@b.c</email>\n</account>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+}
+
+func TestPreserveWhitespace(t *testing.T) {
+	type Snippet struct {
+		Lang string `xml:"lang,attr"`
+		Span string `xml:"span"`
+	}
+	type Page struct {
+		Title    string  `xml:"title"`
+		Code     Snippet `xml:"code,preserve"`
+		Verbatim string  `xml:"pre,preserve"`
+	}
+
+	page := Page{Title: "Doc", Code: Snippet{Lang: "go", Span: "func"}, Verbatim: "  a\n    b  "}
+	outputBytes, err := Marshal(page, &MarshalOptions{Indent: "  "})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := "<Page>\n  <title>Doc</title>\n  <code lang=\"go\" xml:space=\"preserve\"><span>func</span></code>\n  <pre xml:space=\"preserve\">  a\n    b  </pre>\n</Page>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+
+	input := "<doc><p>\n   keep   <b>me</b> </p><poem xml:space=\"preserve\">  roses\n  <i>red</i>\n<note xml:space=\"default\"> <x/> </note></poem></doc>"
+	formatted, err := Format([]byte(input), &MarshalOptions{Indent: "  "})
+	if err != nil {
+		t.Fatalf("Format error: %v", err)
+	}
+	expected = "<doc>\n  <p>\n   keep   \n    <b>me</b>\n  </p>\n  <poem xml:space=\"preserve\">  roses\n  <i>red</i>\n<note xml:space=\"default\">\n      <x></x>\n    </note></poem>\n</doc>"
+	if string(formatted) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, formatted)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	type Reading struct {
+		Unit   string             `xml:"unit,attr"`
+		Sensor string             `xml:"sensor,attr"`
+		Value  float64            `xml:"value"`
+		Delta  *float64           `xml:"delta"`
+		Tags   map[string]int     `xml:"tags"`
+		Limits map[string]float64 `xml:"limits,attr"`
+	}
+
+	delta := math.Copysign(0, -1)
+	reading := Reading{
+		Unit:   "C",
+		Sensor: "t1",
+		Value:  -0.001,
+		Delta:  &delta,
+		Tags:   map[string]int{"zone": 3, "floor": 2, "building": 1},
+		Limits: map[string]float64{"max": 40, "min": -10},
+	}
+
+	expected := `<Reading limits="map[max:40 min:-10]" sensor="t1" unit="C">` +
+		"\n<value>0.00</value>\n<delta>0.00</delta>\n<tags>map[building:1 floor:2 zone:3]</tags>\n</Reading>"
+	for i := 0; i < 10; i++ {
+		outputBytes, err := Marshal(reading, &MarshalOptions{Deterministic: true})
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		if string(outputBytes) != expected {
+			t.Fatalf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+		}
+	}
+
+	outputBytes, err := Marshal(reading, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if !strings.Contains(string(outputBytes), "<value>-0.00</value>") {
+		t.Errorf("Expected non-deterministic output to keep the sign, got %q", outputBytes)
+	}
+
+	if _, err := Marshal(reading, &MarshalOptions{Deterministic: true, CompatStdlib: true}); err == nil {
+		t.Error("Expected Deterministic to be rejected with CompatStdlib")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	type Item struct {
+		ID    int     `xml:"id,attr"`
+		Name  string  `xml:"name,attr"`
+		Price float64 `xml:"price"`
+	}
+	type Catalog struct {
+		Items []Item `xml:"item"`
+	}
+
+	catalog := Catalog{}
+	for i := 0; i < 200; i++ {
+		catalog.Items = append(catalog.Items, Item{ID: i, Name: fmt.Sprintf("item-%d", i), Price: float64(i) / 3})
+	}
+	opts := &MarshalOptions{Indent: "  ", Parallelism: 4, ParallelThreshold: 16}
+
+	digest, err := Digest(catalog, opts, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Digest error: %v", err)
+	}
+	data, err := Marshal(catalog, &MarshalOptions{Indent: "  ", Deterministic: true})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := sha256.Sum256(data)
+	if !bytes.Equal(digest, expected[:]) {
+		t.Errorf("Digest mismatch.\nExpected: %x\nGot: %x", expected, digest)
+	}
+
+	again, err := Digest(catalog, opts, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Digest error: %v", err)
+	}
+	if !bytes.Equal(digest, again) {
+		t.Error("Expected identical inputs to produce identical digests")
+	}
+
+	catalog.Items[100].Price = 0
+	changed, err := Digest(catalog, opts, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Digest error: %v", err)
+	}
+	if bytes.Equal(digest, changed) {
+		t.Error("Expected a changed input to produce a different digest")
+	}
+
+	if _, err := Digest(catalog, nil, crypto.Hash(0)); err == nil {
+		t.Error("Expected an error for an unavailable hash function")
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	type Card struct {
+		Number string `xml:"number,redact"`
+		Holder string `xml:"holder"`
+		CVV    CDATA  `xml:"cvv,redact"`
+	}
+	type Payment struct {
+		Token  string   `xml:"token,attr,redact"`
+		Amount int      `xml:"amount"`
+		Card   Card     `xml:"card"`
+		Keys   []string `xml:"keys>key,redact"`
+	}
+
+	payment := Payment{
+		Token:  "tok_123456",
+		Amount: 42,
+		Card:   Card{Number: "4111111111111111", Holder: "Ada", CVV: "123"},
+		Keys:   []string{"k1", "k2"},
+	}
+
+	outputBytes, err := Marshal(payment, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := `<Payment token="tok_123456">` +
+		"\n<amount>42</amount>\n<card>\n<number>4111111111111111</number>\n<holder>Ada</holder>\n<cvv><![CDATA[123]]></cvv>\n</card>\n<keys>\n<key>k1</key>\n<key>k2</key>\n</keys>\n</Payment>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+
+	var paths []string
+	opts := &MarshalOptions{Redactor: func(path, value string) string {
+		paths = append(paths, path)
+		if path == "Card.Number" && len(value) > 4 {
+			return strings.Repeat("*", len(value)-4) + value[len(value)-4:]
+		}
+		return "***"
+	}}
+	outputBytes, err = Marshal(payment, opts)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected = `<Payment token="***">` +
+		"\n<amount>42</amount>\n<card>\n<number>************1111</number>\n<holder>Ada</holder>\n<cvv><![CDATA[***]]></cvv>\n</card>\n<keys>\n<key>***</key>\n<key>***</key>\n</keys>\n</Payment>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+	expectedPaths := []string{"Token", "Card.Number", "Card.CVV", "Keys", "Keys"}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("Redactor paths mismatch.\nExpected: %v\nGot: %v", expectedPaths, paths)
+	}
+}
+
+func TestMarshalLimits(t *testing.T) {
+	type Node struct {
+		Name     string  `xml:"name,attr"`
+		Children []*Node `xml:"node"`
+	}
+
+	tree := Node{Name: "root", Children: []*Node{{Name: "a", Children: []*Node{{Name: "b"}}}}}
+	if _, err := Marshal(tree, &MarshalOptions{MaxDepth: 3}); err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	_, err := Marshal(tree, &MarshalOptions{MaxDepth: 2})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected a LimitError, got %v", err)
+	}
+	if limitErr.Limit != "MaxDepth" || limitErr.Path != "Node.Children[0].Children[0]" {
+		t.Errorf("Unexpected limit error: %+v", limitErr)
+	}
+
+	cycle := &Node{Name: "loop"}
+	cycle.Children = []*Node{cycle}
+	if _, err := Marshal(*cycle, &MarshalOptions{MaxDepth: 50, Parallelism: 2, ParallelThreshold: 1}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected cyclic input to hit MaxDepth, got %v", err)
+	}
+
+	outputBytes, err := Marshal(tree, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if _, err := Marshal(tree, &MarshalOptions{MaxBytes: len(outputBytes)}); err != nil {
+		t.Errorf("Expected output of exactly MaxBytes to succeed, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = MarshalTo(&buf, tree, &MarshalOptions{MaxBytes: len(outputBytes) - 1})
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxBytes" {
+		t.Errorf("Expected a MaxBytes LimitError, got %v", err)
+	}
+	if buf.Len() >= len(outputBytes) {
+		t.Errorf("Expected truncated output, got %d bytes", buf.Len())
+	}
+
+	items := make(chan interface{}, 3)
+	for i := 0; i < 3; i++ {
+		items <- tree
+	}
+	close(items)
+	if err := MarshalStream(io.Discard, "nodes", items, &MarshalOptions{MaxBytes: 64}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected MarshalStream to enforce MaxBytes, got %v", err)
+	}
+}
+
+func TestUnsupportedKinds(t *testing.T) {
+	type Job struct {
+		ID       int            `xml:"id,attr"`
+		Weight   complex128     `xml:"weight,attr"`
+		Name     string         `xml:"name"`
+		Done     chan bool      `xml:"done"`
+		Callback func()         `xml:"callback"`
+		Handle   unsafe.Pointer `xml:"handle"`
+	}
+	type Queue struct {
+		Jobs []Job `xml:"job"`
+	}
+
+	queue := Queue{Jobs: []Job{{ID: 1, Name: "build", Done: make(chan bool), Callback: func() {}}}}
+
+	_, err := Marshal(queue, nil)
+	var kindErr *UnsupportedKindError
+	if !errors.As(err, &kindErr) || !errors.Is(err, ErrUnsupportedKind) {
+		t.Fatalf("Expected an UnsupportedKindError, got %v", err)
+	}
+	if kindErr.Kind != reflect.Complex128 || kindErr.Path != "Queue.Jobs[0].Weight" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	type Event struct {
+		Name    string `xml:"name"`
+		Trigger func() `xml:"trigger"`
+	}
+	_, err = Marshal(Event{Name: "tick"}, nil)
+	if !errors.As(err, &kindErr) || kindErr.Kind != reflect.Func || kindErr.Path != "Event.Trigger" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	outputBytes, err := Marshal(queue, &MarshalOptions{SkipUnsupported: true})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := `<Queue>` + "\n" + `<job id="1">` + "\n<name>build</name>\n</job>\n</Queue>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+}
+
+func TestDuplicateAttributes(t *testing.T) {
+	type Base struct {
+		ID string `xml:"id,attr"`
+	}
+	type Record struct {
+		Base
+		Key   string `xml:"id,attr"`
+		Kind  string `xml:"kind,attr"`
+		Value string `xml:"value"`
+	}
+	type Namespaced struct {
+		NS   string `xml:"xmlns,attr"`
+		Name string `xml:"name"`
+	}
+
+	record := Record{Base: Base{ID: "1"}, Key: "2", Kind: "a", Value: "v"}
+
+	_, err := Marshal(record, nil)
+	var dupErr *DuplicateAttributeError
+	if !errors.As(err, &dupErr) || !errors.Is(err, ErrDuplicateAttribute) {
+		t.Fatalf("Expected a DuplicateAttributeError, got %v", err)
+	}
+	if dupErr.Name != "id" || dupErr.Path != "Record" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	outputBytes, err := Marshal(record, &MarshalOptions{DuplicateAttributes: DuplicateAttributesLastWins})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := `<Record id="2" kind="a">` + "\n<value>v</value>\n</Record>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+
+	_, err = Marshal(Namespaced{NS: "urn:field", Name: "n"}, &MarshalOptions{Namespace: "urn:option"})
+	if !errors.As(err, &dupErr) || dupErr.Name != "xmlns" {
+		t.Errorf("Expected an xmlns collision error, got %v", err)
+	}
+
+	outputBytes, err = Marshal(Namespaced{NS: "urn:same", Name: "n"}, &MarshalOptions{Namespace: "urn:same"})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected = `<Namespaced xmlns="urn:same">` + "\n<name>n</name>\n</Namespaced>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+
+	outputBytes, err = Marshal(Namespaced{NS: "urn:field", Name: "n"}, &MarshalOptions{Namespace: "urn:option", DuplicateAttributes: DuplicateAttributesLastWins})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected = `<Namespaced xmlns="urn:field">` + "\n<name>n</name>\n</Namespaced>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+}
+
+func TestReservedNames(t *testing.T) {
+	type Config struct {
+		Lang    string `xml:"xml:lang,attr"`
+		NS      string `xml:"xmlns:cfg,attr"`
+		Version string `xml:"XMLVersion,attr"`
+		Name    string `xml:"name"`
+	}
+	type Entry struct {
+		Data string `xml:"xmlData"`
+	}
+	type Feed struct {
+		Entries []Entry `xml:"entry"`
+	}
+
+	tests := []struct {
+		name         string
+		input        interface{}
+		opts         *MarshalOptions
+		expectedName string
+		expectedPath string
+	}{
+		{
+			name:         "Reserved attribute",
+			input:        Config{Lang: "en", NS: "urn:cfg", Version: "1", Name: "n"},
+			opts:         &MarshalOptions{StrictNames: true},
+			expectedName: "XMLVersion",
+			expectedPath: "Config.Version",
+		},
+		{
+			name:         "Reserved element",
+			input:        Feed{Entries: []Entry{{Data: "a"}}},
+			opts:         &MarshalOptions{StrictNames: true},
+			expectedName: "xmlData",
+			expectedPath: "Feed.Entries[0].Data",
+		},
+		{
+			name:         "Reserved root tag",
+			input:        Entry{},
+			opts:         &MarshalOptions{StrictNames: true, RootTag: "xml"},
+			expectedName: "xml",
+			expectedPath: "xml",
+		},
+		{
+			name:  "Checks disabled",
+			input: Config{Version: "1"},
+			opts:  &MarshalOptions{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Marshal(tt.input, tt.opts)
+			if tt.expectedName == "" {
+				if err != nil {
+					t.Fatalf("Serialization error: %v", err)
+				}
+				return
+			}
+
+			var nameErr *ReservedNameError
+			if !errors.As(err, &nameErr) {
+				t.Fatalf("Expected ReservedNameError, got %v", err)
+			}
+			if !errors.Is(err, ErrReservedName) || !errors.Is(err, ErrInvalidName) {
+				t.Errorf("Expected error to match ErrReservedName and ErrInvalidName")
+			}
+			if nameErr.Name != tt.expectedName || nameErr.Path != tt.expectedPath {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNamespacePrefixes(t *testing.T) {
+	type Item struct {
+		SKU  string `xml:"urn:catalog sku"`
+		Name string `xml:"name"`
+	}
+	type Summary struct {
+		Currency string `xml:"urn:money currency,attr"`
+		Total    string `xml:"urn:money total"`
+		Tax      string `xml:"urn:money tax"`
+	}
+	type Order struct {
+		Other   string  `xml:"xmlns:ns1,attr,omitempty"`
+		ID      string  `xml:"id,attr"`
+		Items   []Item  `xml:"items>item"`
+		Summary Summary `xml:"summary"`
+	}
+
+	order := Order{
+		ID:      "7",
+		Items:   []Item{{SKU: "A1", Name: "pen"}, {SKU: "B2", Name: "ink"}},
+		Summary: Summary{Currency: "EUR", Total: "10", Tax: "2"},
+	}
+
+	tests := []struct {
+		name     string
+		input    Order
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name:  "Declarations on nearest common ancestor",
+			input: order,
+			opts:  &MarshalOptions{Indent: "  "},
+			expected: `<Order id="7">
+  <items xmlns:ns1="urn:catalog">
+    <item>
+      <ns1:sku>A1</ns1:sku>
+      <name>pen</name>
+    </item>
+    <item>
+      <ns1:sku>B2</ns1:sku>
+      <name>ink</name>
+    </item>
+  </items>
+  <summary xmlns:ns2="urn:money" ns2:currency="EUR">
+    <ns2:total>10</ns2:total>
+    <ns2:tax>2</ns2:tax>
+  </summary>
+</Order>`,
+		},
+		{
+			name: "Generated prefixes avoid declared ones",
+			input: func() Order {
+				o := order
+				o.Other = "urn:other"
+				return o
+			}(),
+			opts:     &MarshalOptions{Parallelism: 2, ParallelThreshold: 1},
+			expected: `<Order xmlns:ns1="urn:other" id="7">` + "\n" + `<items xmlns:ns2="urn:catalog">` + "\n<item>\n<ns2:sku>A1</ns2:sku>\n<name>pen</name>\n</item>\n<item>\n<ns2:sku>B2</ns2:sku>\n<name>ink</name>\n</item>\n</items>\n" + `<summary xmlns:ns3="urn:money" ns3:currency="EUR">` + "\n<ns3:total>10</ns3:total>\n<ns3:tax>2</ns3:tax>\n</summary>\n</Order>",
+		},
+		{
+			name:     "Default namespace is reused for elements",
+			input:    order,
+			opts:     &MarshalOptions{Namespace: "urn:catalog", Include: []string{"Items"}},
+			expected: `<Order xmlns="urn:catalog">` + "\n<items>\n<item>\n<sku>A1</sku>\n<name>pen</name>\n</item>\n<item>\n<sku>B2</sku>\n<name>ink</name>\n</item>\n</items>\n</Order>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(tt.input, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", tt.expected, outputBytes)
+			}
+		})
+	}
+
+	items := make(chan interface{}, 1)
+	items <- Summary{Currency: "USD", Total: "3"}
+	close(items)
+	var buf bytes.Buffer
+	if err := MarshalStream(&buf, "summaries", items, nil); err != nil {
+		t.Fatalf("MarshalStream error: %v", err)
+	}
+	expected := "<summaries>\n" + `<Summary ns1:currency="USD" xmlns:ns1="urn:money">` + "\n" + `<total xmlns="urn:money">3</total>` + "\n" + `<tax xmlns="urn:money"></tax>` + "\n</Summary>\n</summaries>"
+	if buf.String() != expected {
+		t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", expected, buf.String())
+	}
+}
+
+func TestQName(t *testing.T) {
+	type Detail struct {
+		Kind QName `xml:"kind"`
+	}
+	type Fault struct {
+		SOAP   string `xml:"xmlns:soap,attr"`
+		Type   QName  `xml:"type,attr"`
+		Code   QName  `xml:"faultcode"`
+		Local  QName  `xml:"local"`
+		Detail Detail `xml:"detail"`
+		Ref    *QName `xml:"ref,omitempty"`
+	}
+
+	fault := Fault{
+		SOAP:   "http://schemas.xmlsoap.org/soap/envelope/",
+		Type:   QName{Space: "urn:types", Local: "ServerFault"},
+		Code:   QName{Space: "http://schemas.xmlsoap.org/soap/envelope/", Local: "Server"},
+		Local:  QName{Local: "plain"},
+		Detail: Detail{Kind: QName{Space: "urn:types", Local: "Timeout"}},
+		Ref:    &QName{Space: "urn:refs", Local: "r1"},
+	}
+
+	outputBytes, err := Marshal(fault, &MarshalOptions{Indent: "  "})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := `<Fault xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ns1="urn:types" type="ns1:ServerFault">
+  <faultcode>soap:Server</faultcode>
+  <local>plain</local>
+  <detail>
+    <kind>ns1:Timeout</kind>
+  </detail>
+  <ref xmlns:ns2="urn:refs">ns2:r1</ref>
+</Fault>`
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", expected, outputBytes)
+	}
+
+	outputBytes, err = Marshal(Detail{Kind: QName{Space: "urn:types", Local: "Timeout"}}, &MarshalOptions{Namespace: "urn:types"})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected = `<Detail xmlns="urn:types">` + "\n<kind>Timeout</kind>\n</Detail>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", expected, outputBytes)
+	}
+}
+
+type testDecimal struct {
+	units int64
+	scale int
+}
+
+func TestDecimalFormatting(t *testing.T) {
+	RegisterDecimal(reflect.TypeOf(testDecimal{}), func(v interface{}) string {
+		d := v.(testDecimal)
+		s := fmt.Sprintf("%0*d", d.scale+1, d.units)
+		return s[:len(s)-d.scale] + "." + s[len(s)-d.scale:]
+	})
+
+	type Line struct {
+		Quantity *big.Int    `xml:"qty,attr"`
+		Price    big.Float   `xml:"price"`
+		Share    *big.Rat    `xml:"share"`
+		Third    big.Rat     `xml:"third"`
+		Tax      testDecimal `xml:"tax"`
+	}
+	type Invoice struct {
+		Total *big.Int `xml:"total"`
+		Lines []Line   `xml:"line"`
+	}
+
+	total, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	price, _ := new(big.Float).SetPrec(200).SetString("19.990000000000000000000001")
+	invoice := Invoice{
+		Total: total,
+		Lines: []Line{{
+			Quantity: big.NewInt(3),
+			Price:    *price,
+			Share:    big.NewRat(1, 8),
+			Third:    *big.NewRat(1, 3),
+			Tax:      testDecimal{units: 5, scale: 2},
+		}},
+	}
+
+	outputBytes, err := Marshal(invoice, &MarshalOptions{Indent: "  "})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := `<Invoice>
+  <total>123456789012345678901234567890</total>
+  <line qty="3">
+    <price>19.990000000000000000000001</price>
+    <share>0.125</share>
+    <third>1/3</third>
+    <tax>0.05</tax>
+  </line>
+</Invoice>`
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", expected, outputBytes)
+	}
+
+	schema, err := GenerateXSD(Line{}, nil)
+	if err != nil {
+		t.Fatalf("GenerateXSD error: %v", err)
+	}
+	for _, fragment := range []string{`name="qty" type="xs:integer"`, `name="price" type="xs:decimal"`, `name="tax" type="xs:decimal"`} {
+		if !strings.Contains(string(schema), fragment) {
+			t.Errorf("Expected schema to contain %s, got %s", fragment, schema)
+		}
+	}
+}
+
+func TestEnumValidation(t *testing.T) {
+	type Shipment struct {
+		Mode     string   `xml:"mode,attr" enum:"air|sea|road"`
+		Status   string   `xml:"status" enum:"NEW|SHIPPED|DELIVERED"`
+		Priority *int     `xml:"priority,omitempty" enum:"1|2|3"`
+		Tags     []string `xml:"tags>tag" enum:"fragile|cold|bulk"`
+		Note     string   `xml:"note,omitempty" enum:"x|y"`
+	}
+
+	priority := 2
+	valid := Shipment{Mode: "sea", Status: "SHIPPED", Priority: &priority, Tags: []string{"cold", "bulk"}}
+	data, err := Marshal(valid, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	var decoded Shipment
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, valid) {
+		t.Errorf("Round trip mismatch.\nExpected: %+v\nGot: %+v", valid, decoded)
+	}
+
+	invalidPriority := 5
+	tests := []struct {
+		name     string
+		input    Shipment
+		expected string
+	}{
+		{name: "Attribute", input: Shipment{Mode: "rail", Status: "NEW"}, expected: "Shipment.Mode"},
+		{name: "Element", input: Shipment{Mode: "air", Status: "LOST"}, expected: "Shipment.Status"},
+		{name: "Pointer", input: Shipment{Mode: "air", Status: "NEW", Priority: &invalidPriority}, expected: "Shipment.Priority"},
+		{name: "Slice item", input: Shipment{Mode: "air", Status: "NEW", Tags: []string{"cold", "hot"}}, expected: "Shipment.Tags[1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Marshal(tt.input, nil)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || !errors.Is(err, ErrValidation) {
+				t.Fatalf("Expected a ValidationError, got %v", err)
+			}
+			if validationErr.Constraint != "enum" || validationErr.Path != tt.expected {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+
+	input := `<Shipment mode="air"><status>NEW</status><tags><tag>cold</tag><tag>warm</tag></tags></Shipment>`
+	err = Unmarshal([]byte(input), &decoded)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Path != "Shipment.Tags[1]" {
+		t.Errorf("Expected an enum error for the second tag, got %v", err)
+	}
+
+	input = `<Shipment mode="bike"><status>NEW</status></Shipment>`
+	if err := Unmarshal([]byte(input), &decoded); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected an enum error for the mode attribute, got %v", err)
+	}
+}
+
+func TestRequiredValidation(t *testing.T) {
+	type Address struct {
+		Street string `xml:"street,required"`
+		City   string `xml:"city,omitempty,required"`
+	}
+	type Customer struct {
+		ID      string   `xml:"id,attr,required"`
+		Email   string   `xml:"email,attr,omitempty"`
+		Name    string   `xml:"name,required"`
+		Address *Address `xml:"address,required"`
+		Phones  []string `xml:"phones>phone,required"`
+	}
+
+	valid := Customer{ID: "c1", Name: "Ada", Address: &Address{Street: "Main", City: "Paris"}, Phones: []string{"1"}}
+	if _, err := Marshal(valid, &MarshalOptions{Validate: true}); err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		mutate   func(c *Customer)
+		expected string
+	}{
+		{name: "Attribute", mutate: func(c *Customer) { c.ID = "" }, expected: "Customer.ID"},
+		{name: "Element", mutate: func(c *Customer) { c.Name = "" }, expected: "Customer.Name"},
+		{name: "Nil pointer", mutate: func(c *Customer) { c.Address = nil }, expected: "Customer.Address"},
+		{name: "Nested omitempty", mutate: func(c *Customer) { c.Address = &Address{Street: "Main"} }, expected: "Customer.Address.City"},
+		{name: "Empty slice", mutate: func(c *Customer) { c.Phones = nil }, expected: "Customer.Phones"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			customer := valid
+			tt.mutate(&customer)
+
+			if _, err := Marshal(customer, nil); err != nil {
+				t.Fatalf("Expected no validation without Validate, got %v", err)
+			}
+
+			_, err := Marshal(customer, &MarshalOptions{Validate: true})
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || !errors.Is(err, ErrValidation) {
+				t.Fatalf("Expected a ValidationError, got %v", err)
+			}
+			if validationErr.Constraint != "required" || validationErr.Path != tt.expected {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValueConstraints(t *testing.T) {
+	type Product struct {
+		Code     string   `xml:"code,attr" pattern:"^[A-Z]{3}$"`
+		SKU      string   `xml:"sku,attr" pattern:"[A-Z]{2}-[0-9]+"`
+		Discount int      `xml:"discount" min:"0" max:"100"`
+		Price    float64  `xml:"price" min:"0.01"`
+		Name     string   `xml:"name" min:"2" max:"5"`
+		Scores   []int    `xml:"scores>score" max:"10"`
+		Weight   *big.Rat `xml:"weight,omitempty" max:"2.5"`
+	}
+
+	valid := Product{Code: "ABC", SKU: "AB-1", Discount: 15, Price: 9.5, Name: "Pen", Scores: []int{1, 10}}
+	data, err := Marshal(valid, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	var decoded Product
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		mutate     func(p *Product)
+		constraint string
+		path       string
+	}{
+		{name: "Pattern", mutate: func(p *Product) { p.Code = "abcd" }, constraint: "pattern", path: "Product.Code"},
+		{name: "Pattern matches the whole value", mutate: func(p *Product) { p.SKU = "xAB-1y" }, constraint: "pattern", path: "Product.SKU"},
+		{name: "Numeric max", mutate: func(p *Product) { p.Discount = 101 }, constraint: "max", path: "Product.Discount"},
+		{name: "Numeric min", mutate: func(p *Product) { p.Discount = -1 }, constraint: "min", path: "Product.Discount"},
+		{name: "Decimal min", mutate: func(p *Product) { p.Price = 0 }, constraint: "min", path: "Product.Price"},
+		{name: "String length", mutate: func(p *Product) { p.Name = "Notebook" }, constraint: "max", path: "Product.Name"},
+		{name: "Slice item", mutate: func(p *Product) { p.Scores = []int{3, 11} }, constraint: "max", path: "Product.Scores[1]"},
+		{name: "Big rational", mutate: func(p *Product) { p.Weight = big.NewRat(11, 4) }, constraint: "max", path: "Product.Weight"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := valid
+			tt.mutate(&product)
+			_, err := Marshal(product, nil)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Expected a ValidationError, got %v", err)
+			}
+			if validationErr.Constraint != tt.constraint || validationErr.Path != tt.path {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+
+	input := `<Product code="ABC"><discount>250</discount><price>1</price><name>Pen</name></Product>`
+	err = Unmarshal([]byte(input), &decoded)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Constraint != "max" || validationErr.Path != "Product.Discount" {
+		t.Errorf("Expected a max violation on unmarshal, got %v", err)
+	}
+
+	schema, err := GenerateXSD(Product{}, nil)
+	if err != nil {
+		t.Fatalf("GenerateXSD error: %v", err)
+	}
+	for _, fragment := range []string{
+		`<xs:restriction base="xs:long">`,
+		`<xs:minInclusive value="0"></xs:minInclusive>`,
+		`<xs:maxInclusive value="100"></xs:maxInclusive>`,
+		`<xs:maxLength value="5"></xs:maxLength>`,
+		`<xs:pattern value="[A-Z]{3}"></xs:pattern>`,
+	} {
+		if !strings.Contains(string(schema), fragment) {
+			t.Errorf("Expected schema to contain %s, got %s", fragment, schema)
+		}
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	type Contact struct {
+		Name   string `xml:"name"`
+		Fax    string `xml:"fax" until:"2"`
+		Email  string `xml:"email" since:"2"`
+		Mobile string `xml:"mobile,attr" since:"2.1" until:"3"`
+		Chat   string `xml:"chat" since:"3"`
+	}
+
+	contact := Contact{Name: "Ada", Fax: "f", Email: "e", Mobile: "m", Chat: "c"}
+	tests := []struct {
+		version  string
+		expected string
+	}{
+		{version: "", expected: `<Contact mobile="m">` + "\n<name>Ada</name>\n<fax>f</fax>\n<email>e</email>\n<chat>c</chat>\n</Contact>"},
+		{version: "1", expected: "<Contact>\n<name>Ada</name>\n<fax>f</fax>\n</Contact>"},
+		{version: "2", expected: "<Contact>\n<name>Ada</name>\n<email>e</email>\n</Contact>"},
+		{version: "2.10", expected: `<Contact mobile="m">` + "\n<name>Ada</name>\n<email>e</email>\n</Contact>"},
+		{version: "3.0", expected: "<Contact>\n<name>Ada</name>\n<email>e</email>\n<chat>c</chat>\n</Contact>"},
+	}
+	for _, tt := range tests {
+		t.Run("version "+tt.version, func(t *testing.T) {
+			outputBytes, err := Marshal(contact, &MarshalOptions{SchemaVersion: tt.version})
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	type Item struct {
+		SKU string `xml:"sku,attr"`
+	}
+	type Record struct {
+		Name  *string           `xml:"name"`
+		Note  *string           `xml:"note,omitempty"`
+		Tags  []string          `xml:"tags>tag"`
+		Meta  map[string]string `xml:"meta"`
+		Items []*Item           `xml:"item"`
+	}
+
+	record := Record{Items: []*Item{{SKU: "a"}, nil}}
+	tests := []struct {
+		name     string
+		policy   NilPolicy
+		expected string
+	}{
+		{
+			name:     "Omit",
+			policy:   NilOmit,
+			expected: "<Record>\n<tags></tags>\n" + `<item sku="a"></item>` + "\n</Record>",
+		},
+		{
+			name:     "Empty element",
+			policy:   NilEmpty,
+			expected: "<Record>\n<name></name>\n<tags>\n<tag></tag>\n</tags>\n<meta></meta>\n" + `<item sku="a"></item>` + "\n<item></item>\n</Record>",
+		},
+		{
+			name:     "Self-closing",
+			policy:   NilSelfClose,
+			expected: "<Record>\n<name/>\n<tags>\n<tag/>\n</tags>\n<meta/>\n" + `<item sku="a"></item>` + "\n<item/>\n</Record>",
+		},
+		{
+			name:   "xsi:nil",
+			policy: NilXSI,
+			expected: "<Record>\n" + `<name xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:nil="true"/>` +
+				"\n<tags>\n" + `<tag xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:nil="true"/>` +
+				"\n</tags>\n" + `<meta xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:nil="true"/>` +
+				"\n" + `<item sku="a"></item>` + "\n" + `<item xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:nil="true"/>` + "\n</Record>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(record, &MarshalOptions{NilValues: tt.policy})
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+
+	outputBytes, err := Marshal(record, &MarshalOptions{NilValues: NilXSI, RootAttributes: []Attribute{{Name: "xmlns:i", Value: "http://www.w3.org/2001/XMLSchema-instance"}}, Include: []string{"Name"}})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := `<Record xmlns:i="http://www.w3.org/2001/XMLSchema-instance">` + "\n" + `<name i:nil="true"/>` + "\n</Record>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+}
+
+func TestNilVersusEmptySlices(t *testing.T) {
+	type Profile struct {
+		Name   string   `xml:"name"`
+		Roles  []string `xml:"roles>role,omitnil"`
+		Groups []string `xml:"groups>group"`
+		Emails []string `xml:"emails>email,omitempty"`
+	}
+
+	tests := []struct {
+		name     string
+		input    Profile
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name:     "Tag omits nil slice",
+			input:    Profile{Name: "a"},
+			expected: "<Profile>\n<name>a</name>\n<groups></groups>\n</Profile>",
+		},
+		{
+			name:     "Tag keeps empty slice",
+			input:    Profile{Name: "a", Roles: []string{}},
+			expected: "<Profile>\n<name>a</name>\n<roles></roles>\n<groups></groups>\n</Profile>",
+		},
+		{
+			name:     "Option omits nil slices",
+			input:    Profile{Name: "a", Groups: []string{}},
+			opts:     &MarshalOptions{OmitNilSlices: true},
+			expected: "<Profile>\n<name>a</name>\n<groups></groups>\n</Profile>",
+		},
+		{
+			name:     "Option keeps omitempty for empty slices",
+			input:    Profile{Name: "a", Emails: []string{}},
+			opts:     &MarshalOptions{OmitNilSlices: true},
+			expected: "<Profile>\n<name>a</name>\n</Profile>",
+		},
+		{
+			name:     "Option keeps populated slices",
+			input:    Profile{Name: "a", Groups: []string{"g"}},
+			opts:     &MarshalOptions{OmitNilSlices: true},
+			expected: "<Profile>\n<name>a</name>\n<groups>\n<group>g</group>\n</groups>\n</Profile>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(tt.input, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+
+	var decoded Profile
+	if err := Unmarshal([]byte("<Profile><name>a</name><roles></roles></Profile>"), &decoded); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if decoded.Roles == nil || len(decoded.Roles) != 0 {
+		t.Errorf("Expected an empty non-nil slice, got %#v", decoded.Roles)
+	}
+
+	decoded = Profile{}
+	if err := Unmarshal([]byte("<Profile><name>a</name></Profile>"), &decoded); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if decoded.Roles != nil {
+		t.Errorf("Expected a nil slice, got %#v", decoded.Roles)
+	}
+}
+
+type testMoney struct {
+	Amount   int64
+	Currency string
+}
+
+func (m *testMoney) IsZero() bool {
+	return m.Amount == 0
+}
+
+type testCoordinates struct {
+	Lat float64 `xml:"lat,attr"`
+	Lon float64 `xml:"lon,attr"`
+}
+
+func TestOmitZero(t *testing.T) {
+	type Event struct {
+		Created  time.Time       `xml:"created,attr,omitzero"`
+		Count    int             `xml:"count,omitzero"`
+		Location testCoordinates `xml:"location,omitzero"`
+		Fee      testMoney       `xml:"fee,omitzero"`
+		Backup   *testMoney      `xml:"backup,omitzero"`
+		Kept     testCoordinates `xml:"kept,omitempty"`
+	}
+
+	outputBytes, err := Marshal(Event{Fee: testMoney{Currency: "EUR"}}, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := "<Event>\n" + `<kept lat="0.00" lon="0.00"></kept>` + "\n</Event>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	event := Event{Created: created, Count: 2, Location: testCoordinates{Lat: 1}, Fee: testMoney{Amount: 5}}
+	outputBytes, err = Marshal(event, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	for _, fragment := range []string{`created="2024-05-01 12:00:00 +0000 UTC"`, "<count>2</count>", `<location lat="1.00" lon="0.00">`, "<fee>"} {
+		if !strings.Contains(string(outputBytes), fragment) {
+			t.Errorf("Expected output to contain %s, got %s", fragment, outputBytes)
+		}
+	}
+	if strings.Contains(string(outputBytes), "<backup>") {
+		t.Errorf("Expected nil pointer to be omitted, got %s", outputBytes)
+	}
+}
+
+func TestOmitEmptyStructs(t *testing.T) {
+	type Address struct {
+		Street string `xml:"street"`
+		City   string `xml:"city,attr"`
+	}
+	type Customer struct {
+		Name     string   `xml:"name"`
+		Billing  Address  `xml:"billing,omitempty"`
+		Shipping Address  `xml:"shipping"`
+		Previous *Address `xml:"previous,omitempty"`
+	}
+
+	customer := Customer{Name: "Ada", Previous: &Address{}}
+
+	outputBytes, err := Marshal(customer, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := "<Customer>\n<name>Ada</name>\n" + `<billing city="">` + "\n<street></street>\n</billing>\n" + `<shipping city="">` + "\n<street></street>\n</shipping>\n" + `<previous city="">` + "\n<street></street>\n</previous>\n</Customer>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+
+	outputBytes, err = Marshal(customer, &MarshalOptions{OmitEmptyStructs: true})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected = "<Customer>\n<name>Ada</name>\n" + `<shipping city="">` + "\n<street></street>\n</shipping>\n" + `<previous city="">` + "\n<street></street>\n</previous>\n</Customer>"
+	if string(outputBytes) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, outputBytes)
+	}
+
+	customer.Billing.City = "Paris"
+	outputBytes, err = Marshal(customer, &MarshalOptions{OmitEmptyStructs: true})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if !strings.Contains(string(outputBytes), `<billing city="Paris">`) {
+		t.Errorf("Expected populated struct to be kept, got %q", outputBytes)
+	}
+}
+
+func TestTopLevelSlices(t *testing.T) {
+	type Item struct {
+		ID   int    `xml:"id,attr"`
+		Name string `xml:"name"`
+	}
+
+	items := []Item{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}}
+	tests := []struct {
+		name     string
+		input    interface{}
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name:  "Explicit item tag",
+			input: items,
+			opts:  &MarshalOptions{RootTag: "items", ItemTag: "item", Indent: "  "},
+			expected: `<items>
+  <item id="1">
+    <name>a</name>
+  </item>
+  <item id="2">
+    <name>b</name>
+  </item>
+</items>`,
+		},
+		{
+			name:     "Item tag from element type",
+			input:    []*Item{{ID: 3}},
+			opts:     &MarshalOptions{RootTag: "items"},
+			expected: "<items>\n" + `<Item id="3">` + "\n<name></name>\n</Item>\n</items>",
+		},
+		{
+			name:     "Array of strings",
+			input:    [2]string{"x", "y"},
+			opts:     &MarshalOptions{RootTag: "values", ItemTag: "value"},
+			expected: "<values>\n<value>x</value>\n<value>y</value>\n</values>",
+		},
+		{
+			name:     "Pointer root uses element type name",
+			input:    &Item{ID: 4, Name: "d"},
+			expected: `<Item id="4">` + "\n<name>d</name>\n</Item>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputBytes, err := Marshal(tt.input, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(outputBytes) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, outputBytes)
+			}
+		})
+	}
+
+	if _, err := Marshal(items, nil); err == nil || !strings.Contains(err.Error(), "RootTag") {
+		t.Errorf("Expected a RootTag error, got %v", err)
+	}
+	if _, err := Marshal([]struct{ X int }{{X: 1}}, &MarshalOptions{RootTag: "values"}); err == nil || !strings.Contains(err.Error(), "ItemTag") {
+		t.Errorf("Expected an ItemTag error, got %v", err)
+	}
+}
+
+func TestDocumentWriter(t *testing.T) {
+	type message struct {
+		ID   int    `xml:"id,attr"`
+		Body string `xml:"body"`
+	}
+
+	tests := []struct {
+		name     string
+		opts     *DocumentOptions
+		expected string
+	}{
+		{
+			name:     "No delimiter",
+			opts:     nil,
+			expected: `<message id="1">` + "\n<body>hi</body>\n</message>" + `<message id="2">` + "\n<body>bye</body>\n</message>",
+		},
+		{
+			name:     "Newline delimiter",
+			opts:     &DocumentOptions{Delimiter: "\n", Marshal: &MarshalOptions{Indent: "  "}},
+			expected: `<message id="1">` + "\n  <body>hi</body>\n</message>\n" + `<message id="2">` + "\n  <body>bye</body>\n</message>",
+		},
+		{
+			name:     "Header per document",
+			opts:     &DocumentOptions{Delimiter: "\n\n", Marshal: &MarshalOptions{XMLHeader: true}},
+			expected: strings.TrimSpace(xml.Header) + `<message id="1">` + "\n<body>hi</body>\n</message>\n\n" + strings.TrimSpace(xml.Header) + `<message id="2">` + "\n<body>bye</body>\n</message>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewDocumentWriter(&buf, tt.opts)
+			for i, body := range []string{"hi", "bye"} {
+				if err := w.Encode(message{ID: i + 1, Body: body}); err != nil {
+					t.Fatalf("Encode error: %v", err)
+				}
+			}
+			if w.Count() != 2 {
+				t.Errorf("Expected 2 documents, got %d", w.Count())
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close error: %v", err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, buf.String())
+			}
+			if err := w.Encode(message{}); !errors.Is(err, ErrWriterClosed) {
+				t.Errorf("Expected ErrWriterClosed, got %v", err)
+			}
+		})
+	}
+
+	t.Run("Failed document writes nothing", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewDocumentWriter(&buf, &DocumentOptions{Delimiter: "\n"})
+		if err := w.Encode(message{ID: 1}); err != nil {
+			t.Fatalf("Encode error: %v", err)
+		}
+		before := buf.Len()
+		if err := w.Encode(make(chan int)); err == nil {
+			t.Fatal("Expected an error for an unsupported value")
+		}
+		if buf.Len() != before || w.Count() != 1 {
+			t.Errorf("Expected failed document to be discarded, got %q", buf.String())
+		}
+	})
+
+	t.Run("Write errors are sticky", func(t *testing.T) {
+		w := NewDocumentWriter(&failingWriter{remaining: 10}, nil)
+		if err := w.Encode(message{ID: 1, Body: "too long for the writer"}); err == nil {
+			t.Fatal("Expected a write error")
+		}
+		if err := w.Encode(message{ID: 2}); err == nil {
+			t.Error("Expected the write error to be sticky")
+		}
+		if err := w.Close(); err == nil {
+			t.Error("Expected Close to report the write error")
+		}
+	})
+}
+
+func TestDeepIndentation(t *testing.T) {
+	const depth = sharedIndentLevels + 8
+
+	for _, indent := range []string{"  ", "\t"} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, &MarshalOptions{Indent: indent})
+		for i := 0; i < depth; i++ {
+			if err := w.StartElement("n"); err != nil {
+				t.Fatalf("StartElement error: %v", err)
+			}
+		}
+		for i := 0; i < depth; i++ {
+			if err := w.EndElement(); err != nil {
+				t.Fatalf("EndElement error: %v", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close error: %v", err)
+		}
+
+		lines := strings.Split(buf.String(), "\n")
+		if len(lines) != 2*depth-1 {
+			t.Fatalf("Expected %d lines, got %d", 2*depth-1, len(lines))
+		}
+		for i, line := range lines {
+			level := i
+			if i >= depth {
+				level = 2*depth - 2 - i
+			}
+			if prefix := strings.Repeat(indent, level); !strings.HasPrefix(line, prefix+"<") {
+				t.Errorf("Line %d has wrong indentation: %q", i, line)
+			}
+		}
+	}
+}
+
+func TestEncoderReset(t *testing.T) {
+	src := []byte(`<a id="1"><b>text</b><br/></a>`)
+
+	var first, second bytes.Buffer
+	encoder := NewEncoder(&first, []string{"br"}, "  ", false)
+	if err := encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: "unfinished"}}); err != nil {
+		t.Fatalf("EncodeToken error: %v", err)
+	}
+
+	first.Reset()
+	for _, buf := range []*bytes.Buffer{&first, &second} {
+		encoder.Reset(buf)
+		root, err := Parse(src)
+		if err != nil {
+			t.Fatalf("Parse error: %v", err)
+		}
+		if err := root.Accept(encoder); err != nil {
+			t.Fatalf("Accept error: %v", err)
+		}
+	}
+
+	expected := "<a id=\"1\">\n  <b>text</b>\n  <br/>\n</a>"
+	if first.String() != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, first.String())
+	}
+	if second.String() != first.String() {
+		t.Errorf("Reused encoder output differs.\nFirst: %q\nSecond: %q", first.String(), second.String())
+	}
+}
+
+func TestFieldMetadataTags(t *testing.T) {
+	type Record struct {
+		XMLName xml.Name `xml:"record"`
+		ID      int      `xml:"id,attr,omitempty"`
+		Tags    []string `xml:"tags>tag"`
+		Note    string   `xml:",omitempty"`
+		Secret  string   `xml:"-"`
+		Scoped  string   `xml:"urn:x scoped"`
+	}
+
+	fields := GetFieldMetadata(reflect.TypeOf(Record{}))
+	if len(fields) != 5 {
+		t.Fatalf("Expected 5 fields, got %d", len(fields))
+	}
+
+	expected := []struct {
+		name      string
+		tags      []string
+		explicit  bool
+		attr      bool
+		omitEmpty bool
+		xmlName   bool
+	}{
+		{name: "record", tags: []string{"record"}, explicit: true, xmlName: true},
+		{name: "id", tags: []string{"id"}, explicit: true, attr: true, omitEmpty: true},
+		{name: "tags>tag", tags: []string{"tags", "tag"}, explicit: true},
+		{name: "Note", tags: []string{"Note"}, omitEmpty: true},
+		{name: "urn:x scoped", tags: []string{"{urn:x}scoped"}, explicit: true},
+	}
+	for i, want := range expected {
+		got := fields[i]
+		if got.Name != want.name || !reflect.DeepEqual(got.Tags, want.tags) || got.Explicit != want.explicit ||
+			got.Attr != want.attr || got.OmitEmpty != want.omitEmpty || got.XMLName != want.xmlName {
+			t.Errorf("Field %d mismatch.\nExpected: %+v\nGot: %+v", i, want, got)
+		}
+	}
+
+	output, err := Marshal(Record{Tags: []string{"a"}, Note: "n"}, &MarshalOptions{NameStrategy: strings.ToLower})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if !strings.Contains(string(output), "<note>n</note>") || !strings.Contains(string(output), "<tags>") {
+		t.Errorf("Expected name strategy to apply only to implicit names, got %q", output)
+	}
+}
+
+func TestPoolConfiguration(t *testing.T) {
+	ConfigurePools(PoolConfig{AttributeCapacity: 2, MaxBufferSize: 1024, Instrument: true})
+	defer ConfigurePools(PoolConfig{})
+	ResetPoolStatistics()
+
+	if cfg := currentPoolConfig(); cfg.AttributeCapacity != 2 || cfg.ChildrenCapacity != defaultChildrenCapacity {
+		t.Errorf("Unexpected pool config: %+v", cfg)
+	}
+	if _, err := Format([]byte(`<a x="1"><b>text</b></a>`), nil); err != nil {
+		t.Fatalf("Format error: %v", err)
+	}
+
+	stats := PoolStatistics()
+	if stats.Elements.Gets == 0 || stats.Elements.Puts == 0 {
+		t.Errorf("Expected element pool activity, got %+v", stats.Elements)
+	}
+	if stats.Texts.Gets == 0 || stats.Buffers.Gets == 0 {
+		t.Errorf("Expected text and buffer pool activity, got %+v", stats)
+	}
+
+	buf := acquireBuffer()
+	buf.Grow(4096)
+	puts := PoolStatistics().Buffers.Puts
+	releaseBuffer(buf)
+	if got := PoolStatistics().Buffers.Puts; got != puts {
+		t.Errorf("Expected oversized buffer to be dropped, puts went from %d to %d", puts, got)
+	}
+
+	if published, err := json.Marshal(PoolStatistics()); err != nil || !strings.Contains(string(published), `"Elements"`) {
+		t.Errorf("Expected pool statistics to be publishable as JSON, got %s (%v)", published, err)
+	}
+
+	ResetPoolStatistics()
+	ConfigurePools(PoolConfig{})
+	if _, err := Format([]byte(`<a/>`), nil); err != nil {
+		t.Fatalf("Format error: %v", err)
+	}
+	if stats := PoolStatistics(); stats != (PoolStats{}) {
+		t.Errorf("Expected no counters without instrumentation, got %+v", stats)
+	}
+}
+
+func TestPoolRetentionLimits(t *testing.T) {
+	defer ConfigurePools(PoolConfig{})
+
+	tests := []struct {
+		name         string
+		cfg          PoolConfig
+		bufferSize   int
+		children     int
+		bufferDrops  uint64
+		elementDrops uint64
+	}{
+		{name: "Defaults drop oversized buffers", cfg: PoolConfig{Instrument: true}, bufferSize: 1 << 20, children: 8, bufferDrops: 1},
+		{name: "Small objects are retained", cfg: PoolConfig{Instrument: true}, bufferSize: 1024, children: 8},
+		{name: "Node capacity threshold", cfg: PoolConfig{MaxNodeCapacity: 16, Instrument: true}, bufferSize: 1024, children: 64, elementDrops: 1},
+		{name: "Negative thresholds disable limits", cfg: PoolConfig{MaxBufferSize: -1, MaxNodeCapacity: -1, Instrument: true}, bufferSize: 1 << 20, children: 1024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ConfigurePools(tt.cfg)
+			ResetPoolStatistics()
+
+			buf := acquireBuffer()
+			buf.Grow(tt.bufferSize)
+			releaseBuffer(buf)
+
+			node := acquireElementNode()
+			for i := 0; i < tt.children; i++ {
+				node.Children = append(node.Children, nil)
+			}
+			releaseElementNode(node)
+
+			stats := PoolStatistics()
+			if stats.Buffers.Drops != tt.bufferDrops || stats.Buffers.Puts != 1-tt.bufferDrops {
+				t.Errorf("Unexpected buffer counters: %+v", stats.Buffers)
+			}
+			if stats.Elements.Drops != tt.elementDrops || stats.Elements.Puts != 1-tt.elementDrops {
+				t.Errorf("Unexpected element counters: %+v", stats.Elements)
+			}
+		})
+	}
+}
+
+func TestMarshalTyped(t *testing.T) {
+	type Item struct {
+		ID   int    `xml:"id,attr"`
+		Name string `xml:"urn:example name"`
+	}
+
+	opts := &MarshalOptions{Indent: "  "}
+	item := Item{ID: 1, Name: "a"}
+	expected, err := Marshal(item, opts)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	outputs := map[string]func() ([]byte, error){
+		"Value":     func() ([]byte, error) { return MarshalTyped(item, opts) },
+		"Pointer":   func() ([]byte, error) { return MarshalTyped(&item, opts) },
+		"Interface": func() ([]byte, error) { return MarshalTyped[interface{}](item, opts) },
+		"Bound":     func() ([]byte, error) { return NewTypedMarshaler[Item](opts).Marshal(item) },
+	}
+	for name, marshal := range outputs {
+		t.Run(name, func(t *testing.T) {
+			output, err := marshal()
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(output) != string(expected) {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, output)
+			}
+		})
+	}
+
+	bound := NewTypedMarshaler[[]Item](&MarshalOptions{RootTag: "items", ItemTag: "item"})
+	for i := 0; i < 2; i++ {
+		output, err := bound.Marshal([]Item{{ID: i}})
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		if !strings.Contains(string(output), fmt.Sprintf(`<item id="%d">`, i)) {
+			t.Errorf("Unexpected output: %q", output)
+		}
+	}
+
+	if _, err := MarshalTyped[*Item](nil, nil); !errors.Is(err, ErrNilNode) {
+		t.Errorf("Expected ErrNilNode, got %v", err)
+	}
+}
+
+type testGeneratedPoint struct {
+	X     int    `xml:"x,attr"`
+	Label string `xml:"label"`
+}
+
+var generatedCalls int
+
+func (v testGeneratedPoint) MarshalGoXML(w io.Writer, opts *MarshalOptions) error {
+	generatedCalls++
+	dst := []byte(`<testGeneratedPoint x="`)
+	dst = strconv.AppendInt(dst, int64(v.X), 10)
+	dst = append(dst, "\">\n<label>"...)
+	dst = AppendEscaped(dst, v.Label)
+	dst = append(dst, "</label>\n</testGeneratedPoint>"...)
+	_, err := w.Write(dst)
+	return err
+}
+
+func TestGeneratedMarshaler(t *testing.T) {
+	point := testGeneratedPoint{X: 3, Label: "a<b"}
+	expected := `<testGeneratedPoint x="3">` + "\n<label>a&lt;b</label>\n</testGeneratedPoint>"
+
+	tests := []struct {
+		name      string
+		input     interface{}
+		opts      *MarshalOptions
+		expected  string
+		generated bool
+	}{
+		{name: "Default options", input: point, expected: expected, generated: true},
+		{name: "Pointer value", input: &point, expected: expected, generated: true},
+		{name: "Header", input: point, opts: &MarshalOptions{XMLHeader: true}, expected: `<?xml version="1.0" encoding="UTF-8"?>` + expected, generated: true},
+		{name: "Indent falls back to reflection", input: point, opts: &MarshalOptions{Indent: "  "}, expected: `<testGeneratedPoint x="3">` + "\n  <label>a&lt;b</label>\n</testGeneratedPoint>"},
+		{name: "Filters fall back to reflection", input: point, opts: &MarshalOptions{Exclude: []string{"Label"}}, expected: `<testGeneratedPoint x="3"></testGeneratedPoint>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generatedCalls = 0
+			output, err := Marshal(tt.input, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(output) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, output)
+			}
+			if used := generatedCalls > 0; used != tt.generated {
+				t.Errorf("Expected generated marshaler used=%v, got %v", tt.generated, used)
+			}
+		})
+	}
+}
+
+func TestMarshalAll(t *testing.T) {
+	type Item struct {
+		ID int `xml:"id,attr"`
+	}
+
+	values := make([]interface{}, 50)
+	for i := range values {
+		values[i] = Item{ID: i}
+	}
+
+	for _, opts := range []*MarshalOptions{nil, {Parallelism: 3}, {Parallelism: 1, XMLHeader: true}} {
+		results, err := MarshalAll(values, opts)
+		if err != nil {
+			t.Fatalf("MarshalAll error: %v", err)
+		}
+		if len(results) != len(values) {
+			t.Fatalf("Expected %d results, got %d", len(values), len(results))
+		}
+		for i, data := range results {
+			expected, err := Marshal(values[i], opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(data) != string(expected) {
+				t.Errorf("Result %d mismatch.\nExpected: %q\nGot: %q", i, expected, data)
+			}
+		}
+	}
+
+	t.Run("Reports the failing document", func(t *testing.T) {
+		failing := append([]interface{}(nil), values...)
+		failing[17] = make(chan int)
+		_, err := MarshalAll(failing, &MarshalOptions{Parallelism: 4})
+		if !errors.Is(err, ErrUnsupportedKind) || !strings.Contains(err.Error(), "document 17") {
+			t.Errorf("Expected an unsupported kind error for document 17, got %v", err)
+		}
+	})
+
+	t.Run("Canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := MarshalAllContext(ctx, values, nil); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+
+	if results, err := MarshalAll(nil, nil); err != nil || results != nil {
+		t.Errorf("Expected no results for an empty batch, got %v, %v", results, err)
+	}
+}
+
+func TestMarshalResult(t *testing.T) {
+	type Item struct {
+		ID   int    `xml:"id,attr"`
+		Name string `xml:"name"`
+	}
+
+	item := Item{ID: 1, Name: strings.Repeat("x", 512)}
+	tests := []struct {
+		name       string
+		opts       *MarshalOptions
+		compressed bool
+	}{
+		{name: "Plain", opts: &MarshalOptions{Indent: "  "}},
+		{name: "Compressed", opts: &MarshalOptions{Compress: true}, compressed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, compressed, err := MarshalCompressed(item, tt.opts)
+			if err != nil {
+				t.Fatalf("MarshalCompressed error: %v", err)
+			}
+
+			result, err := MarshalResult(item, tt.opts)
+			if err != nil {
+				t.Fatalf("MarshalResult error: %v", err)
+			}
+			if result.Len() != len(expected) || result.Compressed() != compressed || compressed != tt.compressed {
+				t.Errorf("Expected length %d compressed %v, got %d %v", len(expected), compressed, result.Len(), result.Compressed())
+			}
+
+			var buf bytes.Buffer
+			var writerTo io.WriterTo = result
+			n, err := writerTo.WriteTo(&buf)
+			if err != nil {
+				t.Fatalf("WriteTo error: %v", err)
+			}
+			if n != int64(len(expected)) || !bytes.Equal(buf.Bytes(), expected) || !bytes.Equal(result.Bytes(), expected) {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, buf.Bytes())
+			}
+
+			result.Release()
+			result.Release()
+			if _, err := result.WriteTo(&buf); !errors.Is(err, ErrResultReleased) {
+				t.Errorf("Expected ErrResultReleased, got %v", err)
+			}
+			if result.Len() != 0 {
+				t.Errorf("Expected empty result after Release, got %d bytes", result.Len())
+			}
+		})
+	}
+
+	if _, err := MarshalResult(make(chan int), nil); !errors.Is(err, ErrUnsupportedKind) {
+		t.Errorf("Expected ErrUnsupportedKind, got %v", err)
+	}
+}
+
+func TestEscapePolicy(t *testing.T) {
+	type Snippet struct {
+		Title   string `xml:"title"`
+		Trusted string `xml:"trusted,noescape"`
+		Link    string `xml:"link,attr,noescape"`
+		Label   string `xml:"label,attr"`
+	}
+
+	snippet := Snippet{Title: "a < b & 'c'", Trusted: "x &amp; <b>y</b>", Link: "?a=1&amp;b=2", Label: `"q"`}
+	tests := []struct {
+		name     string
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name:     "Default escaping with noescape fields",
+			expected: `<Snippet link="?a=1&amp;b=2" label="&quot;q&quot;">` + "\n<title>a &lt; b &amp; &apos;c&apos;</title>\n<trusted>x &amp; <b>y</b></trusted>\n</Snippet>",
+		},
+		{
+			name:     "Numeric references",
+			opts:     &MarshalOptions{Escaper: NumericEscaper},
+			expected: `<Snippet link="?a=1&amp;b=2" label="&#x22;q&#x22;">` + "\n<title>a &#x3c; b &#x26; &#x27;c&#x27;</title>\n<trusted>x &amp; <b>y</b></trusted>\n</Snippet>",
+		},
+		{
+			name: "Custom escaper",
+			opts: &MarshalOptions{Escaper: EscaperFunc(func(dst []byte, s string) []byte {
+				return AppendEscaped(dst, strings.ToUpper(s))
+			})},
+			expected: `<Snippet link="?a=1&amp;b=2" label="&quot;Q&quot;">` + "\n<title>A &lt; B &amp; &apos;C&apos;</title>\n<trusted>x &amp; <b>y</b></trusted>\n</Snippet>",
+		},
+		{
+			name:     "Tree path keeps noescape",
+			opts:     &MarshalOptions{Transformers: []NodeTransformer{NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) { return root, nil })}},
+			expected: `<Snippet link="?a=1&amp;b=2" label="&quot;q&quot;">` + "\n<title>a &lt; b &amp; &apos;c&apos;</title>\n<trusted>x &amp; <b>y</b></trusted>\n</Snippet>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := Marshal(snippet, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if string(output) != tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", tt.expected, output)
+			}
+		})
+	}
+
+	if _, err := Marshal(snippet, &MarshalOptions{CompatStdlib: true, Escaper: NumericEscaper}); err == nil || !strings.Contains(err.Error(), "Escaper") {
+		t.Errorf("Expected a compat error for Escaper, got %v", err)
+	}
+}
+
+func TestEntityOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     EscapeOptions
+		input    string
+		expected string
+	}{
+		{name: "Named by default", input: `<a & "b" 'c'> café`, expected: "&lt;a &amp; &quot;b&quot; &apos;c&apos;&gt; café"},
+		{name: "Selected numeric references", opts: EscapeOptions{NumericChars: `'"`}, input: `"b" 'c' & d`, expected: "&#x22;b&#x22; &#x27;c&#x27; &amp; d"},
+		{name: "Extra characters", opts: EscapeOptions{NumericChars: "\t€"}, input: "a\tb €5 é", expected: "a&#x9;b &#x20ac;5 é"},
+		{name: "ASCII only", opts: EscapeOptions{ASCIIOnly: true}, input: "café & 日本 😀", expected: "caf&#xe9; &amp; &#x65e5;&#x672c; &#x1f600;"},
+		{name: "Plain ASCII is untouched", opts: EscapeOptions{ASCIIOnly: true}, input: "plain text", expected: "plain text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(NewEscaper(tt.opts).AppendEscaped([]byte("prefix:"), tt.input)); got != "prefix:"+tt.expected {
+				t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", "prefix:"+tt.expected, got)
+			}
+		})
+	}
+
+	type Place struct {
+		City string `xml:"city,attr"`
+		Name string `xml:"name"`
+	}
+	output, err := Marshal(Place{City: "Zürich", Name: "Café <Zoë>"}, &MarshalOptions{Escaper: NewEscaper(EscapeOptions{ASCIIOnly: true})})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := `<Place city="Z&#xfc;rich">` + "\n<name>Caf&#xe9; &lt;Zo&#xeb;&gt;</name>\n</Place>"
+	if string(output) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, output)
+	}
+	for _, b := range output {
+		if b >= utf8.RuneSelf {
+			t.Fatalf("Expected ASCII-only output, got %q", output)
+		}
+	}
+}
+
+func TestCustomEntities(t *testing.T) {
+	type letter struct {
+		From string `xml:"from,attr"`
+		Body string `xml:"body"`
+	}
+	opts := &MarshalOptions{Entities: []Entity{
+		{Name: "company", Value: "Acme & Sons"},
+		{Name: "short", Value: "Acme"},
+	}}
+	output, err := Marshal(letter{From: "Acme & Sons", Body: "Greetings from Acme & Sons, part of Acme group <ltd>"}, opts)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := `<!DOCTYPE letter [<!ENTITY company "Acme &#38;#38; Sons"><!ENTITY short "Acme">]>` +
+		`<letter from="&company;">` + "\n<body>Greetings from &company;, part of &short; group &lt;ltd&gt;</body>\n</letter>"
+	if string(output) != expected {
+		t.Fatalf("Output mismatch.\nExpected: %q\nGot: %q", expected, output)
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(output))
+	decoder.Entity = map[string]string{"company": "Acme & Sons", "short": "Acme"}
+	var decoded letter
+	if err := decoder.Decode(&decoded); err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if decoded.From != "Acme & Sons" || decoded.Body != "Greetings from Acme & Sons, part of Acme group <ltd>" {
+		t.Errorf("Round trip mismatch: %+v", decoded)
+	}
+
+	type memo struct {
+		Body string `xml:"urn:memos body"`
+	}
+	entities := []Entity{{Name: "short", Value: "Acme"}}
+	roots := []struct {
+		name     string
+		value    interface{}
+		opts     *MarshalOptions
+		expected string
+	}{
+		{
+			name:     "Renamed by a transformer",
+			value:    letter{Body: "Acme"},
+			opts:     &MarshalOptions{Entities: entities, Transformers: []NodeTransformer{RenameElements(map[string]string{"letter": "note"})}},
+			expected: `<!DOCTYPE note [<!ENTITY short "Acme">]><note from="">`,
+		},
+		{
+			name:     "Namespaced root",
+			value:    memo{Body: "Acme"},
+			opts:     &MarshalOptions{Entities: entities, RootTag: "{urn:memos}memo"},
+			expected: `<!DOCTYPE ns1:memo [<!ENTITY short "Acme">]><ns1:memo xmlns:ns1="urn:memos">`,
+		},
+		{
+			name:     "XHTML lowercases the root",
+			value:    letter{Body: "Acme"},
+			opts:     &MarshalOptions{Entities: entities, Mode: ModeXHTML, RootTag: "Letter"},
+			expected: `<!DOCTYPE letter [<!ENTITY short "Acme">]><letter`,
+		},
+	}
+	for _, tt := range roots {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := Marshal(tt.value, tt.opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			if !strings.HasPrefix(string(output), tt.expected) {
+				t.Errorf("Expected prefix %q, got %q", tt.expected, output)
+			}
+		})
+	}
+
+	invalid := []struct {
+		name     string
+		entities []Entity
+	}{
+		{name: "Invalid name", entities: []Entity{{Name: "1st", Value: "first"}}},
+		{name: "Empty value", entities: []Entity{{Name: "empty"}}},
+		{name: "Duplicate", entities: []Entity{{Name: "a", Value: "x"}, {Name: "a", Value: "y"}}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Marshal(letter{Body: "x"}, &MarshalOptions{Entities: tt.entities}); err == nil {
+				t.Error("Expected error for invalid entity")
+			}
+		})
+	}
+}
+
+func TestNormalizeUnicode(t *testing.T) {
+	type entry struct {
+		Label string `xml:"label,attr"`
+		Name  string `xml:"name"`
+		Note  CDATA  `xml:"note"`
+	}
+	decomposed := "Café"
+	value := entry{Label: decomposed, Name: decomposed + " & co", Note: CDATA(decomposed)}
+
+	output, err := Marshal(value, &MarshalOptions{NormalizeUnicode: true})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := "<entry label=\"Café\">\n<name>Café &amp; co</name>\n<note><![CDATA[Café]]></note>\n</entry>"
+	if string(output) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, output)
+	}
+
+	output, err = Marshal(value, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if !strings.Contains(string(output), decomposed) {
+		t.Errorf("Expected text to be left unnormalized by default, got %q", output)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	laughs := `<!DOCTYPE lolz [
+<!ENTITY lol "lol">
+<!ENTITY lol1 "&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;">
+<!ENTITY lol2 "&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;">
+<!ENTITY lol3 "&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;&lol2;">
+<!ENTITY lol4 "&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;&lol3;">
+<!ENTITY lol5 "&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;&lol4;">
+]><lolz>&lol5;</lolz>`
+
+	tests := []struct {
+		name  string
+		input string
+		opts  *UnmarshalOptions
+		limit string
+		path  string
+	}{
+		{name: "Depth", input: strings.Repeat("<a>", 5) + strings.Repeat("</a>", 5), opts: &UnmarshalOptions{MaxDepth: 4}, limit: "MaxDepth", path: "/a/a/a/a/a"},
+		{name: "Default depth", input: strings.Repeat("<a>", defaultMaxDecodeDepth+1) + strings.Repeat("</a>", defaultMaxDecodeDepth+1), limit: "MaxDepth"},
+		{name: "Attribute count", input: `<a x="1" y="2" z="3"/>`, opts: &UnmarshalOptions{MaxAttributes: 2}, limit: "MaxAttributes", path: "/a"},
+		{name: "Attribute length", input: `<a><b x="123456"/></a>`, opts: &UnmarshalOptions{MaxAttributeLength: 5}, limit: "MaxAttributeLength", path: "/a/b/@x"},
+		{name: "Characters", input: `<a><b>1234</b><c>5678</c></a>`, opts: &UnmarshalOptions{MaxCharacters: 6}, limit: "MaxCharacters", path: "/a/c"},
+		{name: "Entity expansions", input: laughs, limit: "MaxEntityExpansions"},
+		{name: "Expanded size", input: laughs, opts: &UnmarshalOptions{MaxEntityExpansions: -1, MaxCharacters: 10000}, limit: "MaxCharacters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseWithOptions([]byte(tt.input), tt.opts)
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("Expected limit error, got %v", err)
+			}
+			if limitErr.Limit != tt.limit {
+				t.Errorf("Expected limit %s, got %s", tt.limit, limitErr.Limit)
+			}
+			if tt.path != "" && limitErr.Path != tt.path {
+				t.Errorf("Expected path %q, got %q", tt.path, limitErr.Path)
+			}
+		})
+	}
+
+	root, err := ParseWithOptions([]byte(strings.Repeat("<a>", 5)+strings.Repeat("</a>", 5)), &UnmarshalOptions{MaxDepth: -1})
+	if err != nil {
+		t.Fatalf("Unexpected error with disabled limit: %v", err)
+	}
+	releaseNode(root)
+
+	type letter struct {
+		From string `xml:"from,attr"`
+		Body string `xml:"body"`
+	}
+	opts := &MarshalOptions{Entities: []Entity{{Name: "company", Value: `Acme & "Sons" <ltd>`}}}
+	original := letter{From: `Acme & "Sons" <ltd>`, Body: `Hello from Acme & "Sons" <ltd>`}
+	output, err := Marshal(original, opts)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	var decoded letter
+	if err := Unmarshal(output, &decoded); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if decoded != original {
+		t.Errorf("Round trip mismatch.\nExpected: %+v\nGot: %+v", original, decoded)
+	}
+}
+
+func TestEntityResolver(t *testing.T) {
+	type note struct {
+		Body string `xml:"body"`
+	}
+	xxe := `<!DOCTYPE note [<!ENTITY secret SYSTEM "file:///etc/passwd"><!ENTITY greeting "hello">]><note><body>&greeting; [&secret;]</body></note>`
+
+	var decoded note
+	if err := Unmarshal([]byte(xxe), &decoded); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if decoded.Body != "hello []" {
+		t.Errorf("Expected external entity to be ignored, got %q", decoded.Body)
+	}
+
+	var calls []string
+	resolver := EntityResolverFunc(func(name, publicID, systemID string) (string, error) {
+		calls = append(calls, name+"|"+publicID+"|"+systemID)
+		switch systemID {
+		case "file:///etc/passwd":
+			return "redacted &greeting;", nil
+		case "defs.dtd":
+			return `<!ENTITY sender "Acme">`, nil
+		}
+		return "", fmt.Errorf("blocked %s", systemID)
+	})
+
+	decoded = note{}
+	if err := UnmarshalWithOptions([]byte(xxe), &decoded, &UnmarshalOptions{EntityResolver: resolver}); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if decoded.Body != "hello [redacted hello]" {
+		t.Errorf("Expected resolved entity, got %q", decoded.Body)
+	}
+
+	calls = nil
+	withDTD := `<!DOCTYPE note PUBLIC "-//Acme//Notes" "defs.dtd"><note><body>from &sender;</body></note>`
+	decoded = note{}
+	if err := UnmarshalWithOptions([]byte(withDTD), &decoded, &UnmarshalOptions{EntityResolver: resolver}); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if decoded.Body != "from Acme" {
+		t.Errorf("Expected entity from external DTD, got %q", decoded.Body)
+	}
+	if len(calls) != 1 || calls[0] != "|-//Acme//Notes|defs.dtd" {
+		t.Errorf("Unexpected resolver calls: %v", calls)
+	}
+	if err := Unmarshal([]byte(withDTD), &decoded); err == nil {
+		t.Error("Expected undefined entity error when the DTD is not fetched")
+	}
+
+	blocked := `<!DOCTYPE note [<!ENTITY remote SYSTEM "http://example.com/x">]><note/>`
+	if err := UnmarshalWithOptions([]byte(blocked), &decoded, &UnmarshalOptions{EntityResolver: resolver}); err == nil || !strings.Contains(err.Error(), "blocked http://example.com/x") {
+		t.Errorf("Expected resolver error, got %v", err)
+	}
+}
+
+func TestDecodeErrorPositions(t *testing.T) {
+	type item struct {
+		SKU   string `xml:"sku,attr" enum:"A|B|C|D"`
+		Price int    `xml:"price"`
+	}
+	type order struct {
+		Items []item `xml:"items>item"`
+	}
+	input := "<order>\n<items>\n" +
+		"<item sku=\"A\"><price>1</price></item>\n" +
+		"<item sku=\"B\"><price>2</price></item>\n" +
+		"<item sku=\"C\"><price>3</price></item>\n" +
+		"<item sku=\"D\"><price>four</price></item>\n" +
+		"</items>\n</order>"
+
+	tests := []struct {
+		name     string
+		input    string
+		path     string
+		line     int
+		column   int
+		sentinel error
+	}{
+		{name: "Invalid value", input: input, path: "/order/items/item[4]/price", line: 6, column: 15},
+		{name: "Invalid attribute", input: strings.Replace(input, `sku="C"`, `sku="X"`, 1), path: "/order/items/item[3]/@sku", line: 5, column: 1, sentinel: ErrValidation},
+		{name: "Syntax error", input: "<order>\n<items>\n<item></items>", path: "/order/items/item", line: 3, column: 7},
+		{name: "Limit", input: input, path: "/order/items/item[2]", line: 4, column: 1, sentinel: ErrLimitExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &UnmarshalOptions{}
+			if tt.sentinel == ErrLimitExceeded {
+				opts.MaxCharacters = 5
+			}
+			var decoded order
+			err := UnmarshalWithOptions([]byte(tt.input), &decoded, opts)
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) || !errors.Is(err, ErrDecode) {
+				t.Fatalf("Expected DecodeError, got %v", err)
+			}
+			if decodeErr.Path != tt.path || decodeErr.Line != tt.line || decodeErr.Column != tt.column {
+				t.Errorf("Expected %s at %d:%d, got %s at %d:%d", tt.path, tt.line, tt.column, decodeErr.Path, decodeErr.Line, decodeErr.Column)
+			}
+			if decodeErr.Offset <= 0 || decodeErr.Offset > int64(len(tt.input)) {
+				t.Errorf("Unexpected offset %d", decodeErr.Offset)
+			}
+			if tt.sentinel != nil && !errors.Is(err, tt.sentinel) {
+				t.Errorf("Expected %v to match %v", err, tt.sentinel)
+			}
+		})
+	}
+
+	root, err := Parse([]byte(input))
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	defer releaseNode(root)
+	var decoded order
+	err = UnmarshalNode(root, &decoded)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Path != "/order/items/item[4]/price" || decodeErr.Line != 0 {
+		t.Errorf("Expected path-only DecodeError, got %#v", err)
+	}
+	if strings.Contains(err.Error(), "line") {
+		t.Errorf("Expected no position in message: %v", err)
+	}
+}
+
+func TestUnmarshalModes(t *testing.T) {
+	type Address struct {
+		City string `xml:"city"`
+	}
+	type customer struct {
+		ID      string   `xml:"id,attr"`
+		Name    string   `xml:"name"`
+		Tags    []string `xml:"tags>tag"`
+		Address `xml:"address"`
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		opts     *UnmarshalOptions
+		sentinel error
+		path     string
+	}{
+		{name: "Known content", input: `<customer id="1" xmlns:x="urn:x" xml:lang="en"><name>Ann</name><tags><tag>a</tag></tags><city>Oslo</city></customer>`, opts: &UnmarshalOptions{DisallowUnknownElements: true, DisallowUnknownAttributes: true}},
+		{name: "Unknown elements allowed by default", input: `<customer><name>Ann</name><nickname>A</nickname></customer>`},
+		{name: "Unknown element", input: `<customer><name>Ann</name><nickname>A</nickname></customer>`, opts: &UnmarshalOptions{DisallowUnknownElements: true}, sentinel: ErrUnknownElement, path: "/customer/nickname"},
+		{name: "Unknown element in wrapper", input: `<customer><tags><tag>a</tag><label>b</label></tags></customer>`, opts: &UnmarshalOptions{DisallowUnknownElements: true}, sentinel: ErrUnknownElement, path: "/customer/tags/label"},
+		{name: "Unknown attribute", input: `<customer id="1" vip="true"><name>Ann</name></customer>`, opts: &UnmarshalOptions{DisallowUnknownAttributes: true}, sentinel: ErrUnknownAttribute, path: "/customer/@vip"},
+		{name: "Unknown attribute allowed", input: `<customer id="1" vip="true"><name>Ann</name></customer>`, opts: &UnmarshalOptions{DisallowUnknownElements: true}},
+		{name: "Trailing content is an error", input: `<customer><name>Ann</name></customer><customer>`, sentinel: ErrDecode},
+		{name: "Lenient trailing content", input: `<customer><name>Ann</name></customer>garbage<broken`, opts: &UnmarshalOptions{Lenient: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded customer
+			err := UnmarshalWithOptions([]byte(tt.input), &decoded, tt.opts)
+			if tt.sentinel == nil {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if decoded.Name != "Ann" && len(decoded.Tags) == 0 {
+					t.Errorf("Expected decoded content, got %+v", decoded)
+				}
+				return
+			}
+			if !errors.Is(err, tt.sentinel) {
+				t.Fatalf("Expected %v, got %v", tt.sentinel, err)
+			}
+			var decodeErr *DecodeError
+			if tt.path != "" && (!errors.As(err, &decodeErr) || decodeErr.Path != tt.path) {
+				t.Errorf("Expected path %q, got %v", tt.path, err)
+			}
+		})
+	}
+}
+
+func TestCatchAllFields(t *testing.T) {
+	type product struct {
+		ID         string         `xml:"id,attr"`
+		ExtraAttrs []Attribute    `xml:",any,attr"`
+		Name       string         `xml:"name"`
+		Tags       []string       `xml:"tags>tag"`
+		Extensions []*ElementNode `xml:",any"`
+	}
+	input := `<product id="7" xmlns:v="urn:vendor" v:rank="3"><name>Lamp</name><v:color code="r">red</v:color><tags><tag>home</tag></tags><v:note><b>fragile</b></v:note></product>`
+
+	var decoded product
+	if err := UnmarshalWithOptions([]byte(input), &decoded, &UnmarshalOptions{DisallowUnknownElements: true, DisallowUnknownAttributes: true}); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if decoded.ID != "7" || decoded.Name != "Lamp" || len(decoded.Tags) != 1 {
+		t.Errorf("Unexpected mapped fields: %+v", decoded)
+	}
+	expectedAttrs := []Attribute{{Name: "xmlns:v", Value: "urn:vendor"}, {Name: "v:rank", Value: "3"}}
+	if !reflect.DeepEqual(decoded.ExtraAttrs, expectedAttrs) {
+		t.Errorf("Attribute mismatch.\nExpected: %+v\nGot: %+v", expectedAttrs, decoded.ExtraAttrs)
+	}
+	if len(decoded.Extensions) != 2 || decoded.Extensions[0].Name != "v:color" || decoded.Extensions[1].Name != "v:note" {
+		t.Fatalf("Unexpected extensions: %+v", decoded.Extensions)
+	}
+
+	output, err := Marshal(decoded, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := `<product id="7" xmlns:v="urn:vendor" v:rank="3">` + "\n<name>Lamp</name>\n<tags>\n<tag>home</tag>\n</tags>\n" +
+		`<v:color code="r">red</v:color>` + "\n<v:note>\n<b>fragile</b>\n</v:note>\n</product>"
+	if string(output) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, output)
+	}
+
+	var again product
+	if err := Unmarshal(output, &again); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if !reflect.DeepEqual(again.ExtraAttrs, decoded.ExtraAttrs) || len(again.Extensions) != 2 {
+		t.Fatalf("Round trip mismatch.\nExpected: %+v\nGot: %+v", decoded, again)
+	}
+	if note := again.Extensions[1].ChildElements(); len(note) != 1 || note[0].Text() != "fragile" {
+		t.Errorf("Expected nested extension content to survive, got %+v", again.Extensions[1])
+	}
+
+	type invalid struct {
+		Extra []string `xml:",any"`
+	}
+	if _, err := Marshal(invalid{Extra: []string{"x"}}, nil); err == nil {
+		t.Error("Expected error for unsupported any field type")
+	}
+	if err := Unmarshal([]byte(`<invalid><x/></invalid>`), &invalid{}); err == nil {
+		t.Error("Expected error for unsupported any field type")
+	}
+}
+
+func TestEntityExpansionMemory(t *testing.T) {
+	var doc strings.Builder
+	doc.WriteString("<!DOCTYPE r [\n<!ENTITY a0 \"" + strings.Repeat("x", 1000) + "\">\n")
+	for i := 1; i <= 3; i++ {
+		doc.WriteString(fmt.Sprintf("<!ENTITY a%d \"%s\">\n", i, strings.Repeat(fmt.Sprintf("&a%d;", i-1), 10)))
+	}
+	doc.WriteString("]><r>" + strings.Repeat("&a3;", 300) + "</r>")
+	input := []byte(doc.String())
+
+	tests := []struct {
+		name  string
+		opts  *UnmarshalOptions
+		limit string
+	}{
+		{name: "Default limits", limit: "MaxEntityExpansions"},
+		{name: "Character budget", opts: &UnmarshalOptions{MaxEntityExpansions: -1, MaxCharacters: 1 << 20}, limit: "MaxCharacters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			_, err := ParseWithOptions(input, tt.opts)
+			runtime.ReadMemStats(&after)
+
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+				t.Fatalf("Expected %s limit error, got %v", tt.limit, err)
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+				t.Errorf("Expected bounded allocation for a %d byte input, got %d bytes", len(input), allocated)
+			}
+		})
+	}
+}
+
+func TestCharDataField(t *testing.T) {
+	type Price struct {
+		Currency string  `xml:"currency,attr"`
+		Amount   float64 `xml:",chardata"`
+	}
+	type Item struct {
+		Price Price `xml:"price"`
+	}
+
+	data, err := Marshal(Item{Price: Price{Currency: "EUR", Amount: 9.5}}, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := "<Item>\n<price currency=\"EUR\">9.50</price>\n</Item>"
+	if string(data) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, string(data))
+	}
+
+	var decoded Item
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if decoded.Price.Currency != "EUR" || decoded.Price.Amount != 9.5 {
+		t.Errorf("Unexpected round trip: %+v", decoded)
+	}
+}
+
+func TestNamespacedMaxBytes(t *testing.T) {
+	type Entry struct {
+		Value string `xml:"urn:x value"`
+	}
+	type Feed struct {
+		Entries []Entry `xml:"entry"`
+	}
+
+	feed := Feed{Entries: make([]Entry, 10000)}
+	for i := range feed.Entries {
+		feed.Entries[i].Value = "some entry text"
+	}
+	visited := 0
+	opts := &MarshalOptions{MaxBytes: 1000, FieldFilter: func(path string, field reflect.StructField) bool {
+		visited++
+		return true
+	}}
+
+	_, err := Marshal(feed, opts)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxBytes" {
+		t.Fatalf("Expected MaxBytes limit error, got %v", err)
+	}
+	if visited > 200 {
+		t.Errorf("Expected the build to stop near the limit, visited %d fields", visited)
+	}
+}
+
+func TestEntityReferencesAndCharacterReferences(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		text  string
+		attr  string
+	}{
+		{
+			name:  "Noncharacter reference next to an entity",
+			input: `<!DOCTYPE Doc [<!ENTITY co "ACME">]><Doc><a v="&co; &#xFDD0;">&co; &#xFDD0;</a></Doc>`,
+			text:  "ACME \uFDD0",
+			attr:  "ACME \uFDD0",
+		},
+		{
+			name:  "Character references spelling an entity name stay literal",
+			input: `<!DOCTYPE Doc [<!ENTITY co "ACME">]><Doc><a v="&#xFDD0;co&#xFDD0;">&#xFDD0;co&#xFDD0;</a></Doc>`,
+			text:  "\uFDD0co\uFDD0",
+			attr:  "\uFDD0co\uFDD0",
+		},
+		{
+			name:  "Predefined and line-ending normalization",
+			input: "<!DOCTYPE Doc [<!ENTITY co \"ACME\">]><Doc><a v=\"&lt;&co;&gt;\">&amp;&co;\r\n&#38;</a></Doc>",
+			text:  "&ACME\n&",
+			attr:  "<ACME>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := Parse([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Parse error: %v", err)
+			}
+			defer releaseNode(root)
+			a := root.ChildElements()[0]
+			if a.Text() != tt.text {
+				t.Errorf("Expected text %q, got %q", tt.text, a.Text())
+			}
+			if value, _ := a.Attribute("v"); value != tt.attr {
+				t.Errorf("Expected attribute %q, got %q", tt.attr, value)
+			}
+		})
+	}
+}
+
+func TestCompressMinSizeError(t *testing.T) {
+	type Data struct {
+		Text    string `xml:"text"`
+		Trigger func() `xml:"trigger"`
+	}
+
+	tests := []struct {
+		name    string
+		minSize int
+	}{
+		{name: "Below threshold", minSize: 1 << 20},
+		{name: "Above threshold", minSize: 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			data := Data{Text: strings.Repeat("payload ", 2000), Trigger: func() {}}
+			err := MarshalTo(&out, data, &MarshalOptions{Compress: true, CompressMinSize: tt.minSize})
+			if !errors.Is(err, ErrUnsupportedKind) {
+				t.Fatalf("Expected an unsupported kind error, got %v", err)
+			}
+			if bytes.Contains(out.Bytes(), []byte("payload")) {
+				t.Errorf("Expected no plaintext output on error, got %d bytes", out.Len())
+			}
+		})
+	}
+}
+
+func TestTransformerNodeRelease(t *testing.T) {
+	type Item struct {
+		SKU  string `xml:"sku,attr"`
+		Name string `xml:"name"`
+	}
+	type Order struct {
+		ID    int    `xml:"id,attr"`
+		Items []Item `xml:"items>item"`
+	}
+
+	input := Order{ID: 7, Items: []Item{{SKU: "A", Name: "Widget"}, {SKU: "B", Name: "Gadget"}}}
+	element := func(name string, children ...Node) *ElementNode {
+		node := acquireElementNode()
+		node.Name = name
+		node.Children = append(node.Children, children...)
+		return node
+	}
+
+	tests := []struct {
+		name          string
+		transformers  []NodeTransformer
+		expected      string
+		expectedError bool
+	}{
+		{
+			name: "Replace the root",
+			transformers: []NodeTransformer{NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) {
+				return element("empty"), nil
+			})},
+			expected: `<empty></empty>`,
+		},
+		{
+			name: "Wrap the root",
+			transformers: []NodeTransformer{NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) {
+				return element("envelope", root), nil
+			})},
+			expected: `<envelope><Order id="7"><items><item sku="A"><name>Widget</name></item><item sku="B"><name>Gadget</name></item></items></Order></envelope>`,
+		},
+		{
+			name: "Reuse the children",
+			transformers: []NodeTransformer{NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) {
+				return element("order", root.Children...), nil
+			})},
+			expected: `<order><items><item sku="A"><name>Widget</name></item><item sku="B"><name>Gadget</name></item></items></order>`,
+		},
+		{
+			name: "Wrap then unwrap",
+			transformers: []NodeTransformer{
+				NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) {
+					return element("envelope", root), nil
+				}),
+				NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) {
+					return root.Children[0].(*ElementNode), nil
+				}),
+			},
+			expected: `<Order id="7"><items><item sku="A"><name>Widget</name></item><item sku="B"><name>Gadget</name></item></items></Order>`,
+		},
+		{
+			name: "Error after a replacement",
+			transformers: []NodeTransformer{
+				NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) {
+					return element("envelope", root), nil
+				}),
+				NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) {
+					return nil, fmt.Errorf("rejected")
+				}),
+			},
+			expectedError: true,
+		},
+	}
+
+	ConfigurePools(PoolConfig{Instrument: true})
+	defer ConfigurePools(PoolConfig{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ResetPoolStatistics()
+			outputBytes, err := Marshal(input, &MarshalOptions{Transformers: tt.transformers})
+			if tt.expectedError {
+				if err == nil {
+					t.Fatalf("Expected an error, got %s", outputBytes)
+				}
+			} else if err != nil {
+				t.Fatalf("Serialization error: %v", err)
+			} else if normalizeXML(string(outputBytes)) != normalizeXML(tt.expected) {
+				t.Errorf("Output mismatch.\nExpected: %s\nGot: %s", tt.expected, outputBytes)
+			}
+
+			stats := PoolStatistics()
+			if stats.Elements.Gets != stats.Elements.Puts+stats.Elements.Drops {
+				t.Errorf("Unbalanced element pool: %+v", stats.Elements)
+			}
+			if stats.Texts.Gets != stats.Texts.Puts+stats.Texts.Drops {
+				t.Errorf("Unbalanced text pool: %+v", stats.Texts)
+			}
+		})
+	}
+}
+
+func BenchmarkPerformance(b *testing.B) {
+	type SimpleStruct struct {
+		ID   int    `xml:"id,attr"`
+		Name string `xml:"name"`
+	}
+
+	type NestedStruct struct {
+		ID       int      `xml:"id,attr"`
+		Title    string   `xml:"title"`
+		Children []string `xml:"children>child"`
+	}
+
+	tests := []struct {
+		scenario   string
+		data       interface{}
+		opts       *MarshalOptions
+		iterations int
+	}{
+		{
+			scenario: "Simple struct - 1M serializations",
+			data: SimpleStruct{
+				ID:   1,
+				Name: "TestName",
+			},
+			opts: &MarshalOptions{
+				Indent:    "  ",
+				XMLHeader: true,
+			},
+			iterations: 1_000_000,
+		},
+		{
+			scenario: "Nested struct - 1M serializations",
+			data: NestedStruct{
+				ID:    2,
+				Title: "Parent",
+				Children: []string{
+					"Child1",
+					"Child2",
+					"Child3",
+				},
+			},
+			opts: &MarshalOptions{
+				Indent:    "  ",
+				XMLHeader: true,
+			},
+			iterations: 1_000_000,
+		},
+		{
+			scenario: "Large data - 500k serializations",
+			data: NestedStruct{
+				ID:    3,
+				Title: "Large Parent",
+				Children: func() []string {
+					largeList := make([]string, 1000)
+					for i := range largeList {
+						largeList[i] = fmt.Sprintf("Child%d", i+1)
+					}
+					return largeList
+				}(),
+			},
+			opts: &MarshalOptions{
+				Indent:    "  ",
+				XMLHeader: true,
+			},
+			iterations: 500_000,
+		},
+	}
+
+	fmt.Println("Scenario,Iterations,TotalTime(s),AvgTimePerIteration(ms)")
+
+	for _, tt := range tests {
+		b.Run(tt.scenario, func(b *testing.B) {
+			start := time.Now()
+
+			for i := 0; i < tt.iterations; i++ {
+				_, err := Marshal(tt.data, tt.opts)
+				if err != nil {
+					b.Fatalf("Serialization error: %v", err)
+				}
+			}
+
+			duration := time.Since(start).Seconds()
+			avgTimePerIteration := (duration / float64(tt.iterations)) * 1000 // in milliseconds
+			fmt.Printf("%s,%d,%.2f,%.4f\n", tt.scenario, tt.iterations, duration, avgTimePerIteration)
+		})
+	}
+}
+
+func BenchmarkNamespacedMarshal(b *testing.B) {
+	type PlainEntry struct {
+		ID    int    `xml:"id,attr"`
+		Value string `xml:"value"`
+	}
+	type NamespacedEntry struct {
+		ID    int    `xml:"id,attr"`
+		Value string `xml:"urn:x value"`
+	}
+	type PlainFeed struct {
+		Entries []PlainEntry `xml:"entry"`
+	}
+	type NamespacedFeed struct {
+		Entries []NamespacedEntry `xml:"entry"`
+	}
+
+	plain := PlainFeed{Entries: make([]PlainEntry, 1000)}
+	namespaced := NamespacedFeed{Entries: make([]NamespacedEntry, 1000)}
+	for i := range plain.Entries {
+		plain.Entries[i] = PlainEntry{ID: i, Value: "entry"}
+		namespaced.Entries[i] = NamespacedEntry{ID: i, Value: "entry"}
+	}
+
+	tests := []struct {
+		scenario string
+		data     interface{}
+	}{
+		{scenario: "Plain", data: plain},
+		{scenario: "Namespaced", data: namespaced},
+	}
+	for _, tt := range tests {
+		b.Run(tt.scenario, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := MarshalTo(io.Discard, tt.data, nil); err != nil {
+					b.Fatalf("Serialization error: %v", err)
+				}
+			}
 		})
 	}
 }
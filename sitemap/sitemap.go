@@ -0,0 +1,285 @@
+package sitemap
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+const (
+	Namespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+	MaxURLs  = 50000
+	MaxBytes = 50 * 1024 * 1024
+
+	IndexName = "sitemap"
+)
+
+const (
+	header        = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"
+	urlsetOpen    = "<urlset xmlns=\"" + Namespace + "\">\n"
+	urlsetClose   = "\n</urlset>\n"
+	indexOpen     = "<sitemapindex xmlns=\"" + Namespace + "\">\n"
+	indexClose    = "\n</sitemapindex>\n"
+	lastModLayout = time.RFC3339
+)
+
+var (
+	ErrMissingLoc  = errors.New("sitemap: URL has no location")
+	ErrEntryTooBig = errors.New("sitemap: URL entry exceeds the size limit")
+	ErrTooManyURLs = errors.New("sitemap: too many URLs for a single sitemap")
+	ErrTooLarge    = errors.New("sitemap: document exceeds the size limit")
+	ErrClosed      = errors.New("sitemap: generator is closed")
+)
+
+type URL struct {
+	Loc        string
+	LastMod    time.Time
+	ChangeFreq string
+	Priority   float64
+}
+
+type urlXML struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+type sitemapXML struct {
+	Loc string `xml:"loc"`
+}
+
+var entryOptions = &go_xml.MarshalOptions{RootTag: "url"}
+
+func appendURL(dst []byte, u URL) ([]byte, error) {
+	if u.Loc == "" {
+		return dst, ErrMissingLoc
+	}
+	entry := urlXML{Loc: u.Loc, ChangeFreq: u.ChangeFreq}
+	if !u.LastMod.IsZero() {
+		entry.LastMod = u.LastMod.Format(lastModLayout)
+	}
+	if u.Priority > 0 {
+		entry.Priority = strconv.FormatFloat(u.Priority, 'f', 1, 64)
+	}
+	return go_xml.AppendMarshal(dst, entry, entryOptions)
+}
+
+type countingWriter struct {
+	w       io.Writer
+	written int
+	max     int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.written+len(p) > c.max {
+		return 0, ErrTooLarge
+	}
+	n, err := c.w.Write(p)
+	c.written += n
+	return n, err
+}
+
+func Write(w io.Writer, urls []URL) error {
+	return writeLimited(w, urls, MaxBytes)
+}
+
+func writeLimited(w io.Writer, urls []URL, maxBytes int) error {
+	if len(urls) > MaxURLs {
+		return ErrTooManyURLs
+	}
+	for _, u := range urls {
+		if u.Loc == "" {
+			return ErrMissingLoc
+		}
+	}
+
+	out := &countingWriter{w: w, max: maxBytes}
+	if _, err := io.WriteString(out, header+urlsetOpen); err != nil {
+		return err
+	}
+	var entry []byte
+	for i, u := range urls {
+		var err error
+		entry = entry[:0]
+		if i > 0 {
+			entry = append(entry, '\n')
+		}
+		if entry, err = appendURL(entry, u); err != nil {
+			return err
+		}
+		if _, err := out.Write(entry); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(out, urlsetClose)
+	return err
+}
+
+type Generator struct {
+	BaseURL  string
+	Create   func(name string) (io.WriteCloser, error)
+	Compress bool
+	MaxURLs  int
+	MaxBytes int
+
+	parts   []string
+	file    io.WriteCloser
+	out     io.Writer
+	count   int
+	written int
+	entry   []byte
+	closed  bool
+}
+
+func NewGenerator(baseURL string, create func(name string) (io.WriteCloser, error)) *Generator {
+	return &Generator{BaseURL: baseURL, Create: create}
+}
+
+func (g *Generator) Add(u URL) error {
+	if g.closed {
+		return ErrClosed
+	}
+
+	var err error
+	if g.entry, err = appendURL(g.entry[:0], u); err != nil {
+		return err
+	}
+
+	maxURLs, maxBytes := g.limits()
+	fixed := len(header) + len(urlsetOpen) + len(urlsetClose)
+	if fixed+len(g.entry) > maxBytes {
+		return ErrEntryTooBig
+	}
+	if g.out != nil && (g.count >= maxURLs || g.written+1+len(g.entry)+len(urlsetClose) > maxBytes) {
+		if err := g.finishPart(); err != nil {
+			return err
+		}
+	}
+	if g.out == nil {
+		if err := g.startPart(); err != nil {
+			return err
+		}
+	} else if err := g.write("\n"); err != nil {
+		return err
+	}
+
+	if err := g.write(string(g.entry)); err != nil {
+		return err
+	}
+	g.count++
+	return nil
+}
+
+func (g *Generator) Parts() []string {
+	return g.parts
+}
+
+func (g *Generator) Close() error {
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	if g.out != nil {
+		if err := g.finishPart(); err != nil {
+			return err
+		}
+	}
+
+	file, out, err := g.open(IndexName)
+	if err != nil {
+		return err
+	}
+	buf := append([]byte(header), indexOpen...)
+	for i, part := range g.parts {
+		if i > 0 {
+			buf = append(buf, '\n')
+		}
+		if buf, err = go_xml.AppendMarshal(buf, sitemapXML{Loc: g.BaseURL + part}, &go_xml.MarshalOptions{RootTag: "sitemap"}); err != nil {
+			return err
+		}
+	}
+	buf = append(buf, indexClose...)
+	if _, err := out.Write(buf); err != nil {
+		return err
+	}
+	return closeAll(out, file)
+}
+
+func (g *Generator) limits() (int, int) {
+	maxURLs, maxBytes := g.MaxURLs, g.MaxBytes
+	if maxURLs <= 0 || maxURLs > MaxURLs {
+		maxURLs = MaxURLs
+	}
+	if maxBytes <= 0 || maxBytes > MaxBytes {
+		maxBytes = MaxBytes
+	}
+	return maxURLs, maxBytes
+}
+
+func (g *Generator) fileName(base string) string {
+	if g.Compress {
+		return base + ".xml.gz"
+	}
+	return base + ".xml"
+}
+
+func (g *Generator) open(base string) (io.WriteCloser, io.Writer, error) {
+	file, err := g.Create(g.fileName(base))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !g.Compress {
+		return file, file, nil
+	}
+	compressed, err := (&go_xml.GzipCompressor{Level: gzip.DefaultCompression}).NewWriter(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, compressed, nil
+}
+
+func (g *Generator) startPart() error {
+	base := fmt.Sprintf("%s-%d", IndexName, len(g.parts)+1)
+	file, out, err := g.open(base)
+	if err != nil {
+		return err
+	}
+	g.file, g.out = file, out
+	g.parts = append(g.parts, g.fileName(base))
+	g.count, g.written = 0, 0
+	return g.write(header + urlsetOpen)
+}
+
+func (g *Generator) finishPart() error {
+	err := g.write(urlsetClose)
+	if closeErr := closeAll(g.out, g.file); err == nil {
+		err = closeErr
+	}
+	g.file, g.out = nil, nil
+	return err
+}
+
+func (g *Generator) write(s string) error {
+	n, err := io.WriteString(g.out, s)
+	g.written += n
+	return err
+}
+
+func closeAll(out io.Writer, file io.WriteCloser) error {
+	var err error
+	if closer, ok := out.(io.WriteCloser); ok && closer != file {
+		err = closer.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
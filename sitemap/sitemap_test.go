@@ -0,0 +1,180 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+type memoryFile struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (f *memoryFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+type memoryFS map[string]*memoryFile
+
+func (fs memoryFS) create(name string) (io.WriteCloser, error) {
+	file := &memoryFile{}
+	fs[name] = file
+	return file, nil
+}
+
+func (fs memoryFS) read(t *testing.T, name string, compressed bool) string {
+	t.Helper()
+	file, ok := fs[name]
+	if !ok || !file.closed {
+		t.Fatalf("File %s missing or not closed", name)
+	}
+	if !compressed {
+		return file.String()
+	}
+	reader, err := gzip.NewReader(&file.Buffer)
+	if err != nil {
+		t.Fatalf("Gzip reader error: %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Gzip read error: %v", err)
+	}
+	return string(data)
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, []URL{
+		{Loc: "https://example.com/?a=1&b=2", LastMod: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), ChangeFreq: "daily", Priority: 0.8},
+		{Loc: "https://example.com/about"},
+	})
+	if err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/?a=1&amp;b=2</loc><lastmod>2024-01-02T03:04:05Z</lastmod><changefreq>daily</changefreq><priority>0.8</priority></url>
+  <url><loc>https://example.com/about</loc></url>
+</urlset>`
+	diffs, err := go_xml.Diff([]byte(expected), buf.Bytes(), nil)
+	if err != nil || len(diffs) > 0 {
+		t.Errorf("Sitemap mismatch %v %v\nGot: %s", diffs, err, buf.String())
+	}
+
+	if err := Write(io.Discard, []URL{{}}); !errors.Is(err, ErrMissingLoc) {
+		t.Errorf("Expected ErrMissingLoc, got %v", err)
+	}
+
+	writes := &countingFile{}
+	urls := []URL{{Loc: "https://example.com/a"}, {Loc: "https://example.com/b"}, {Loc: "https://example.com/c"}}
+	if err := Write(writes, urls); err != nil {
+		t.Fatalf("Write error: %v", err)
+	}
+	if writes.calls < len(urls)+2 {
+		t.Errorf("Expected entries to be streamed, got %d writes", writes.calls)
+	}
+
+	err = writeLimited(io.Discard, urls, 150)
+	if !errors.Is(err, ErrTooLarge) || errors.Is(err, ErrTooManyURLs) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+}
+
+type countingFile struct {
+	calls int
+}
+
+func (f *countingFile) Write(p []byte) (int, error) {
+	f.calls++
+	return len(p), nil
+}
+
+func TestGeneratorSplitting(t *testing.T) {
+	tests := []struct {
+		name          string
+		compress      bool
+		maxURLs       int
+		maxBytes      int
+		urls          int
+		expectedParts []string
+	}{
+		{
+			name:          "Split by URL count",
+			maxURLs:       2,
+			urls:          5,
+			expectedParts: []string{"sitemap-1.xml", "sitemap-2.xml", "sitemap-3.xml"},
+		},
+		{
+			name:          "Split by size with gzip",
+			compress:      true,
+			maxBytes:      250,
+			urls:          6,
+			expectedParts: []string{"sitemap-1.xml.gz", "sitemap-2.xml.gz", "sitemap-3.xml.gz"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := memoryFS{}
+			g := NewGenerator("https://example.com/", fs.create)
+			g.Compress = tt.compress
+			g.MaxURLs = tt.maxURLs
+			g.MaxBytes = tt.maxBytes
+
+			for i := 0; i < tt.urls; i++ {
+				if err := g.Add(URL{Loc: fmt.Sprintf("https://example.com/page/%d", i)}); err != nil {
+					t.Fatalf("Add error: %v", err)
+				}
+			}
+			if err := g.Close(); err != nil {
+				t.Fatalf("Close error: %v", err)
+			}
+			if err := g.Add(URL{Loc: "https://example.com/late"}); !errors.Is(err, ErrClosed) {
+				t.Errorf("Expected ErrClosed, got %v", err)
+			}
+
+			if fmt.Sprint(g.Parts()) != fmt.Sprint(tt.expectedParts) {
+				t.Fatalf("Expected parts %v, got %v", tt.expectedParts, g.Parts())
+			}
+
+			total := 0
+			for _, part := range g.Parts() {
+				content := fs.read(t, part, tt.compress)
+				if tt.maxBytes > 0 && len(content) > tt.maxBytes {
+					t.Errorf("%s is %d bytes, limit %d", part, len(content), tt.maxBytes)
+				}
+				root, err := go_xml.Parse([]byte(content))
+				if err != nil {
+					t.Fatalf("%s is not well-formed: %v\n%s", part, err, content)
+				}
+				total += len(root.FindAll("url"))
+			}
+			if total != tt.urls {
+				t.Errorf("Expected %d URLs across parts, got %d", tt.urls, total)
+			}
+
+			index := fs.read(t, g.fileName(IndexName), tt.compress)
+			for _, part := range tt.expectedParts {
+				if !strings.Contains(index, "<loc>https://example.com/"+part+"</loc>") {
+					t.Errorf("Index is missing %s:\n%s", part, index)
+				}
+			}
+		})
+	}
+
+	g := NewGenerator("", memoryFS{}.create)
+	g.MaxBytes = 100
+	if err := g.Add(URL{Loc: "https://example.com/" + strings.Repeat("x", 200)}); !errors.Is(err, ErrEntryTooBig) {
+		t.Errorf("Expected ErrEntryTooBig, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package soap
+
+import (
+	"fmt"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+type Fault struct {
+	Version Version
+	Code    string
+	Subcode string
+	Reason  string
+	Actor   string
+	Detail  *go_xml.ElementNode
+}
+
+func (f *Fault) Error() string {
+	if f.Subcode != "" {
+		return fmt.Sprintf("soap fault %s (%s): %s", f.Code, f.Subcode, f.Reason)
+	}
+	return fmt.Sprintf("soap fault %s: %s", f.Code, f.Reason)
+}
+
+type Fault11 struct {
+	Code   string          `xml:"faultcode"`
+	String string          `xml:"faultstring"`
+	Actor  string          `xml:"faultactor,omitempty"`
+	Detail []go_xml.RawXML `xml:"detail>entry,omitempty"`
+}
+
+type Fault12 struct {
+	Code    string
+	Subcode string
+	Reason  string
+	Lang    string
+	Role    string
+	Detail  []go_xml.RawXML
+}
+
+type fault12XML struct {
+	Code   fault12Code     `xml:"soap:Code"`
+	Reason fault12Reason   `xml:"soap:Reason"`
+	Role   string          `xml:"soap:Role,omitempty"`
+	Detail []go_xml.RawXML `xml:"soap:Detail>entry,omitempty"`
+}
+
+type fault12Code struct {
+	Value   string       `xml:"soap:Value"`
+	Subcode *fault12Code `xml:"soap:Subcode,omitempty"`
+}
+
+type fault12Reason struct {
+	Text fault12Text `xml:"soap:Text"`
+}
+
+type fault12Text struct {
+	Lang  string `xml:"xml:lang,attr"`
+	Value string `xml:",chardata"`
+}
+
+func MarshalFault(fault interface{}, opts *Options) ([]byte, error) {
+	envelopeOpts := Options{}
+	if opts != nil {
+		envelopeOpts = *opts
+	}
+
+	var payload interface{}
+	switch f := fault.(type) {
+	case Fault11:
+		envelopeOpts.Version = V11
+		payload = f
+	case *Fault11:
+		envelopeOpts.Version = V11
+		payload = f
+	case Fault12:
+		envelopeOpts.Version = V12
+		payload = f.toXML()
+	case *Fault12:
+		envelopeOpts.Version = V12
+		payload = f.toXML()
+	default:
+		return nil, fmt.Errorf("soap: unsupported fault type %T", fault)
+	}
+
+	faultOpts := go_xml.MarshalOptions{}
+	if envelopeOpts.MarshalOptions != nil {
+		faultOpts = *envelopeOpts.MarshalOptions
+	}
+	faultOpts.RootTag = "soap:Fault"
+	faultOpts.Namespace = ""
+	faultOpts.XMLHeader = false
+	faultOpts.Compress = false
+	body, err := marshalFragment(payload, &faultOpts)
+	if err != nil {
+		return nil, fmt.Errorf("soap: error encoding body: %w", err)
+	}
+	return Marshal(body, &envelopeOpts)
+}
+
+func (f *Fault12) toXML() fault12XML {
+	lang := f.Lang
+	if lang == "" {
+		lang = "en"
+	}
+	out := fault12XML{
+		Code:   fault12Code{Value: f.Code},
+		Reason: fault12Reason{Text: fault12Text{Lang: lang, Value: f.Reason}},
+		Role:   f.Role,
+		Detail: f.Detail,
+	}
+	if f.Subcode != "" {
+		out.Code.Subcode = &fault12Code{Value: f.Subcode}
+	}
+	return out
+}
+
+func (e *Envelope) Fault() (*Fault, bool) {
+	payload := e.Payload()
+	if payload == nil {
+		return nil, false
+	}
+	prefix, local := splitName(payload.Name)
+	if local != "Fault" || go_xml.NamespaceScope(payload, e.scope)[prefix] != e.Version.Namespace() {
+		return nil, false
+	}
+
+	fault := &Fault{Version: e.Version}
+	if e.Version == V11 {
+		fault.Code = childText(payload, "faultcode")
+		fault.Reason = childText(payload, "faultstring")
+		fault.Actor = childText(payload, "faultactor")
+		fault.Detail = child(payload, "detail")
+		return fault, true
+	}
+
+	if code := child(payload, "Code"); code != nil {
+		fault.Code = childText(code, "Value")
+		if subcode := child(code, "Subcode"); subcode != nil {
+			fault.Subcode = childText(subcode, "Value")
+		}
+	}
+	if reason := child(payload, "Reason"); reason != nil {
+		fault.Reason = childText(reason, "Text")
+	}
+	fault.Actor = childText(payload, "Role")
+	fault.Detail = child(payload, "Detail")
+	return fault, true
+}
+
+func IsFault(data []byte) bool {
+	env, err := Parse(data)
+	if err != nil {
+		return false
+	}
+	_, ok := env.Fault()
+	return ok
+}
+
+func child(node *go_xml.ElementNode, local string) *go_xml.ElementNode {
+	for _, element := range node.ChildElements() {
+		if _, name := splitName(element.Name); name == local {
+			return element
+		}
+	}
+	return nil
+}
+
+func childText(node *go_xml.ElementNode, local string) string {
+	if element := child(node, local); element != nil {
+		return element.Text()
+	}
+	return ""
+}
@@ -0,0 +1,207 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+type Version int
+
+const (
+	V11 Version = iota
+	V12
+)
+
+const (
+	Namespace11 = "http://schemas.xmlsoap.org/soap/envelope/"
+	Namespace12 = "http://www.w3.org/2003/05/soap-envelope"
+
+	ContentType11 = "text/xml; charset=utf-8"
+	ContentType12 = "application/soap+xml; charset=utf-8"
+)
+
+var (
+	ErrNotEnvelope = errors.New("soap: document is not a SOAP envelope")
+	ErrMissingBody = errors.New("soap: envelope has no body")
+)
+
+func (v Version) Namespace() string {
+	if v == V12 {
+		return Namespace12
+	}
+	return Namespace11
+}
+
+func (v Version) ContentType() string {
+	if v == V12 {
+		return ContentType12
+	}
+	return ContentType11
+}
+
+type Options struct {
+	Version        Version
+	Headers        []interface{}
+	MarshalOptions *go_xml.MarshalOptions
+}
+
+type envelope struct {
+	Namespace string          `xml:"xmlns:soap,attr"`
+	Header    []go_xml.RawXML `xml:"soap:Header>entry,omitempty"`
+	Body      []go_xml.RawXML `xml:"soap:Body>entry"`
+}
+
+func Marshal(body interface{}, opts *Options) ([]byte, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	base := go_xml.MarshalOptions{}
+	if opts.MarshalOptions != nil {
+		base = *opts.MarshalOptions
+	}
+
+	payloadOpts := base
+	payloadOpts.XMLHeader = false
+	payloadOpts.Compress = false
+
+	headerOpts := payloadOpts
+	headerOpts.RootTag = ""
+
+	env := envelope{Namespace: opts.Version.Namespace()}
+	for _, header := range opts.Headers {
+		fragment, err := marshalFragment(header, &headerOpts)
+		if err != nil {
+			return nil, fmt.Errorf("soap: error encoding header: %w", err)
+		}
+		env.Header = append(env.Header, fragment)
+	}
+	if body != nil {
+		fragment, err := marshalFragment(body, &payloadOpts)
+		if err != nil {
+			return nil, fmt.Errorf("soap: error encoding body: %w", err)
+		}
+		env.Body = append(env.Body, fragment)
+	}
+
+	envelopeOpts := base
+	envelopeOpts.RootTag = "soap:Envelope"
+	envelopeOpts.Namespace = ""
+	envelopeOpts.Transformers = nil
+	return go_xml.Marshal(env, &envelopeOpts)
+}
+
+func marshalFragment(v interface{}, opts *go_xml.MarshalOptions) (go_xml.RawXML, error) {
+	if raw, ok := v.(go_xml.RawXML); ok {
+		return raw, nil
+	}
+	data, err := go_xml.Marshal(v, opts)
+	if err != nil {
+		return "", err
+	}
+	return go_xml.RawXML(data), nil
+}
+
+type Envelope struct {
+	Version Version
+	Header  *go_xml.ElementNode
+	Body    *go_xml.ElementNode
+
+	scope map[string]string
+}
+
+func Parse(data []byte) (*Envelope, error) {
+	root, err := go_xml.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := go_xml.NamespaceScope(root, nil)
+	prefix, local := splitName(root.Name)
+	if local != "Envelope" {
+		return nil, ErrNotEnvelope
+	}
+
+	env := &Envelope{scope: scope}
+	switch scope[prefix] {
+	case Namespace11:
+		env.Version = V11
+	case Namespace12:
+		env.Version = V12
+	default:
+		return nil, ErrNotEnvelope
+	}
+
+	for _, child := range root.ChildElements() {
+		childScope := go_xml.NamespaceScope(child, scope)
+		childPrefix, childLocal := splitName(child.Name)
+		if childScope[childPrefix] != env.Version.Namespace() {
+			continue
+		}
+		switch childLocal {
+		case "Header":
+			env.Header = child
+		case "Body":
+			env.Body = child
+		}
+	}
+	if env.Body == nil {
+		return nil, ErrMissingBody
+	}
+	return env, nil
+}
+
+func (e *Envelope) Payload() *go_xml.ElementNode {
+	if children := e.Body.ChildElements(); len(children) > 0 {
+		return children[0]
+	}
+	return nil
+}
+
+func (e *Envelope) DecodeBody(v interface{}) error {
+	if fault, ok := e.Fault(); ok {
+		return fault
+	}
+	payload := e.Payload()
+	if payload == nil {
+		return ErrMissingBody
+	}
+	return go_xml.UnmarshalNode(payload, v)
+}
+
+func (e *Envelope) HeaderEntry(local string) *go_xml.ElementNode {
+	if e.Header == nil {
+		return nil
+	}
+	for _, child := range e.Header.ChildElements() {
+		if _, name := splitName(child.Name); name == local {
+			return child
+		}
+	}
+	return nil
+}
+
+func (e *Envelope) DecodeHeader(local string, v interface{}) (bool, error) {
+	entry := e.HeaderEntry(local)
+	if entry == nil {
+		return false, nil
+	}
+	return true, go_xml.UnmarshalNode(entry, v)
+}
+
+func Unmarshal(data []byte, body interface{}) error {
+	env, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	return env.DecodeBody(body)
+}
+
+func splitName(name string) (string, string) {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
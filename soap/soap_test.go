@@ -0,0 +1,182 @@
+package soap
+
+import (
+	"errors"
+	"testing"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+type getPrice struct {
+	Item string `xml:"Item"`
+}
+
+type auth struct {
+	Token string `xml:"Token"`
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     *Options
+		expected string
+	}{
+		{
+			name:     "SOAP 1.1 without header",
+			expected: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><GetPrice xmlns="urn:shop"><Item>Apple</Item></GetPrice></soap:Body></soap:Envelope>`,
+		},
+		{
+			name: "SOAP 1.2 with header",
+			opts: &Options{
+				Version: V12,
+				Headers: []interface{}{go_xml.RawXML(`<Auth xmlns="urn:shop"><Token>t</Token></Auth>`)},
+			},
+			expected: `<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"><soap:Header><Auth xmlns="urn:shop"><Token>t</Token></Auth></soap:Header><soap:Body><GetPrice xmlns="urn:shop"><Item>Apple</Item></GetPrice></soap:Body></soap:Envelope>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if opts == nil {
+				opts = &Options{}
+			}
+			opts.MarshalOptions = &go_xml.MarshalOptions{RootTag: "GetPrice", Namespace: "urn:shop"}
+
+			output, err := Marshal(getPrice{Item: "Apple"}, opts)
+			if err != nil {
+				t.Fatalf("Marshal error: %v", err)
+			}
+			diffs, err := go_xml.Diff([]byte(tt.expected), output, nil)
+			if err != nil {
+				t.Fatalf("Diff error: %v", err)
+			}
+			if len(diffs) > 0 {
+				t.Errorf("Envelope mismatch %v\nGot: %s", diffs, output)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	response := []byte(`<?xml version="1.0"?>
+<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+  <env:Header><s:Auth xmlns:s="urn:shop"><Token>abc</Token></s:Auth></env:Header>
+  <env:Body><s:GetPrice xmlns:s="urn:shop"><Item>Pear</Item></s:GetPrice></env:Body>
+</env:Envelope>`)
+
+	env, err := Parse(response)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if env.Version != V12 || env.Version.ContentType() != ContentType12 {
+		t.Errorf("Expected SOAP 1.2, got %v", env.Version)
+	}
+
+	var body getPrice
+	if err := env.DecodeBody(&body); err != nil || body.Item != "Pear" {
+		t.Errorf("DecodeBody returned %+v, %v", body, err)
+	}
+	var header auth
+	if found, err := env.DecodeHeader("Auth", &header); !found || err != nil || header.Token != "abc" {
+		t.Errorf("DecodeHeader returned %v, %+v, %v", found, header, err)
+	}
+
+	var roundTrip getPrice
+	output, err := Marshal(getPrice{Item: "Plum"}, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if err := Unmarshal(output, &roundTrip); err != nil || roundTrip.Item != "Plum" {
+		t.Errorf("Unmarshal returned %+v, %v", roundTrip, err)
+	}
+
+	if _, err := Parse([]byte(`<Envelope><Body/></Envelope>`)); !errors.Is(err, ErrNotEnvelope) {
+		t.Errorf("Expected ErrNotEnvelope, got %v", err)
+	}
+	if _, err := Parse([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"/>`)); !errors.Is(err, ErrMissingBody) {
+		t.Errorf("Expected ErrMissingBody, got %v", err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		fault    interface{}
+		expected Fault
+	}{
+		{
+			name: "SOAP 1.1 fault",
+			fault: Fault11{
+				Code:   "soap:Client",
+				String: "Invalid item",
+				Actor:  "urn:shop",
+				Detail: []go_xml.RawXML{`<error code="42"/>`},
+			},
+			expected: Fault{Version: V11, Code: "soap:Client", Reason: "Invalid item", Actor: "urn:shop"},
+		},
+		{
+			name: "SOAP 1.2 fault",
+			fault: &Fault12{
+				Code:    "soap:Sender",
+				Subcode: "s:OutOfStock",
+				Reason:  "No pears left",
+				Role:    "urn:shop",
+				Detail:  []go_xml.RawXML{`<error code="42"/>`},
+			},
+			expected: Fault{Version: V12, Code: "soap:Sender", Subcode: "s:OutOfStock", Reason: "No pears left", Actor: "urn:shop"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := MarshalFault(tt.fault, &Options{MarshalOptions: &go_xml.MarshalOptions{Indent: "  "}})
+			if err != nil {
+				t.Fatalf("MarshalFault error: %v", err)
+			}
+			if !IsFault(output) {
+				t.Fatalf("Expected a fault envelope, got %s", output)
+			}
+
+			var body getPrice
+			err = Unmarshal(output, &body)
+			var fault *Fault
+			if !errors.As(err, &fault) {
+				t.Fatalf("Expected *Fault from Unmarshal, got %v", err)
+			}
+			if fault.Detail == nil || fault.Detail.Find("error") == nil {
+				t.Errorf("Fault detail not extracted: %s", output)
+			}
+			fault.Detail = nil
+			if *fault != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, *fault)
+			}
+		})
+	}
+
+	output, err := MarshalFault(Fault11{Code: "soap:Server", String: "Down"}, &Options{Headers: []interface{}{auth{Token: "t"}}})
+	if err != nil {
+		t.Fatalf("MarshalFault error: %v", err)
+	}
+	env, err := Parse(output)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	if header := env.Header.ChildElements(); len(header) != 1 || header[0].Name != "auth" {
+		t.Errorf("Expected the header entry to keep its name, got %s", output)
+	}
+	if fault, ok := env.Fault(); !ok || fault.Reason != "Down" {
+		t.Errorf("Expected a fault body, got %s", output)
+	}
+
+	output, err = Marshal(getPrice{Item: "Apple"}, nil)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	if IsFault(output) {
+		t.Errorf("Regular response detected as fault")
+	}
+	if _, err := MarshalFault("oops", nil); err == nil {
+		t.Errorf("Expected an error for an unsupported fault type")
+	}
+}
@@ -0,0 +1,89 @@
+package go_xml
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+func MarshalStream(w io.Writer, root string, items <-chan interface{}, opts *MarshalOptions) error {
+	return MarshalStreamContext(context.Background(), w, root, items, opts)
+}
+
+// MarshalStreamContext stops receiving on the first error or when ctx is done
+// and never drains items, so the caller must stop the producer, typically by
+// cancelling ctx, or it will block on its next send.
+func MarshalStreamContext(ctx context.Context, w io.Writer, root string, items <-chan interface{}, opts *MarshalOptions) error {
+	bw := acquireBufferedWriter(w)
+	defer releaseBufferedWriter(bw)
+
+	m := newMarshaler(opts, nil)
+	opts = m.opts
+	if ctx.Done() != nil {
+		m.ctx = ctx
+	}
+
+	ew, closer, err := encodingWriter(limitOutput(bw, opts), opts)
+	if err != nil {
+		return err
+	}
+	encoder := newDocumentEncoder(ew, opts)
+	if err := encoder.writeProlog(opts); err != nil {
+		return err
+	}
+
+	m.out = encoder
+	m.path = append(m.path, root)
+	if err := m.startElement(root, nil); err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		var item interface{}
+		var ok bool
+		select {
+		case item, ok = <-items:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !ok {
+			break
+		}
+
+		val := reflect.ValueOf(item)
+		if isNilValue(val) {
+			continue
+		}
+
+		tag, err := streamItemTag(val, opts)
+		if err != nil {
+			return fmt.Errorf("error encoding item %d: %w", i, err)
+		}
+		m.path = append(m.path, indexSegment(i))
+		err = m.marshalValue(val, []string{tag})
+		m.path = m.path[:len(m.path)-1]
+		if err != nil {
+			return fmt.Errorf("error encoding structure: %w", err)
+		}
+	}
+
+	if err := m.endElement(); err != nil {
+		return err
+	}
+	if err := closer.Close(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func streamItemTag(val reflect.Value, opts *MarshalOptions) (string, error) {
+	if opts.ItemTag != "" {
+		return opts.ItemTag, nil
+	}
+	typ := reflect.Indirect(val).Type()
+	if typ.Name() == "" {
+		return "", fmt.Errorf("items of unnamed type %s require ItemTag", typ)
+	}
+	return typ.Name(), nil
+}
@@ -0,0 +1,108 @@
+package go_xml
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var knownNamesCache sync.Map
+
+type knownNames struct {
+	attrs       map[string]bool
+	elements    map[string]*knownNames
+	anyAttrs    bool
+	anyElements bool
+}
+
+func newKnownNames() *knownNames {
+	return &knownNames{attrs: make(map[string]bool), elements: make(map[string]*knownNames)}
+}
+
+func structKnownNames(t reflect.Type) *knownNames {
+	if cached, ok := knownNamesCache.Load(t); ok {
+		return cached.(*knownNames)
+	}
+	known := newKnownNames()
+	collectKnownNames(t, known, make(map[reflect.Type]bool))
+	knownNamesCache.Store(t, known)
+	return known
+}
+
+func collectKnownNames(t reflect.Type, known *knownNames, seen map[reflect.Type]bool) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+
+	fields := GetFieldMetadata(t)
+	for i := range fields {
+		meta := &fields[i]
+		field := meta.FieldType
+		switch {
+		case field.Anonymous:
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				collectKnownNames(embedded, known, seen)
+			}
+		case !field.IsExported() || meta.XMLName || meta.CharData:
+		case meta.Any:
+			if meta.Attr {
+				known.anyAttrs = true
+			} else {
+				known.anyElements = true
+			}
+		case meta.Attr:
+			known.attrs[meta.Name] = true
+		default:
+			node := known
+			for _, wrapper := range meta.Tags[:len(meta.Tags)-1] {
+				child := node.elements[wrapper]
+				if child == nil {
+					child = newKnownNames()
+					node.elements[wrapper] = child
+				}
+				node = child
+			}
+			if _, ok := node.elements[meta.Tags[len(meta.Tags)-1]]; !ok {
+				node.elements[meta.Tags[len(meta.Tags)-1]] = nil
+			}
+		}
+	}
+}
+
+func isReservedAttribute(name string) bool {
+	if _, ok := namespacePrefix(name); ok {
+		return true
+	}
+	return strings.HasPrefix(name, "xml:") || strings.HasPrefix(name, "xsi:")
+}
+
+func (u *unmarshaler) checkUnknown(node *ElementNode, known *knownNames) error {
+	if u.opts.DisallowUnknownAttributes && !known.anyAttrs {
+		for _, attr := range node.Attributes {
+			if known.attrs[attr.Name] || isReservedAttribute(attr.Name) {
+				continue
+			}
+			return u.locate(&UnknownAttributeError{Name: attr.Name, Path: u.fieldPath()}, node, attr.Name)
+		}
+	}
+	if !u.opts.DisallowUnknownElements || known.anyElements {
+		return nil
+	}
+	for _, child := range node.ChildElements() {
+		wrapper, ok := known.elements[child.Name]
+		if !ok {
+			return u.locate(&UnknownElementError{Name: child.Name, Path: u.fieldPath()}, child, "")
+		}
+		if wrapper != nil {
+			if err := u.checkUnknown(child, wrapper); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package go_xml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+type flusher interface {
+	Flush() error
+}
+
+func (e *Encoder) EncodeToken(token xml.Token) error {
+	first := !e.encodedToken
+	e.encodedToken = true
+
+	switch t := token.(type) {
+	case xml.StartElement:
+		return e.encodeStartToken(t)
+	case xml.EndElement:
+		name := t.Name.Local
+		open := e.current()
+		if open == nil {
+			return fmt.Errorf("unexpected end element </%s>", name)
+		}
+		if open.name != name {
+			return fmt.Errorf("end element </%s> does not match start element <%s>", name, open.name)
+		}
+		return e.endElement()
+	case xml.CharData:
+		return e.writeText(string(t))
+	case xml.Comment:
+		return e.writeComment(string(t))
+	case xml.ProcInst:
+		if t.Target == "xml" {
+			if !first {
+				return fmt.Errorf("xml declaration must be the first token")
+			}
+			return e.writeDeclaration(string(t.Inst))
+		}
+		return e.writeProcInst(t.Target, string(t.Inst))
+	case xml.Directive:
+		if !isValidDirective(string(t)) {
+			return fmt.Errorf("directive %q has unbalanced quotes, brackets or comments", string(t))
+		}
+		return e.writeRaw("<!" + string(t) + ">")
+	}
+	return fmt.Errorf("unsupported token type %T", token)
+}
+
+func (e *Encoder) encodeStartToken(t xml.StartElement) error {
+	if !isValidName(t.Name.Local) {
+		return &InvalidNameError{Name: t.Name.Local}
+	}
+
+	attrs := make([]Attribute, 0, len(t.Attr)+1)
+	if t.Name.Space != "" {
+		attrs = append(attrs, Attribute{Name: "xmlns", Value: t.Name.Space})
+	}
+	for _, attr := range t.Attr {
+		if attr.Name.Space == "" && attr.Name.Local == "xmlns" && t.Name.Space != "" {
+			continue
+		}
+		space := attr.Name.Space
+		if space == xmlNamespaceURI {
+			space = "xml"
+		}
+		uri := strings.ContainsAny(space, ":/")
+		name := qualifiedName(xml.Name{Space: space, Local: attr.Name.Local})
+		if uri {
+			name = attr.Name.Local
+		}
+		if !isValidName(name) {
+			return &InvalidNameError{Name: name}
+		}
+		if uri {
+			name = expandedName(space, name)
+		}
+		attrs = append(attrs, Attribute{Name: name, Value: attr.Value})
+	}
+	_, attrs = qualifyAttributes(t.Name.Local, attrs)
+	return e.startElement(t.Name.Local, attrs)
+}
+
+func isValidDirective(dir string) bool {
+	depth := 0
+	var quote byte
+	comment := false
+	for i := 0; i < len(dir); i++ {
+		switch c := dir[i]; {
+		case comment:
+			if strings.HasPrefix(dir[i:], "-->") {
+				comment = false
+				i += 2
+			}
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case strings.HasPrefix(dir[i:], "<!--"):
+			comment = true
+			i += 3
+		case c == '<':
+			depth++
+		case c == '>':
+			if depth == 0 {
+				return false
+			}
+			depth--
+		}
+	}
+	return depth == 0 && quote == 0 && !comment
+}
+
+func (e *Encoder) writeDeclaration(inst string) error {
+	return e.writePrologLine("<?xml " + inst + "?>")
+}
+
+func (e *Encoder) Flush() error {
+	if f, ok := e.w.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
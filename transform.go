@@ -0,0 +1,168 @@
+package go_xml
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type NodeTransformer interface {
+	Transform(root *ElementNode) (*ElementNode, error)
+}
+
+type NodeTransformerFunc func(root *ElementNode) (*ElementNode, error)
+
+func (f NodeTransformerFunc) Transform(root *ElementNode) (*ElementNode, error) {
+	return f(root)
+}
+
+func RenameElements(names map[string]string) NodeTransformer {
+	return NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) {
+		rename := func(element *ElementNode) bool {
+			if name, ok := names[element.Name]; ok {
+				element.Name = name
+			}
+			return true
+		}
+		rename(root)
+		root.Walk(rename)
+		return root, nil
+	})
+}
+
+func StripEmptyElements() NodeTransformer {
+	return NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) {
+		stripEmpty(root)
+		return root, nil
+	})
+}
+
+func stripEmpty(node *ElementNode) {
+	children := node.Children[:0]
+	for _, child := range node.Children {
+		if element, ok := child.(*ElementNode); ok {
+			stripEmpty(element)
+			if len(element.Attributes) == 0 && isBlank(element.Children) {
+				releaseNode(element)
+				continue
+			}
+		}
+		children = append(children, child)
+	}
+	clear(node.Children[len(children):])
+	node.Children = children
+}
+
+func isBlank(children []Node) bool {
+	for _, child := range children {
+		text, ok := child.(*TextNode)
+		if !ok || strings.TrimSpace(text.Text) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func SetRootAttributes(attrs ...Attribute) NodeTransformer {
+	return NodeTransformerFunc(func(root *ElementNode) (*ElementNode, error) {
+		for _, attr := range attrs {
+			root.SetAttribute(attr.Name, attr.Value)
+		}
+		return root, nil
+	})
+}
+
+func (m *marshaler) encodeTransformed(val reflect.Value, tags []string, encoder *Encoder) (err error) {
+	builder := &treeBuilder{}
+	if len(m.opts.Transformers) == 0 && isUTF8(m.opts.Encoding) {
+		builder.maxBytes = m.opts.MaxBytes
+	}
+	var replaced []*ElementNode
+	defer func() {
+		if r := recover(); r != nil {
+			releaseDetached(replaced, builder.root)
+			builder.release()
+			err = fmt.Errorf("panic while encoding structure: %v", r)
+		}
+	}()
+
+	m.out = builder
+	if err := m.marshalValue(val, tags); err != nil {
+		builder.release()
+		return fmt.Errorf("error encoding structure: %w", err)
+	}
+
+	if element, ok := builder.root.(*ElementNode); ok {
+		if m.deferNamespaces {
+			resolveNamespaces(element)
+		}
+		for _, transformer := range m.opts.Transformers {
+			transformed, err := transformer.Transform(element)
+			if err != nil {
+				releaseDetached(replaced, builder.root)
+				builder.release()
+				return fmt.Errorf("error transforming structure: %w", err)
+			}
+			if transformed == nil {
+				releaseDetached(replaced, builder.root)
+				builder.release()
+				return fmt.Errorf("error transforming structure: %T returned no root element", transformer)
+			}
+			if transformed != element {
+				replaced = append(replaced, element)
+			}
+			builder.root = transformed
+			element = transformed
+		}
+	}
+
+	root := builder.root
+	releaseDetached(replaced, root)
+	replaced = nil
+	builder.root = nil
+	if root == nil {
+		return nil
+	}
+	return root.Accept(encoder)
+}
+
+// releaseDetached releases the nodes of replaced roots that are no longer
+// reachable from the current root.
+func releaseDetached(roots []*ElementNode, current Node) {
+	if len(roots) == 0 {
+		return
+	}
+	seen := make(map[Node]bool)
+	markReachable(current, seen)
+	for _, root := range roots {
+		releaseUnseen(root, seen)
+	}
+}
+
+func markReachable(node Node, seen map[Node]bool) {
+	if node == nil || seen[node] {
+		return
+	}
+	seen[node] = true
+	if element, ok := node.(*ElementNode); ok {
+		for _, child := range element.Children {
+			markReachable(child, seen)
+		}
+	}
+}
+
+func releaseUnseen(node Node, seen map[Node]bool) {
+	if node == nil || seen[node] {
+		return
+	}
+	seen[node] = true
+	switch n := node.(type) {
+	case *ElementNode:
+		for _, child := range n.Children {
+			releaseUnseen(child, seen)
+		}
+		releaseElementNode(n)
+	case *TextNode:
+		releaseTextNode(n)
+	}
+}
@@ -0,0 +1,69 @@
+package go_xml
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+type typePlan struct {
+	root       reflect.Type
+	namespaces bool
+	generated  bool
+}
+
+var typePlans sync.Map
+
+func planFor(typ reflect.Type) *typePlan {
+	if cached, ok := typePlans.Load(typ); ok {
+		return cached.(*typePlan)
+	}
+
+	root := typ
+	for root.Kind() == reflect.Ptr {
+		root = root.Elem()
+	}
+	plan := &typePlan{
+		root:       root,
+		namespaces: usesNamespaces(typ),
+		generated:  typ.Implements(goXMLMarshalerType) && lookupHooks(root) == 0,
+	}
+	if root.Kind() == reflect.Struct {
+		GetFieldMetadata(root)
+	}
+	cached, _ := typePlans.LoadOrStore(typ, plan)
+	return cached.(*typePlan)
+}
+
+func MarshalTyped[T any](v T, opts *MarshalOptions) ([]byte, error) {
+	var plan *typePlan
+	if typ := reflect.TypeFor[T](); typ.Kind() != reflect.Interface {
+		plan = planFor(typ)
+	}
+	data, _, err := marshalPlanned(context.Background(), v, plan, opts)
+	return data, err
+}
+
+type TypedMarshaler[T any] struct {
+	opts *MarshalOptions
+	once sync.Once
+	plan *typePlan
+}
+
+func NewTypedMarshaler[T any](opts *MarshalOptions) *TypedMarshaler[T] {
+	return &TypedMarshaler[T]{opts: opts}
+}
+
+func (t *TypedMarshaler[T]) Marshal(v T) ([]byte, error) {
+	return t.MarshalContext(context.Background(), v)
+}
+
+func (t *TypedMarshaler[T]) MarshalContext(ctx context.Context, v T) ([]byte, error) {
+	t.once.Do(func() {
+		if typ := reflect.TypeFor[T](); typ.Kind() != reflect.Interface {
+			t.plan = planFor(typ)
+		}
+	})
+	data, _, err := marshalPlanned(ctx, v, t.plan, t.opts)
+	return data, err
+}
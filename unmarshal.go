@@ -0,0 +1,301 @@
+package go_xml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+func Unmarshal(data []byte, v interface{}) error {
+	return UnmarshalWithOptions(data, v, nil)
+}
+
+func UnmarshalWithOptions(data []byte, v interface{}, opts *UnmarshalOptions) error {
+	root, positions, err := parseDocument(data, opts, true)
+	if err != nil {
+		return err
+	}
+	defer releaseNode(root)
+
+	return unmarshalNode(root, v, opts, positions)
+}
+
+func UnmarshalNode(node *ElementNode, v interface{}) error {
+	return unmarshalNode(node, v, nil, nil)
+}
+
+func unmarshalNode(node *ElementNode, v interface{}, opts *UnmarshalOptions, positions []nodePosition) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return fmt.Errorf("Unmarshal requires a non-nil pointer, got %T", v)
+	}
+	if node == nil {
+		return ErrNilNode
+	}
+
+	u := &unmarshaler{
+		opts:      resolveUnmarshalOptions(opts),
+		path:      []string{val.Elem().Type().Name()},
+		root:      node,
+		positions: positions,
+	}
+	return u.decodeValue(node, val.Elem())
+}
+
+type unmarshaler struct {
+	opts      UnmarshalOptions
+	path      []string
+	root      *ElementNode
+	positions []nodePosition
+}
+
+func (u *unmarshaler) fieldPath() string {
+	return joinPath(u.path, "")
+}
+
+func (u *unmarshaler) decodeValue(node *ElementNode, val reflect.Value) error {
+	return u.locate(u.decodeNode(node, val), node, "")
+}
+
+func (u *unmarshaler) decodeNode(node *ElementNode, val reflect.Value) error {
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			val.Set(reflect.New(val.Type().Elem()))
+		}
+		val = val.Elem()
+	}
+
+	switch val.Kind() {
+	case reflect.Struct:
+		known := structKnownNames(val.Type())
+		if u.opts.DisallowUnknownElements || u.opts.DisallowUnknownAttributes {
+			if err := u.checkUnknown(node, known); err != nil {
+				return err
+			}
+		}
+		return u.decodeStruct(node, val, known)
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return u.setString(val, node.Text())
+		}
+		return &UnsupportedKindError{Kind: val.Kind(), Path: u.fieldPath()}
+	default:
+		return u.setString(val, node.Text())
+	}
+}
+
+func (u *unmarshaler) decodeStruct(node *ElementNode, val reflect.Value, known *knownNames) error {
+	fields := GetFieldMetadata(val.Type())
+	for i := range fields {
+		meta := &fields[i]
+		field := meta.FieldType
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		fieldValue := val.FieldByIndex(field.Index)
+
+		if field.Anonymous {
+			if err := u.decodeEmbedded(node, fieldValue, known); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if meta.XMLName {
+			fieldValue.Set(reflect.ValueOf(xml.Name{Local: node.Name}))
+			continue
+		}
+
+		u.path = append(u.path, field.Name)
+		var err error
+		if meta.Any {
+			err = u.decodeAny(node, fieldValue, meta, known)
+		} else {
+			err = u.decodeField(node, fieldValue, meta)
+		}
+		u.path = u.path[:len(u.path)-1]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *unmarshaler) decodeEmbedded(node *ElementNode, fieldValue reflect.Value, known *knownNames) error {
+	if fieldValue.Kind() == reflect.Ptr {
+		if fieldValue.Type().Elem().Kind() != reflect.Struct || !fieldValue.CanSet() {
+			return nil
+		}
+		if fieldValue.IsNil() {
+			fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
+		}
+		fieldValue = fieldValue.Elem()
+	}
+	if fieldValue.Kind() != reflect.Struct {
+		return nil
+	}
+	return u.decodeStruct(node, fieldValue, known)
+}
+
+func (u *unmarshaler) decodeField(node *ElementNode, fieldValue reflect.Value, meta *fieldMeta) error {
+	field := meta.FieldType
+	if meta.Attr {
+		if value, ok := node.Attribute(meta.Name); ok {
+			err := u.validateText(field, value)
+			if err == nil {
+				err = u.setString(fieldValue, value)
+			}
+			return u.locate(err, node, meta.Name)
+		}
+		return nil
+	}
+
+	if meta.CharData {
+		text := charDataText(node)
+		err := u.validateText(field, text)
+		if err == nil {
+			err = u.setString(fieldValue, text)
+		}
+		return u.locate(err, node, "")
+	}
+
+	if fieldValue.Type() == rawXMLType {
+		return nil
+	}
+
+	tags := meta.Tags
+	parent := node
+	for _, wrapper := range tags[:len(tags)-1] {
+		parent = firstChild(parent, wrapper)
+		if parent == nil {
+			return nil
+		}
+	}
+	name := tags[len(tags)-1]
+
+	if fieldValue.Kind() == reflect.Slice && fieldValue.Type().Elem().Kind() != reflect.Uint8 {
+		if len(tags) > 1 && fieldValue.IsNil() && meta.OmitNil {
+			fieldValue.Set(reflect.MakeSlice(fieldValue.Type(), 0, 0))
+		}
+		return u.decodeItems(parent, name, fieldValue, field)
+	}
+
+	child := firstChild(parent, name)
+	if child == nil {
+		return nil
+	}
+	if err := u.validateText(field, child.Text()); err != nil {
+		return u.locate(err, child, "")
+	}
+	return u.decodeValue(child, fieldValue)
+}
+
+func (u *unmarshaler) decodeItems(parent *ElementNode, name string, slice reflect.Value, field reflect.StructField) error {
+	items := reflect.MakeSlice(slice.Type(), 0, 0)
+	for _, child := range parent.ChildElements() {
+		if child.Name != name {
+			continue
+		}
+		item := reflect.New(slice.Type().Elem()).Elem()
+		u.path = append(u.path, indexSegment(items.Len()))
+		err := u.locate(u.validateText(field, child.Text()), child, "")
+		if err == nil {
+			err = u.decodeValue(child, item)
+		}
+		u.path = u.path[:len(u.path)-1]
+		if err != nil {
+			return err
+		}
+		items = reflect.Append(items, item)
+	}
+	if items.Len() > 0 {
+		slice.Set(items)
+	}
+	return nil
+}
+
+func firstChild(node *ElementNode, name string) *ElementNode {
+	for _, child := range node.Children {
+		if element, ok := child.(*ElementNode); ok && element.Name == name {
+			return element
+		}
+	}
+	return nil
+}
+
+func charDataText(node *ElementNode) string {
+	var sb strings.Builder
+	for _, child := range node.Children {
+		switch c := child.(type) {
+		case *TextNode:
+			sb.WriteString(c.Text)
+		case *CDataNode:
+			sb.WriteString(c.Text)
+		}
+	}
+	return sb.String()
+}
+
+func (u *unmarshaler) setString(val reflect.Value, text string) error {
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			val.Set(reflect.New(val.Type().Elem()))
+		}
+		val = val.Elem()
+	}
+
+	trimmed := strings.TrimSpace(text)
+	var err error
+	switch val.Kind() {
+	case reflect.String:
+		val.SetString(text)
+		return nil
+	case reflect.Slice:
+		if val.Type().Elem().Kind() != reflect.Uint8 {
+			return &UnsupportedKindError{Kind: val.Kind(), Path: u.fieldPath()}
+		}
+		val.SetBytes([]byte(text))
+		return nil
+	case reflect.Bool:
+		if trimmed == "" {
+			return nil
+		}
+		var b bool
+		if b, err = strconv.ParseBool(trimmed); err == nil {
+			val.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if trimmed == "" {
+			return nil
+		}
+		var i int64
+		if i, err = strconv.ParseInt(trimmed, 10, val.Type().Bits()); err == nil {
+			val.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if trimmed == "" {
+			return nil
+		}
+		var i uint64
+		if i, err = strconv.ParseUint(trimmed, 10, val.Type().Bits()); err == nil {
+			val.SetUint(i)
+		}
+	case reflect.Float32, reflect.Float64:
+		if trimmed == "" {
+			return nil
+		}
+		var f float64
+		if f, err = strconv.ParseFloat(trimmed, val.Type().Bits()); err == nil {
+			val.SetFloat(f)
+		}
+	default:
+		return &UnsupportedKindError{Kind: val.Kind(), Path: u.fieldPath()}
+	}
+
+	if err != nil {
+		return fmt.Errorf("error decoding %q at %s: %w", text, u.fieldPath(), err)
+	}
+	return nil
+}
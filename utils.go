@@ -3,6 +3,7 @@ package go_xml
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -13,40 +14,78 @@ func insertAttributeAtBeginning(attrs []Attribute, attr Attribute) []Attribute {
 	return newAttrs
 }
 
-func hasNonEmptyChildren(node *ElementNode) bool {
-	for _, child := range node.Children {
-		switch c := child.(type) {
-		case *ElementNode:
+func setAttribute(attrs []Attribute, attr Attribute) []Attribute {
+	for i := range attrs {
+		if attrs[i].Name == attr.Name {
+			attrs[i].Value = attr.Value
+			return attrs
+		}
+	}
+	return append(attrs, attr)
+}
+
+func hasAttribute(attrs []Attribute, name string) bool {
+	for _, attr := range attrs {
+		if attr.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+const escapedChars = "&<>\"'"
+
+func escapeEntity(c byte) string {
+	switch c {
+	case '&':
+		return "&amp;"
+	case '<':
+		return "&lt;"
+	case '>':
+		return "&gt;"
+	case '"':
+		return "&quot;"
+	case '\'':
+		return "&apos;"
+	}
+	return string(c)
+}
+
+func parseTag(field reflect.StructField) (string, []string) {
+	tagParts := strings.Split(field.Tag.Get("xml"), ",")
+	tagName := tagParts[0]
+	if tagName == "" {
+		tagName = field.Name
+	}
+
+	var tagOptions []string
+	if len(tagParts) > 1 {
+		tagOptions = tagParts[1:]
+	}
+	return tagName, tagOptions
+}
+
+func isNilValue(val reflect.Value) bool {
+	if !val.IsValid() {
+		return true
+	}
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
 			return true
-		case *TextNode:
-			if c.Text != "" {
-				return true
-			}
 		}
+		val = val.Elem()
 	}
 	return false
 }
 
-func escapeString(s string) string {
-	var buf strings.Builder
-	buf.Grow(len(s))
-	for _, c := range s {
-		switch c {
-		case '&':
-			buf.WriteString("&amp;")
-		case '<':
-			buf.WriteString("&lt;")
-		case '>':
-			buf.WriteString("&gt;")
-		case '"':
-			buf.WriteString("&quot;")
-		case '\'':
-			buf.WriteString("&apos;")
-		default:
-			buf.WriteRune(c)
+func embeddedStruct(val reflect.Value) (reflect.Value, bool) {
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return reflect.Value{}, false
 		}
+		val = val.Elem()
 	}
-	return buf.String()
+	return val, val.Kind() == reflect.Struct
 }
 
 func contains(options []string, opt string) bool {
@@ -76,6 +115,40 @@ func isEmptyValue(val reflect.Value) bool {
 	return false
 }
 
+func (m *marshaler) isEmpty(val reflect.Value) bool {
+	if m.opts.OmitEmptyStructs && val.Kind() == reflect.Struct {
+		return val.IsZero()
+	}
+	return isEmptyValue(val)
+}
+
+type isZeroer interface {
+	IsZero() bool
+}
+
+var isZeroerType = reflect.TypeOf((*isZeroer)(nil)).Elem()
+
+func isZeroValue(val reflect.Value) bool {
+	if !val.IsValid() {
+		return true
+	}
+	if (val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface) && val.IsNil() {
+		return true
+	}
+	if val.Type().Implements(isZeroerType) && val.CanInterface() {
+		return val.Interface().(isZeroer).IsZero()
+	}
+	if reflect.PtrTo(val.Type()).Implements(isZeroerType) && val.CanInterface() {
+		if !val.CanAddr() {
+			copied := reflect.New(val.Type()).Elem()
+			copied.Set(val)
+			val = copied
+		}
+		return val.Addr().Interface().(isZeroer).IsZero()
+	}
+	return val.IsZero()
+}
+
 func valueToString(val reflect.Value) string {
 	// Dereference pointer types
 	for val.Kind() == reflect.Ptr {
@@ -100,3 +173,30 @@ func valueToString(val reflect.Value) string {
 		return fmt.Sprintf("%v", val.Interface())
 	}
 }
+
+func (m *marshaler) valueString(val reflect.Value) string {
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return ""
+		}
+		val = val.Elem()
+	}
+	if format, ok := lookupDecimal(val.Type()); ok {
+		return format(val.Interface())
+	}
+	if m.opts.Deterministic {
+		switch val.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return normalizeFloat(val.Float())
+		}
+	}
+	return valueToString(val)
+}
+
+func normalizeFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 2, 64)
+	if s == "-0.00" {
+		return "0.00"
+	}
+	return s
+}
@@ -0,0 +1,180 @@
+package go_xml
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var constraintTags = []string{"enum", "min", "max", "pattern"}
+
+var patternCache sync.Map
+
+func hasConstraints(field reflect.StructField) bool {
+	for _, key := range constraintTags {
+		if _, ok := field.Tag.Lookup(key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func constraintType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) && typ.Elem().Kind() != reflect.Uint8 {
+		typ = typ.Elem()
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+	}
+	return typ
+}
+
+func isNumericType(typ reflect.Type) bool {
+	if _, ok := lookupDecimal(typ); ok {
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func fieldViolation(field reflect.StructField, value string) *ValidationError {
+	if allowed, ok := field.Tag.Lookup("enum"); ok && !enumAllows(allowed, value) {
+		return &ValidationError{
+			Constraint: "enum",
+			Detail:     fmt.Sprintf("%q is not one of %s", value, allowed),
+		}
+	}
+
+	numeric := isNumericType(constraintType(field.Type))
+	for _, key := range []string{"min", "max"} {
+		bound, ok := field.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		if err := checkBound(key, bound, value, numeric); err != nil {
+			return err
+		}
+	}
+
+	if pattern, ok := field.Tag.Lookup("pattern"); ok {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return &ValidationError{Constraint: "pattern", Detail: err.Error()}
+		}
+		if !re.MatchString(value) {
+			return &ValidationError{
+				Constraint: "pattern",
+				Detail:     fmt.Sprintf("%q does not match %s", value, pattern),
+			}
+		}
+	}
+	return nil
+}
+
+func enumAllows(allowed, value string) bool {
+	for _, option := range strings.Split(allowed, "|") {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
+
+func checkBound(key, bound, value string, numeric bool) *ValidationError {
+	limit, ok := new(big.Rat).SetString(bound)
+	if !ok {
+		return &ValidationError{Constraint: key, Detail: fmt.Sprintf("invalid bound %q", bound)}
+	}
+
+	var actual *big.Rat
+	subject := fmt.Sprintf("%q", value)
+	if numeric {
+		if actual, ok = new(big.Rat).SetString(strings.TrimSpace(value)); !ok {
+			return &ValidationError{Constraint: key, Detail: fmt.Sprintf("%q is not a number", value)}
+		}
+	} else {
+		length := utf8.RuneCountInString(value)
+		actual = new(big.Rat).SetInt64(int64(length))
+		subject = fmt.Sprintf("length %d of %q", length, value)
+	}
+
+	cmp := actual.Cmp(limit)
+	if key == "min" && cmp < 0 {
+		return &ValidationError{Constraint: key, Detail: fmt.Sprintf("%s is less than %s", subject, bound)}
+	}
+	if key == "max" && cmp > 0 {
+		return &ValidationError{Constraint: key, Detail: fmt.Sprintf("%s is greater than %s", subject, bound)}
+	}
+	return nil
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := patternCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	patternCache.Store(pattern, re)
+	return re, nil
+}
+
+func (m *marshaler) checkRequired(fieldValue reflect.Value, tagOptions []string, field string) error {
+	if !m.opts.Validate || !contains(tagOptions, "required") || !isEmptyValue(fieldValue) {
+		return nil
+	}
+	return &ValidationError{
+		Constraint: "required",
+		Detail:     "value is empty",
+		Path:       m.fieldPath(field),
+	}
+}
+
+func (m *marshaler) validateField(field reflect.StructField, fieldValue reflect.Value) error {
+	if !hasConstraints(field) || isNilValue(fieldValue) {
+		return nil
+	}
+	items := reflect.Indirect(fieldValue)
+	if (items.Kind() == reflect.Slice || items.Kind() == reflect.Array) && items.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < items.Len(); i++ {
+			item := items.Index(i)
+			if isNilValue(item) {
+				continue
+			}
+			if err := fieldViolation(field, m.valueString(item)); err != nil {
+				err.Path = m.fieldPath(indexSegment(i))
+				return err
+			}
+		}
+		return nil
+	}
+	if err := fieldViolation(field, m.valueString(fieldValue)); err != nil {
+		err.Path = m.fieldPath("")
+		return err
+	}
+	return nil
+}
+
+func (u *unmarshaler) validateText(field reflect.StructField, text string) error {
+	if !hasConstraints(field) {
+		return nil
+	}
+	if err := fieldViolation(field, strings.TrimSpace(text)); err != nil {
+		err.Path = u.fieldPath()
+		return err
+	}
+	return nil
+}
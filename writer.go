@@ -0,0 +1,144 @@
+package go_xml
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+type Writer struct {
+	bw      *bufio.Writer
+	closer  io.Closer
+	enc     *Encoder
+	opts    *MarshalOptions
+	started bool
+	done    bool
+	closed  bool
+	err     error
+}
+
+func NewWriter(w io.Writer, opts *MarshalOptions) *Writer {
+	if opts == nil {
+		opts = &MarshalOptions{}
+	}
+	bw := acquireBufferedWriter(w)
+	ew, closer, err := encodingWriter(bw, opts)
+	if err != nil {
+		return &Writer{bw: bw, enc: newDocumentEncoder(bw, opts), opts: opts, err: err}
+	}
+	return &Writer{bw: bw, closer: closer, enc: newDocumentEncoder(ew, opts), opts: opts}
+}
+
+func (w *Writer) fail(err error) error {
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return err
+}
+
+func (w *Writer) check() error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	return w.err
+}
+
+func (w *Writer) StartElement(name string, attrs ...Attribute) error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	if !isValidName(name) {
+		return w.fail(&InvalidNameError{Name: name})
+	}
+	for _, attr := range attrs {
+		if !isValidName(attr.Name) {
+			return w.fail(&InvalidNameError{Name: attr.Name, Path: name})
+		}
+	}
+	if w.done {
+		return w.fail(fmt.Errorf("multiple root elements: <%s> after the root was closed", name))
+	}
+	if !w.started {
+		w.started = true
+		if err := w.enc.writeProlog(w.opts); err != nil {
+			return w.fail(err)
+		}
+	}
+	return w.fail(w.enc.startElement(name, attrs))
+}
+
+func (w *Writer) Text(s string) error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	if w.enc.current() == nil {
+		return w.fail(fmt.Errorf("text outside the root element"))
+	}
+	return w.fail(w.enc.writeText(s))
+}
+
+func (w *Writer) CData(s string) error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	if w.enc.current() == nil {
+		return w.fail(fmt.Errorf("CDATA outside the root element"))
+	}
+	return w.fail(w.enc.writeCData(s))
+}
+
+func (w *Writer) Comment(s string) error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	return w.fail(w.enc.writeComment(s))
+}
+
+func (w *Writer) EndElement() error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	if w.enc.current() == nil {
+		return w.fail(fmt.Errorf("EndElement called with no open element"))
+	}
+	if err := w.enc.endElement(); err != nil {
+		return w.fail(err)
+	}
+	if w.enc.current() == nil {
+		w.done = true
+	}
+	return nil
+}
+
+func (w *Writer) Depth() int {
+	if w.enc == nil {
+		return 0
+	}
+	return len(w.enc.stack)
+}
+
+func (w *Writer) Flush() error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	return w.fail(w.bw.Flush())
+}
+
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	err := w.err
+	if err == nil {
+		if open := w.enc.current(); open != nil {
+			err = fmt.Errorf("unclosed element <%s>", open.name)
+		} else if err = w.closer.Close(); err == nil {
+			err = w.bw.Flush()
+		}
+	}
+	w.closed = true
+	releaseBufferedWriter(w.bw)
+	w.bw = nil
+	w.enc = nil
+	return err
+}
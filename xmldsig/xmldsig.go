@@ -0,0 +1,440 @@
+package xmldsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+const (
+	Namespace = "http://www.w3.org/2000/09/xmldsig#"
+
+	ExclusiveC14N      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	EnvelopedSignature = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+)
+
+var (
+	ErrSignatureNotFound  = errors.New("xmldsig: signature element not found")
+	ErrUnsupportedAlgo    = errors.New("xmldsig: unsupported algorithm")
+	ErrDigestMismatch     = errors.New("xmldsig: digest mismatch")
+	ErrInvalidSignature   = errors.New("xmldsig: invalid signature value")
+	ErrUnsupportedKeyType = errors.New("xmldsig: unsupported key type")
+)
+
+var digestMethods = map[crypto.Hash]string{
+	crypto.SHA1:   "http://www.w3.org/2000/09/xmldsig#sha1",
+	crypto.SHA256: "http://www.w3.org/2001/04/xmlenc#sha256",
+	crypto.SHA512: "http://www.w3.org/2001/04/xmlenc#sha512",
+}
+
+var rsaSignatureMethods = map[crypto.Hash]string{
+	crypto.SHA1:   "http://www.w3.org/2000/09/xmldsig#rsa-sha1",
+	crypto.SHA256: "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256",
+	crypto.SHA512: "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512",
+}
+
+var ecdsaSignatureMethods = map[crypto.Hash]string{
+	crypto.SHA1:   "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha1",
+	crypto.SHA256: "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256",
+	crypto.SHA512: "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512",
+}
+
+type SignOptions struct {
+	Hash        crypto.Hash
+	Prefix      string
+	Certificate *x509.Certificate
+}
+
+func Sign(doc []byte, key crypto.Signer, opts *SignOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &SignOptions{}
+	}
+	hash := opts.Hash
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
+	prefix := opts.Prefix
+	if prefix == "" {
+		prefix = "ds"
+	}
+
+	signatureMethod, err := signatureMethodFor(key.Public(), hash)
+	if err != nil {
+		return nil, err
+	}
+	digestMethod, ok := digestMethods[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: digest %v", ErrUnsupportedAlgo, hash)
+	}
+
+	root, err := go_xml.Parse(doc)
+	if err != nil {
+		return nil, err
+	}
+	canonical, err := go_xml.CanonicalizeNode(root, nil)
+	if err != nil {
+		return nil, err
+	}
+	digest := hashBytes(hash, canonical)
+
+	name := func(local string) string {
+		return prefix + ":" + local
+	}
+	algorithm := func(local, uri string) *go_xml.ElementNode {
+		return element(name(local), []go_xml.Attribute{{Name: "Algorithm", Value: uri}})
+	}
+
+	signedInfo := element(name("SignedInfo"), nil,
+		algorithm("CanonicalizationMethod", ExclusiveC14N),
+		algorithm("SignatureMethod", signatureMethod),
+		element(name("Reference"), []go_xml.Attribute{{Name: "URI", Value: ""}},
+			element(name("Transforms"), nil,
+				algorithm("Transform", EnvelopedSignature),
+				algorithm("Transform", ExclusiveC14N),
+			),
+			algorithm("DigestMethod", digestMethod),
+			textElement(name("DigestValue"), base64.StdEncoding.EncodeToString(digest)),
+		),
+	)
+
+	scope := map[string]string{}
+	for p, uri := range go_xml.NamespaceScope(root, nil) {
+		scope[p] = uri
+	}
+	scope[prefix] = Namespace
+	canonicalSignedInfo, err := go_xml.CanonicalizeNode(signedInfo, scope)
+	if err != nil {
+		return nil, err
+	}
+	signatureValue, err := signDigest(key, hash, hashBytes(hash, canonicalSignedInfo))
+	if err != nil {
+		return nil, err
+	}
+
+	signature := element(name("Signature"), []go_xml.Attribute{{Name: "xmlns:" + prefix, Value: Namespace}},
+		signedInfo,
+		textElement(name("SignatureValue"), base64.StdEncoding.EncodeToString(signatureValue)),
+	)
+	if opts.Certificate != nil {
+		signature.Children = append(signature.Children,
+			element(name("KeyInfo"), nil,
+				element(name("X509Data"), nil,
+					textElement(name("X509Certificate"), base64.StdEncoding.EncodeToString(opts.Certificate.Raw)),
+				),
+			),
+		)
+	}
+
+	encoded, err := go_xml.CanonicalizeNode(signature, go_xml.NamespaceScope(root, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return insertBeforeRootEnd(doc, root.Name, encoded)
+}
+
+func Verify(doc []byte, key crypto.PublicKey) error {
+	root, err := go_xml.Parse(doc)
+	if err != nil {
+		return err
+	}
+	rootScope := go_xml.NamespaceScope(root, nil)
+
+	signatureIndex := -1
+	var signature *go_xml.ElementNode
+	for i, child := range root.Children {
+		if element, ok := child.(*go_xml.ElementNode); ok && isDSig(element, rootScope, "Signature") {
+			if signature != nil {
+				return fmt.Errorf("xmldsig: multiple enveloped signatures")
+			}
+			signature, signatureIndex = element, i
+		}
+	}
+	if signature == nil {
+		return ErrSignatureNotFound
+	}
+
+	signatureScope := go_xml.NamespaceScope(signature, rootScope)
+	signedInfo := findChild(signature, signatureScope, "SignedInfo")
+	signatureValueNode := findChild(signature, signatureScope, "SignatureValue")
+	if signedInfo == nil || signatureValueNode == nil {
+		return fmt.Errorf("xmldsig: incomplete signature element")
+	}
+
+	signedInfoScope := go_xml.NamespaceScope(signedInfo, signatureScope)
+	if algorithmOf(findChild(signedInfo, signedInfoScope, "CanonicalizationMethod")) != ExclusiveC14N {
+		return fmt.Errorf("%w: canonicalization method", ErrUnsupportedAlgo)
+	}
+	hash, err := verifySignatureMethod(key, algorithmOf(findChild(signedInfo, signedInfoScope, "SignatureMethod")))
+	if err != nil {
+		return err
+	}
+
+	reference := findChild(signedInfo, signedInfoScope, "Reference")
+	if reference == nil || attribute(reference, "URI") != "" {
+		return fmt.Errorf("xmldsig: only whole-document references are supported")
+	}
+	referenceScope := go_xml.NamespaceScope(reference, signedInfoScope)
+	if err := checkTransforms(reference, referenceScope); err != nil {
+		return err
+	}
+	digestHash, err := digestHashFor(algorithmOf(findChild(reference, referenceScope, "DigestMethod")))
+	if err != nil {
+		return err
+	}
+	expectedDigest, err := decodeBase64(findChild(reference, referenceScope, "DigestValue"))
+	if err != nil {
+		return err
+	}
+
+	canonicalSignedInfo, err := go_xml.CanonicalizeNode(signedInfo, signatureScope)
+	if err != nil {
+		return err
+	}
+	signatureValue, err := decodeBase64(signatureValueNode)
+	if err != nil {
+		return err
+	}
+	if err := verifyDigest(key, hash, hashBytes(hash, canonicalSignedInfo), signatureValue); err != nil {
+		return err
+	}
+
+	children := root.Children
+	root.Children = append(append([]go_xml.Node{}, children[:signatureIndex]...), children[signatureIndex+1:]...)
+	canonical, err := go_xml.CanonicalizeNode(root, nil)
+	root.Children = children
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(hashBytes(digestHash, canonical), expectedDigest) {
+		return ErrDigestMismatch
+	}
+	return nil
+}
+
+func element(name string, attrs []go_xml.Attribute, children ...go_xml.Node) *go_xml.ElementNode {
+	return &go_xml.ElementNode{Name: name, Attributes: attrs, Children: children}
+}
+
+func textElement(name, text string) *go_xml.ElementNode {
+	return element(name, nil, &go_xml.TextNode{Text: text})
+}
+
+func insertBeforeRootEnd(doc []byte, rootName string, fragment []byte) ([]byte, error) {
+	trimmed := bytes.TrimRight(doc, " \t\r\n")
+	trailing := doc[len(trimmed):]
+	endTag := []byte("</" + rootName + ">")
+
+	out := make([]byte, 0, len(doc)+len(fragment)+len(endTag))
+	switch {
+	case bytes.HasSuffix(trimmed, endTag):
+		out = append(out, trimmed[:len(trimmed)-len(endTag)]...)
+	case bytes.HasSuffix(trimmed, []byte("/>")):
+		start := bytes.TrimRight(trimmed[:len(trimmed)-2], " \t\r\n")
+		out = append(append(out, start...), '>')
+	default:
+		return nil, fmt.Errorf("xmldsig: cannot locate the end of root element <%s>", rootName)
+	}
+
+	out = append(out, fragment...)
+	out = append(out, endTag...)
+	return append(out, trailing...), nil
+}
+
+func isDSig(node *go_xml.ElementNode, parentScope map[string]string, local string) bool {
+	prefix, name := "", node.Name
+	if i := strings.IndexByte(node.Name, ':'); i >= 0 {
+		prefix, name = node.Name[:i], node.Name[i+1:]
+	}
+	return name == local && go_xml.NamespaceScope(node, parentScope)[prefix] == Namespace
+}
+
+func findChild(parent *go_xml.ElementNode, scope map[string]string, local string) *go_xml.ElementNode {
+	if parent == nil {
+		return nil
+	}
+	for _, child := range parent.Children {
+		if element, ok := child.(*go_xml.ElementNode); ok && isDSig(element, scope, local) {
+			return element
+		}
+	}
+	return nil
+}
+
+func attribute(node *go_xml.ElementNode, name string) string {
+	for _, attr := range node.Attributes {
+		if attr.Name == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func algorithmOf(node *go_xml.ElementNode) string {
+	if node == nil {
+		return ""
+	}
+	return attribute(node, "Algorithm")
+}
+
+func textOf(node *go_xml.ElementNode) string {
+	var sb strings.Builder
+	for _, child := range node.Children {
+		if text, ok := child.(*go_xml.TextNode); ok {
+			sb.WriteString(text.Text)
+		}
+	}
+	return sb.String()
+}
+
+func decodeBase64(node *go_xml.ElementNode) ([]byte, error) {
+	if node == nil {
+		return nil, fmt.Errorf("xmldsig: missing base64 value")
+	}
+	compact := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, textOf(node))
+	return base64.StdEncoding.DecodeString(compact)
+}
+
+func checkTransforms(reference *go_xml.ElementNode, scope map[string]string) error {
+	transforms := findChild(reference, scope, "Transforms")
+	if transforms == nil {
+		return fmt.Errorf("xmldsig: enveloped-signature transform is required")
+	}
+
+	enveloped := false
+	transformsScope := go_xml.NamespaceScope(transforms, scope)
+	for _, child := range transforms.Children {
+		transform, ok := child.(*go_xml.ElementNode)
+		if !ok || !isDSig(transform, transformsScope, "Transform") {
+			continue
+		}
+		switch algorithmOf(transform) {
+		case EnvelopedSignature:
+			enveloped = true
+		case ExclusiveC14N:
+		default:
+			return fmt.Errorf("%w: transform %s", ErrUnsupportedAlgo, algorithmOf(transform))
+		}
+	}
+	if !enveloped {
+		return fmt.Errorf("xmldsig: enveloped-signature transform is required")
+	}
+	return nil
+}
+
+func hashBytes(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func digestHashFor(uri string) (crypto.Hash, error) {
+	for hash, method := range digestMethods {
+		if method == uri {
+			return hash, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: digest %s", ErrUnsupportedAlgo, uri)
+}
+
+func signatureMethodFor(public crypto.PublicKey, hash crypto.Hash) (string, error) {
+	var methods map[crypto.Hash]string
+	switch public.(type) {
+	case *rsa.PublicKey:
+		methods = rsaSignatureMethods
+	case *ecdsa.PublicKey:
+		methods = ecdsaSignatureMethods
+	default:
+		return "", ErrUnsupportedKeyType
+	}
+	method, ok := methods[hash]
+	if !ok {
+		return "", fmt.Errorf("%w: signature hash %v", ErrUnsupportedAlgo, hash)
+	}
+	return method, nil
+}
+
+func verifySignatureMethod(key crypto.PublicKey, uri string) (crypto.Hash, error) {
+	var methods map[crypto.Hash]string
+	switch key.(type) {
+	case *rsa.PublicKey:
+		methods = rsaSignatureMethods
+	case *ecdsa.PublicKey:
+		methods = ecdsaSignatureMethods
+	default:
+		return 0, ErrUnsupportedKeyType
+	}
+	for hash, method := range methods {
+		if method == uri {
+			return hash, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: signature method %s", ErrUnsupportedAlgo, uri)
+}
+
+func signDigest(key crypto.Signer, hash crypto.Hash, digest []byte) ([]byte, error) {
+	signature, err := key.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	public, ok := key.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return signature, nil
+	}
+
+	var parsed struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(signature, &parsed); err != nil {
+		return nil, err
+	}
+	size := (public.Curve.Params().BitSize + 7) / 8
+	out := make([]byte, 2*size)
+	parsed.R.FillBytes(out[:size])
+	parsed.S.FillBytes(out[size:])
+	return out, nil
+}
+
+func verifyDigest(key crypto.PublicKey, hash crypto.Hash, digest, signature []byte) error {
+	switch public := key.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(public, hash, digest, signature); err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(public, digest, r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return ErrUnsupportedKeyType
+}
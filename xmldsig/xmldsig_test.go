@@ -0,0 +1,99 @@
+package xmldsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+type assertion struct {
+	ID      string `xml:"ID,attr"`
+	Issuer  string `xml:"saml:Issuer"`
+	Subject string `xml:"saml:Subject"`
+	XMLNS   string `xml:"xmlns:saml,attr"`
+}
+
+func TestSignAndVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Key generation error: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Key generation error: %v", err)
+	}
+
+	doc, err := go_xml.Marshal(assertion{
+		ID:      "_abc123",
+		Issuer:  "https://idp.example.com",
+		Subject: "alice & bob",
+		XMLNS:   "urn:oasis:names:tc:SAML:2.0:assertion",
+	}, &go_xml.MarshalOptions{Indent: "  ", XMLHeader: true, RootTag: "saml:Assertion"})
+	if err != nil {
+		t.Fatalf("Serialization error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		signer crypto.Signer
+		opts   *SignOptions
+	}{
+		{name: "RSA SHA-256", signer: rsaKey},
+		{name: "RSA SHA-512 default prefix", signer: rsaKey, opts: &SignOptions{Hash: crypto.SHA512, Prefix: "dsig"}},
+		{name: "ECDSA P-256", signer: ecKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := Sign(doc, tt.signer, tt.opts)
+			if err != nil {
+				t.Fatalf("Sign error: %v", err)
+			}
+			if err := Verify(signed, tt.signer.Public()); err != nil {
+				t.Fatalf("Verify error: %v\n%s", err, signed)
+			}
+
+			tampered := bytes.Replace(signed, []byte("alice"), []byte("mallory"), 1)
+			if err := Verify(tampered, tt.signer.Public()); !errors.Is(err, ErrDigestMismatch) {
+				t.Fatalf("Expected digest mismatch, got %v", err)
+			}
+		})
+	}
+
+	t.Run("Wrong key", func(t *testing.T) {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("Key generation error: %v", err)
+		}
+		signed, err := Sign(doc, rsaKey, nil)
+		if err != nil {
+			t.Fatalf("Sign error: %v", err)
+		}
+		if err := Verify(signed, &otherKey.PublicKey); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("Expected invalid signature, got %v", err)
+		}
+	})
+
+	t.Run("Unsigned document", func(t *testing.T) {
+		if err := Verify(doc, &rsaKey.PublicKey); !errors.Is(err, ErrSignatureNotFound) {
+			t.Fatalf("Expected missing signature, got %v", err)
+		}
+	})
+
+	t.Run("Self-closing root", func(t *testing.T) {
+		signed, err := Sign([]byte(`<root id="1"/>`), rsaKey, nil)
+		if err != nil {
+			t.Fatalf("Sign error: %v", err)
+		}
+		if err := Verify(signed, &rsaKey.PublicKey); err != nil {
+			t.Fatalf("Verify error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package xmlhttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+const ContentType = "application/xml; charset=utf-8"
+
+var contentEncodings = map[string]string{
+	go_xml.CompressionGzip: "gzip",
+	go_xml.CompressionZlib: "deflate",
+}
+
+func WriteXML(w http.ResponseWriter, status int, v interface{}, opts *go_xml.MarshalOptions) error {
+	data, compressed, err := go_xml.MarshalCompressed(v, opts)
+	if err != nil {
+		return err
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", ContentType)
+	if compressed {
+		header.Set("Content-Encoding", contentEncoding(opts.CompressionAlgorithm))
+	}
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
+
+func WriteNegotiated(w http.ResponseWriter, r *http.Request, status int, v interface{}, opts *go_xml.MarshalOptions) error {
+	negotiated := go_xml.MarshalOptions{}
+	if opts != nil {
+		negotiated = *opts
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	algorithm := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	negotiated.Compress = algorithm != ""
+	negotiated.CompressionAlgorithm = algorithm
+
+	return WriteXML(w, status, v, &negotiated)
+}
+
+func contentEncoding(algorithm string) string {
+	if algorithm == "" {
+		algorithm = go_xml.CompressionGzip
+	}
+	if encoding, ok := contentEncodings[algorithm]; ok {
+		return encoding
+	}
+	return algorithm
+}
+
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, quality := parseCoding(part)
+		if coding != "" {
+			qualities[coding] = quality
+		}
+	}
+
+	qualityOf := func(coding string) float64 {
+		if quality, ok := qualities[coding]; ok {
+			return quality
+		}
+		return qualities["*"]
+	}
+
+	gzipQuality := qualityOf("gzip")
+	deflateQuality := qualityOf("deflate")
+
+	switch {
+	case gzipQuality > 0 && gzipQuality >= deflateQuality:
+		return go_xml.CompressionGzip
+	case deflateQuality > 0:
+		return go_xml.CompressionZlib
+	}
+	return ""
+}
+
+func parseCoding(part string) (string, float64) {
+	fields := strings.Split(part, ";")
+	coding := strings.ToLower(strings.TrimSpace(fields[0]))
+	quality := 1.0
+
+	for _, param := range fields[1:] {
+		param = strings.TrimSpace(param)
+		if !strings.HasPrefix(param, "q=") {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+		if err != nil {
+			return coding, 0
+		}
+		quality = parsed
+	}
+	return coding, quality
+}
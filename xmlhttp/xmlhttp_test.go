@@ -0,0 +1,138 @@
+package xmlhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+type payload struct {
+	ID   int    `xml:"id,attr"`
+	Text string `xml:"text"`
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{acceptEncoding: "", expected: ""},
+		{acceptEncoding: "gzip", expected: go_xml.CompressionGzip},
+		{acceptEncoding: "deflate, gzip;q=0.5", expected: go_xml.CompressionZlib},
+		{acceptEncoding: "gzip;q=0, deflate;q=0", expected: ""},
+		{acceptEncoding: "br, *;q=0.1", expected: go_xml.CompressionGzip},
+		{acceptEncoding: "gzip;q=0, *", expected: go_xml.CompressionZlib},
+		{acceptEncoding: "identity", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			if got := negotiateEncoding(tt.acceptEncoding); got != tt.expected {
+				t.Fatalf("Expected: %q, Got: %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestWriteNegotiated(t *testing.T) {
+	value := payload{ID: 1, Text: strings.Repeat("response body ", 100)}
+	expected, err := go_xml.Marshal(value, &go_xml.MarshalOptions{XMLHeader: true})
+	if err != nil {
+		t.Fatalf("Serialization error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		minSize        int
+		encoding       string
+		decode         func(io.Reader) (io.Reader, error)
+	}{
+		{
+			name:     "Identity",
+			encoding: "",
+		},
+		{
+			name:           "Gzip",
+			acceptEncoding: "gzip, deflate",
+			encoding:       "gzip",
+			decode: func(r io.Reader) (io.Reader, error) {
+				return gzip.NewReader(r)
+			},
+		},
+		{
+			name:           "Deflate",
+			acceptEncoding: "deflate",
+			encoding:       "deflate",
+			decode: func(r io.Reader) (io.Reader, error) {
+				return zlib.NewReader(r)
+			},
+		},
+		{
+			name:           "Below compression threshold",
+			acceptEncoding: "gzip",
+			minSize:        1 << 20,
+			encoding:       "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				request.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			recorder := httptest.NewRecorder()
+
+			opts := &go_xml.MarshalOptions{XMLHeader: true, CompressMinSize: tt.minSize}
+			if err := WriteNegotiated(recorder, request, http.StatusCreated, value, opts); err != nil {
+				t.Fatalf("Write error: %v", err)
+			}
+
+			if recorder.Code != http.StatusCreated {
+				t.Fatalf("Expected status %d, got %d", http.StatusCreated, recorder.Code)
+			}
+			if recorder.Header().Get("Content-Type") != ContentType {
+				t.Fatalf("Unexpected content type %q", recorder.Header().Get("Content-Type"))
+			}
+			if recorder.Header().Get("Vary") != "Accept-Encoding" {
+				t.Fatalf("Missing Vary header")
+			}
+			if got := recorder.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Expected Content-Encoding %q, got %q", tt.encoding, got)
+			}
+
+			var body io.Reader = recorder.Body
+			if tt.decode != nil {
+				body, err = tt.decode(recorder.Body)
+				if err != nil {
+					t.Fatalf("Decoder error: %v", err)
+				}
+			}
+			decoded, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("Read error: %v", err)
+			}
+			if !bytes.Equal(decoded, expected) {
+				t.Fatalf("Expected: %s, Got: %s", expected, decoded)
+			}
+		})
+	}
+}
+
+func TestWriteXMLError(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	if err := WriteXML(recorder, http.StatusOK, nil, nil); err == nil {
+		t.Fatalf("Expected serialization error")
+	}
+	if recorder.Body.Len() != 0 || recorder.Header().Get("Content-Type") != "" {
+		t.Fatalf("Response was written despite serialization error")
+	}
+}
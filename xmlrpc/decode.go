@@ -0,0 +1,272 @@
+package xmlrpc
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+var dateLayouts = []string{dateFormat, "2006-01-02T15:04:05Z07:00", "20060102T15:04:05Z07:00", "2006-01-02T15:04:05"}
+
+func UnmarshalCall(data []byte) (string, []interface{}, error) {
+	root, err := go_xml.Parse(data)
+	if err != nil {
+		return "", nil, err
+	}
+	if root.Name != "methodCall" {
+		return "", nil, fmt.Errorf("%w: expected methodCall, got %s", ErrInvalidPayload, root.Name)
+	}
+
+	method := root.Find("methodName")
+	if method == nil {
+		return "", nil, fmt.Errorf("%w: missing methodName", ErrInvalidPayload)
+	}
+	params, err := decodeParams(root)
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.TrimSpace(method.Text()), params, nil
+}
+
+func UnmarshalResponse(data []byte, v interface{}) error {
+	root, err := go_xml.Parse(data)
+	if err != nil {
+		return err
+	}
+	if root.Name != "methodResponse" {
+		return fmt.Errorf("%w: expected methodResponse, got %s", ErrInvalidPayload, root.Name)
+	}
+
+	if faultNode := firstElement(root, "fault"); faultNode != nil {
+		value := firstElement(faultNode, "value")
+		if value == nil {
+			return fmt.Errorf("%w: empty fault", ErrInvalidPayload)
+		}
+		decoded, err := decodeValue(value)
+		if err != nil {
+			return err
+		}
+		fault := &Fault{}
+		if err := Decode(decoded, fault); err != nil {
+			return err
+		}
+		return fault
+	}
+
+	params, err := decodeParams(root)
+	if err != nil {
+		return err
+	}
+	if len(params) != 1 {
+		return fmt.Errorf("%w: expected one response param, got %d", ErrInvalidPayload, len(params))
+	}
+	if v == nil {
+		return nil
+	}
+	return Decode(params[0], v)
+}
+
+func Decode(src interface{}, dst interface{}) error {
+	val := reflect.ValueOf(dst)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return fmt.Errorf("xmlrpc: Decode requires a non-nil pointer, got %T", dst)
+	}
+	return assign(val.Elem(), src)
+}
+
+func decodeParams(root *go_xml.ElementNode) ([]interface{}, error) {
+	paramsNode := firstElement(root, "params")
+	if paramsNode == nil {
+		return nil, nil
+	}
+
+	var params []interface{}
+	for _, param := range paramsNode.ChildElements() {
+		value := firstElement(param, "value")
+		if param.Name != "param" || value == nil {
+			return nil, fmt.Errorf("%w: malformed param", ErrInvalidPayload)
+		}
+		decoded, err := decodeValue(value)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, decoded)
+	}
+	return params, nil
+}
+
+func firstElement(node *go_xml.ElementNode, name string) *go_xml.ElementNode {
+	for _, child := range node.ChildElements() {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+func decodeValue(value *go_xml.ElementNode) (interface{}, error) {
+	children := value.ChildElements()
+	if len(children) == 0 {
+		return value.Text(), nil
+	}
+
+	node := children[0]
+	content := strings.TrimSpace(node.Text())
+	switch node.Name {
+	case "i4", "int", "i8":
+		i, err := strconv.ParseInt(content, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+		}
+		return int(i), nil
+	case "boolean":
+		switch content {
+		case "1", "true":
+			return true, nil
+		case "0", "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%w: invalid boolean %q", ErrInvalidPayload, content)
+	case "string":
+		return node.Text(), nil
+	case "double":
+		f, err := strconv.ParseFloat(content, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+		}
+		return f, nil
+	case "dateTime.iso8601":
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, content); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: invalid dateTime %q", ErrInvalidPayload, content)
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(content), ""))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+		}
+		return decoded, nil
+	case "nil":
+		return nil, nil
+	case "array":
+		items := []interface{}{}
+		data := firstElement(node, "data")
+		if data == nil {
+			return items, nil
+		}
+		for _, item := range data.ChildElements() {
+			decoded, err := decodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, decoded)
+		}
+		return items, nil
+	case "struct":
+		members := map[string]interface{}{}
+		for _, member := range node.ChildElements() {
+			name, value := firstElement(member, "name"), firstElement(member, "value")
+			if name == nil || value == nil {
+				return nil, fmt.Errorf("%w: malformed struct member", ErrInvalidPayload)
+			}
+			decoded, err := decodeValue(value)
+			if err != nil {
+				return nil, err
+			}
+			members[name.Text()] = decoded
+		}
+		return members, nil
+	}
+	return nil, fmt.Errorf("%w: unknown value type %s", ErrInvalidPayload, node.Name)
+}
+
+func assign(dst reflect.Value, src interface{}) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		dst.Set(reflect.ValueOf(src))
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(dst.Elem(), src)
+	}
+
+	switch s := src.(type) {
+	case map[string]interface{}:
+		return assignStruct(dst, s)
+	case []interface{}:
+		if dst.Kind() != reflect.Slice {
+			return fmt.Errorf("xmlrpc: cannot decode array into %s", dst.Type())
+		}
+		items := reflect.MakeSlice(dst.Type(), len(s), len(s))
+		for i, item := range s {
+			if err := assign(items.Index(i), item); err != nil {
+				return err
+			}
+		}
+		dst.Set(items)
+		return nil
+	}
+
+	srcVal := reflect.ValueOf(src)
+	if !compatible(srcVal.Kind(), dst.Kind()) || !srcVal.Type().ConvertibleTo(dst.Type()) {
+		return fmt.Errorf("xmlrpc: cannot decode %T into %s", src, dst.Type())
+	}
+	dst.Set(srcVal.Convert(dst.Type()))
+	return nil
+}
+
+func compatible(src, dst reflect.Kind) bool {
+	numeric := func(k reflect.Kind) bool {
+		return k >= reflect.Int && k <= reflect.Float64
+	}
+	if numeric(src) {
+		return numeric(dst)
+	}
+	return src == dst
+}
+
+func assignStruct(dst reflect.Value, members map[string]interface{}) error {
+	switch dst.Kind() {
+	case reflect.Map:
+		if dst.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("xmlrpc: cannot decode struct into %s", dst.Type())
+		}
+		out := reflect.MakeMapWithSize(dst.Type(), len(members))
+		for name, member := range members {
+			value := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(value, member); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(name).Convert(dst.Type().Key()), value)
+		}
+		dst.Set(out)
+		return nil
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			name, _, ok := memberName(dst.Type().Field(i))
+			if !ok {
+				continue
+			}
+			if member, found := members[name]; found {
+				if err := assign(dst.Field(i), member); err != nil {
+					return fmt.Errorf("member %s: %w", name, err)
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("xmlrpc: cannot decode struct into %s", dst.Type())
+}
@@ -0,0 +1,204 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+const (
+	header     = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"
+	dateFormat = "20060102T15:04:05"
+)
+
+var (
+	ErrInvalidPayload = errors.New("xmlrpc: invalid payload")
+
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+type Fault struct {
+	Code   int    `xmlrpc:"faultCode"`
+	String string `xmlrpc:"faultString"`
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("xmlrpc fault %d: %s", f.Code, f.String)
+}
+
+func MarshalCall(method string, params ...interface{}) ([]byte, error) {
+	root := element("methodCall", element("methodName", text(method)))
+	paramsNode, err := encodeParams(params)
+	if err != nil {
+		return nil, err
+	}
+	root.Children = append(root.Children, paramsNode)
+	return encodeDocument(root)
+}
+
+func MarshalResponse(value interface{}) ([]byte, error) {
+	paramsNode, err := encodeParams([]interface{}{value})
+	if err != nil {
+		return nil, err
+	}
+	return encodeDocument(element("methodResponse", paramsNode))
+}
+
+func MarshalFault(fault *Fault) ([]byte, error) {
+	value, err := encodeValue(reflect.ValueOf(fault))
+	if err != nil {
+		return nil, err
+	}
+	return encodeDocument(element("methodResponse", element("fault", value)))
+}
+
+func encodeDocument(root *go_xml.ElementNode) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	if err := root.Accept(go_xml.NewEncoder(&buf, nil, "", false)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeParams(params []interface{}) (*go_xml.ElementNode, error) {
+	node := element("params")
+	for i, param := range params {
+		value, err := encodeValue(reflect.ValueOf(param))
+		if err != nil {
+			return nil, fmt.Errorf("xmlrpc: param %d: %w", i, err)
+		}
+		node.Children = append(node.Children, element("param", value))
+	}
+	return node, nil
+}
+
+func element(name string, children ...go_xml.Node) *go_xml.ElementNode {
+	return &go_xml.ElementNode{Name: name, Children: children}
+}
+
+func text(s string) *go_xml.TextNode {
+	return &go_xml.TextNode{Text: s}
+}
+
+func typed(kind, s string) *go_xml.ElementNode {
+	return element("value", element(kind, text(s)))
+}
+
+func encodeValue(val reflect.Value) (*go_xml.ElementNode, error) {
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return element("value", element("nil")), nil
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() {
+		return element("value", element("nil")), nil
+	}
+
+	switch {
+	case val.Type() == timeType:
+		return typed("dateTime.iso8601", val.Interface().(time.Time).Format(dateFormat)), nil
+	case val.Type() == bytesType:
+		return typed("base64", base64.StdEncoding.EncodeToString(val.Bytes())), nil
+	}
+
+	switch val.Kind() {
+	case reflect.Bool:
+		if val.Bool() {
+			return typed("boolean", "1"), nil
+		}
+		return typed("boolean", "0"), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encodeInt(val.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if val.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("integer %d overflows i8", val.Uint())
+		}
+		return encodeInt(int64(val.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return typed("double", strconv.FormatFloat(val.Float(), 'f', -1, 64)), nil
+	case reflect.String:
+		return typed("string", val.String()), nil
+	case reflect.Slice, reflect.Array:
+		data := element("data")
+		for i := 0; i < val.Len(); i++ {
+			item, err := encodeValue(val.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			data.Children = append(data.Children, item)
+		}
+		return element("value", element("array", data)), nil
+	case reflect.Map:
+		if val.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map keys must be strings, got %s", val.Type().Key())
+		}
+		keys := val.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		members := element("struct")
+		for _, key := range keys {
+			member, err := encodeMember(key.String(), val.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			members.Children = append(members.Children, member)
+		}
+		return element("value", members), nil
+	case reflect.Struct:
+		members := element("struct")
+		for i := 0; i < val.NumField(); i++ {
+			name, omitEmpty, ok := memberName(val.Type().Field(i))
+			if !ok || (omitEmpty && val.Field(i).IsZero()) {
+				continue
+			}
+			member, err := encodeMember(name, val.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			members.Children = append(members.Children, member)
+		}
+		return element("value", members), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", val.Type())
+}
+
+func encodeInt(i int64) *go_xml.ElementNode {
+	if i < math.MinInt32 || i > math.MaxInt32 {
+		return typed("i8", strconv.FormatInt(i, 10))
+	}
+	return typed("int", strconv.FormatInt(i, 10))
+}
+
+func encodeMember(name string, val reflect.Value) (*go_xml.ElementNode, error) {
+	value, err := encodeValue(val)
+	if err != nil {
+		return nil, fmt.Errorf("member %s: %w", name, err)
+	}
+	return element("member", element("name", text(name)), value), nil
+}
+
+func memberName(field reflect.StructField) (string, bool, bool) {
+	if !field.IsExported() {
+		return "", false, false
+	}
+	tag := field.Tag.Get("xmlrpc")
+	if tag == "-" {
+		return "", false, false
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, options == "omitempty", true
+}
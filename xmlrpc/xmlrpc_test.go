@@ -0,0 +1,107 @@
+package xmlrpc
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type account struct {
+	ID      int       `xmlrpc:"id"`
+	Name    string    `xmlrpc:"name"`
+	Active  bool      `xmlrpc:"active"`
+	Balance float64   `xmlrpc:"balance"`
+	Created time.Time `xmlrpc:"created"`
+	Avatar  []byte    `xmlrpc:"avatar,omitempty"`
+	Tags    []string  `xmlrpc:"tags"`
+	secret  string
+}
+
+func TestMarshalCall(t *testing.T) {
+	output, err := MarshalCall("examples.getStateName", 41, "x<y")
+	if err != nil {
+		t.Fatalf("MarshalCall error: %v", err)
+	}
+	expected := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<methodCall>\n<methodName>examples.getStateName</methodName>\n<params>\n<param>\n<value>\n<int>41</int>\n</value>\n</param>\n<param>\n<value>\n<string>x&lt;y</string>\n</value>\n</param>\n</params>\n</methodCall>"
+	if string(output) != expected {
+		t.Errorf("Output mismatch.\nExpected: %q\nGot: %q", expected, output)
+	}
+
+	method, params, err := UnmarshalCall(output)
+	if err != nil {
+		t.Fatalf("UnmarshalCall error: %v", err)
+	}
+	if method != "examples.getStateName" || !reflect.DeepEqual(params, []interface{}{41, "x<y"}) {
+		t.Errorf("Decoded %s %#v", method, params)
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 17, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value interface{}
+		into  func() interface{}
+	}{
+		{
+			name: "Struct",
+			value: account{
+				ID: 7, Name: "Alice", Active: true, Balance: 12.5,
+				Created: created, Avatar: []byte{0, 1, 2}, Tags: []string{"a", "b"},
+			},
+			into: func() interface{} { return &account{} },
+		},
+		{
+			name:  "Map of arrays",
+			value: map[string][]int{"primes": {2, 3, 5, 1 << 40}},
+			into:  func() interface{} { return &map[string][]int{} },
+		},
+		{
+			name:  "Generic value",
+			value: []interface{}{int(1), "two", 3.5, false, nil},
+			into:  func() interface{} { return new(interface{}) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := MarshalResponse(tt.value)
+			if err != nil {
+				t.Fatalf("MarshalResponse error: %v", err)
+			}
+			decoded := tt.into()
+			if err := UnmarshalResponse(output, decoded); err != nil {
+				t.Fatalf("UnmarshalResponse error: %v\n%s", err, output)
+			}
+			if got := reflect.ValueOf(decoded).Elem().Interface(); !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("Expected %#v, got %#v", tt.value, got)
+			}
+		})
+	}
+}
+
+func TestFault(t *testing.T) {
+	output, err := MarshalFault(&Fault{Code: 4, String: "Too many parameters."})
+	if err != nil {
+		t.Fatalf("MarshalFault error: %v", err)
+	}
+	if !strings.Contains(string(output), "<name>faultCode</name>") {
+		t.Errorf("Fault members missing: %s", output)
+	}
+
+	var result string
+	err = UnmarshalResponse(output, &result)
+	var fault *Fault
+	if !errors.As(err, &fault) || fault.Code != 4 || fault.String != "Too many parameters." {
+		t.Fatalf("Expected fault, got %v", err)
+	}
+
+	if err := UnmarshalResponse([]byte(`<methodResponse><params><param><value><int>x</int></value></param></params></methodResponse>`), &result); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("Expected ErrInvalidPayload, got %v", err)
+	}
+	if err := UnmarshalResponse([]byte(`<methodResponse><params><param><value><int>1</int></value></param></params></methodResponse>`), &result); err == nil {
+		t.Errorf("Expected a type mismatch error")
+	}
+}
@@ -0,0 +1,55 @@
+package xmltest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+const UpdateEnv = "XMLTEST_UPDATE"
+
+var GoldenDir = "testdata"
+
+func GoldenFile(name string) string {
+	return filepath.Join(GoldenDir, filepath.FromSlash(name)+".golden")
+}
+
+func AssertGolden[A Document](t testing.TB, name string, actual A) bool {
+	t.Helper()
+
+	path := GoldenFile(name)
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Errorf("xmltest: %v", err)
+			return false
+		}
+		if err := os.WriteFile(path, []byte(actual), 0o644); err != nil {
+			t.Errorf("xmltest: %v", err)
+			return false
+		}
+		return true
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("xmltest: %v (run with %s=1 to create it)", err, UpdateEnv)
+		return false
+	}
+	return AssertEqual(t, expected, actual)
+}
+
+func AssertSnapshot(t testing.TB, name string, v interface{}, opts *go_xml.MarshalOptions) bool {
+	t.Helper()
+
+	if opts == nil {
+		opts = &go_xml.MarshalOptions{Indent: "  "}
+	}
+	output, err := go_xml.Marshal(v, opts)
+	if err != nil {
+		t.Errorf("xmltest: %v", err)
+		return false
+	}
+	return AssertGolden(t, name, output)
+}
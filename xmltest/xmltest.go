@@ -0,0 +1,70 @@
+package xmltest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+type Document interface {
+	~string | ~[]byte
+}
+
+func Equal[E, A Document](expected E, actual A, opts *go_xml.DiffOptions) ([]go_xml.Difference, error) {
+	return go_xml.Diff([]byte(expected), []byte(actual), opts)
+}
+
+func AssertEqual[E, A Document](t testing.TB, expected E, actual A) bool {
+	t.Helper()
+	return AssertEqualWith(t, expected, actual, nil)
+}
+
+func AssertEqualWith[E, A Document](t testing.TB, expected E, actual A, opts *go_xml.DiffOptions) bool {
+	t.Helper()
+
+	diffs, err := Equal(expected, actual, opts)
+	if err != nil {
+		t.Errorf("xmltest: %v", err)
+		return false
+	}
+	if len(diffs) == 0 {
+		return true
+	}
+
+	var sb strings.Builder
+	sb.WriteString("XML documents differ:")
+	for _, diff := range diffs {
+		sb.WriteString("\n  ")
+		sb.WriteString(diff.String())
+	}
+	t.Error(sb.String())
+	return false
+}
+
+func CanonicalEqual[E, A Document](expected E, actual A) (bool, error) {
+	left, err := go_xml.Canonicalize([]byte(expected))
+	if err != nil {
+		return false, err
+	}
+	right, err := go_xml.Canonicalize([]byte(actual))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(left, right), nil
+}
+
+func AssertCanonicalEqual[E, A Document](t testing.TB, expected E, actual A) bool {
+	t.Helper()
+
+	equal, err := CanonicalEqual(expected, actual)
+	if err != nil {
+		t.Errorf("xmltest: %v", err)
+		return false
+	}
+	if !equal {
+		t.Errorf("XML documents are not canonically equal:\nexpected: %s\nactual:   %s", expected, actual)
+	}
+	return equal
+}
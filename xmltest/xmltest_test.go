@@ -0,0 +1,118 @@
+package xmltest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Error(args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprint(args...))
+}
+
+func TestAssertEqual(t *testing.T) {
+	type Item struct {
+		SKU  string `xml:"sku,attr"`
+		Name string `xml:"name"`
+	}
+
+	output, err := go_xml.Marshal(Item{SKU: "A", Name: "Widget"}, &go_xml.MarshalOptions{Indent: "\t"})
+	if err != nil {
+		t.Fatalf("Serialization error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+		failure  string
+	}{
+		{
+			name:     "Whitespace and attribute order ignored",
+			expected: `<Item  sku="A" ><name>Widget</name></Item>`,
+		},
+		{
+			name:     "Changed text reported",
+			expected: `<Item sku="A"><name>Gadget</name></Item>`,
+			failure:  `changed /Item/name[1]/text(): "Gadget" != "Widget"`,
+		},
+		{
+			name:     "Malformed document reported",
+			expected: `<Item>`,
+			failure:  "xmltest:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{TB: t}
+			ok := AssertEqual(r, tt.expected, output)
+			if tt.failure == "" {
+				if !ok || len(r.errors) > 0 {
+					t.Fatalf("Unexpected failure: %v", r.errors)
+				}
+				return
+			}
+			if ok || len(r.errors) != 1 || !strings.Contains(r.errors[0], tt.failure) {
+				t.Fatalf("Expected failure containing %q, got %v", tt.failure, r.errors)
+			}
+		})
+	}
+}
+
+func TestAssertCanonicalEqual(t *testing.T) {
+	r := &recorder{TB: t}
+	if !AssertCanonicalEqual(r, `<a y="2" x="1"><b/></a>`, []byte(`<a x="1" y="2"><b></b></a>`)) {
+		t.Fatalf("Expected canonical equality, got %v", r.errors)
+	}
+	if AssertCanonicalEqual(r, `<a><b/></a>`, `<a> <b/></a>`) || len(r.errors) != 1 {
+		t.Fatalf("Expected whitespace to matter canonically, got %v", r.errors)
+	}
+}
+
+func TestAssertSnapshot(t *testing.T) {
+	type Order struct {
+		ID    int      `xml:"id,attr"`
+		Items []string `xml:"items>item"`
+	}
+
+	GoldenDir = t.TempDir()
+	defer func() { GoldenDir = "testdata" }()
+
+	order := Order{ID: 1, Items: []string{"a", "b"}}
+
+	r := &recorder{TB: t}
+	if AssertSnapshot(r, "orders/basic", order, nil) || len(r.errors) != 1 {
+		t.Fatalf("Expected missing golden file failure, got %v", r.errors)
+	}
+
+	t.Setenv(UpdateEnv, "1")
+	r = &recorder{TB: t}
+	if !AssertSnapshot(r, "orders/basic", order, nil) {
+		t.Fatalf("Expected golden file to be written, got %v", r.errors)
+	}
+
+	t.Setenv(UpdateEnv, "")
+	r = &recorder{TB: t}
+	if !AssertSnapshot(r, "orders/basic", order, &go_xml.MarshalOptions{}) {
+		t.Fatalf("Expected snapshot to match regardless of indentation, got %v", r.errors)
+	}
+
+	order.Items = order.Items[:1]
+	r = &recorder{TB: t}
+	if AssertSnapshot(r, "orders/basic", order, nil) || len(r.errors) != 1 || !strings.Contains(r.errors[0], "removed /Order/items[1]/item[2]") {
+		t.Fatalf("Expected snapshot diff, got %v", r.errors)
+	}
+}
@@ -0,0 +1,267 @@
+package go_xml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type XPath struct {
+	expr     string
+	absolute bool
+	parents  bool
+	steps    []xpathStep
+}
+
+type xpathStep struct {
+	descendant bool
+	name       string
+	predicates []xpathPredicate
+}
+
+type xpathPredicate struct {
+	position int
+	last     bool
+	attr     string
+	hasValue bool
+	value    string
+}
+
+func CompileXPath(expr string) (*XPath, error) {
+	p := &XPath{expr: expr}
+	rest := strings.TrimSpace(expr)
+	if rest == "" {
+		return nil, fmt.Errorf("empty XPath expression")
+	}
+
+	if strings.HasPrefix(rest, "/") {
+		p.absolute = true
+	}
+	descendant := false
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			descendant = true
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "/"):
+			rest = rest[1:]
+		}
+
+		step, remaining, err := parseXPathStep(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid XPath %q: %w", expr, err)
+		}
+		step.descendant = descendant
+		p.parents = p.parents || step.name == ".."
+		p.steps = append(p.steps, step)
+		descendant = false
+		rest = remaining
+	}
+	return p, nil
+}
+
+func MustCompileXPath(expr string) *XPath {
+	p, err := CompileXPath(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func parseXPathStep(s string) (xpathStep, string, error) {
+	end := strings.IndexAny(s, "/[")
+	if end < 0 {
+		end = len(s)
+	}
+	step := xpathStep{name: strings.TrimSpace(s[:end])}
+	if step.name == "" {
+		return step, "", fmt.Errorf("missing step name")
+	}
+	if step.name != "*" && step.name != "." && step.name != ".." && !isValidName(step.name) {
+		return step, "", fmt.Errorf("invalid step name %q", step.name)
+	}
+	s = s[end:]
+
+	for strings.HasPrefix(s, "[") {
+		closing := predicateEnd(s)
+		if closing < 0 {
+			return step, "", fmt.Errorf("unterminated predicate")
+		}
+		predicate, err := parseXPathPredicate(strings.TrimSpace(s[1:closing]))
+		if err != nil {
+			return step, "", err
+		}
+		step.predicates = append(step.predicates, predicate)
+		s = s[closing+1:]
+	}
+
+	if s != "" && !strings.HasPrefix(s, "/") {
+		return step, "", fmt.Errorf("unexpected %q", s)
+	}
+	return step, s, nil
+}
+
+func predicateEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseXPathPredicate(s string) (xpathPredicate, error) {
+	var predicate xpathPredicate
+	switch {
+	case s == "last()":
+		predicate.last = true
+	case strings.HasPrefix(s, "@"):
+		name, value, hasValue := strings.Cut(s[1:], "=")
+		predicate.attr = strings.TrimSpace(name)
+		if !isValidName(predicate.attr) {
+			return predicate, fmt.Errorf("invalid attribute name %q", predicate.attr)
+		}
+		if hasValue {
+			value = strings.TrimSpace(value)
+			if len(value) < 2 || (value[0] != '\'' && value[0] != '"') || value[len(value)-1] != value[0] {
+				return predicate, fmt.Errorf("attribute value must be a quoted literal: %s", value)
+			}
+			predicate.hasValue = true
+			predicate.value = value[1 : len(value)-1]
+		}
+	default:
+		position, err := strconv.Atoi(s)
+		if err != nil || position < 1 {
+			return predicate, fmt.Errorf("unsupported predicate [%s]", s)
+		}
+		predicate.position = position
+	}
+	return predicate, nil
+}
+
+func (p *XPath) String() string {
+	return p.expr
+}
+
+func (p *XPath) Select(node *ElementNode) []*ElementNode {
+	if node == nil {
+		return nil
+	}
+
+	context := []*ElementNode{node}
+	if p.absolute {
+		context = []*ElementNode{{Children: []Node{node}}}
+	}
+	var parents map[*ElementNode]*ElementNode
+	if p.parents {
+		parents = map[*ElementNode]*ElementNode{}
+		indexParents(context[0], parents)
+	}
+
+	for _, step := range p.steps {
+		context = step.apply(context, parents)
+		if len(context) == 0 {
+			return nil
+		}
+	}
+	return context
+}
+
+func (p *XPath) SelectFirst(node *ElementNode) *ElementNode {
+	if matches := p.Select(node); len(matches) > 0 {
+		return matches[0]
+	}
+	return nil
+}
+
+func (n *ElementNode) Query(expr string) ([]*ElementNode, error) {
+	p, err := CompileXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Select(n), nil
+}
+
+func indexParents(node *ElementNode, parents map[*ElementNode]*ElementNode) {
+	for _, child := range node.ChildElements() {
+		parents[child] = node
+		indexParents(child, parents)
+	}
+}
+
+func (s xpathStep) apply(context []*ElementNode, parents map[*ElementNode]*ElementNode) []*ElementNode {
+	if s.descendant {
+		var expanded []*ElementNode
+		for _, node := range context {
+			expanded = append(expanded, node)
+			node.Walk(func(element *ElementNode) bool {
+				expanded = append(expanded, element)
+				return true
+			})
+		}
+		context = expanded
+	}
+
+	seen := map[*ElementNode]bool{}
+	var result []*ElementNode
+	for _, node := range context {
+		var candidates []*ElementNode
+		switch s.name {
+		case ".":
+			candidates = []*ElementNode{node}
+		case "..":
+			if parent := parents[node]; parent != nil {
+				candidates = []*ElementNode{parent}
+			}
+		default:
+			for _, child := range node.ChildElements() {
+				if s.name == "*" || child.Name == s.name {
+					candidates = append(candidates, child)
+				}
+			}
+		}
+
+		for _, predicate := range s.predicates {
+			candidates = predicate.filter(candidates)
+		}
+		for _, candidate := range candidates {
+			if !seen[candidate] {
+				seen[candidate] = true
+				result = append(result, candidate)
+			}
+		}
+	}
+	return result
+}
+
+func (p xpathPredicate) filter(nodes []*ElementNode) []*ElementNode {
+	switch {
+	case p.last:
+		if len(nodes) == 0 {
+			return nil
+		}
+		return nodes[len(nodes)-1:]
+	case p.position > 0:
+		if p.position > len(nodes) {
+			return nil
+		}
+		return nodes[p.position-1 : p.position]
+	}
+
+	var matched []*ElementNode
+	for _, node := range nodes {
+		value, ok := node.Attribute(p.attr)
+		if ok && (!p.hasValue || value == p.value) {
+			matched = append(matched, node)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,302 @@
+package go_xml
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const xsdNamespace = "http://www.w3.org/2001/XMLSchema"
+
+type xsdGenerator struct {
+	typeNames map[reflect.Type]string
+	usedNames map[string]bool
+	pending   []reflect.Type
+}
+
+func GenerateXSD(v interface{}, opts *MarshalOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &MarshalOptions{}
+	}
+
+	typ := reflect.TypeOf(v)
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil {
+		return nil, fmt.Errorf("GenerateXSD requires a struct: %w", ErrNilNode)
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("GenerateXSD requires a struct: %w", &UnsupportedKindError{Kind: typ.Kind()})
+	}
+
+	rootTag := opts.RootTag
+	if rootTag == "" {
+		rootTag = typ.Name()
+	}
+
+	g := &xsdGenerator{
+		typeNames: make(map[reflect.Type]string),
+		usedNames: make(map[string]bool),
+	}
+
+	schema := xsdNode("schema", "xmlns:xs", xsdNamespace, "elementFormDefault", "qualified")
+	if opts.Namespace != "" {
+		schema.Attributes = append(schema.Attributes,
+			Attribute{Name: "targetNamespace", Value: opts.Namespace},
+			Attribute{Name: "xmlns", Value: opts.Namespace},
+		)
+	}
+	schema.Children = append(schema.Children, xsdNode("element", "name", rootTag, "type", g.complexTypeName(typ)))
+
+	for len(g.pending) > 0 {
+		next := g.pending[0]
+		g.pending = g.pending[1:]
+		schema.Children = append(schema.Children, g.complexType(next))
+	}
+
+	indent := opts.Indent
+	if indent == "" {
+		indent = "  "
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xmlHeader)
+	buf.WriteString("\n")
+	encoder := NewEncoder(&buf, []string{"xs:element", "xs:attribute", "xs:complexType", "xs:any", "xs:anyAttribute"}, indent, opts.SpacedSelfClose)
+	if err := schema.Accept(encoder); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func xsdNode(name string, attrs ...string) *ElementNode {
+	node := acquireElementNode()
+	node.Name = "xs:" + name
+	for i := 0; i+1 < len(attrs); i += 2 {
+		node.Attributes = append(node.Attributes, Attribute{Name: attrs[i], Value: attrs[i+1]})
+	}
+	return node
+}
+
+func (g *xsdGenerator) complexTypeName(typ reflect.Type) string {
+	if name, ok := g.typeNames[typ]; ok {
+		return name
+	}
+
+	base := typ.Name()
+	if base == "" {
+		base = "AnonymousType"
+	}
+	name := base
+	for i := 2; g.usedNames[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+
+	g.typeNames[typ] = name
+	g.usedNames[name] = true
+	g.pending = append(g.pending, typ)
+	return name
+}
+
+func (g *xsdGenerator) complexType(typ reflect.Type) *ElementNode {
+	complexType := xsdNode("complexType", "name", g.typeNames[typ])
+	sequence := xsdNode("sequence")
+
+	attributes := g.collectFields(typ, sequence, nil)
+
+	if len(sequence.Children) > 0 {
+		complexType.Children = append(complexType.Children, sequence)
+	} else {
+		releaseElementNode(sequence)
+	}
+	for _, attribute := range attributes {
+		if attribute.(*ElementNode).Name != "xs:anyAttribute" {
+			complexType.Children = append(complexType.Children, attribute)
+		}
+	}
+	for _, attribute := range attributes {
+		if attribute.(*ElementNode).Name == "xs:anyAttribute" {
+			complexType.Children = append(complexType.Children, attribute)
+		}
+	}
+	return complexType
+}
+
+func (g *xsdGenerator) collectFields(typ reflect.Type, sequence *ElementNode, attributes []Node) []Node {
+	fields := GetFieldMetadata(typ)
+	for i := range fields {
+		meta := &fields[i]
+		field := meta.FieldType
+
+		if field.Anonymous {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				attributes = g.collectFields(embedded, sequence, attributes)
+			}
+			continue
+		}
+
+		if meta.XMLName || meta.CharData {
+			continue
+		}
+
+		if meta.Any {
+			if meta.Attr {
+				attributes = append(attributes, xsdNode("anyAttribute", "processContents", "lax"))
+			} else {
+				sequence.Children = append(sequence.Children, xsdNode("any", "processContents", "lax", "minOccurs", "0", "maxOccurs", "unbounded"))
+			}
+			continue
+		}
+
+		if meta.Attr {
+			attribute := xsdNode("attribute", "name", meta.Name, "type", xsdSimpleType(field.Type), "use", "required")
+			attributes = append(attributes, withFacets(attribute, field))
+			continue
+		}
+
+		sequence.Children = append(sequence.Children, g.fieldElement(field, meta.Name, meta.Options))
+	}
+	return attributes
+}
+
+func (g *xsdGenerator) fieldElement(field reflect.StructField, tagName string, tagOptions []string) *ElementNode {
+	optional := contains(tagOptions, "omitempty") || field.Type.Kind() == reflect.Ptr || field.Type.Kind() == reflect.Interface
+	path := strings.Split(tagName, ">")
+
+	leafType := field.Type
+	repeated := false
+	if leafType.Kind() == reflect.Slice || leafType.Kind() == reflect.Array {
+		leafType = leafType.Elem()
+		repeated = true
+	}
+
+	leaf := withFacets(xsdNode("element", "name", path[len(path)-1], "type", g.typeRef(leafType)), field)
+	if repeated {
+		leaf.Attributes = append(leaf.Attributes,
+			Attribute{Name: "minOccurs", Value: "0"},
+			Attribute{Name: "maxOccurs", Value: "unbounded"},
+		)
+	} else if optional || leafType.Kind() == reflect.Ptr {
+		leaf.Attributes = append(leaf.Attributes, Attribute{Name: "minOccurs", Value: "0"})
+	}
+
+	element := leaf
+	for i := len(path) - 2; i >= 0; i-- {
+		sequence := xsdNode("sequence")
+		sequence.Children = append(sequence.Children, element)
+		complexType := xsdNode("complexType")
+		complexType.Children = append(complexType.Children, sequence)
+
+		wrapper := xsdNode("element", "name", path[i])
+		if i == 0 && optional {
+			wrapper.Attributes = append(wrapper.Attributes, Attribute{Name: "minOccurs", Value: "0"})
+		}
+		wrapper.Children = append(wrapper.Children, complexType)
+		element = wrapper
+	}
+	return element
+}
+
+func withFacets(node *ElementNode, field reflect.StructField) *ElementNode {
+	if !hasConstraints(field) {
+		return node
+	}
+	base := node.Attributes[1].Value
+	if !strings.HasPrefix(base, "xs:") {
+		return node
+	}
+
+	restriction := xsdNode("restriction", "base", base)
+	if allowed, ok := field.Tag.Lookup("enum"); ok {
+		for _, option := range strings.Split(allowed, "|") {
+			restriction.Children = append(restriction.Children, xsdNode("enumeration", "value", option))
+		}
+	}
+	numeric := isNumericType(constraintType(field.Type))
+	if bound, ok := field.Tag.Lookup("min"); ok {
+		facet := "minLength"
+		if numeric {
+			facet = "minInclusive"
+		}
+		restriction.Children = append(restriction.Children, xsdNode(facet, "value", bound))
+	}
+	if bound, ok := field.Tag.Lookup("max"); ok {
+		facet := "maxLength"
+		if numeric {
+			facet = "maxInclusive"
+		}
+		restriction.Children = append(restriction.Children, xsdNode(facet, "value", bound))
+	}
+	if pattern, ok := field.Tag.Lookup("pattern"); ok {
+		pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "^"), "$")
+		restriction.Children = append(restriction.Children, xsdNode("pattern", "value", pattern))
+	}
+
+	simpleType := xsdNode("simpleType")
+	simpleType.Children = append(simpleType.Children, restriction)
+	node.Attributes = append(node.Attributes[:1], node.Attributes[2:]...)
+	node.Children = append(node.Children, simpleType)
+	return node
+}
+
+func (g *xsdGenerator) typeRef(typ reflect.Type) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if _, ok := lookupDecimal(typ); ok || typ == qnameType {
+		return xsdSimpleType(typ)
+	}
+	if typ.Kind() == reflect.Struct {
+		return g.complexTypeName(typ)
+	}
+	return xsdSimpleType(typ)
+}
+
+func xsdSimpleType(typ reflect.Type) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if typ == qnameType {
+		return "xs:QName"
+	}
+	if typ == bigIntType {
+		return "xs:integer"
+	}
+	if _, ok := lookupDecimal(typ); ok {
+		return "xs:decimal"
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "xs:boolean"
+	case reflect.Int8:
+		return "xs:byte"
+	case reflect.Int16:
+		return "xs:short"
+	case reflect.Int32:
+		return "xs:int"
+	case reflect.Int, reflect.Int64:
+		return "xs:long"
+	case reflect.Uint8:
+		return "xs:unsignedByte"
+	case reflect.Uint16:
+		return "xs:unsignedShort"
+	case reflect.Uint32:
+		return "xs:unsignedInt"
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return "xs:unsignedLong"
+	case reflect.Float32, reflect.Float64:
+		return "xs:decimal"
+	case reflect.Interface:
+		return "xs:anyType"
+	}
+	return "xs:string"
+}
@@ -0,0 +1,492 @@
+package xsdgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+type Options struct {
+	Package string
+}
+
+type field struct {
+	name   string
+	goType string
+	tag    string
+}
+
+type structType struct {
+	name   string
+	fields []field
+}
+
+type generator struct {
+	complexTypes map[string]*go_xml.ElementNode
+	simpleTypes  map[string]*go_xml.ElementNode
+	elements     map[string]*go_xml.ElementNode
+	structs      []*structType
+	generated    map[string]string
+	usedNames    map[string]bool
+}
+
+var builtinTypes = map[string]string{
+	"string":             "string",
+	"normalizedString":   "string",
+	"token":              "string",
+	"anyURI":             "string",
+	"date":               "string",
+	"dateTime":           "string",
+	"time":               "string",
+	"duration":           "string",
+	"ID":                 "string",
+	"IDREF":              "string",
+	"NCName":             "string",
+	"QName":              "string",
+	"language":           "string",
+	"boolean":            "bool",
+	"byte":               "int8",
+	"short":              "int16",
+	"int":                "int32",
+	"long":               "int64",
+	"integer":            "int64",
+	"nonNegativeInteger": "uint64",
+	"positiveInteger":    "uint64",
+	"unsignedByte":       "uint8",
+	"unsignedShort":      "uint16",
+	"unsignedInt":        "uint32",
+	"unsignedLong":       "uint64",
+	"decimal":            "float64",
+	"double":             "float64",
+	"float":              "float32",
+	"base64Binary":       "string",
+	"hexBinary":          "string",
+	"anyType":            "string",
+}
+
+var initialisms = map[string]string{
+	"id":   "ID",
+	"url":  "URL",
+	"uri":  "URI",
+	"xml":  "XML",
+	"http": "HTTP",
+	"api":  "API",
+	"uuid": "UUID",
+}
+
+func Generate(xsd []byte, opts *Options) ([]byte, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "schema"
+	}
+
+	schema, err := go_xml.Parse(xsd)
+	if err != nil {
+		return nil, fmt.Errorf("xsdgen: %w", err)
+	}
+	if localName(schema.Name) != "schema" {
+		return nil, fmt.Errorf("xsdgen: root element is <%s>, expected <schema>", schema.Name)
+	}
+
+	g := &generator{
+		complexTypes: make(map[string]*go_xml.ElementNode),
+		simpleTypes:  make(map[string]*go_xml.ElementNode),
+		elements:     make(map[string]*go_xml.ElementNode),
+		generated:    make(map[string]string),
+		usedNames:    make(map[string]bool),
+	}
+
+	var roots []*go_xml.ElementNode
+	for _, child := range children(schema) {
+		name := attr(child, "name")
+		switch localName(child.Name) {
+		case "complexType":
+			g.complexTypes[name] = child
+		case "simpleType":
+			g.simpleTypes[name] = child
+		case "element":
+			g.elements[name] = child
+			roots = append(roots, child)
+		}
+	}
+
+	for _, root := range roots {
+		if _, err := g.rootType(root); err != nil {
+			return nil, err
+		}
+	}
+
+	typeNames := make([]string, 0, len(g.complexTypes))
+	for name := range g.complexTypes {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+	for _, name := range typeNames {
+		if _, err := g.namedComplexType(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return g.render(pkg)
+}
+
+func (g *generator) rootType(element *go_xml.ElementNode) (string, error) {
+	if typeName := attr(element, "type"); typeName != "" {
+		if goType, ok := g.simpleGoType(typeName); ok {
+			return goType, nil
+		}
+		return g.namedComplexType(localName(typeName))
+	}
+	if inline := firstChild(element, "complexType"); inline != nil {
+		return g.structFor(exportedName(attr(element, "name")), inline)
+	}
+	return "string", nil
+}
+
+func (g *generator) namedComplexType(name string) (string, error) {
+	if goName, ok := g.generated[name]; ok {
+		return goName, nil
+	}
+	node, ok := g.complexTypes[name]
+	if !ok {
+		return "", fmt.Errorf("xsdgen: unknown type %q", name)
+	}
+	return g.structFor(exportedName(name), node)
+}
+
+func (g *generator) structFor(baseName string, complexType *go_xml.ElementNode) (string, error) {
+	key := attr(complexType, "name")
+	goName := g.uniqueName(baseName)
+	if key != "" {
+		g.generated[key] = goName
+	}
+
+	st := &structType{name: goName}
+	g.structs = append(g.structs, st)
+
+	fields, err := g.complexTypeFields(goName, complexType)
+	if err != nil {
+		return "", err
+	}
+	st.fields = fields
+	return goName, nil
+}
+
+func (g *generator) complexTypeFields(owner string, complexType *go_xml.ElementNode) ([]field, error) {
+	var fields []field
+
+	for _, child := range children(complexType) {
+		switch localName(child.Name) {
+		case "sequence", "all", "choice":
+			particles, err := g.particleFields(owner, child, localName(child.Name) == "choice")
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, particles...)
+		case "attribute":
+			fields = append(fields, g.attributeField(child))
+		case "complexContent":
+			extension := firstChild(child, "extension")
+			if extension == nil {
+				continue
+			}
+			base, err := g.namedComplexType(localName(attr(extension, "base")))
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field{goType: base})
+			extended, err := g.complexTypeFields(owner, extension)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, extended...)
+		}
+	}
+	return fields, nil
+}
+
+func (g *generator) particleFields(owner string, group *go_xml.ElementNode, optional bool) ([]field, error) {
+	var fields []field
+	for _, child := range children(group) {
+		switch localName(child.Name) {
+		case "element":
+			f, err := g.elementField(owner, child, optional)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, f)
+		case "sequence", "all", "choice":
+			nested, err := g.particleFields(owner, child, optional || localName(child.Name) == "choice")
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, nested...)
+		}
+	}
+	return fields, nil
+}
+
+func (g *generator) elementField(owner string, element *go_xml.ElementNode, optional bool) (field, error) {
+	if ref := attr(element, "ref"); ref != "" {
+		referenced, ok := g.elements[localName(ref)]
+		if !ok {
+			return field{}, fmt.Errorf("xsdgen: unknown element reference %q", ref)
+		}
+		merged := *referenced
+		merged.Attributes = append(append([]go_xml.Attribute{}, referenced.Attributes...), element.Attributes...)
+		element = &merged
+	}
+
+	name := attr(element, "name")
+	path := []string{name}
+	repeated := isRepeated(element)
+	optional = optional || attr(element, "minOccurs") == "0"
+
+	if !repeated {
+		wrapperPath := path
+		for candidate := element; ; {
+			inner, ok := wrappedItem(candidate)
+			if !ok {
+				break
+			}
+			wrapperPath = append(wrapperPath, attr(inner, "name"))
+			if isRepeated(inner) {
+				element, path, repeated = inner, wrapperPath, true
+				break
+			}
+			candidate = inner
+		}
+	}
+
+	goType, err := g.elementType(owner, element)
+	if err != nil {
+		return field{}, err
+	}
+
+	tag := strings.Join(path, ">")
+	switch {
+	case repeated:
+		goType = "[]" + goType
+		if optional {
+			tag += ",omitempty"
+		}
+	case optional && g.isStruct(goType):
+		goType = "*" + goType
+	case optional:
+		tag += ",omitempty"
+	}
+
+	return field{name: exportedName(name), goType: goType, tag: tag}, nil
+}
+
+func (g *generator) attributeField(attribute *go_xml.ElementNode) field {
+	goType := "string"
+	if typeName := attr(attribute, "type"); typeName != "" {
+		if simple, ok := g.simpleGoType(typeName); ok {
+			goType = simple
+		}
+	}
+	tag := attr(attribute, "name") + ",attr"
+	if attr(attribute, "use") != "required" {
+		tag += ",omitempty"
+	}
+	return field{name: exportedName(attr(attribute, "name")), goType: goType, tag: tag}
+}
+
+func (g *generator) elementType(owner string, element *go_xml.ElementNode) (string, error) {
+	if typeName := attr(element, "type"); typeName != "" {
+		if goType, ok := g.simpleGoType(typeName); ok {
+			return goType, nil
+		}
+		return g.namedComplexType(localName(typeName))
+	}
+	if inline := firstChild(element, "complexType"); inline != nil {
+		return g.structFor(owner+exportedName(attr(element, "name")), inline)
+	}
+	if inline := firstChild(element, "simpleType"); inline != nil {
+		return g.simpleTypeGoType(inline), nil
+	}
+	return "string", nil
+}
+
+func (g *generator) simpleGoType(typeName string) (string, bool) {
+	local := localName(typeName)
+	if simple, ok := g.simpleTypes[local]; ok {
+		return g.simpleTypeGoType(simple), true
+	}
+	if _, ok := g.complexTypes[local]; ok {
+		return "", false
+	}
+	goType, ok := builtinTypes[local]
+	return goType, ok
+}
+
+func (g *generator) simpleTypeGoType(simpleType *go_xml.ElementNode) string {
+	if restriction := firstChild(simpleType, "restriction"); restriction != nil {
+		if goType, ok := g.simpleGoType(attr(restriction, "base")); ok {
+			return goType
+		}
+	}
+	return "string"
+}
+
+func (g *generator) isStruct(goType string) bool {
+	for _, st := range g.structs {
+		if st.name == goType {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) uniqueName(base string) string {
+	name := base
+	for i := 2; g.usedNames[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	g.usedNames[name] = true
+	return name
+}
+
+func (g *generator) render(pkg string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by xsdgen. DO NOT EDIT.\n\n")
+	buf.WriteString("package " + pkg + "\n")
+
+	for _, st := range g.structs {
+		buf.WriteString("\ntype " + st.name + " struct {\n")
+		for _, f := range st.fields {
+			if f.name == "" {
+				buf.WriteString("\t" + f.goType + "\n")
+				continue
+			}
+			buf.WriteString("\t" + f.name + " " + f.goType + " `xml:\"" + f.tag + "\"`\n")
+		}
+		buf.WriteString("}\n")
+	}
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("xsdgen: formatting generated code: %w", err)
+	}
+	return formatted, nil
+}
+
+func wrappedItem(element *go_xml.ElementNode) (*go_xml.ElementNode, bool) {
+	if attr(element, "type") != "" {
+		return nil, false
+	}
+	complexType := firstChild(element, "complexType")
+	if complexType == nil {
+		return nil, false
+	}
+
+	content := children(complexType)
+	if len(content) != 1 || localName(content[0].Name) != "sequence" {
+		return nil, false
+	}
+	items := children(content[0])
+	if len(items) != 1 || localName(items[0].Name) != "element" || attr(items[0], "ref") != "" {
+		return nil, false
+	}
+	return items[0], true
+}
+
+func isRepeated(element *go_xml.ElementNode) bool {
+	maxOccurs := attr(element, "maxOccurs")
+	if maxOccurs == "unbounded" {
+		return true
+	}
+	n, err := strconv.Atoi(maxOccurs)
+	return err == nil && n > 1
+}
+
+func children(node *go_xml.ElementNode) []*go_xml.ElementNode {
+	var elements []*go_xml.ElementNode
+	for _, child := range node.Children {
+		if element, ok := child.(*go_xml.ElementNode); ok && localName(element.Name) != "annotation" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+func firstChild(node *go_xml.ElementNode, local string) *go_xml.ElementNode {
+	for _, child := range children(node) {
+		if localName(child.Name) == local {
+			return child
+		}
+	}
+	return nil
+}
+
+func attr(node *go_xml.ElementNode, name string) string {
+	for _, attribute := range node.Attributes {
+		if attribute.Name == name {
+			return attribute.Value
+		}
+	}
+	return ""
+}
+
+func localName(name string) string {
+	if i := strings.LastIndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+func exportedName(name string) string {
+	var sb strings.Builder
+	for _, part := range splitWords(name) {
+		if initialism, ok := initialisms[strings.ToLower(part)]; ok {
+			sb.WriteString(initialism)
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		sb.WriteString(string(runes))
+	}
+	if sb.Len() == 0 {
+		return "Field"
+	}
+	result := sb.String()
+	if unicode.IsDigit(rune(result[0])) {
+		result = "X" + result
+	}
+	return result
+}
+
+func splitWords(name string) []string {
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = current[:0]
+		}
+	}
+
+	for _, r := range name {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && len(current) > 0 && unicode.IsLower(current[len(current)-1]):
+			flush()
+			current = append(current, r)
+		default:
+			current = append(current, r)
+		}
+	}
+	flush()
+	return words
+}
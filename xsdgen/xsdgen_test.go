@@ -0,0 +1,135 @@
+package xsdgen
+
+import (
+	"testing"
+
+	go_xml "github.com/lrnxzz/go-xml/v2"
+)
+
+func TestGenerate(t *testing.T) {
+	type Address struct {
+		Street string `xml:"street"`
+	}
+	type Employee struct {
+		ID      int      `xml:"id,attr"`
+		Name    string   `xml:"name"`
+		Salary  float64  `xml:"salary,omitempty"`
+		Address *Address `xml:"address"`
+		Tags    []string `xml:"tags>tag"`
+	}
+
+	generated, err := go_xml.GenerateXSD(Employee{}, nil)
+	if err != nil {
+		t.Fatalf("XSD generation error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		xsd      string
+		expected string
+	}{
+		{
+			name: "Round trip from GenerateXSD",
+			xsd:  string(generated),
+			expected: `// Code generated by xsdgen. DO NOT EDIT.
+
+package schema
+
+type Employee struct {
+	Name    string   ` + "`" + `xml:"name"` + "`" + `
+	Salary  float64  ` + "`" + `xml:"salary,omitempty"` + "`" + `
+	Address *Address ` + "`" + `xml:"address"` + "`" + `
+	Tags    []string ` + "`" + `xml:"tags>tag"` + "`" + `
+	ID      int64    ` + "`" + `xml:"id,attr"` + "`" + `
+}
+
+type Address struct {
+	Street string ` + "`" + `xml:"street"` + "`" + `
+}
+`,
+		},
+		{
+			name: "Inline types, references and extensions",
+			xsd: `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:simpleType name="sku">
+    <xs:restriction base="xs:string"/>
+  </xs:simpleType>
+  <xs:element name="note" type="xs:string"/>
+  <xs:complexType name="base-entity">
+    <xs:attribute name="uuid" type="xs:string" use="required"/>
+  </xs:complexType>
+  <xs:element name="purchase-order">
+    <xs:complexType>
+      <xs:complexContent>
+        <xs:extension base="base-entity">
+          <xs:sequence>
+            <xs:element ref="note" minOccurs="0"/>
+            <xs:element name="lines">
+              <xs:complexType>
+                <xs:sequence>
+                  <xs:element name="group">
+                    <xs:complexType>
+                      <xs:sequence>
+                        <xs:element name="line" maxOccurs="unbounded">
+                          <xs:complexType>
+                            <xs:sequence>
+                              <xs:element name="sku" type="sku"/>
+                              <xs:element name="qty" type="xs:int"/>
+                            </xs:sequence>
+                          </xs:complexType>
+                        </xs:element>
+                      </xs:sequence>
+                    </xs:complexType>
+                  </xs:element>
+                </xs:sequence>
+              </xs:complexType>
+            </xs:element>
+          </xs:sequence>
+          <xs:attribute name="priority" type="xs:boolean"/>
+        </xs:extension>
+      </xs:complexContent>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`,
+			expected: `// Code generated by xsdgen. DO NOT EDIT.
+
+package schema
+
+type PurchaseOrder struct {
+	BaseEntity
+	Note     string              ` + "`" + `xml:"note,omitempty"` + "`" + `
+	Lines    []PurchaseOrderLine ` + "`" + `xml:"lines>group>line"` + "`" + `
+	Priority bool                ` + "`" + `xml:"priority,attr,omitempty"` + "`" + `
+}
+
+type BaseEntity struct {
+	UUID string ` + "`" + `xml:"uuid,attr"` + "`" + `
+}
+
+type PurchaseOrderLine struct {
+	Sku string ` + "`" + `xml:"sku"` + "`" + `
+	Qty int32  ` + "`" + `xml:"qty"` + "`" + `
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := Generate([]byte(tt.xsd), nil)
+			if err != nil {
+				t.Fatalf("Generation error: %v", err)
+			}
+			if string(source) != tt.expected {
+				t.Fatalf("Expected:\n%s\nGot:\n%s", tt.expected, source)
+			}
+		})
+	}
+
+	t.Run("Not a schema", func(t *testing.T) {
+		if _, err := Generate([]byte(`<root/>`), nil); err == nil {
+			t.Fatalf("Expected error for non-schema document")
+		}
+	})
+}